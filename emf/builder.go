@@ -0,0 +1,551 @@
+package emf
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// Builder creates a metafile record by record. Objects get the lowest free
+// handle, the bounds of the drawing records are computed from their points
+// and File finishes the header.
+//
+// Coordinates are logical units. The computed bounds take them as device
+// units, which they are unless the mapping mode or the window and viewport
+// are changed.
+type Builder struct {
+	file    *EmfFile
+	bounds  w32.RECT
+	frame   w32.RECT
+	extent  w32.RECT // union of the bounds of the drawing records
+	drawn   bool
+	handles []bool
+
+	fonts    map[uint32]w32.LOGFONT
+	textFont w32.LOGFONT
+
+	// objects created and selected by SelectPen, SelectBrush and SelectFont
+	pen, brush, font uint32
+}
+
+// NewBuilder returns a builder for a picture with the given bounds in device
+// units and frame in 0.01 millimeters. An empty bounds rectangle is replaced
+// by the bounds of what is drawn, an empty frame is derived from the bounds
+// for a 96 dpi device.
+func NewBuilder(bounds, frame w32.RECT) *Builder {
+	b := &Builder{
+		file: &EmfFile{
+			Header: &HeaderRecord{Record: Record{Type: EMR_HEADER}},
+		},
+		bounds:  bounds,
+		frame:   frame,
+		handles: []bool{true}, // index 0 is reserved
+		fonts:   make(map[uint32]w32.LOGFONT),
+	}
+
+	b.textFont = w32.LOGFONT{Height: 16, Weight: w32.FW_BOLD}
+	b.textFont.SetFaceName("System")
+
+	return b
+}
+
+func (b *Builder) add(rec Recorder) {
+	b.file.Records = append(b.file.Records, rec)
+}
+
+// Add appends a record as it is. Its points are not added to the computed
+// bounds, and the handles it uses are not reserved.
+func (b *Builder) Add(rec Recorder) {
+	b.add(rec)
+}
+
+// addBounds extends the drawn extent by the inclusive rectangle r.
+func (b *Builder) addBounds(r w32.RECT) {
+	if !b.drawn {
+		b.extent, b.drawn = r, true
+		return
+	}
+
+	if r.Left < b.extent.Left {
+		b.extent.Left = r.Left
+	}
+	if r.Top < b.extent.Top {
+		b.extent.Top = r.Top
+	}
+	if r.Right > b.extent.Right {
+		b.extent.Right = r.Right
+	}
+	if r.Bottom > b.extent.Bottom {
+		b.extent.Bottom = r.Bottom
+	}
+}
+
+func pointsBounds(points []w32.POINT) w32.RECT {
+	if len(points) == 0 {
+		return w32.RECT{}
+	}
+
+	r := w32.RECT{Left: points[0].X, Top: points[0].Y, Right: points[0].X, Bottom: points[0].Y}
+	for _, p := range points[1:] {
+		if p.X < r.Left {
+			r.Left = p.X
+		}
+		if p.Y < r.Top {
+			r.Top = p.Y
+		}
+		if p.X > r.Right {
+			r.Right = p.X
+		}
+		if p.Y > r.Bottom {
+			r.Bottom = p.Y
+		}
+	}
+
+	return r
+}
+
+// pointsS returns the points with 16-bit coordinates, false when one of them
+// needs the records with 32-bit coordinates.
+func pointsS(points []w32.POINT) ([]PointS, bool) {
+	ps := make([]PointS, len(points))
+	for i, p := range points {
+		if p.X < math.MinInt16 || p.X > math.MaxInt16 || p.Y < math.MinInt16 || p.Y > math.MaxInt16 {
+			return nil, false
+		}
+		ps[i] = PointS{X: int16(p.X), Y: int16(p.Y)}
+	}
+	return ps, true
+}
+
+func pointsToL(points []w32.POINT) []w32.POINTL {
+	ps := make([]w32.POINTL, len(points))
+	for i, p := range points {
+		ps[i] = w32.POINTL{X: p.X, Y: p.Y}
+	}
+	return ps
+}
+
+func wmfColor(c w32.COLORREF) WMFCOLORREF {
+	return WMFCOLORREF{Red: byte(c), Green: byte(c >> 8), Blue: byte(c >> 16)}
+}
+
+// allocHandle returns the lowest free object handle.
+func (b *Builder) allocHandle() uint32 {
+	for i, used := range b.handles {
+		if !used {
+			b.handles[i] = true
+			return uint32(i)
+		}
+	}
+
+	b.handles = append(b.handles, true)
+	return uint32(len(b.handles) - 1)
+}
+
+// CreatePen adds an EMR_CREATEPEN record and returns the handle of the pen.
+func (b *Builder) CreatePen(style uint32, width int32, color w32.COLORREF) uint32 {
+	ih := b.allocHandle()
+	b.add(&CreatePenRecord{
+		Record: Record{Type: EMR_CREATEPEN},
+		IhPen:  ih,
+		LogPen: WMFLOGPEN{PenStyle: style, Width: w32.POINT{X: width}, ColorRef: wmfColor(color)},
+	})
+	return ih
+}
+
+// CreateBrush adds an EMR_CREATEBRUSHINDIRECT record and returns the handle
+// of the brush.
+func (b *Builder) CreateBrush(style uint32, color w32.COLORREF, hatch uint32) uint32 {
+	ih := b.allocHandle()
+	b.add(&CreateBrushIndirectRecord{
+		Record:   Record{Type: EMR_CREATEBRUSHINDIRECT},
+		IhBrush:  ih,
+		LogBrush: WMFLOGBRUSH{BrushStyle: style, Color: wmfColor(color), BrushHatch: hatch},
+	})
+	return ih
+}
+
+// CreateFont adds an EMR_EXTCREATEFONTINDIRECTW record and returns the handle
+// of the font.
+func (b *Builder) CreateFont(font w32.LOGFONT) uint32 {
+	ih := b.allocHandle()
+	r := &ExtCreateFontIndirectWRecord{Record: Record{Type: EMR_EXTCREATEFONTINDIRECTW}, IhFonts: ih}
+	r.Elw.LOGFONT = font
+	b.add(r)
+
+	b.fonts[ih] = font
+	return ih
+}
+
+// SelectObject selects an object created by the builder or a stock object.
+func (b *Builder) SelectObject(ih uint32) {
+	if font, ok := b.fonts[ih]; ok {
+		b.textFont = font
+	}
+
+	b.add(&SelectObjectRecord{Record: Record{Type: EMR_SELECTOBJECT}, IhObject: ih})
+}
+
+// DeleteObject deletes an object created by the builder, its handle is used
+// again for the next object.
+func (b *Builder) DeleteObject(ih uint32) {
+	b.add(&DeleteObjectRecord{Record: Record{Type: EMR_DELETEOBJECT}, IhObject: ih})
+
+	if int(ih) < len(b.handles) && ih != 0 {
+		b.handles[ih] = false
+	}
+	delete(b.fonts, ih)
+}
+
+// selectNew selects ih and deletes the object it replaces if that was
+// created by the same Select method.
+func (b *Builder) selectNew(ih uint32, old *uint32) uint32 {
+	b.SelectObject(ih)
+	if *old != 0 {
+		b.DeleteObject(*old)
+	}
+	*old = ih
+	return ih
+}
+
+// SelectPen creates and selects a pen, deleting the pen selected by the
+// previous call.
+func (b *Builder) SelectPen(style uint32, width int32, color w32.COLORREF) uint32 {
+	return b.selectNew(b.CreatePen(style, width, color), &b.pen)
+}
+
+// SelectBrush creates and selects a brush, deleting the brush selected by
+// the previous call.
+func (b *Builder) SelectBrush(style uint32, color w32.COLORREF, hatch uint32) uint32 {
+	return b.selectNew(b.CreateBrush(style, color, hatch), &b.brush)
+}
+
+// SelectFont creates and selects a font, deleting the font selected by the
+// previous call.
+func (b *Builder) SelectFont(font w32.LOGFONT) uint32 {
+	return b.selectNew(b.CreateFont(font), &b.font)
+}
+
+func (b *Builder) SetTextColor(color w32.COLORREF) {
+	b.add(&SetTextColorRecord{Record: Record{Type: EMR_SETTEXTCOLOR}, Color: wmfColor(color)})
+}
+
+func (b *Builder) SetBkColor(color w32.COLORREF) {
+	b.add(&SetBkColorRecord{Record: Record{Type: EMR_SETBKCOLOR}, Color: wmfColor(color)})
+}
+
+func (b *Builder) SetBkMode(mode uint32) {
+	b.add(&SetBkModeRecord{Record: Record{Type: EMR_SETBKMODE}, BkMode: mode})
+}
+
+func (b *Builder) SetTextAlign(align uint32) {
+	b.add(&SetTextAlignRecord{Record: Record{Type: EMR_SETTEXTALIGN}, TextAlignmentMode: align})
+}
+
+func (b *Builder) SetPolyFillMode(mode uint32) {
+	b.add(&SetPolyfillModeRecord{Record: Record{Type: EMR_SETPOLYFILLMODE}, PolygonFillMode: mode})
+}
+
+func (b *Builder) SetMapMode(mode uint32) {
+	b.add(&SetMapModeRecord{Record: Record{Type: EMR_SETMAPMODE}, MapMode: mode})
+}
+
+func (b *Builder) SetWindowExtEx(cx, cy int32) {
+	b.add(&SetWindowExtExRecord{Record: Record{Type: EMR_SETWINDOWEXTEX}, Extent: w32.SIZE{CX: cx, CY: cy}})
+}
+
+func (b *Builder) SetWindowOrgEx(x, y int32) {
+	b.add(&SetWindowOrgExRecord{Record: Record{Type: EMR_SETWINDOWORGEX}, Origin: w32.POINT{X: x, Y: y}})
+}
+
+func (b *Builder) SetViewportExtEx(cx, cy int32) {
+	b.add(&SetWiewporTextExRecord{Record: Record{Type: EMR_SETVIEWPORTEXTEX}, Extent: w32.SIZE{CX: cx, CY: cy}})
+}
+
+func (b *Builder) SetViewportOrgEx(x, y int32) {
+	b.add(&SetWiewportOrgExRecord{Record: Record{Type: EMR_SETVIEWPORTORGEX}, Origin: w32.POINT{X: x, Y: y}})
+}
+
+func (b *Builder) SaveDC() {
+	b.add(&SaveDCRecord{Record: Record{Type: EMR_SAVEDC}})
+}
+
+// RestoreDC restores a saved state, -1 is the last one.
+func (b *Builder) RestoreDC(savedDC int32) {
+	b.add(&RestoreDCRecord{Record: Record{Type: EMR_RESTOREDC}, SavedDC: savedDC})
+}
+
+func (b *Builder) MoveTo(x, y int32) {
+	b.add(&MoveToExRecord{Record: Record{Type: EMR_MOVETOEX}, Offset: w32.POINT{X: x, Y: y}})
+}
+
+func (b *Builder) LineTo(x, y int32) {
+	b.addBounds(w32.RECT{Left: x, Top: y, Right: x, Bottom: y})
+	b.add(&LineToRecord{Record: Record{Type: EMR_LINETO}, Point: w32.POINT{X: x, Y: y}})
+}
+
+// Rectangle draws a rectangle, the right and bottom edges are excluded.
+func (b *Builder) Rectangle(left, top, right, bottom int32) {
+	b.addBounds(w32.RECT{Left: left, Top: top, Right: right - 1, Bottom: bottom - 1})
+	b.add(&RectangleRecord{Record: Record{Type: EMR_RECTANGLE}, Box: w32.RECT{Left: left, Top: top, Right: right, Bottom: bottom}})
+}
+
+func (b *Builder) Polygon(points []w32.POINT) error {
+	bounds := pointsBounds(points)
+	b.addBounds(bounds)
+
+	if ps, ok := pointsS(points); ok {
+		b.add(&Polygon16Record{Record: Record{Type: EMR_POLYGON16}, Bounds: bounds, Count: uint32(len(ps)), APoints: ps})
+	} else {
+		b.add(&PolygonRecord{Record: Record{Type: EMR_POLYGON}, Bounds: bounds, Count: uint32(len(points)), APoints: pointsToL(points)})
+	}
+	return nil
+}
+
+func (b *Builder) Polyline(points []w32.POINT) error {
+	bounds := pointsBounds(points)
+	b.addBounds(bounds)
+
+	if ps, ok := pointsS(points); ok {
+		b.add(&PolyLine16Record{Record: Record{Type: EMR_POLYLINE16}, Bounds: bounds, Count: uint32(len(ps)), APoints: ps})
+	} else {
+		b.add(&PolyLineRecord{Record: Record{Type: EMR_POLYLINE}, Bounds: bounds, Count: uint32(len(points)), APoints: pointsToL(points)})
+	}
+	return nil
+}
+
+// Bezier draws cubic Bézier curves through the start point and every third
+// point after it, the points in between are the control points.
+func (b *Builder) Bezier(points []w32.POINT) error {
+	if len(points) == 0 || len(points)%3 != 1 {
+		return errors.New("invalid number of Bézier points")
+	}
+
+	bounds := pointsBounds(points)
+	b.addBounds(bounds)
+
+	if ps, ok := pointsS(points); ok {
+		b.add(&PolyBezier16Record{Record: Record{Type: EMR_POLYBEZIER16}, Bounds: bounds, Count: uint32(len(ps)), APoints: ps})
+	} else {
+		b.add(&PolyBezierRecord{Record: Record{Type: EMR_POLYBEZIER}, Bounds: bounds, Count: uint32(len(points)), APoints: pointsToL(points)})
+	}
+	return nil
+}
+
+// PolyPolygon draws several polygons which are filled together.
+func (b *Builder) PolyPolygon(polygons [][]w32.POINT) error {
+	var all []w32.POINT
+	var counts []uint32
+	for _, polygon := range polygons {
+		counts = append(counts, uint32(len(polygon)))
+		all = append(all, polygon...)
+	}
+
+	bounds := pointsBounds(all)
+	b.addBounds(bounds)
+
+	if ps, ok := pointsS(all); ok {
+		b.add(&PolyPolygon16Record{
+			Record:            Record{Type: EMR_POLYPOLYGON16},
+			Bounds:            bounds,
+			NumberOfPolygons:  uint32(len(polygons)),
+			Count:             uint32(len(ps)),
+			PolygonPointCount: counts,
+			APoints:           ps,
+		})
+	} else {
+		b.add(&PolyPolygonRecord{
+			Record:            Record{Type: EMR_POLYPOLYGON},
+			Bounds:            bounds,
+			NumberOfPolygons:  uint32(len(polygons)),
+			Count:             uint32(len(all)),
+			PolygonPointCount: counts,
+			APoints:           pointsToL(all),
+		})
+	}
+	return nil
+}
+
+// Text draws a string at the reference point with the selected font. The
+// character widths are taken from the Go font closest to the LOGFONT, so
+// that the records do not depend on the fonts of the system.
+func (b *Builder) Text(x, y int32, text string) error {
+	face, err := loadGoFont(b.textFont)
+	if err != nil {
+		return err
+	}
+
+	em := face.emSize(b.textFont.Height)
+	scale := em / face.unitsPerEm
+
+	var chars []uint16
+	var dx []int32
+	width := int32(0)
+
+	for _, r := range text {
+		adv := int32(math.Round(face.advance(face.glyphIndex(r)) * scale))
+		width += adv
+
+		units := utf16.Encode([]rune{r})
+		chars = append(chars, units...)
+		dx = append(dx, adv)
+		for range units[1:] {
+			dx = append(dx, 0)
+		}
+	}
+
+	if len(chars) == 0 {
+		return nil
+	}
+
+	height := int32(math.Ceil((face.ascent + face.descent) * scale))
+	bounds := w32.RECT{Left: x, Top: y, Right: x + width - 1, Bottom: y + height - 1}
+	b.addBounds(bounds)
+
+	pxW, pxH := b.pixelSize()
+	b.add(&ExtTextOutWRecord{
+		Record:        Record{Type: EMR_EXTTEXTOUTW},
+		Bounds:        bounds,
+		IGraphicsMode: w32.GM_COMPATIBLE,
+		ExScale:       float32(pxW),
+		EyScale:       float32(pxH),
+		WEmrText: EmrText{
+			Reference:    w32.POINT{X: x, Y: y},
+			Chars:        uint32(len(chars)),
+			OutputString: chars,
+			OutputDx:     dx,
+		},
+	})
+
+	return nil
+}
+
+// DrawImage stretches img onto the destination rectangle with an
+// EMR_STRETCHDIBITS record. Metafiles have no alpha channel, transparent
+// pixels are blended with white.
+func (b *Builder) DrawImage(img image.Image, x, y, cx, cy int32) error {
+	r := img.Bounds()
+	if r.Empty() {
+		return errors.New("empty image")
+	}
+
+	w, h := r.Dx(), r.Dy()
+
+	// 32 bits per pixel, rows from the bottom
+	bits := make([]byte, 0, w*h*4)
+	for j := r.Max.Y - 1; j >= r.Min.Y; j-- {
+		for i := r.Min.X; i < r.Max.X; i++ {
+			c := color.RGBAModel.Convert(img.At(i, j)).(color.RGBA)
+			white := 0xFF - c.A
+			bits = append(bits, c.B+white, c.G+white, c.R+white, 0)
+		}
+	}
+
+	bounds := w32.RECT{Left: x, Top: y, Right: x + cx - 1, Bottom: y + cy - 1}
+	b.addBounds(bounds)
+
+	rec := &StretchDIBitsRecord{
+		Record: Record{Type: EMR_STRETCHDIBITS},
+		StretchDIBitsInfo: StretchDIBitsInfo{
+			Bounds:    bounds,
+			XDest:     x,
+			YDest:     y,
+			CxSrc:     int32(w),
+			CySrc:     int32(h),
+			UsageSrc:  DIB_RGB_COLORS,
+			BitBltROP: w32.SRCCOPY,
+			CxDest:    cx,
+			CyDest:    cy,
+		},
+		BitsSrc: bits,
+	}
+	rec.BmiSrc.BITMAPINFOHEADER = w32.BITMAPINFOHEADER{
+		BiSize:        40,
+		BiWidth:       int32(w),
+		BiHeight:      int32(h),
+		BiPlanes:      1,
+		BiBitCount:    32,
+		BiCompression: BI_RGB,
+		BiSizeImage:   uint32(len(bits)),
+	}
+
+	b.add(rec)
+	return nil
+}
+
+// pixelSize returns the size of a device pixel in 0.01 millimeters.
+func (b *Builder) pixelSize() (float64, float64) {
+	bounds, frame := b.bounds, b.frame
+	if bounds.Right <= bounds.Left || bounds.Bottom <= bounds.Top {
+		bounds = b.extent
+	}
+
+	if frame.Right <= frame.Left || frame.Bottom <= frame.Top || bounds.Right <= bounds.Left || bounds.Bottom <= bounds.Top {
+		return 2540.0 / 96, 2540.0 / 96
+	}
+
+	return float64(frame.Right-frame.Left) / float64(bounds.Right-bounds.Left),
+		float64(frame.Bottom-frame.Top) / float64(bounds.Bottom-bounds.Top)
+}
+
+// File finishes the header and returns the metafile. The builder can be used
+// further, later records are part of the same file.
+func (b *Builder) File() *EmfFile {
+	hdr := b.file.Header
+
+	bounds := b.bounds
+	if bounds.Right <= bounds.Left || bounds.Bottom <= bounds.Top {
+		bounds = b.extent
+	}
+
+	pxW, pxH := b.pixelSize()
+
+	frame := b.frame
+	if frame.Right <= frame.Left || frame.Bottom <= frame.Top {
+		frame = w32.RECT{
+			Left:   int32(math.Round(float64(bounds.Left) * pxW)),
+			Top:    int32(math.Round(float64(bounds.Top) * pxH)),
+			Right:  int32(math.Round(float64(bounds.Right) * pxW)),
+			Bottom: int32(math.Round(float64(bounds.Bottom) * pxH)),
+		}
+	}
+
+	// the reference device covers the picture
+	device := w32.SIZE{CX: bounds.Right + 1, CY: bounds.Bottom + 1}
+	if device.CX < 1 {
+		device.CX = 1
+	}
+	if device.CY < 1 {
+		device.CY = 1
+	}
+
+	hdr.Original.Bounds = bounds
+	hdr.Original.Frame = frame
+	hdr.Original.RecordSignature = ENHMETA_SIGNATURE
+	hdr.Original.Version = 0x10000
+	hdr.Original.Device = device
+	hdr.Original.Millimeters = w32.SIZE{
+		CX: int32(math.Max(1, math.Round(float64(device.CX)*pxW/100))),
+		CY: int32(math.Max(1, math.Round(float64(device.CY)*pxH/100))),
+	}
+	hdr.Ext2.MicrometersX = uint32(math.Round(float64(device.CX) * pxW * 10))
+	hdr.Ext2.MicrometersY = uint32(math.Round(float64(device.CY) * pxH * 10))
+	hdr.Original.Records = uint32(len(b.file.Records) + 2)
+	hdr.Original.Handles = uint16(len(b.handles))
+
+	if b.file.Eof == nil {
+		b.file.Eof = &EofRecord{Record: Record{Type: EMR_EOF}}
+	}
+
+	return b.file
+}
+
+// WriteTo finishes the metafile and writes it to w.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	return b.File().WriteTo(w)
+}
@@ -0,0 +1,138 @@
+package emf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+func TestBuilderRead(t *testing.T) {
+	b := NewBuilder(w32.RECT{}, w32.RECT{})
+	b.SelectPen(PS_SOLID, 2, 0x0000FF)   // handle 1
+	b.SelectBrush(BS_SOLID, 0x00FF00, 0) // handle 2
+	b.Rectangle(10, 10, 50, 60)
+	b.SelectPen(PS_DASH, 1, 0) // handle 3, deletes 1
+	b.Polygon([]w32.POINT{{X: 0, Y: 5}, {X: 9, Y: 5}, {X: 4, Y: 0}})
+	b.SelectPen(PS_DOT, 1, 0) // handle 1 again, deletes 3
+	b.Polygon([]w32.POINT{{X: 0, Y: 0}, {X: 40000, Y: 5}, {X: 4, Y: 70}})
+
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f := readFile(t, buf.Bytes())
+
+	types := []uint32{
+		EMR_CREATEPEN, EMR_SELECTOBJECT,
+		EMR_CREATEBRUSHINDIRECT, EMR_SELECTOBJECT,
+		EMR_RECTANGLE,
+		EMR_CREATEPEN, EMR_SELECTOBJECT, EMR_DELETEOBJECT,
+		EMR_POLYGON16,
+		EMR_CREATEPEN, EMR_SELECTOBJECT, EMR_DELETEOBJECT,
+		EMR_POLYGON,
+	}
+	if len(f.Records) != len(types) {
+		t.Fatalf("read %d records, want %d", len(f.Records), len(types))
+	}
+	for i, want := range types {
+		if got := recordType(f.Records[i]); got != want {
+			t.Errorf("record %d has type %#x, want %#x", i, got, want)
+		}
+	}
+
+	pen := f.Records[0].(*CreatePenRecord)
+	if pen.IhPen != 1 || pen.LogPen.PenStyle != PS_SOLID || pen.LogPen.Width.X != 2 || pen.LogPen.ColorRef != (WMFCOLORREF{Red: 0xFF}) {
+		t.Errorf("first pen is %+v", pen)
+	}
+	if rect := f.Records[4].(*RectangleRecord); rect.Box != (w32.RECT{Left: 10, Top: 10, Right: 50, Bottom: 60}) {
+		t.Errorf("rectangle is %+v", rect.Box)
+	}
+	if ih := f.Records[5].(*CreatePenRecord).IhPen; ih != 3 {
+		t.Errorf("second pen has handle %d, want 3", ih)
+	}
+	if ih := f.Records[7].(*DeleteObjectRecord).IhObject; ih != 1 {
+		t.Errorf("deleted handle %d, want 1", ih)
+	}
+	if ih := f.Records[9].(*CreatePenRecord).IhPen; ih != 1 {
+		t.Errorf("third pen has handle %d, want the free handle 1", ih)
+	}
+
+	poly := f.Records[12].(*PolygonRecord)
+	if want := []w32.POINTL{{X: 0, Y: 0}, {X: 40000, Y: 5}, {X: 4, Y: 70}}; !reflect.DeepEqual(poly.APoints, want) {
+		t.Errorf("polygon points are %v, want %v", poly.APoints, want)
+	}
+	if want := (w32.RECT{Right: 40000, Bottom: 70}); poly.Bounds != want {
+		t.Errorf("polygon bounds are %v, want %v", poly.Bounds, want)
+	}
+
+	hdr := f.Header.Original
+	if want := (w32.RECT{Right: 40000, Bottom: 70}); hdr.Bounds != want {
+		t.Errorf("header bounds are %v, want the drawn extent %v", hdr.Bounds, want)
+	}
+	if hdr.Device != (w32.SIZE{CX: 40001, CY: 71}) {
+		t.Errorf("reference device is %v", hdr.Device)
+	}
+	if hdr.Handles != 4 {
+		t.Errorf("header has %d handles, want 4", hdr.Handles)
+	}
+}
+
+func TestBuilderText(t *testing.T) {
+	tests := []struct {
+		name   string
+		font   *w32.LOGFONT // nil for the default System font
+		text   string
+		dx     []int32
+		bounds w32.RECT
+	}{
+		// the advances of Go Bold at 16 pixels
+		{"system", nil, "Hi!", []int32{10, 4, 5}, w32.RECT{Left: 10, Top: 20, Right: 28, Bottom: 35}},
+		// the width of a character is given to its first code unit
+		{"surrogate pair", nil, "H\U0001F600", []int32{10, 10, 0}, w32.RECT{}},
+		{"fixed pitch", &w32.LOGFONT{Height: -20, PitchAndFamily: FIXED_PITCH}, "il W", []int32{12, 12, 12, 12}, w32.RECT{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(w32.RECT{}, w32.RECT{})
+			if tt.font != nil {
+				b.SelectFont(*tt.font)
+			}
+			if err := b.Text(10, 20, tt.text); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := b.File().Records[len(b.File().Records)-1].(*ExtTextOutWRecord)
+			dx := rec.WEmrText.OutputDx
+
+			if !reflect.DeepEqual(dx, tt.dx) {
+				t.Errorf("advances are %v, want %v", dx, tt.dx)
+			}
+			if tt.bounds != (w32.RECT{}) && rec.Bounds != tt.bounds {
+				t.Errorf("bounds are %v, want %v", rec.Bounds, tt.bounds)
+			}
+		})
+	}
+}
+
+func TestBuilderTextSystemFonts(t *testing.T) {
+	// the fonts of the system do not change the records
+	text := func() []byte {
+		b := NewBuilder(w32.RECT{}, w32.RECT{})
+		b.SelectFont(w32.LOGFONT{Height: -12, Weight: w32.FW_NORMAL})
+		b.Text(0, 0, "Hello")
+		return writeFile(t, b.File())
+	}
+
+	want := text()
+
+	saved := DefaultFontResolver
+	defer func() { DefaultFontResolver = saved }()
+	DefaultFontResolver = &FontResolver{Dirs: []string{t.TempDir()}}
+
+	if got := text(); !bytes.Equal(got, want) {
+		t.Error("text records depend on the font resolver")
+	}
+}
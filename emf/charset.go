@@ -0,0 +1,119 @@
+package emf
+
+import (
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// code pages of the LOGFONT charsets, ANSI text of other charsets is
+// decoded as Windows-1252
+var charsetEncodings = map[uint32]encoding.Encoding{
+	ANSI_CHARSET:        charmap.Windows1252,
+	DEFAULT_CHARSET:     charmap.Windows1252,
+	MAC_CHARSET:         charmap.Macintosh,
+	SHIFTJIS_CHARSET:    japanese.ShiftJIS,
+	HANGUL_CHARSET:      korean.EUCKR,
+	GB2312_CHARSET:      simplifiedchinese.GBK,
+	CHINESEBIG5_CHARSET: traditionalchinese.Big5,
+	GREEK_CHARSET:       charmap.Windows1253,
+	TURKISH_CHARSET:     charmap.Windows1254,
+	VIETNAMESE_CHARSET:  charmap.Windows1258,
+	HEBREW_CHARSET:      charmap.Windows1255,
+	ARABIC_CHARSET:      charmap.Windows1256,
+	BALTIC_CHARSET:      charmap.Windows1257,
+	RUSSIAN_CHARSET:     charmap.Windows1251,
+	THAI_CHARSET:        charmap.Windows874,
+	EASTEUROPE_CHARSET:  charmap.Windows1250,
+	OEM_CHARSET:         charmap.CodePage437,
+}
+
+// decodeAnsi decodes the string of an ANSI text record, whose distances
+// are given per byte, and sums the distances per UTF-16 unit. With pdy the
+// distances are pairs of x and y distances.
+func decodeAnsi(charset uint8, s []byte, dx []int32, pdy bool) ([]uint16, []int32) {
+	text, sizes := DecodeCharset(charset, s)
+	if dx == nil {
+		return text, nil
+	}
+
+	step := 1
+	if pdy {
+		step = 2
+	}
+
+	outDx := make([]int32, 0, len(text)*step)
+	i := 0
+	for _, n := range sizes {
+		d := make([]int32, step)
+		for ; n > 0 && i+step <= len(dx); n-- {
+			for k := range d {
+				d[k] += dx[i+k]
+			}
+			i += step
+		}
+		outDx = append(outDx, d...)
+	}
+
+	return text, outDx
+}
+
+// DecodeCharset decodes ANSI text in the code page of a LOGFONT charset. It
+// also returns the number of bytes each UTF-16 unit was decoded from, which
+// is 0 for the second unit of a surrogate pair, so that per byte character
+// widths can be summed per character.
+//
+// Symbol fonts map bytes to U+F000 to U+F0FF, as Windows does.
+func DecodeCharset(charset uint8, s []byte) ([]uint16, []int) {
+	text := make([]uint16, 0, len(s))
+	sizes := make([]int, 0, len(s))
+
+	if uint32(charset) == SYMBOL_CHARSET {
+		for _, b := range s {
+			text = append(text, 0xF000|uint16(b))
+			sizes = append(sizes, 1)
+		}
+		return text, sizes
+	}
+
+	enc, ok := charsetEncodings[uint32(charset)]
+	if !ok {
+		enc = charmap.Windows1252
+	}
+	dec := enc.NewDecoder()
+
+	var buf [8]byte
+	for len(s) > 0 {
+		// one character of one or two bytes
+		n := 1
+		dec.Reset()
+		nDst, _, err := dec.Transform(buf[:], s[:1], false)
+		if (err != nil || nDst == 0) && len(s) > 1 {
+			n = 2
+			dec.Reset()
+			nDst, _, err = dec.Transform(buf[:], s[:2], true)
+		}
+
+		r := '�'
+		if err == nil && nDst > 0 {
+			r = []rune(string(buf[:nDst]))[0]
+		}
+
+		if r1, r2 := utf16.EncodeRune(r); r1 != '�' {
+			text = append(text, uint16(r1), uint16(r2))
+			sizes = append(sizes, n, 0)
+		} else {
+			text = append(text, uint16(r))
+			sizes = append(sizes, n)
+		}
+
+		s = s[n:]
+	}
+
+	return text, sizes
+}
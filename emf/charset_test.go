@@ -0,0 +1,66 @@
+package emf
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset uint32
+		in      []byte
+		want    string
+		sizes   []int
+	}{
+		{"ansi", ANSI_CHARSET, []byte{'A', 0x80}, "A€", []int{1, 1}},
+		{"default", DEFAULT_CHARSET, []byte{0x80}, "€", []int{1}},
+		{"mac", MAC_CHARSET, []byte{0x80}, "Ä", []int{1}},
+		{"shift-jis", SHIFTJIS_CHARSET, []byte{'A', 0x82, 0xA0}, "Aあ", []int{1, 2}},
+		{"hangul", HANGUL_CHARSET, []byte{0xB0, 0xA1}, "가", []int{2}},
+		{"gb2312", GB2312_CHARSET, []byte{0xC4, 0xE3, '1'}, "你1", []int{2, 1}},
+		{"big5", CHINESEBIG5_CHARSET, []byte{0xA4, 0x40}, "一", []int{2}},
+		{"greek", GREEK_CHARSET, []byte{0xC1}, "Α", []int{1}},
+		{"turkish", TURKISH_CHARSET, []byte{0xD0}, "Ğ", []int{1}},
+		{"vietnamese", VIETNAMESE_CHARSET, []byte{0xD0}, "Đ", []int{1}},
+		{"hebrew", HEBREW_CHARSET, []byte{0xE0}, "א", []int{1}},
+		{"arabic", ARABIC_CHARSET, []byte{0xC7}, "ا", []int{1}},
+		{"baltic", BALTIC_CHARSET, []byte{0xC0}, "Ą", []int{1}},
+		{"russian", RUSSIAN_CHARSET, []byte{0xC0}, "А", []int{1}},
+		{"thai", THAI_CHARSET, []byte{0xA1}, "ก", []int{1}},
+		{"east europe", EASTEUROPE_CHARSET, []byte{0x8A}, "Š", []int{1}},
+		{"oem", OEM_CHARSET, []byte{0x80}, "Ç", []int{1}},
+		{"symbol", SYMBOL_CHARSET, []byte{0x41, 0xB7}, "\uF041\uF0B7", []int{1, 1}},
+		{"unknown", 200, []byte{0x80}, "€", []int{1}},
+		{"lead byte at the end", SHIFTJIS_CHARSET, []byte{'A', 0x82}, "A�", []int{1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, sizes := DecodeCharset(uint8(tt.charset), tt.in)
+
+			if got := string(utf16.Decode(text)); got != tt.want {
+				t.Errorf("decoded %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("sizes are %v, want %v", sizes, tt.sizes)
+			}
+		})
+	}
+}
+
+func TestDecodeAnsiDx(t *testing.T) {
+	s := []byte{'A', 0x82, 0xA0}
+
+	// the distances of the two bytes of あ are summed
+	if _, dx := decodeAnsi(uint8(SHIFTJIS_CHARSET), s, []int32{5, 7, 3}, false); !reflect.DeepEqual(dx, []int32{5, 10}) {
+		t.Errorf("distances are %v, want [5 10]", dx)
+	}
+	if _, dx := decodeAnsi(uint8(SHIFTJIS_CHARSET), s, []int32{5, 1, 7, 2, 3, 3}, true); !reflect.DeepEqual(dx, []int32{5, 1, 10, 5}) {
+		t.Errorf("distances with PDY are %v, want [5 1 10 5]", dx)
+	}
+	if _, dx := decodeAnsi(uint8(SHIFTJIS_CHARSET), s, nil, false); dx != nil {
+		t.Errorf("distances without dx are %v", dx)
+	}
+}
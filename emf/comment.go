@@ -0,0 +1,345 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+)
+
+// readCommentData returns the typed record for the data of a comment. The
+// plain comment is kept for private data.
+func readCommentData(r *CommentRecord) (Recorder, error) {
+	// DataSize and CommentIdentifier lead the comment data
+	if len(r.Data) < 8 {
+		return r, nil
+	}
+
+	n := binary.LittleEndian.Uint32(r.Data)
+	if n < 4 || uint64(n) > uint64(len(r.Data)-4) {
+		return r, nil
+	}
+	data := r.Data[8 : 4+n]
+
+	var rec Recorder
+	var err error
+
+	switch binary.LittleEndian.Uint32(r.Data[4:]) {
+	case EMR_COMMENT_EMFPLUS:
+		var recs []EmfPlusRecorder
+		if recs, err = readEmfPlusRecords(data); err == nil {
+			rec = &CommentEmfPlusRecord{CommentRecord: *r, Records: recs}
+		}
+	case EMR_COMMENT_EMFSPOOL:
+		rec, err = readCommentEmfSpool(r, data)
+	case EMR_COMMENT_PUBLIC:
+		rec, err = readCommentPublic(r, data)
+	default:
+		return r, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func readCommentPublic(r *CommentRecord, data []byte) (Recorder, error) {
+	if len(data) < 4 {
+		return nil, errors.New("invalid size of public comment")
+	}
+
+	reader := bytes.NewReader(data[4:])
+
+	switch id := binary.LittleEndian.Uint32(data); id {
+	case EMR_COMMENT_BEGINGROUP:
+		return readCommentBeginGroup(r, reader)
+	case EMR_COMMENT_ENDGROUP:
+		return &CommentEndGroupRecord{CommentRecord: *r}, nil
+	case EMR_COMMENT_MULTIFORMATS:
+		// offsets of the formats count from the CommentIdentifier
+		return readCommentMultiformats(r, reader, r.Data[4:])
+	case EMR_COMMENT_WINDOWS_METAFILE:
+		return readCommentWindowsMetafile(r, reader)
+	case EMR_COMMENT_UNICODE_STRING, EMR_COMMENT_UNICODE_END:
+		return readCommentUnicode(r, id, reader)
+	default:
+		// public comments of newer or other writers are kept as they are
+		return r, nil
+	}
+}
+
+// CommentBeginGroupRecord starts a group of records, which ends at the
+// matching CommentEndGroupRecord.
+type CommentBeginGroupRecord struct {
+	CommentRecord
+	Rectangle   w32.RECT
+	Description []uint16
+}
+
+func readCommentBeginGroup(r *CommentRecord, reader *bytes.Reader) (Recorder, error) {
+	rec := &CommentBeginGroupRecord{CommentRecord: *r}
+
+	var n uint32
+	if err := readValues(reader, &rec.Rectangle, &n); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, n, 2); err != nil {
+		return nil, err
+	}
+
+	rec.Description = make([]uint16, n)
+	if err := readValues(reader, rec.Description); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (r *CommentBeginGroupRecord) GetDescription() string {
+	s := utf16ToString(r.Description)
+	for len(s) > 0 && s[len(s)-1] == 0 {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func (r *CommentBeginGroupRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_BEGINGROUP")
+	return nil
+}
+
+type CommentEndGroupRecord struct {
+	CommentRecord
+}
+
+func (r *CommentEndGroupRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_ENDGROUP")
+	return nil
+}
+
+// EmrFormat is a picture format in a CommentMultiformatsRecord.
+type EmrFormat struct {
+	Signature uint32
+	Version   uint32
+	SizeData  uint32
+	OffData   uint32
+	Data      []byte
+}
+
+// Metafile returns the metafile of an EMF format.
+func (f *EmrFormat) Metafile() (*EmfFile, error) {
+	if f.Signature != ENHMETA_SIGNATURE {
+		return nil, errors.New("format is not an EMF")
+	}
+
+	return ReadFile(f.Data)
+}
+
+// CommentMultiformatsRecord holds alternative pictures, such as EPS
+// or EMF, of the records it replaces.
+type CommentMultiformatsRecord struct {
+	CommentRecord
+	OutputRect w32.RECT
+	Formats    []EmrFormat
+}
+
+func readCommentMultiformats(r *CommentRecord, reader *bytes.Reader, base []byte) (Recorder, error) {
+	rec := &CommentMultiformatsRecord{CommentRecord: *r}
+
+	var n uint32
+	if err := readValues(reader, &rec.OutputRect, &n); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, n, 16); err != nil {
+		return nil, err
+	}
+
+	rec.Formats = make([]EmrFormat, n)
+	for i := range rec.Formats {
+		f := &rec.Formats[i]
+		if err := readValues(reader, &f.Signature, &f.Version, &f.SizeData, &f.OffData); err != nil {
+			return nil, err
+		}
+
+		if uint64(f.OffData)+uint64(f.SizeData) > uint64(len(base)) {
+			return nil, errors.New("invalid EmrFormat data")
+		}
+		f.Data = base[f.OffData : f.OffData+f.SizeData]
+	}
+
+	return rec, nil
+}
+
+func (r *CommentMultiformatsRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_MULTIFORMATS")
+	return nil
+}
+
+// CommentWindowsMetafileRecord holds the WMF an EMF was converted from.
+type CommentWindowsMetafileRecord struct {
+	CommentRecord
+	Version     uint16
+	Reserved    uint16
+	Checksum    uint32
+	Flags       uint32
+	WinMetafile []byte
+}
+
+func readCommentWindowsMetafile(r *CommentRecord, reader *bytes.Reader) (Recorder, error) {
+	rec := &CommentWindowsMetafileRecord{CommentRecord: *r}
+
+	var n uint32
+	if err := readValues(reader, &rec.Version, &rec.Reserved, &rec.Checksum, &rec.Flags, &n); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, n, 1); err != nil {
+		return nil, err
+	}
+
+	rec.WinMetafile = make([]byte, n)
+	if err := readValues(reader, rec.WinMetafile); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (r *CommentWindowsMetafileRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_WINDOWS_METAFILE")
+	return nil
+}
+
+// CommentUnicodeRecord is an EMR_COMMENT_UNICODE_STRING or
+// EMR_COMMENT_UNICODE_END comment. Windows does not write them, the
+// data is kept as text.
+type CommentUnicodeRecord struct {
+	CommentRecord
+	Identifier uint32
+	String     []uint16
+}
+
+func readCommentUnicode(r *CommentRecord, id uint32, reader *bytes.Reader) (Recorder, error) {
+	rec := &CommentUnicodeRecord{CommentRecord: *r, Identifier: id}
+
+	rec.String = make([]uint16, reader.Len()/2)
+	if err := readValues(reader, rec.String); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (r *CommentUnicodeRecord) GetString() string {
+	return utf16ToString(r.String)
+}
+
+func (r *CommentUnicodeRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_UNICODE")
+	return nil
+}
+
+// CommentEmfSpoolRecord holds EMF spool records, such as the fonts
+// embedded by the print spooler.
+type CommentEmfSpoolRecord struct {
+	CommentRecord
+	Identifier   uint32
+	SpoolRecords []byte
+}
+
+func readCommentEmfSpool(r *CommentRecord, data []byte) (Recorder, error) {
+	if len(data) < 4 {
+		return nil, errors.New("invalid size of EMF spool comment")
+	}
+
+	return &CommentEmfSpoolRecord{
+		CommentRecord: *r,
+		Identifier:    binary.LittleEndian.Uint32(data),
+		SpoolRecords:  data[4:],
+	}, nil
+}
+
+func (r *CommentEmfSpoolRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_EMFSPOOL")
+	return nil
+}
+
+// CommentGroup is a group of records between an EMR_COMMENT_BEGINGROUP and
+// its EMR_COMMENT_ENDGROUP.
+type CommentGroup struct {
+	Begin   *CommentBeginGroupRecord
+	Records []Recorder      // records of the group, nested groups included
+	Groups  []*CommentGroup // nested groups
+}
+
+// Groups returns the top level groups of the file. A group missing its end
+// runs to the end of the file.
+func (f *EmfFile) Groups() []*CommentGroup {
+	var groups []*CommentGroup
+	var open []*CommentGroup
+
+	for _, rec := range f.Records {
+		switch rec := rec.(type) {
+		case *CommentBeginGroupRecord:
+			g := &CommentGroup{Begin: rec}
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.Groups = append(parent.Groups, g)
+			} else {
+				groups = append(groups, g)
+			}
+			open = append(open, g)
+			continue
+		case *CommentEndGroupRecord:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+			continue
+		}
+
+		for _, g := range open {
+			g.Records = append(g.Records, rec)
+		}
+	}
+
+	return groups
+}
+
+// Multiformats returns the comments holding alternative pictures.
+func (f *EmfFile) Multiformats() []*CommentMultiformatsRecord {
+	var recs []*CommentMultiformatsRecord
+	for _, rec := range f.Records {
+		if rec, ok := rec.(*CommentMultiformatsRecord); ok {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// WindowsMetafiles returns the comments holding an embedded WMF.
+func (f *EmfFile) WindowsMetafiles() []*CommentWindowsMetafileRecord {
+	var recs []*CommentWindowsMetafileRecord
+	for _, rec := range f.Records {
+		if rec, ok := rec.(*CommentWindowsMetafileRecord); ok {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// EmfSpools returns the EMF spool comments.
+func (f *EmfFile) EmfSpools() []*CommentEmfSpoolRecord {
+	var recs []*CommentEmfSpoolRecord
+	for _, rec := range f.Records {
+		if rec, ok := rec.(*CommentEmfSpoolRecord); ok {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
@@ -0,0 +1,192 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// comment returns an EMR_COMMENT of the identifier and the values, with
+// the data size and the padding.
+func comment(t *testing.T, id uint32, values ...interface{}) *CommentRecord {
+	t.Helper()
+
+	var data bytes.Buffer
+	for _, v := range values {
+		if err := binary.Write(&data, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(4+data.Len()))
+	binary.Write(&buf, binary.LittleEndian, id)
+	buf.Write(data.Bytes())
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+
+	return &CommentRecord{Record: Record{Type: EMR_COMMENT}, Data: buf.Bytes()}
+}
+
+func beginGroup(t *testing.T, description string) *CommentRecord {
+	s := utf16.Encode([]rune(description + "\x00"))
+	return comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_BEGINGROUP, w32.RECT{Left: 1, Top: 2, Right: 3, Bottom: 4}, uint32(len(s)), s)
+}
+
+func endGroup(t *testing.T) *CommentRecord {
+	return comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_ENDGROUP)
+}
+
+func TestCommentRecords(t *testing.T) {
+	picture := writeFile(t, NewBuilder(w32.RECT{Right: 9, Bottom: 9}, w32.RECT{}).File())
+	eps := []byte("%!PS-Adobe-3.0 EPSF-3.0\n")
+
+	// the formats follow the two descriptors, 12 + 16 + 2 * 16 bytes after
+	// the CommentIdentifier
+	offEps := uint32(60)
+	offEmf := offEps + uint32(len(eps))
+	formats := []uint32{
+		EPS_SIGNATURE, 1, uint32(len(eps)), offEps,
+		ENHMETA_SIGNATURE, 0x10000, uint32(len(picture)), offEmf,
+	}
+
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	b.Add(beginGroup(t, "Chart"))
+	b.Rectangle(0, 0, 10, 10)
+	b.Add(beginGroup(t, "Axis"))
+	b.Rectangle(0, 0, 20, 20)
+	b.Add(endGroup(t))
+	b.Add(endGroup(t))
+	b.Add(comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_MULTIFORMATS, w32.RECT{Right: 9, Bottom: 9}, uint32(2), formats, eps, picture))
+	b.Add(comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_WINDOWS_METAFILE, uint16(0x300), uint16(0), uint32(0), uint32(0), uint32(3), []byte{1, 2, 3}))
+	b.Add(comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_UNICODE_STRING, utf16.Encode([]rune("note"))))
+	b.Add(comment(t, EMR_COMMENT_EMFSPOOL, uint32(0x544F4E46), []byte{5, 6, 7, 8}))
+	b.Add(comment(t, 0x12345678, []byte("private")))
+	b.Add(comment(t, EMR_COMMENT_PUBLIC, uint32(0x7F), []byte("vendor")))
+
+	// the records are typed when read, and written back as they were read
+	f := readFile(t, writeFile(t, readFile(t, writeFile(t, b.File()))))
+
+	var types []string
+	for _, rec := range f.Records {
+		switch rec.(type) {
+		case *CommentBeginGroupRecord:
+			types = append(types, "begin")
+		case *CommentEndGroupRecord:
+			types = append(types, "end")
+		case *CommentMultiformatsRecord:
+			types = append(types, "multiformats")
+		case *CommentWindowsMetafileRecord:
+			types = append(types, "wmf")
+		case *CommentUnicodeRecord:
+			types = append(types, "unicode")
+		case *CommentEmfSpoolRecord:
+			types = append(types, "spool")
+		case *CommentRecord:
+			types = append(types, "private")
+		}
+	}
+	want := []string{"begin", "begin", "end", "end", "multiformats", "wmf", "unicode", "spool", "private", "private"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("comments are %v, want %v", types, want)
+	}
+
+	groups := f.Groups()
+	if len(groups) != 1 || len(groups[0].Groups) != 1 {
+		t.Fatalf("groups are %+v", groups)
+	}
+	chart, axis := groups[0], groups[0].Groups[0]
+	if chart.Begin.GetDescription() != "Chart" || axis.Begin.GetDescription() != "Axis" {
+		t.Errorf("groups are %q and %q", chart.Begin.GetDescription(), axis.Begin.GetDescription())
+	}
+	if chart.Begin.Rectangle != (w32.RECT{Left: 1, Top: 2, Right: 3, Bottom: 4}) {
+		t.Errorf("group rectangle is %v", chart.Begin.Rectangle)
+	}
+	if len(chart.Records) != 2 || len(axis.Records) != 1 {
+		t.Errorf("groups have %d and %d records, want 2 and 1", len(chart.Records), len(axis.Records))
+	}
+
+	multi := f.Multiformats()
+	if len(multi) != 1 || len(multi[0].Formats) != 2 {
+		t.Fatalf("multiformats are %+v", multi)
+	}
+	if !bytes.Equal(multi[0].Formats[0].Data, eps) {
+		t.Errorf("EPS data is %q", multi[0].Formats[0].Data)
+	}
+	if _, err := multi[0].Formats[0].Metafile(); err == nil {
+		t.Error("EPS format read as a metafile")
+	}
+	if emf, err := multi[0].Formats[1].Metafile(); err != nil || emf.Header == nil {
+		t.Errorf("EMF format: %v", err)
+	}
+
+	if wmfs := f.WindowsMetafiles(); len(wmfs) != 1 || wmfs[0].Version != 0x300 || !bytes.Equal(wmfs[0].WinMetafile, []byte{1, 2, 3}) {
+		t.Errorf("windows metafiles are %+v", wmfs)
+	}
+
+	spools := f.EmfSpools()
+	if len(spools) != 1 || spools[0].Identifier != 0x544F4E46 || !bytes.Equal(spools[0].SpoolRecords, []byte{5, 6, 7, 8}) {
+		t.Errorf("EMF spools are %+v", spools)
+	}
+
+	for _, rec := range f.Records {
+		if rec, ok := rec.(*CommentUnicodeRecord); ok && rec.GetString() != "note" {
+			t.Errorf("unicode comment is %q", rec.GetString())
+		}
+	}
+}
+
+func TestCommentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  func(t *testing.T) *CommentRecord
+	}{
+		{"description past the data", func(t *testing.T) *CommentRecord {
+			return comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_BEGINGROUP, w32.RECT{}, uint32(100))
+		}},
+		{"format past the data", func(t *testing.T) *CommentRecord {
+			return comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_MULTIFORMATS, w32.RECT{}, uint32(1), []uint32{EPS_SIGNATURE, 1, 100, 40})
+		}},
+		{"too many formats", func(t *testing.T) *CommentRecord {
+			return comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_MULTIFORMATS, w32.RECT{}, uint32(1<<20))
+		}},
+		{"metafile past the data", func(t *testing.T) *CommentRecord {
+			return comment(t, EMR_COMMENT_PUBLIC, EMR_COMMENT_WINDOWS_METAFILE, uint16(0x300), uint16(0), uint32(0), uint32(0), uint32(100))
+		}},
+		{"empty public comment", func(t *testing.T) *CommentRecord {
+			return comment(t, EMR_COMMENT_PUBLIC)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(w32.RECT{Right: 9, Bottom: 9}, w32.RECT{})
+			b.Add(tt.rec(t))
+			data := writeFile(t, b.File())
+
+			_, err := ReadFileWithOptions(data, &ReadOptions{Strict: true})
+			var rerr *RecordError
+			if !errors.As(err, &rerr) || rerr.Type != EMR_COMMENT {
+				t.Errorf("strict read returned %v, want an error of the comment", err)
+			}
+
+			// a lenient read keeps the comment raw
+			f, err := ReadFile(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Records) != 1 {
+				t.Fatalf("lenient read returned %d records, want 1", len(f.Records))
+			}
+			if _, ok := f.Records[0].(*RawRecord); !ok {
+				t.Errorf("lenient read returned %T", f.Records[0])
+			}
+		})
+	}
+}
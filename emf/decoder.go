@@ -0,0 +1,174 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Decoder reads the records of a metafile from a stream one at a time, so
+// large files can be filtered or drawn without holding all the records in
+// memory.
+type Decoder struct {
+	r      io.Reader
+	strict bool
+	limits *Limits
+
+	offset int64
+	header *HeaderRecord
+	err    error
+}
+
+// NewDecoder returns a lenient decoder of r with the DefaultLimits.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, nil)
+}
+
+// NewDecoderWithOptions returns a decoder of r, nil options mean the
+// defaults. In lenient mode a record which cannot be parsed is returned as a
+// RawRecord.
+func NewDecoderWithOptions(r io.Reader, opts *ReadOptions) *Decoder {
+	if opts == nil {
+		opts = &ReadOptions{}
+	}
+
+	limits := opts.Limits
+	if limits == nil {
+		limits = &DefaultLimits
+	}
+
+	return &Decoder{r: r, strict: opts.Strict, limits: limits}
+}
+
+// Header returns the header record, nil until Next has returned it.
+func (d *Decoder) Header() *HeaderRecord {
+	return d.header
+}
+
+// Next returns the next record, the first one being the *HeaderRecord and
+// the last one the *EofRecord. It returns io.EOF after the EofRecord, and
+// ErrNoEof when the stream ends without it. A record which cannot be read is
+// reported as a *RecordError, after which the decoder keeps returning the
+// same error.
+func (d *Decoder) Next() (Recorder, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	rec, err := d.next()
+	if err != nil {
+		d.err = err
+		return nil, err
+	}
+
+	if _, ok := rec.(*EofRecord); ok {
+		d.err = io.EOF
+	}
+
+	return rec, nil
+}
+
+func (d *Decoder) next() (Recorder, error) {
+	offset := d.offset
+
+	var hdr [8]byte
+	n, err := io.ReadFull(d.r, hdr[:])
+	d.offset += int64(n)
+	if err == io.EOF {
+		if d.header == nil {
+			return nil, ErrNoHeader
+		}
+		return nil, ErrNoEof
+	}
+
+	rerr := &RecordError{Op: "read", Offset: offset}
+	if err != nil {
+		rerr.Err = err
+		return nil, rerr
+	}
+
+	rerr.Type = binary.LittleEndian.Uint32(hdr[:])
+	size := binary.LittleEndian.Uint32(hdr[4:])
+
+	data, err := d.readData(hdr, size)
+	if err != nil {
+		rerr.Err = err
+		return nil, rerr
+	}
+	d.offset += int64(size) - 8
+
+	rec, err := parseRecord(data)
+	if err != nil {
+		rerr.Err = err
+		if d.strict || d.header == nil {
+			return nil, rerr
+		}
+
+		if errors.Is(err, ErrUnknownRecord) {
+			log.Warn(rerr)
+		} else {
+			log.Error(rerr)
+		}
+
+		// the size tells where the next record is, so this one is kept raw
+		rec = &RawRecord{Record: Record{Type: rerr.Type, Size: size}, Data: data[8:]}
+	}
+
+	if d.header == nil {
+		header, ok := rec.(*HeaderRecord)
+		if !ok {
+			return nil, ErrNoHeader
+		}
+		d.header = header
+	}
+
+	return rec, nil
+}
+
+// readData returns the record of size bytes whose header is hdr. The buffer
+// only grows as the data arrives, unless the length of the stream is known,
+// so a truncated stream cannot make it allocate the whole size.
+func (d *Decoder) readData(hdr [8]byte, size uint32) ([]byte, error) {
+	if size < 8 {
+		return nil, ErrRecordSize
+	}
+
+	if d.limits.MaxRecordSize > 0 && size > d.limits.MaxRecordSize {
+		return nil, fmt.Errorf("%w: record of %d bytes", ErrLimit, size)
+	}
+
+	if r, ok := d.r.(interface{ Len() int }); ok {
+		if uint64(size-8) > uint64(r.Len()) {
+			return nil, ErrRecordSize
+		}
+
+		data := make([]byte, size)
+		copy(data, hdr[:])
+		if _, err := io.ReadFull(d.r, data[8:]); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, minSize(size, 64<<10)))
+	buf.Write(hdr[:])
+	if _, err := io.CopyN(buf, d.r, int64(size-8)); err != nil {
+		if err == io.EOF {
+			err = ErrRecordSize
+		}
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func minSize(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
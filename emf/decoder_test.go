@@ -0,0 +1,173 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// streamReader hides the length of the data from the decoder.
+type streamReader struct {
+	io.Reader
+}
+
+// decoderData returns a metafile of a header, a rectangle and an EOF, and the
+// offset of the rectangle.
+func decoderData(t *testing.T) ([]byte, int) {
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	b.Rectangle(1, 2, 30, 40)
+	data := writeFile(t, b.File())
+	return data, int(binary.LittleEndian.Uint32(data[4:]))
+}
+
+// withRecord inserts a record of type typ before the EOF of data.
+func withRecord(data []byte, typ uint32, params ...uint32) []byte {
+	var rec bytes.Buffer
+	binary.Write(&rec, binary.LittleEndian, typ)
+	binary.Write(&rec, binary.LittleEndian, uint32(8+4*len(params)))
+	binary.Write(&rec, binary.LittleEndian, params)
+
+	out := append([]byte{}, data[:len(data)-20]...)
+	out = append(out, rec.Bytes()...)
+	return append(out, data[len(data)-20:]...)
+}
+
+func TestDecoderNext(t *testing.T) {
+	data, _ := decoderData(t)
+
+	for _, stream := range []bool{false, true} {
+		var r io.Reader = bytes.NewReader(data)
+		if stream {
+			r = streamReader{r}
+		}
+		dec := NewDecoder(r)
+
+		if dec.Header() != nil {
+			t.Error("header before the first record")
+		}
+
+		var types []uint32
+		for {
+			rec, err := dec.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("stream %v: Next returned %v", stream, err)
+			}
+			types = append(types, recordType(rec))
+		}
+
+		want := []uint32{EMR_HEADER, EMR_RECTANGLE, EMR_EOF}
+		if len(types) != len(want) || types[0] != want[0] || types[1] != want[1] || types[2] != want[2] {
+			t.Errorf("stream %v: decoded %#x, want %#x", stream, types, want)
+		}
+		if dec.Header() == nil || dec.Header().Original.Bounds != (w32.RECT{Right: 99, Bottom: 99}) {
+			t.Errorf("stream %v: header is %+v", stream, dec.Header())
+		}
+		if _, err := dec.Next(); err != io.EOF {
+			t.Errorf("stream %v: Next after the end returned %v, want io.EOF", stream, err)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	data, rectOffset := decoderData(t)
+	eofOffset := len(data) - 20
+
+	small := withRecord(data, EMR_RECTANGLE)
+	binary.LittleEndian.PutUint32(small[eofOffset+4:], 4)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		strict  bool
+		limits  *Limits
+		records int   // returned before the error
+		err     error // cause of the error
+		offset  int64 // of the record which failed, -1 when no *RecordError
+	}{
+		{"empty", nil, false, nil, 0, ErrNoHeader, -1},
+		{"no header", data[rectOffset:], false, nil, 0, ErrNoHeader, -1},
+		{"no eof", data[:eofOffset], false, nil, 2, ErrNoEof, -1},
+		{"truncated record", data[:rectOffset+12], false, nil, 1, ErrRecordSize, int64(rectOffset)},
+		{"truncated header", data[:rectOffset+4], false, nil, 1, io.ErrUnexpectedEOF, int64(rectOffset)},
+		{"size too small", small, false, nil, 2, ErrRecordSize, int64(eofOffset)},
+		{"unknown strict", withRecord(data, 0x7777, 1, 2), true, nil, 2, ErrUnknownRecord, int64(eofOffset)},
+		{"unreadable strict", withRecord(data, EMR_RECTANGLE, 1), true, nil, 2, nil, int64(eofOffset)},
+		{"over the limit", data, false, &Limits{MaxRecordSize: 100}, 0, ErrLimit, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, stream := range []bool{false, true} {
+				var r io.Reader = bytes.NewReader(tt.data)
+				if stream {
+					r = streamReader{r}
+				}
+				dec := NewDecoderWithOptions(r, &ReadOptions{Strict: tt.strict, Limits: tt.limits})
+
+				n := 0
+				var err error
+				for ; ; n++ {
+					if _, err = dec.Next(); err != nil {
+						break
+					}
+				}
+
+				if err == io.EOF {
+					t.Fatalf("stream %v: decoded the whole file", stream)
+				}
+				if n != tt.records {
+					t.Errorf("stream %v: decoded %d records before %v, want %d", stream, n, err, tt.records)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("stream %v: Next returned %v, want %v", stream, err, tt.err)
+				}
+
+				var rerr *RecordError
+				if errors.As(err, &rerr) != (tt.offset >= 0) || rerr != nil && rerr.Offset != tt.offset {
+					t.Errorf("stream %v: Next returned %v, want a read error at offset %d", stream, err, tt.offset)
+				}
+
+				// the decoder stops at the error
+				if _, again := dec.Next(); again != err {
+					t.Errorf("stream %v: Next after the error returned %v, want %v", stream, again, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderLenient(t *testing.T) {
+	data, _ := decoderData(t)
+
+	dec := NewDecoder(bytes.NewReader(withRecord(data, 0x7777, 1, 2)))
+
+	var recs []Recorder
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next returned %v", err)
+		}
+		recs = append(recs, rec)
+	}
+
+	if len(recs) != 4 {
+		t.Fatalf("decoded %d records, want 4", len(recs))
+	}
+	raw, ok := recs[2].(*RawRecord)
+	if !ok || raw.Type != 0x7777 || raw.Size != 16 || !bytes.Equal(raw.Data, []byte{1, 0, 0, 0, 2, 0, 0, 0}) {
+		t.Errorf("unknown record decoded as %+v, want a RawRecord of its data", recs[2])
+	}
+	if recordType(recs[3]) != EMR_EOF {
+		t.Errorf("record after the unknown one is %T, want the EOF", recs[3])
+	}
+}
@@ -0,0 +1,170 @@
+package emf
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// Bitmap is a device-independent bitmap taken from a bitmap record.
+type Bitmap struct {
+	Info   w32.BITMAPINFO
+	Colors []w32.RGBQUAD
+	Bits   []byte
+}
+
+func newBitmap(info w32.BITMAPINFO, colors []w32.RGBQUAD, bits []byte) *Bitmap {
+	if info.BiSize == 0 || len(bits) == 0 {
+		return nil
+	}
+	return &Bitmap{Info: info, Colors: colors, Bits: bits}
+}
+
+// bitmap returns the bitmap of a record, which decoding must not make
+// exceed the limits of the context.
+func (e *EmfContext) bitmap(info w32.BITMAPINFO, colors []w32.RGBQUAD, bits []byte) (*Bitmap, error) {
+	if err := e.limits.checkPixels(int64(info.BiWidth), int64(info.BiHeight)); err != nil {
+		return nil, err
+	}
+
+	bmp := newBitmap(info, colors, bits)
+
+	// the header does not bind the size of an embedded image
+	if bmp != nil && (info.BiCompression == BI_JPEG || info.BiCompression == BI_PNG) {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(bits))
+		if err != nil {
+			return nil, err
+		}
+		if err := e.limits.checkPixels(int64(cfg.Width), int64(cfg.Height)); err != nil {
+			return nil, err
+		}
+	}
+
+	return bmp, nil
+}
+
+// region returns the rectangles of a region record, which combining must
+// not make exceed the limits of the context.
+func (e *EmfContext) region(rgn RegionData) ([]w32.RECT, error) {
+	if err := e.limits.checkRects(len(rgn.Data)); err != nil {
+		return nil, err
+	}
+	return rgn.Data, nil
+}
+
+// Device is the drawing target of EmfContext. Records translate themselves
+// into calls on the device, which forwards them to gdi32, emulates them in
+// software or does whatever else a custom target needs. Coordinates are
+// logical units unless noted otherwise.
+type Device interface {
+	Release()
+	Image() (*image.RGBA, error)
+
+	// GraphicsMode is the mode the device runs in. In GM_COMPATIBLE
+	// EmfContext keeps the world transform and the mapping mode, and sets
+	// the window and viewport of the device to their combination, in
+	// GM_ADVANCED the records are passed to the device.
+	GraphicsMode() int
+
+	// objects, the returned values are stored in EmfContext.Objects
+	StockObject(ih uint32) (interface{}, bool)
+	CreatePen(pen w32.LOGPEN) interface{}
+	ExtCreatePen(pen w32.LOGPENEX) interface{}
+	CreateBrushIndirect(brush w32.LOGBRUSH) interface{}
+	CreateFontIndirect(font w32.LOGFONT) interface{}
+	CreatePalette(palette w32.LOGPALETTE) interface{}
+	SelectObject(object interface{}) error
+	SelectPalette(object interface{}) error
+	DeleteObject(object interface{}) error
+
+	// state
+	SaveDC() error
+	RestoreDC(savedDC int) error
+	SetMapMode(mode int) error
+	SetWindowExtEx(cx, cy int) error
+	SetWindowOrgEx(x, y int) error
+	SetViewportExtEx(cx, cy int) error
+	SetViewportOrgEx(x, y int) error
+	ScaleWindowExtEx(xNum, xDenom, yNum, yDenom int) error
+	ScaleViewportExtEx(xNum, xDenom, yNum, yDenom int) error
+	SetWorldTransform(xform w32.XFORM) error
+	ModifyWorldTransform(xform w32.XFORM, mode uint32) error
+	SetBkMode(mode int) error
+	SetBkColor(color w32.COLORREF) error
+	SetTextColor(color w32.COLORREF) error
+	SetTextAlign(align uint32) error
+	SetTextJustification(extra, count int) error
+	SetPolyFillMode(mode int) error
+	SetArcDirection(dir int) error
+	SetROP2(mode int) error
+	SetStretchBltMode(mode int) error
+	SetMapperFlags(flags uint32) error
+	SetMiterLimit(limit float32) error
+	SetBrushOrgEx(x, y int) error
+
+	// GetTextCharset returns the charset of the selected font, which the
+	// strings of the ANSI text records are decoded by
+	GetTextCharset() int
+
+	// clipping, rectangles of regions are in device units
+	IntersectClipRect(left, top, right, bottom int) error
+	ExcludeClipRect(left, top, right, bottom int) error
+	ExtSelectClipRgn(rects []w32.RECT, mode int) error
+	OffsetClipRgn(x, y int) error
+	SetMetaRgn() error
+
+	// GetClipRgn and GetMetaRgn return nil when there is no region
+	GetClipRgn() (*Region, error)
+	GetMetaRgn() (*Region, error)
+
+	// paths
+	BeginPath() error
+	EndPath() error
+	AbortPath() error
+	CloseFigure() error
+	FillPath() error
+	StrokePath() error
+	StrokeAndFillPath() error
+	FlattenPath() error
+	WidenPath() error
+	SelectClipPath(mode int) error
+
+	// drawing
+	MoveToEx(x, y int) error
+	LineTo(x, y int) error
+	Polyline(points []w32.POINT) error
+	PolylineTo(points []w32.POINT) error
+	PolyBezier(points []w32.POINT) error
+	PolyBezierTo(points []w32.POINT) error
+	Polygon(points []w32.POINT) error
+	PolyPolygon(points []w32.POINT, counts []int) error
+	PolyDraw(points []w32.POINT, types []byte) error
+	Rectangle(left, top, right, bottom int) error
+	Arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error
+	ArcTo(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error
+	AngleArc(x, y int, radius uint32, startAngle, sweepAngle float32) error
+	Chord(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error
+	Pie(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error
+	Ellipse(left, top, right, bottom int) error
+	RoundRect(left, top, right, bottom, width, height int) error
+	SetPixelV(x, y int, color w32.COLORREF) error
+	FillRgn(rects []w32.RECT, brush interface{}) error
+	FrameRgn(rects []w32.RECT, brush interface{}, width, height int) error
+	InvertRgn(rects []w32.RECT) error
+	PaintRgn(rects []w32.RECT) error
+	ExtTextOut(x, y int, options uint32, rect *w32.RECT, text []uint16, dx []int32) error
+
+	// bitmaps, src is nil when the record carries no bitmap
+	BitBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc int, rop uint32) error
+	StretchBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, cxSrc, cySrc int, rop uint32) error
+	MaskBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc int, mask *Bitmap, xMask, yMask int, rop uint32) error
+	StretchDIBits(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, cxSrc, cySrc int, usage, rop uint32) error
+	SetDIBitsToDevice(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, startScan, scans int, usage uint32) error
+}
+
+// NewRasterDevice returns a device which renders into an image of the given
+// size without gdi32.
+func NewRasterDevice(width, height int) Device {
+	return newSoftDevice(width, height, newRasterPainter(width, height))
+}
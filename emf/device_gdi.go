@@ -0,0 +1,864 @@
+//go:build windows
+// +build windows
+
+package emf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+)
+
+var StockObjects map[uint32]interface{}
+
+func loadStockObjects() {
+	if StockObjects != nil {
+		return
+	}
+
+	stock := func(ih uint32) w32.HGDIOBJ {
+		return w32.GetStockObject(ih &^ 0x80000000)
+	}
+
+	StockObjects = map[uint32]interface{}{
+		WHITE_BRUSH:         w32.HBRUSH(stock(WHITE_BRUSH)),
+		LTGRAY_BRUSH:        w32.HBRUSH(stock(LTGRAY_BRUSH)),
+		GRAY_BRUSH:          w32.HBRUSH(stock(GRAY_BRUSH)),
+		DKGRAY_BRUSH:        w32.HBRUSH(stock(DKGRAY_BRUSH)),
+		BLACK_BRUSH:         w32.HBRUSH(stock(BLACK_BRUSH)),
+		NULL_BRUSH:          w32.HBRUSH(stock(NULL_BRUSH)),
+		DC_BRUSH:            w32.HBRUSH(stock(DC_BRUSH)),
+		WHITE_PEN:           w32.HPEN(stock(WHITE_PEN)),
+		BLACK_PEN:           w32.HPEN(stock(BLACK_PEN)),
+		DC_PEN:              w32.HPEN(stock(DC_PEN)),
+		NULL_PEN:            w32.HPEN(stock(NULL_PEN)),
+		OEM_FIXED_FONT:      w32.HFONT(stock(OEM_FIXED_FONT)),
+		ANSI_FIXED_FONT:     w32.HFONT(stock(ANSI_FIXED_FONT)),
+		ANSI_VAR_FONT:       w32.HFONT(stock(ANSI_VAR_FONT)),
+		SYSTEM_FONT:         w32.HFONT(stock(SYSTEM_FONT)),
+		DEVICE_DEFAULT_FONT: w32.HFONT(stock(DEVICE_DEFAULT_FONT)),
+		SYSTEM_FIXED_FONT:   w32.HFONT(stock(SYSTEM_FIXED_FONT)),
+		DEFAULT_GUI_FONT:    w32.HFONT(stock(DEFAULT_GUI_FONT)),
+		DEFAULT_PALETTE:     w32.HPALETTE(stock(DEFAULT_PALETTE)),
+	}
+}
+
+// newDevice returns the gdi32 device when the library is available and the
+// software device otherwise.
+func newDevice(window w32.SIZE) Device {
+	if w32.GdiAvailable() {
+		return NewGdiDevice(window)
+	}
+
+	return NewRasterDevice(int(window.CX), int(window.CY))
+}
+
+// GdiDevice draws into a memory device context of gdi32.
+type GdiDevice struct {
+	MDC      w32.HDC
+	BitCount int
+	Width    int
+	Height   int
+}
+
+func NewGdiDevice(window w32.SIZE) *GdiDevice {
+	loadStockObjects()
+
+	memDC := w32.CreateCompatibleDC(0)
+	hBitmap := w32.CreateCompatibleBitmap(memDC, int(window.CX), int(window.CY))
+
+	if hBitmap == 0 {
+		log.Error("failed to create CreateCompatibleBitmap")
+	}
+
+	defer func() {
+		w32.DeleteObject(w32.HGDIOBJ(hBitmap))
+	}()
+
+	d := &GdiDevice{
+		MDC:      memDC,
+		BitCount: w32.GetDeviceCaps(memDC, w32.COLORRES),
+		Width:    int(window.CX),
+		Height:   int(window.CY),
+	}
+
+	// w32.SetTextAlign(memDC, TA_LEFT|TA_TOP)
+	w32.SetBkColor(d.MDC, 0x00FFFFFF)
+
+	// world transforms are passed to the device context, which ignores
+	// them in GM_COMPATIBLE
+	w32.SetGraphicsMode(d.MDC, w32.GM_ADVANCED)
+
+	w32.SelectObject(d.MDC, w32.HGDIOBJ(hBitmap))
+	w32.Rectangle(d.MDC, 0, 0, d.Width, d.Height) // too fill white background
+
+	return d
+}
+
+func (d *GdiDevice) Release() {
+	if !w32.DeleteDC(d.MDC) {
+		log.Error("Error on DeleteDC")
+	}
+}
+
+func (d *GdiDevice) GraphicsMode() int {
+	return w32.GM_ADVANCED
+}
+
+func (d *GdiDevice) Image() (*image.RGBA, error) {
+	_, img, err := DeviceContextToImage(d.MDC, d.Width, d.Height)
+	return img, err
+}
+
+func (d *GdiDevice) StockObject(ih uint32) (interface{}, bool) {
+	object, ok := StockObjects[ih]
+	return object, ok
+}
+
+func (d *GdiDevice) CreatePen(pen w32.LOGPEN) interface{} {
+	return w32.CreatePenIndirect(&pen)
+}
+
+func (d *GdiDevice) ExtCreatePen(pen w32.LOGPENEX) interface{} {
+	logbrush := w32.LOGBRUSH{
+		BrushStyle: pen.BrushStyle,
+		Color:      pen.ColorRef,
+		BrushHatch: pen.BrushHatch,
+	}
+
+	styleEntry := make([]w32.DWORD, len(pen.StyleEntry))
+	for idx := range pen.StyleEntry {
+		styleEntry[idx] = w32.DWORD(pen.StyleEntry[idx])
+	}
+
+	return w32.ExtCreatePen(w32.DWORD(pen.PenStyle), w32.DWORD(pen.Width), &logbrush, w32.DWORD(pen.NumStyleEntries), styleEntry)
+}
+
+func (d *GdiDevice) CreateBrushIndirect(brush w32.LOGBRUSH) interface{} {
+	return w32.CreateBrushIndirect(&brush)
+}
+
+func (d *GdiDevice) CreateFontIndirect(font w32.LOGFONT) interface{} {
+	return w32.CreateFontIndirectW(&font)
+}
+
+func (d *GdiDevice) CreatePalette(palette w32.LOGPALETTE) interface{} {
+	return w32.CreatePalette(&palette)
+}
+
+func (d *GdiDevice) SelectObject(object interface{}) error {
+	switch object := object.(type) {
+	case w32.HPEN:
+		w32.SelectObject(d.MDC, w32.HGDIOBJ(object))
+	case w32.HBRUSH:
+		w32.SelectObject(d.MDC, w32.HGDIOBJ(object))
+	case w32.HFONT:
+		w32.SelectObject(d.MDC, w32.HGDIOBJ(object))
+	default:
+		return errors.New("Unknown type of object")
+	}
+
+	return nil
+}
+
+func (d *GdiDevice) SelectPalette(object interface{}) error {
+	switch object := object.(type) {
+	case w32.HPALETTE:
+		w32.SelectPalette(d.MDC, object, w32.FALSE)
+	default:
+		return errors.New("Unknown type of object")
+	}
+
+	return nil
+}
+
+func (d *GdiDevice) DeleteObject(object interface{}) error {
+	switch object := object.(type) {
+	case w32.HPEN:
+		w32.DeleteObject(w32.HGDIOBJ(object))
+	case w32.HBRUSH:
+		w32.DeleteObject(w32.HGDIOBJ(object))
+	case w32.HFONT:
+		w32.DeleteObject(w32.HGDIOBJ(object))
+	case w32.HPALETTE:
+		w32.DeleteObject(w32.HGDIOBJ(object))
+	}
+
+	return nil
+}
+
+func (d *GdiDevice) SaveDC() error {
+	if w32.SaveDC(d.MDC) == 0 {
+		return errors.New("failed to run SaveDC")
+	}
+	return nil
+}
+
+func (d *GdiDevice) RestoreDC(savedDC int) error {
+	if !w32.RestoreDC(d.MDC, savedDC) {
+		return errors.New("failed to run RestoreDC")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetMapMode(mode int) error {
+	if w32.SetMapMode(d.MDC, mode) == 0 {
+		return errors.New("failed to run SetMapMode")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetWindowExtEx(cx, cy int) error {
+	if !w32.SetWindowExtEx(d.MDC, cx, cy, nil) {
+		return errors.New("failed to run SetWindowExtEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetWindowOrgEx(x, y int) error {
+	if !w32.SetWindowOrgEx(d.MDC, x, y, nil) {
+		return errors.New("failed to run SetWindowOrgEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetViewportExtEx(cx, cy int) error {
+	if !w32.SetViewportExtEx(d.MDC, cx, cy, nil) {
+		return errors.New("failed to run SetViewportExtEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetViewportOrgEx(x, y int) error {
+	if !w32.SetViewportOrgEx(d.MDC, x, y, nil) {
+		return errors.New("failed to run SetViewportOrgEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) ScaleWindowExtEx(xNum, xDenom, yNum, yDenom int) error {
+	if !w32.ScaleWindowExtEx(d.MDC, xNum, xDenom, yNum, yDenom, nil) {
+		return errors.New("failed to run ScaleWindowExtEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) ScaleViewportExtEx(xNum, xDenom, yNum, yDenom int) error {
+	if !w32.ScaleViewportExtEx(d.MDC, xNum, xDenom, yNum, yDenom, nil) {
+		return errors.New("failed to run ScaleViewportExtEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetWorldTransform(xform w32.XFORM) error {
+	if !w32.SetWorldTransform(d.MDC, &xform) {
+		return errors.New("failed to run SetWorldTransform")
+	}
+	return nil
+}
+
+func (d *GdiDevice) ModifyWorldTransform(xform w32.XFORM, mode uint32) error {
+	if !w32.ModifyWorldTransform(d.MDC, &xform, w32.DWORD(mode)) {
+		return errors.New("failed to run ModifyWorldTransform")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetBkMode(mode int) error {
+	if w32.SetBkMode(d.MDC, mode) == 0 {
+		return errors.New("failed to run SetBkMode")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetBkColor(color w32.COLORREF) error {
+	if w32.SetBkColor(d.MDC, color) == w32.COLORREF(w32.CLR_INVALID) {
+		return errors.New("failed to run SetBkColor")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetTextColor(color w32.COLORREF) error {
+	if w32.SetTextColor(d.MDC, color) == w32.COLORREF(w32.CLR_INVALID) {
+		return errors.New("failed to run SetTextColor")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetTextAlign(align uint32) error {
+	if w32.SetTextAlign(d.MDC, w32.UINT(align)) == w32.GDI_ERROR {
+		return errors.New("failed to run SetTextAlign")
+	}
+	return nil
+}
+
+func (d *GdiDevice) GetTextCharset() int {
+	return w32.GetTextCharset(d.MDC)
+}
+
+func (d *GdiDevice) SetTextJustification(extra, count int) error {
+	if !w32.SetTextJustification(d.MDC, extra, count) {
+		return errors.New("failed to run SetTextJustification")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetPolyFillMode(mode int) error {
+	if w32.SetPolyFillMode(d.MDC, mode) == 0 {
+		return errors.New("failed to run SetPolyFillMode")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetArcDirection(dir int) error {
+	if w32.SetArcDirection(d.MDC, dir) == 0 {
+		return errors.New("failed to run SetArcDirection")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetROP2(mode int) error {
+	if w32.SetROP2(d.MDC, mode) == 0 {
+		return errors.New("failed to run SetROP2")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetStretchBltMode(mode int) error {
+	if w32.SetStretchBltMode(d.MDC, mode) == 0 {
+		return errors.New("failed to run SetStretchBltMode")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetMapperFlags(flags uint32) error {
+	if w32.SetMapperFlags(d.MDC, w32.DWORD(flags)) == w32.GDI_ERROR {
+		return errors.New("failed to run SetMapperFlags")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetMiterLimit(limit float32) error {
+	var old float32
+	if !w32.SetMiterLimit(d.MDC, limit, &old) {
+		return errors.New("failed to run SetMiterLimit")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetBrushOrgEx(x, y int) error {
+	if !w32.SetBrushOrgEx(d.MDC, x, y, nil) {
+		return errors.New("failed to run SetBrushOrgEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) IntersectClipRect(left, top, right, bottom int) error {
+	if w32.IntersectClipRect(d.MDC, left, top, right, bottom) == w32.ERROR {
+		return errors.New("failed to run IntersectClipRect")
+	}
+	return nil
+}
+
+func (d *GdiDevice) ExcludeClipRect(left, top, right, bottom int) error {
+	if w32.ExcludeClipRect(d.MDC, left, top, right, bottom) == w32.ERROR {
+		return errors.New("failed to run ExcludeClipRect")
+	}
+	return nil
+}
+
+// ExtSelectClipRgn combines the clip region with the union of the
+// rectangles, RGN_COPY without rectangles selects the default clip region.
+func (d *GdiDevice) ExtSelectClipRgn(rects []w32.RECT, mode int) error {
+	if mode == RGN_COPY && len(rects) == 0 {
+		if w32.ExtSelectClipRgn(d.MDC, 0, mode) == w32.ERROR {
+			return errors.New("failed to run ExtSelectClipRgn")
+		}
+		return nil
+	}
+
+	hrgn, err := createRgn(rects)
+	if err != nil {
+		return err
+	}
+	defer w32.DeleteObject(w32.HGDIOBJ(hrgn))
+
+	if w32.ExtSelectClipRgn(d.MDC, hrgn, mode) == w32.ERROR {
+		return errors.New("failed to run ExtSelectClipRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) OffsetClipRgn(x, y int) error {
+	if w32.OffsetClipRgn(d.MDC, x, y) == w32.ERROR {
+		return errors.New("failed to run OffsetClipRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetMetaRgn() error {
+	if w32.SetMetaRgn(d.MDC) == w32.ERROR {
+		return errors.New("failed to run SetMetaRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) GetClipRgn() (*Region, error) {
+	return d.getRgn(w32.GetClipRgn, "GetClipRgn")
+}
+
+func (d *GdiDevice) GetMetaRgn() (*Region, error) {
+	rgn, err := d.getRgn(func(hdc w32.HDC, hrgn w32.HRGN) int {
+		if w32.GetMetaRgn(hdc, hrgn) == 0 {
+			return -1
+		}
+		return 1
+	}, "GetMetaRgn")
+
+	// GDI returns an empty region when there is no meta region
+	if rgn.Empty() {
+		return nil, err
+	}
+	return rgn, err
+}
+
+// getRgn reads the region which get copies, get returns 0 when there is no
+// region and -1 on error as GetClipRgn does.
+func (d *GdiDevice) getRgn(get func(w32.HDC, w32.HRGN) int, name string) (*Region, error) {
+	hrgn := w32.CreateRectRgn(0, 0, 0, 0)
+	if hrgn == 0 {
+		return nil, errors.New("failed to run CreateRectRgn")
+	}
+	defer w32.DeleteObject(w32.HGDIOBJ(hrgn))
+
+	switch get(d.MDC, hrgn) {
+	case 0:
+		return nil, nil
+	case -1:
+		return nil, fmt.Errorf("failed to run %s", name)
+	}
+
+	data := make([]byte, w32.GetRegionData(hrgn, nil))
+	if len(data) == 0 || w32.GetRegionData(hrgn, data) == 0 {
+		return nil, errors.New("failed to run GetRegionData")
+	}
+
+	rgn, err := readRegionData(bytes.NewReader(data), uint32(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return NewRegion(rgn.Data...), nil
+}
+
+func (d *GdiDevice) BeginPath() error {
+	if !w32.BeginPath(d.MDC) {
+		return errors.New("failed to run BeginPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) EndPath() error {
+	if !w32.EndPath(d.MDC) {
+		return errors.New("failed to run EndPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) AbortPath() error {
+	if !w32.AbortPath(d.MDC) {
+		return errors.New("failed to run AbortPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) CloseFigure() error {
+	if !w32.CloseFigure(d.MDC) {
+		return errors.New("failed to run CloseFigure")
+	}
+	return nil
+}
+
+func (d *GdiDevice) FillPath() error {
+	if !w32.FillPath(d.MDC) {
+		return errors.New("failed to run FillPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) StrokePath() error {
+	if !w32.StrokePath(d.MDC) {
+		return errors.New("failed to run StrokePath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) FlattenPath() error {
+	if !w32.FlattenPath(d.MDC) {
+		return errors.New("failed to run FlattenPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) WidenPath() error {
+	if !w32.WidenPath(d.MDC) {
+		return errors.New("failed to run WidenPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) StrokeAndFillPath() error {
+	if !w32.StrokeAndFillPath(d.MDC) {
+		return errors.New("failed to run StrokeAndFillPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SelectClipPath(mode int) error {
+	if !w32.SelectClipPath(d.MDC, mode) {
+		return errors.New("failed to run SelectClipPath")
+	}
+	return nil
+}
+
+func (d *GdiDevice) MoveToEx(x, y int) error {
+	if !w32.MoveToEx(d.MDC, x, y, nil) {
+		return errors.New("failed to run MoveToEx")
+	}
+	return nil
+}
+
+func (d *GdiDevice) LineTo(x, y int) error {
+	if !w32.LineTo(d.MDC, x, y) {
+		return errors.New("failed to run LineTo")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Polyline(points []w32.POINT) error {
+	if !w32.Polyline(d.MDC, points, len(points)) {
+		return errors.New("failed to run Polyline")
+	}
+	return nil
+}
+
+func (d *GdiDevice) PolylineTo(points []w32.POINT) error {
+	if !w32.PolylineTo(d.MDC, points, w32.DWORD(len(points))) {
+		return errors.New("failed to run PolylineTo")
+	}
+	return nil
+}
+
+func (d *GdiDevice) PolyBezier(points []w32.POINT) error {
+	if !w32.PolyBezier(d.MDC, points, w32.DWORD(len(points))) {
+		return errors.New("failed to run PolyBezier")
+	}
+	return nil
+}
+
+func (d *GdiDevice) PolyBezierTo(points []w32.POINT) error {
+	if !w32.PolyBezierTo(d.MDC, points, w32.DWORD(len(points))) {
+		return errors.New("failed to run PolyBezierTo")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Polygon(points []w32.POINT) error {
+	if !w32.Polygon(d.MDC, points, len(points)) {
+		return errors.New("failed to run Polygon")
+	}
+	return nil
+}
+
+func (d *GdiDevice) PolyPolygon(points []w32.POINT, counts []int) error {
+	asz := make([]w32.INT, len(counts))
+	for idx := range counts {
+		asz[idx] = w32.INT(counts[idx])
+	}
+
+	if !w32.PolyPolygon(d.MDC, points, asz, len(asz)) {
+		return errors.New("failed to run PolyPolygon")
+	}
+	return nil
+}
+
+func (d *GdiDevice) PolyDraw(points []w32.POINT, types []byte) error {
+	if !w32.PolyDraw(d.MDC, points, types, len(points)) {
+		return errors.New("failed to run PolyDraw")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Rectangle(left, top, right, bottom int) error {
+	if !w32.Rectangle(d.MDC, left, top, right, bottom) {
+		return errors.New("failed to run Rectangle")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	if !w32.Arc(d.MDC, left, top, right, bottom, xStart, yStart, xEnd, yEnd) {
+		return errors.New("failed to run Arc")
+	}
+	return nil
+}
+
+func (d *GdiDevice) ArcTo(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	if !w32.ArcTo(d.MDC, left, top, right, bottom, xStart, yStart, xEnd, yEnd) {
+		return errors.New("failed to run ArcTo")
+	}
+	return nil
+}
+
+func (d *GdiDevice) AngleArc(x, y int, radius uint32, startAngle, sweepAngle float32) error {
+	if !w32.AngleArc(d.MDC, x, y, int(radius), startAngle, sweepAngle) {
+		return errors.New("failed to run AngleArc")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Chord(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	if !w32.Chord(d.MDC, left, top, right, bottom, xStart, yStart, xEnd, yEnd) {
+		return errors.New("failed to run Chord")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Pie(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	if !w32.Pie(d.MDC, left, top, right, bottom, xStart, yStart, xEnd, yEnd) {
+		return errors.New("failed to run Pie")
+	}
+	return nil
+}
+
+func (d *GdiDevice) Ellipse(left, top, right, bottom int) error {
+	if !w32.Ellipse(d.MDC, left, top, right, bottom) {
+		return errors.New("failed to run Ellipse")
+	}
+	return nil
+}
+
+func (d *GdiDevice) RoundRect(left, top, right, bottom, width, height int) error {
+	if !w32.RoundRect(d.MDC, left, top, right, bottom, width, height) {
+		return errors.New("failed to run RoundRect")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetPixelV(x, y int, color w32.COLORREF) error {
+	if !w32.SetPixelV(d.MDC, x, y, color) {
+		return errors.New("failed to run SetPixelV")
+	}
+	return nil
+}
+
+// createRgn returns the union of the rectangles as a region, which the
+// caller deletes.
+func createRgn(rects []w32.RECT) (w32.HRGN, error) {
+	hrgn := w32.CreateRectRgn(0, 0, 0, 0)
+	if hrgn == 0 {
+		return 0, errors.New("failed to run CreateRectRgn")
+	}
+
+	for idx := range rects {
+		rc := w32.CreateRectRgnIndirect(&rects[idx])
+		ret := w32.CombineRgn(hrgn, hrgn, rc, w32.RGN_OR)
+		w32.DeleteObject(w32.HGDIOBJ(rc))
+		if ret == w32.ERROR {
+			w32.DeleteObject(w32.HGDIOBJ(hrgn))
+			return 0, errors.New("failed to run CombineRgn")
+		}
+	}
+
+	return hrgn, nil
+}
+
+func (d *GdiDevice) FillRgn(rects []w32.RECT, brush interface{}) error {
+	hbrush, ok := brush.(w32.HBRUSH)
+	if !ok {
+		return errors.New("Unknown type of object")
+	}
+
+	hrgn, err := createRgn(rects)
+	if err != nil {
+		return err
+	}
+	defer w32.DeleteObject(w32.HGDIOBJ(hrgn))
+
+	if !w32.FillRgn(d.MDC, hrgn, hbrush) {
+		return errors.New("failed to run FillRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) FrameRgn(rects []w32.RECT, brush interface{}, width, height int) error {
+	hbrush, ok := brush.(w32.HBRUSH)
+	if !ok {
+		return errors.New("Unknown type of object")
+	}
+
+	hrgn, err := createRgn(rects)
+	if err != nil {
+		return err
+	}
+	defer w32.DeleteObject(w32.HGDIOBJ(hrgn))
+
+	if !w32.FrameRgn(d.MDC, hrgn, hbrush, width, height) {
+		return errors.New("failed to run FrameRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) InvertRgn(rects []w32.RECT) error {
+	hrgn, err := createRgn(rects)
+	if err != nil {
+		return err
+	}
+	defer w32.DeleteObject(w32.HGDIOBJ(hrgn))
+
+	if !w32.InvertRgn(d.MDC, hrgn) {
+		return errors.New("failed to run InvertRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) PaintRgn(rects []w32.RECT) error {
+	hrgn, err := createRgn(rects)
+	if err != nil {
+		return err
+	}
+	defer w32.DeleteObject(w32.HGDIOBJ(hrgn))
+
+	if !w32.PaintRgn(d.MDC, hrgn) {
+		return errors.New("failed to run PaintRgn")
+	}
+	return nil
+}
+
+func (d *GdiDevice) ExtTextOut(x, y int, options uint32, rect *w32.RECT, text []uint16, dx []int32) error {
+	lpDx := make([]w32.INT, len(dx))
+	for idx := range dx {
+		lpDx[idx] = w32.INT(dx[idx])
+	}
+
+	if !w32.ExtTextOutW(d.MDC, x, y, w32.UINT(options), rect, text, w32.UINT(len(text)), lpDx) {
+		return errors.New("failed to run ExtTextOutW")
+	}
+	return nil
+}
+
+// compatibleBitmap converts src to the color depth of the device.
+func (d *GdiDevice) compatibleBitmap(src *Bitmap) (w32.BITMAPINFO, []byte) {
+	info := src.Info
+	bits := PixelConvert(src.Bits, int(info.BiWidth), int(-info.BiHeight), int(info.BiBitCount), d.BitCount)
+	info.BiBitCount = uint16(d.BitCount)
+	return info, bits
+}
+
+func (d *GdiDevice) BitBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc int, rop uint32) error {
+	if src == nil {
+		return nil
+	}
+
+	info, bits := d.compatibleBitmap(src)
+
+	hbitmap := w32.CreateBitmap(xSrc, ySrc, w32.UINT(info.BiPlanes), w32.UINT(info.BiBitCount), bits)
+	srcDC := w32.CreateCompatibleDC(d.MDC)
+	w32.SelectObject(srcDC, w32.HGDIOBJ(hbitmap))
+
+	defer func() {
+		w32.DeleteObject(w32.HGDIOBJ(hbitmap))
+		w32.DeleteDC(srcDC)
+	}()
+
+	if !w32.BitBlt(d.MDC, x, y, cx, cy, srcDC, xSrc, ySrc, w32.DWORD(rop)) {
+		return errors.New("failed to run BitBlt")
+	}
+	return nil
+}
+
+func (d *GdiDevice) StretchBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, cxSrc, cySrc int, rop uint32) error {
+	if src == nil {
+		return nil
+	}
+
+	info, bits := d.compatibleBitmap(src)
+
+	hbitmap := w32.CreateBitmap(xSrc, ySrc, w32.UINT(info.BiPlanes), w32.UINT(info.BiBitCount), bits)
+	srcDC := w32.CreateCompatibleDC(d.MDC)
+	w32.SelectObject(srcDC, w32.HGDIOBJ(hbitmap))
+
+	defer func() {
+		w32.DeleteObject(w32.HGDIOBJ(hbitmap))
+		w32.DeleteDC(srcDC)
+	}()
+
+	if !w32.StretchBlt(d.MDC, x, y, cx, cy, srcDC, xSrc, ySrc, cxSrc, cySrc, w32.DWORD(rop)) {
+		return errors.New("failed to run StretchBlt")
+	}
+	return nil
+}
+
+func (d *GdiDevice) MaskBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc int, mask *Bitmap, xMask, yMask int, rop uint32) error {
+	if src == nil || mask == nil {
+		return nil
+	}
+
+	info, bits := d.compatibleBitmap(src)
+
+	hbitmap := w32.CreateBitmap(xSrc, ySrc, w32.UINT(info.BiPlanes), w32.UINT(info.BiBitCount), bits)
+	srcDC := w32.CreateCompatibleDC(d.MDC)
+	w32.SelectObject(srcDC, w32.HGDIOBJ(hbitmap))
+
+	maskBitmap := w32.CreateBitmap(int(mask.Info.BiWidth), int(-mask.Info.BiHeight), w32.UINT(mask.Info.BiPlanes), w32.UINT(mask.Info.BiBitCount), mask.Bits)
+
+	defer func() {
+		w32.DeleteObject(w32.HGDIOBJ(hbitmap))
+		w32.DeleteObject(w32.HGDIOBJ(maskBitmap))
+		w32.DeleteDC(srcDC)
+	}()
+
+	if !w32.MaskBlt(
+		d.MDC, x, y, cx, cy, // dest
+		srcDC, xSrc, ySrc, // src
+		maskBitmap, xMask, yMask, // mask
+		w32.DWORD(rop)) {
+		return errors.New("failed to run MaskBlt")
+	}
+	return nil
+}
+
+func (d *GdiDevice) StretchDIBits(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, cxSrc, cySrc int, usage, rop uint32) error {
+	if src == nil {
+		return nil
+	}
+
+	info, bits := d.compatibleBitmap(src)
+
+	if w32.StretchDIBits(
+		d.MDC, x, y, cx, cy, // dest
+		xSrc, ySrc, cxSrc, cySrc, bits, &info, // src
+		w32.UINT(usage), w32.DWORD(rop)) == 0 {
+		return errors.New("failed to run StretchDIBits")
+	}
+	return nil
+}
+
+func (d *GdiDevice) SetDIBitsToDevice(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, startScan, scans int, usage uint32) error {
+	if src == nil {
+		return nil
+	}
+
+	info, bits := d.compatibleBitmap(src)
+
+	if w32.SetDIBitsToDevice(
+		d.MDC, x, y, w32.DWORD(cx), w32.DWORD(cy), // dest
+		xSrc, ySrc, w32.UINT(startScan), w32.UINT(scans), bits, &info, // src
+		w32.UINT(usage)) == 0 {
+		return errors.New("failed to run SetDIBitsToDevice")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package emf
+
+import (
+	"github.com/lokks307/go-emf/w32"
+)
+
+// newDevice returns the software device, gdi32 only exists on Windows.
+func newDevice(window w32.SIZE) Device {
+	return NewRasterDevice(int(window.CX), int(window.CY))
+}
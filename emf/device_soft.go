@@ -0,0 +1,1681 @@
+package emf
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/font/sfnt"
+)
+
+type softPen struct {
+	Style     uint32 // PS_* line style
+	Width     float64
+	Color     w32.COLORREF
+	Geometric bool      // width and dashes are in logical units, otherwise in pixels
+	Dashes    []float64 // nil for solid lines
+	Cap       raster.LineCap
+	Join      raster.LineJoin
+}
+
+type softBrush struct {
+	Style uint32
+	Color w32.COLORREF
+	Hatch uint32
+}
+
+type softFont struct {
+	LogFont w32.LOGFONT
+	face    *fontFace
+	match   FontMatch // of the face, which glyph indices must not be substituted
+}
+
+type softPalette struct {
+	Entries []w32.COLORREF
+}
+
+// softState is the part of the device context saved by SaveDC.
+type softState struct {
+	mapping
+
+	pen     *softPen
+	brush   *softBrush
+	font    *softFont
+	palette *softPalette
+
+	bkMode       int
+	bkColor      w32.COLORREF
+	textColor    w32.COLORREF
+	textAlign    uint32
+	polyFillMode int
+	arcDirection int
+	rop2         int
+	stretchMode  int
+	miterLimit   float64
+	brushOrg     raster.Point
+	cur          raster.Point // current position in logical units
+
+	clip *clipRegion
+	meta *clipRegion
+}
+
+// softDevice emulates a GDI device context in Go and hands the resulting
+// device space shapes to a painter. World transforms are always honored, as
+// in GM_ADVANCED.
+type softDevice struct {
+	painter painter
+	width   int
+	height  int
+	stock   map[uint32]interface{}
+	fonts   *FontResolver
+	report  *fontReport // of the faces substituted, nil without a context
+	limits  *Limits     // of the regions combined
+
+	// graphics mode of the text record drawn, the glyphs follow the
+	// orientation of the font in GM_ADVANCED
+	textMode int
+
+	state softState
+	saved []softState
+
+	path    *raster.Path // in device units
+	inPath  bool
+	widened bool // the path is made of overlapping pieces of a widened path
+
+	clipCache struct {
+		clip, meta, region *clipRegion
+	}
+}
+
+func newSoftDevice(width, height int, p painter) *softDevice {
+	d := &softDevice{
+		painter: p,
+		width:   width,
+		height:  height,
+		fonts:   DefaultFontResolver,
+		limits:  &DefaultLimits,
+	}
+
+	systemFont := w32.LOGFONT{Height: 16, Weight: w32.FW_BOLD}
+	systemFont.SetFaceName("System")
+	fixedFont := w32.LOGFONT{Height: 12, Weight: w32.FW_NORMAL, PitchAndFamily: FIXED_PITCH | FF_MODERN<<4}
+	fixedFont.SetFaceName("Courier")
+	guiFont := w32.LOGFONT{Height: -11, Weight: w32.FW_NORMAL}
+	guiFont.SetFaceName("MS Shell Dlg")
+
+	d.stock = map[uint32]interface{}{
+		WHITE_BRUSH:         &softBrush{Style: BS_SOLID, Color: 0xFFFFFF},
+		LTGRAY_BRUSH:        &softBrush{Style: BS_SOLID, Color: 0xC0C0C0},
+		GRAY_BRUSH:          &softBrush{Style: BS_SOLID, Color: 0x808080},
+		DKGRAY_BRUSH:        &softBrush{Style: BS_SOLID, Color: 0x404040},
+		BLACK_BRUSH:         &softBrush{Style: BS_SOLID, Color: 0x000000},
+		NULL_BRUSH:          &softBrush{Style: BS_NULL},
+		DC_BRUSH:            &softBrush{Style: BS_SOLID, Color: 0xFFFFFF},
+		WHITE_PEN:           &softPen{Style: PS_SOLID, Color: 0xFFFFFF, Cap: raster.CapFlat},
+		BLACK_PEN:           &softPen{Style: PS_SOLID, Color: 0x000000, Cap: raster.CapFlat},
+		NULL_PEN:            &softPen{Style: PS_NULL},
+		DC_PEN:              &softPen{Style: PS_SOLID, Color: 0x000000, Cap: raster.CapFlat},
+		OEM_FIXED_FONT:      d.CreateFontIndirect(fixedFont),
+		ANSI_FIXED_FONT:     d.CreateFontIndirect(fixedFont),
+		ANSI_VAR_FONT:       d.CreateFontIndirect(guiFont),
+		SYSTEM_FONT:         d.CreateFontIndirect(systemFont),
+		DEVICE_DEFAULT_FONT: d.CreateFontIndirect(systemFont),
+		SYSTEM_FIXED_FONT:   d.CreateFontIndirect(fixedFont),
+		DEFAULT_GUI_FONT:    d.CreateFontIndirect(guiFont),
+		DEFAULT_PALETTE:     &softPalette{},
+	}
+
+	d.state = softState{
+		mapping:      newMapping(width, height),
+		pen:          d.stock[BLACK_PEN].(*softPen),
+		brush:        d.stock[WHITE_BRUSH].(*softBrush),
+		font:         d.stock[SYSTEM_FONT].(*softFont),
+		palette:      d.stock[DEFAULT_PALETTE].(*softPalette),
+		bkMode:       OPAQUE,
+		bkColor:      0xFFFFFF,
+		textColor:    0x000000,
+		polyFillMode: ALTERNATE,
+		arcDirection: AD_COUNTERCLOCKWISE,
+		rop2:         R2_COPYPEN,
+		stretchMode:  w32.BLACKONWHITE,
+		miterLimit:   10,
+	}
+
+	p.Clear(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+
+	return d
+}
+
+func (d *softDevice) Release() {}
+
+func (d *softDevice) GraphicsMode() int {
+	return w32.GM_ADVANCED
+}
+
+func (d *softDevice) Image() (*image.RGBA, error) {
+	return d.painter.Image()
+}
+
+// plusPainter lets EMF+ records draw in the device space of the EMF records.
+func (d *softDevice) plusPainter() (painter, int, int) {
+	return d.painter, d.width, d.height
+}
+
+// matrix returns the mapping from logical units to device units.
+func (d *softDevice) matrix() raster.Matrix {
+	return d.state.matrix()
+}
+
+func (d *softDevice) setPixelSize(size raster.Point) {
+	d.state.pixel = size
+}
+
+func (d *softDevice) point(x, y int) raster.Point {
+	return d.matrix().Apply(raster.Pt(float64(x), float64(y)))
+}
+
+func (d *softDevice) colorOf(c w32.COLORREF) color.RGBA {
+	// 0x01 in the high byte selects an entry of the logical palette
+	if c>>24 == 0x01 && d.state.palette != nil {
+		if idx := int(c & 0xFFFF); idx < len(d.state.palette.Entries) {
+			c = d.state.palette.Entries[idx]
+		}
+	}
+
+	return color.RGBA{uint8(c), uint8(c >> 8), uint8(c >> 16), 0xFF}
+}
+
+func (d *softDevice) StockObject(ih uint32) (interface{}, bool) {
+	object, ok := d.stock[ih]
+	return object, ok
+}
+
+func cosmeticDashes(style uint32) []float64 {
+	switch style {
+	case PS_DASH:
+		return []float64{18, 6}
+	case PS_DOT:
+		return []float64{3, 3}
+	case PS_DASHDOT:
+		return []float64{9, 6, 3, 6}
+	case PS_DASHDOTDOT:
+		return []float64{9, 3, 3, 3, 3, 3}
+	case PS_ALTERNATE:
+		return []float64{1, 1}
+	}
+	return nil
+}
+
+func (d *softDevice) CreatePen(pen w32.LOGPEN) interface{} {
+	p := &softPen{
+		Style: pen.PenStyle & w32.PS_STYLE_MASK,
+		Color: pen.ColorRef,
+		Cap:   raster.CapRound,
+		Join:  raster.JoinRound,
+	}
+
+	if pen.Width.X > 1 {
+		// wide pens are always solid
+		p.Width = float64(pen.Width.X)
+		p.Geometric = true
+		if p.Style != PS_NULL {
+			p.Style = PS_SOLID
+		}
+	} else {
+		p.Width = float64(pen.Width.X)
+		p.Dashes = cosmeticDashes(p.Style)
+		if p.Dashes != nil {
+			p.Cap = raster.CapFlat
+		}
+	}
+
+	return p
+}
+
+func (d *softDevice) ExtCreatePen(pen w32.LOGPENEX) interface{} {
+	p := &softPen{
+		Style: pen.PenStyle & w32.PS_STYLE_MASK,
+		Color: pen.ColorRef,
+	}
+
+	if pen.BrushStyle == BS_NULL {
+		p.Style = PS_NULL
+	}
+
+	switch pen.PenStyle & w32.PS_ENDCAP_MASK {
+	case PS_ENDCAP_SQUARE:
+		p.Cap = raster.CapSquare
+	case PS_ENDCAP_FLAT:
+		p.Cap = raster.CapFlat
+	default:
+		p.Cap = raster.CapRound
+	}
+
+	switch pen.PenStyle & w32.PS_JOIN_MASK {
+	case PS_JOIN_BEVEL:
+		p.Join = raster.JoinBevel
+	case PS_JOIN_MITER:
+		p.Join = raster.JoinMiter
+	default:
+		p.Join = raster.JoinRound
+	}
+
+	if pen.PenStyle&w32.PS_TYPE_MASK != PS_GEOMETRIC {
+		p.Cap = raster.CapFlat
+		p.Dashes = cosmeticDashes(p.Style)
+		if p.Style == PS_USERSTYLE {
+			for _, v := range pen.StyleEntry {
+				p.Dashes = append(p.Dashes, float64(v))
+			}
+		}
+		return p
+	}
+
+	p.Width = float64(pen.Width)
+	p.Geometric = true
+
+	w := math.Max(p.Width, 1)
+	switch p.Style {
+	case PS_DASH:
+		p.Dashes = []float64{3 * w, w}
+	case PS_DOT:
+		p.Dashes = []float64{w, w}
+	case PS_DASHDOT:
+		p.Dashes = []float64{3 * w, w, w, w}
+	case PS_DASHDOTDOT:
+		p.Dashes = []float64{3 * w, w, w, w, w, w}
+	case PS_USERSTYLE:
+		for _, v := range pen.StyleEntry {
+			p.Dashes = append(p.Dashes, float64(v))
+		}
+	}
+
+	return p
+}
+
+func (d *softDevice) CreateBrushIndirect(brush w32.LOGBRUSH) interface{} {
+	return &softBrush{Style: brush.BrushStyle, Color: brush.Color, Hatch: brush.BrushHatch}
+}
+
+// CreateFontIndirect returns a font whose face is resolved when it first
+// draws text.
+func (d *softDevice) CreateFontIndirect(font w32.LOGFONT) interface{} {
+	return &softFont{LogFont: font}
+}
+
+func (d *softDevice) setFonts(fonts *FontResolver) {
+	d.fonts = fonts
+}
+
+func (d *softDevice) setFontReport(report *fontReport) {
+	d.report = report
+}
+
+func (d *softDevice) setLimits(limits *Limits) {
+	d.limits = limits
+}
+
+// setTextMode sets the graphics mode the next text was recorded in.
+func (d *softDevice) setTextMode(mode int) {
+	d.textMode = mode
+}
+
+func (d *softDevice) CreatePalette(palette w32.LOGPALETTE) interface{} {
+	return &softPalette{Entries: palette.PaletteEntries}
+}
+
+func (d *softDevice) SelectObject(object interface{}) error {
+	switch object := object.(type) {
+	case *softPen:
+		d.state.pen = object
+	case *softBrush:
+		d.state.brush = object
+	case *softFont:
+		d.state.font = object
+	default:
+		return errors.New("Unknown type of object")
+	}
+
+	return nil
+}
+
+func (d *softDevice) SelectPalette(object interface{}) error {
+	palette, ok := object.(*softPalette)
+	if !ok {
+		return errors.New("Unknown type of object")
+	}
+
+	d.state.palette = palette
+	return nil
+}
+
+func (d *softDevice) DeleteObject(object interface{}) error {
+	return nil
+}
+
+func (d *softDevice) SaveDC() error {
+	d.saved = append(d.saved, d.state)
+	return nil
+}
+
+func (d *softDevice) RestoreDC(savedDC int) error {
+	idx := savedDC - 1
+	if savedDC < 0 {
+		idx = len(d.saved) + savedDC
+	}
+
+	if idx < 0 || idx >= len(d.saved) {
+		return errors.New("failed to run RestoreDC")
+	}
+
+	d.state = d.saved[idx]
+	d.saved = d.saved[:idx]
+
+	return nil
+}
+
+func (d *softDevice) SetMapMode(mode int) error {
+	return d.state.setMapMode(mode)
+}
+
+func (d *softDevice) SetWindowExtEx(cx, cy int) error {
+	return d.state.setWindowExt(cx, cy)
+}
+
+func (d *softDevice) SetWindowOrgEx(x, y int) error {
+	d.state.windowOrg = raster.Pt(float64(x), float64(y))
+	return nil
+}
+
+func (d *softDevice) SetViewportExtEx(cx, cy int) error {
+	return d.state.setViewportExt(cx, cy)
+}
+
+func (d *softDevice) SetViewportOrgEx(x, y int) error {
+	d.state.viewportOrg = raster.Pt(float64(x), float64(y))
+	return nil
+}
+
+func (d *softDevice) ScaleWindowExtEx(xNum, xDenom, yNum, yDenom int) error {
+	return d.state.scaleExt(&d.state.windowExt, xNum, xDenom, yNum, yDenom)
+}
+
+func (d *softDevice) ScaleViewportExtEx(xNum, xDenom, yNum, yDenom int) error {
+	return d.state.scaleExt(&d.state.viewportExt, xNum, xDenom, yNum, yDenom)
+}
+
+func (d *softDevice) SetWorldTransform(xform w32.XFORM) error {
+	return d.state.setWorld(xform)
+}
+
+func (d *softDevice) ModifyWorldTransform(xform w32.XFORM, mode uint32) error {
+	return d.state.modifyWorld(xform, mode)
+}
+
+func (d *softDevice) SetBkMode(mode int) error {
+	d.state.bkMode = mode
+	return nil
+}
+
+func (d *softDevice) SetBkColor(color w32.COLORREF) error {
+	d.state.bkColor = color
+	return nil
+}
+
+func (d *softDevice) SetTextColor(color w32.COLORREF) error {
+	d.state.textColor = color
+	return nil
+}
+
+func (d *softDevice) SetTextAlign(align uint32) error {
+	d.state.textAlign = align
+	return nil
+}
+
+func (d *softDevice) GetTextCharset() int {
+	if d.state.font == nil {
+		return int(ANSI_CHARSET)
+	}
+	return int(d.state.font.LogFont.CharSet)
+}
+
+func (d *softDevice) SetTextJustification(extra, count int) error {
+	return nil
+}
+
+func (d *softDevice) SetPolyFillMode(mode int) error {
+	d.state.polyFillMode = mode
+	return nil
+}
+
+func (d *softDevice) SetArcDirection(dir int) error {
+	if dir != AD_COUNTERCLOCKWISE && dir != AD_CLOCKWISE {
+		return errors.New("failed to run SetArcDirection")
+	}
+
+	d.state.arcDirection = dir
+	return nil
+}
+
+func (d *softDevice) SetROP2(mode int) error {
+	d.state.rop2 = mode
+	return nil
+}
+
+func (d *softDevice) SetStretchBltMode(mode int) error {
+	d.state.stretchMode = mode
+	return nil
+}
+
+func (d *softDevice) SetMapperFlags(flags uint32) error {
+	return nil
+}
+
+func (d *softDevice) SetMiterLimit(limit float32) error {
+	d.state.miterLimit = float64(limit)
+	return nil
+}
+
+func (d *softDevice) SetBrushOrgEx(x, y int) error {
+	d.state.brushOrg = raster.Pt(float64(x), float64(y))
+	return nil
+}
+
+func (d *softDevice) fillRule() raster.FillRule {
+	if d.state.polyFillMode == WINDING {
+		return raster.NonZero
+	}
+	return raster.EvenOdd
+}
+
+// clipRegion returns the intersection of the meta region and the clip
+// region.
+func (d *softDevice) clipRegion() *clipRegion {
+	c := &d.clipCache
+	if c.clip != d.state.clip || c.meta != d.state.meta || (c.region == nil && (c.clip != nil || c.meta != nil)) {
+		c.clip, c.meta = d.state.clip, d.state.meta
+		c.region = d.state.meta.intersectRegion(d.state.clip)
+	}
+	return c.region
+}
+
+// rectPath returns the closed device space outline of a rectangle given in
+// the coordinates m maps from, always turning clockwise on screen.
+func rectPath(m raster.Matrix, left, top, right, bottom float64) *raster.Path {
+	pts := []raster.Point{
+		m.Apply(raster.Pt(left, top)),
+		m.Apply(raster.Pt(right, top)),
+		m.Apply(raster.Pt(right, bottom)),
+		m.Apply(raster.Pt(left, bottom)),
+	}
+
+	flipped := (right < left) != (bottom < top)
+	if m.Det() < 0 {
+		flipped = !flipped
+	}
+	if flipped {
+		pts[1], pts[3] = pts[3], pts[1]
+	}
+
+	p := &raster.Path{}
+	p.MoveTo(pts[0])
+	for _, pt := range pts[1:] {
+		p.LineTo(pt)
+	}
+	p.Close()
+
+	return p
+}
+
+func rectsPath(m raster.Matrix, rects []w32.RECT) *raster.Path {
+	p := &raster.Path{}
+	for _, r := range rects {
+		p.Append(rectPath(m, float64(r.Left), float64(r.Top), float64(r.Right), float64(r.Bottom)))
+	}
+	return p
+}
+
+// combineClip combines the clip region with a device space shape in an
+// RGN_* mode. Regions of rectangles combine exactly in every mode, as the
+// regions of GDI do. Other shapes stay paths with RGN_COPY, RGN_AND and
+// RGN_DIFF, and become the pixels they cover with RGN_OR and RGN_XOR.
+func (d *softDevice) combineClip(shape *clipRegion, mode int) error {
+	clip := d.state.clip
+
+	switch mode {
+	case RGN_COPY:
+		d.state.clip = shape
+	case RGN_AND:
+		d.state.clip = clip.intersectRegion(shape)
+	case RGN_DIFF:
+		if shape.rgn != nil && (clip == nil || clip.rgn != nil) {
+			d.state.clip = rectsClip(clip.region(d.width, d.height).Diff(shape.rgn))
+			break
+		}
+
+		path := &raster.Path{}
+		for _, part := range shape.parts {
+			path.Append(part.path)
+		}
+		d.state.clip = clip.intersect(d.complement(path), raster.EvenOdd)
+	case RGN_OR, RGN_XOR:
+		rgn, err := clip.region(d.width, d.height).combineMode(shape.region(d.width, d.height), mode, d.limits)
+		if err != nil {
+			return err
+		}
+		d.state.clip = rectsClip(rgn)
+	default:
+		return errors.New("invalid region mode")
+	}
+
+	return nil
+}
+
+// complement returns the part of the device outside of path, when filled
+// with EvenOdd.
+func (d *softDevice) complement(path *raster.Path) *raster.Path {
+	p := rectPath(raster.Identity(), 0, 0, float64(d.width), float64(d.height))
+	p.Append(path)
+	return p
+}
+
+// rectClip returns the shape of a rectangle in logical units, made of
+// device pixels unless the transform turns it.
+func (d *softDevice) rectClip(left, top, right, bottom int) *clipRegion {
+	m := d.matrix()
+	if m.B != 0 || m.C != 0 {
+		return (*clipRegion)(nil).intersect(rectPath(m, float64(left), float64(top), float64(right), float64(bottom)), raster.NonZero)
+	}
+
+	p0 := m.Apply(raster.Pt(float64(left), float64(top)))
+	p1 := m.Apply(raster.Pt(float64(right), float64(bottom)))
+
+	return rectsClip(NewRegion(w32.RECT{
+		Left:   int32(math.Round(p0.X)),
+		Top:    int32(math.Round(p0.Y)),
+		Right:  int32(math.Round(p1.X)),
+		Bottom: int32(math.Round(p1.Y)),
+	}))
+}
+
+func (d *softDevice) IntersectClipRect(left, top, right, bottom int) error {
+	return d.combineClip(d.rectClip(left, top, right, bottom), RGN_AND)
+}
+
+func (d *softDevice) ExcludeClipRect(left, top, right, bottom int) error {
+	return d.combineClip(d.rectClip(left, top, right, bottom), RGN_DIFF)
+}
+
+func (d *softDevice) ExtSelectClipRgn(rects []w32.RECT, mode int) error {
+	if mode == RGN_COPY && len(rects) == 0 {
+		d.state.clip = nil
+		return nil
+	}
+
+	rgn, err := newRegion(d.limits, rects...)
+	if err != nil {
+		return err
+	}
+
+	return d.combineClip(rectsClip(rgn), mode)
+}
+
+func (d *softDevice) OffsetClipRgn(x, y int) error {
+	v := d.state.page().ApplyVector(raster.Pt(float64(x), float64(y)))
+	if clip := d.state.clip; clip != nil && clip.rgn != nil {
+		// regions are made of whole pixels
+		v = raster.Pt(math.Round(v.X), math.Round(v.Y))
+	}
+
+	d.state.clip = d.state.clip.translate(v.X, v.Y)
+	return nil
+}
+
+func (d *softDevice) SetMetaRgn() error {
+	d.state.meta = d.state.meta.intersectRegion(d.state.clip)
+	d.state.clip = nil
+	return nil
+}
+
+func (d *softDevice) GetClipRgn() (*Region, error) {
+	if d.state.clip == nil {
+		return nil, nil
+	}
+	return d.state.clip.region(d.width, d.height), nil
+}
+
+func (d *softDevice) GetMetaRgn() (*Region, error) {
+	if d.state.meta == nil {
+		return nil, nil
+	}
+	return d.state.meta.region(d.width, d.height), nil
+}
+
+func (d *softDevice) BeginPath() error {
+	d.path = &raster.Path{}
+	d.inPath = true
+	d.widened = false
+	return nil
+}
+
+func (d *softDevice) EndPath() error {
+	if !d.inPath {
+		return errors.New("failed to run EndPath")
+	}
+
+	d.inPath = false
+	return nil
+}
+
+func (d *softDevice) AbortPath() error {
+	d.path = nil
+	d.inPath = false
+	d.widened = false
+	return nil
+}
+
+func (d *softDevice) CloseFigure() error {
+	if !d.inPath {
+		return errors.New("failed to run CloseFigure")
+	}
+
+	d.path.Close()
+	return nil
+}
+
+// closedPath returns the path defined by the last path bracket.
+func (d *softDevice) closedPath(name string) (*raster.Path, error) {
+	if d.inPath || d.path == nil {
+		return nil, errors.New("failed to run " + name)
+	}
+	return d.path, nil
+}
+
+// takePath returns the path defined by the last path bracket and its fill
+// rule, and discards it from the device.
+func (d *softDevice) takePath(name string) (*raster.Path, raster.FillRule, error) {
+	p, err := d.closedPath(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the pieces of a widened path overlap, which the winding rule unites
+	rule := d.fillRule()
+	if d.widened {
+		rule = raster.NonZero
+	}
+
+	d.path = nil
+	d.widened = false
+	return p, rule, nil
+}
+
+// FlattenPath replaces the curves of the path by line segments.
+func (d *softDevice) FlattenPath() error {
+	p, err := d.closedPath("FlattenPath")
+	if err != nil {
+		return err
+	}
+
+	d.path = polylinesPath(p.Flatten(raster.DefaultTolerance))
+	return nil
+}
+
+// WidenPath replaces the path by the outline of its stroke with the selected
+// pen.
+func (d *softDevice) WidenPath() error {
+	p, err := d.closedPath("WidenPath")
+	if err != nil {
+		return err
+	}
+
+	s, ok := d.penStroke()
+	if !ok {
+		return errors.New("failed to run WidenPath")
+	}
+
+	d.path = polylinesPath(s.Outline(p.Flatten(raster.DefaultTolerance)))
+	d.widened = true
+	return nil
+}
+
+// polylinesPath returns the path made of the polylines.
+func polylinesPath(lines []raster.Polyline) *raster.Path {
+	p := &raster.Path{}
+	for _, l := range lines {
+		for i, pt := range l.Points {
+			if i == 0 {
+				p.MoveTo(pt)
+			} else {
+				p.LineTo(pt)
+			}
+		}
+		if l.Closed {
+			p.Close()
+		}
+	}
+	return p
+}
+
+func (d *softDevice) FillPath() error {
+	p, rule, err := d.takePath("FillPath")
+	if err != nil {
+		return err
+	}
+
+	d.fill(p, rule)
+	return nil
+}
+
+func (d *softDevice) StrokePath() error {
+	p, _, err := d.takePath("StrokePath")
+	if err != nil {
+		return err
+	}
+
+	d.stroke(p)
+	return nil
+}
+
+func (d *softDevice) StrokeAndFillPath() error {
+	p, rule, err := d.takePath("StrokeAndFillPath")
+	if err != nil {
+		return err
+	}
+
+	d.fill(p, rule)
+	d.stroke(p)
+	return nil
+}
+
+func (d *softDevice) SelectClipPath(mode int) error {
+	p, rule, err := d.takePath("SelectClipPath")
+	if err != nil {
+		return err
+	}
+
+	return d.combineClip((*clipRegion)(nil).intersect(p, rule), mode)
+}
+
+// rop2 applies the binary raster operation to a solid color. The second
+// result is false when nothing has to be drawn.
+func (d *softDevice) rop2(c color.RGBA) (color.RGBA, bool) {
+	switch d.state.rop2 {
+	case R2_NOP:
+		return c, false
+	case R2_BLACK:
+		return color.RGBA{0, 0, 0, 0xFF}, true
+	case R2_WHITE:
+		return color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, true
+	case R2_NOTCOPYPEN:
+		return color.RGBA{^c.R, ^c.G, ^c.B, 0xFF}, true
+	}
+	return c, true
+}
+
+var hatchPatterns = map[uint32]func(x, y int) bool{
+	w32.HS_HORIZONTAL: func(x, y int) bool { return y == 7 },
+	w32.HS_VERTICAL:   func(x, y int) bool { return x == 7 },
+	w32.HS_FDIAGONAL:  func(x, y int) bool { return x == y },
+	w32.HS_BDIAGONAL:  func(x, y int) bool { return x+y == 7 },
+	w32.HS_CROSS:      func(x, y int) bool { return x == 7 || y == 7 },
+	w32.HS_DIAGCROSS:  func(x, y int) bool { return x == y || x+y == 7 },
+}
+
+// brushPaint returns the paint of a brush. The second result is false when
+// the brush draws nothing.
+func (d *softDevice) brushPaint(brush *softBrush) (paint, bool) {
+	if brush == nil || brush.Style == BS_NULL {
+		return paint{}, false
+	}
+
+	c, ok := d.rop2(d.colorOf(brush.Color))
+	if !ok {
+		return paint{}, false
+	}
+
+	hatch, ok := hatchPatterns[brush.Hatch]
+	if brush.Style != BS_HATCHED || !ok {
+		return paint{Color: c}, true
+	}
+
+	var bk color.RGBA
+	if d.state.bkMode == OPAQUE {
+		bk = d.colorOf(d.state.bkColor)
+	}
+
+	tile := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if hatch(x, y) {
+				tile.SetRGBA(x, y, c)
+			} else {
+				tile.SetRGBA(x, y, bk)
+			}
+		}
+	}
+
+	org := d.state.brushOrg
+	return paint{Color: c, Pattern: tile, Origin: image.Pt(int(org.X), int(org.Y))}, true
+}
+
+func (d *softDevice) fill(p *raster.Path, rule raster.FillRule) {
+	src, ok := d.brushPaint(d.state.brush)
+	if !ok {
+		return
+	}
+
+	d.painter.Fill(p, rule, src, d.clipRegion())
+}
+
+func (d *softDevice) stroke(p *raster.Path) {
+	s, ok := d.penStroke()
+	if !ok {
+		return
+	}
+
+	c, ok := d.rop2(d.colorOf(d.state.pen.Color))
+	if !ok {
+		return
+	}
+
+	d.painter.Stroke(p, s, paint{Color: c}, d.clipRegion())
+}
+
+// penStroke returns the stroke of the selected pen in device units. The
+// second result is false for the null pen.
+func (d *softDevice) penStroke() (raster.Stroke, bool) {
+	pen := d.state.pen
+	if pen == nil || pen.Style == PS_NULL {
+		return raster.Stroke{}, false
+	}
+
+	scale := d.matrix().ScaleFactor()
+
+	s := raster.Stroke{
+		Width:      1,
+		Cap:        pen.Cap,
+		Join:       pen.Join,
+		MiterLimit: d.state.miterLimit,
+	}
+
+	if pen.Width > 0 {
+		s.Width = math.Max(1, pen.Width*scale)
+	}
+
+	for _, v := range pen.Dashes {
+		if pen.Geometric {
+			v *= scale
+		}
+		s.Dashes = append(s.Dashes, v)
+	}
+
+	return s, true
+}
+
+// draw adds a figure to the open path bracket, or paints it.
+func (d *softDevice) draw(p *raster.Path, fill, stroke bool) {
+	if d.inPath {
+		d.path.Append(p)
+		return
+	}
+
+	if fill {
+		d.fill(p, d.fillRule())
+	}
+	if stroke {
+		d.stroke(p)
+	}
+}
+
+// lineFrom returns a path starting at the current position. In a path
+// bracket the figure continues the open one.
+func (d *softDevice) lineFrom() *raster.Path {
+	start := d.matrix().Apply(d.state.cur)
+
+	if d.inPath {
+		if cur, ok := d.path.Current(); !ok || !d.path.Open() || cur != start {
+			d.path.MoveTo(start)
+		}
+		return d.path
+	}
+
+	p := &raster.Path{}
+	p.MoveTo(start)
+	return p
+}
+
+func (d *softDevice) MoveToEx(x, y int) error {
+	d.state.cur = raster.Pt(float64(x), float64(y))
+	return nil
+}
+
+func (d *softDevice) LineTo(x, y int) error {
+	p := d.lineFrom()
+	p.LineTo(d.point(x, y))
+	d.state.cur = raster.Pt(float64(x), float64(y))
+
+	if !d.inPath {
+		d.stroke(p)
+	}
+	return nil
+}
+
+func (d *softDevice) polyPath(points []w32.POINT, closed bool) *raster.Path {
+	m := d.matrix()
+	p := &raster.Path{}
+	for i, pt := range points {
+		v := m.Apply(raster.Pt(float64(pt.X), float64(pt.Y)))
+		if i == 0 {
+			p.MoveTo(v)
+		} else {
+			p.LineTo(v)
+		}
+	}
+	if closed && len(points) > 0 {
+		p.Close()
+	}
+	return p
+}
+
+func (d *softDevice) Polyline(points []w32.POINT) error {
+	if len(points) < 2 {
+		return errors.New("failed to run Polyline")
+	}
+
+	d.draw(d.polyPath(points, false), false, true)
+	return nil
+}
+
+func (d *softDevice) PolylineTo(points []w32.POINT) error {
+	if len(points) == 0 {
+		return errors.New("failed to run PolylineTo")
+	}
+
+	m := d.matrix()
+	p := d.lineFrom()
+	for _, pt := range points {
+		p.LineTo(m.Apply(raster.Pt(float64(pt.X), float64(pt.Y))))
+	}
+
+	last := points[len(points)-1]
+	d.state.cur = raster.Pt(float64(last.X), float64(last.Y))
+
+	if !d.inPath {
+		d.stroke(p)
+	}
+	return nil
+}
+
+func (d *softDevice) PolyBezier(points []w32.POINT) error {
+	if len(points) < 4 || (len(points)-1)%3 != 0 {
+		return errors.New("failed to run PolyBezier")
+	}
+
+	p := &raster.Path{}
+	p.MoveTo(d.point(int(points[0].X), int(points[0].Y)))
+	d.bezierTo(p, points[1:])
+
+	d.draw(p, false, true)
+	return nil
+}
+
+func (d *softDevice) PolyBezierTo(points []w32.POINT) error {
+	if len(points) < 3 || len(points)%3 != 0 {
+		return errors.New("failed to run PolyBezierTo")
+	}
+
+	p := d.lineFrom()
+	d.bezierTo(p, points)
+
+	last := points[len(points)-1]
+	d.state.cur = raster.Pt(float64(last.X), float64(last.Y))
+
+	if !d.inPath {
+		d.stroke(p)
+	}
+	return nil
+}
+
+func (d *softDevice) bezierTo(p *raster.Path, points []w32.POINT) {
+	m := d.matrix()
+	pt := func(v w32.POINT) raster.Point {
+		return m.Apply(raster.Pt(float64(v.X), float64(v.Y)))
+	}
+
+	for i := 0; i+2 < len(points); i += 3 {
+		p.CubeTo(pt(points[i]), pt(points[i+1]), pt(points[i+2]))
+	}
+}
+
+func (d *softDevice) Polygon(points []w32.POINT) error {
+	if len(points) < 2 {
+		return errors.New("failed to run Polygon")
+	}
+
+	d.draw(d.polyPath(points, true), true, true)
+	return nil
+}
+
+func (d *softDevice) PolyPolygon(points []w32.POINT, counts []int) error {
+	p := &raster.Path{}
+
+	start := 0
+	for _, n := range counts {
+		if n < 0 || start+n > len(points) {
+			return errors.New("failed to run PolyPolygon")
+		}
+		p.Append(d.polyPath(points[start:start+n], true))
+		start += n
+	}
+
+	d.draw(p, true, true)
+	return nil
+}
+
+// PolyDraw draws the lines and Bézier curves of the points from the current
+// position, starting a figure at every PT_MOVETO point. The current position
+// moves to the last point.
+func (d *softDevice) PolyDraw(points []w32.POINT, types []byte) error {
+	if len(points) == 0 || len(types) != len(points) {
+		return errors.New("failed to run PolyDraw")
+	}
+
+	// nothing is drawn when a Bézier curve lacks points
+	for i := 0; i < len(types); i++ {
+		switch types[i] &^ PT_CLOSEFIGURE {
+		case PT_MOVETO, PT_LINETO:
+		case PT_BEZIERTO:
+			if i+2 >= len(types) || types[i+1]&^PT_CLOSEFIGURE != PT_BEZIERTO || types[i+2]&^PT_CLOSEFIGURE != PT_BEZIERTO {
+				return errors.New("failed to run PolyDraw")
+			}
+			i += 2
+		default:
+			return errors.New("failed to run PolyDraw")
+		}
+	}
+
+	m := d.matrix()
+	pt := func(v w32.POINT) raster.Point {
+		return m.Apply(raster.Pt(float64(v.X), float64(v.Y)))
+	}
+
+	p := d.lineFrom()
+	for i := 0; i < len(points); i++ {
+		switch types[i] &^ PT_CLOSEFIGURE {
+		case PT_MOVETO:
+			p.MoveTo(pt(points[i]))
+		case PT_LINETO:
+			p.LineTo(pt(points[i]))
+		case PT_BEZIERTO:
+			p.CubeTo(pt(points[i]), pt(points[i+1]), pt(points[i+2]))
+			i += 2
+		}
+
+		if types[i]&PT_CLOSEFIGURE != 0 {
+			p.Close()
+		}
+	}
+
+	last := points[len(points)-1]
+	d.state.cur = raster.Pt(float64(last.X), float64(last.Y))
+
+	if !d.inPath {
+		d.stroke(p)
+	}
+	return nil
+}
+
+func (d *softDevice) Rectangle(left, top, right, bottom int) error {
+	p := rectPath(d.matrix(), float64(left), float64(top), float64(right), float64(bottom))
+
+	d.draw(p, true, true)
+	return nil
+}
+
+// arcAngles returns the start angle and the sweep of an arc of the ellipse
+// bounded by the box, between the radials to the start and end points. The
+// sweep is negative for counter-clockwise arcs, as the y axis points down.
+func arcAngles(center raster.Point, rx, ry float64, start, end raster.Point, clockwise bool) (float64, float64) {
+	angle := func(p raster.Point) float64 {
+		return math.Atan2((p.Y-center.Y)*rx, (p.X-center.X)*ry)
+	}
+
+	a0 := angle(start)
+	sweep := angle(end) - a0
+	if clockwise {
+		for sweep <= 0 {
+			sweep += 2 * math.Pi
+		}
+		for sweep > 2*math.Pi {
+			sweep -= 2 * math.Pi
+		}
+	} else {
+		for sweep >= 0 {
+			sweep -= 2 * math.Pi
+		}
+		for sweep < -2*math.Pi {
+			sweep += 2 * math.Pi
+		}
+	}
+
+	return a0, sweep
+}
+
+// softArc is an elliptical arc in logical units.
+type softArc struct {
+	center raster.Point
+	rx, ry float64
+	a0     float64
+	sweep  float64
+}
+
+// arc returns the arc of the ellipse bounded by the box in the current arc
+// direction, false when the box is empty.
+func (d *softDevice) arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) (softArc, bool) {
+	a := softArc{
+		center: raster.Pt(float64(left+right)/2, float64(top+bottom)/2),
+		rx:     math.Abs(float64(right-left)) / 2,
+		ry:     math.Abs(float64(bottom-top)) / 2,
+	}
+
+	if a.rx == 0 || a.ry == 0 {
+		return a, false
+	}
+
+	a.a0, a.sweep = arcAngles(a.center, a.rx, a.ry,
+		raster.Pt(float64(xStart), float64(yStart)), raster.Pt(float64(xEnd), float64(yEnd)),
+		d.state.arcDirection == AD_CLOCKWISE)
+	return a, true
+}
+
+// end returns the end point of the arc.
+func (a softArc) end() raster.Point {
+	s, c := math.Sincos(a.a0 + a.sweep)
+	return raster.Pt(a.center.X+a.rx*c, a.center.Y+a.ry*s)
+}
+
+// appendArc adds the arc to p, which is in device units. The arc is joined
+// by a line to the open figure of p.
+func (d *softDevice) appendArc(p *raster.Path, a softArc) {
+	q := &raster.Path{}
+	q.ArcToCubics(a.center, a.rx, a.ry, a.a0, a.sweep)
+
+	for _, seg := range q.Transform(d.matrix()).Segments {
+		switch seg.Op {
+		case raster.MoveTo:
+			if _, ok := p.Current(); ok && p.Open() {
+				p.LineTo(seg.Pts[0])
+			} else {
+				p.MoveTo(seg.Pts[0])
+			}
+		case raster.LineTo:
+			p.LineTo(seg.Pts[0])
+		case raster.CubeTo:
+			p.CubeTo(seg.Pts[0], seg.Pts[1], seg.Pts[2])
+		}
+	}
+}
+
+func (d *softDevice) Arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	a, ok := d.arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd)
+	if !ok {
+		return errors.New("failed to run Arc")
+	}
+
+	p := &raster.Path{}
+	d.appendArc(p, a)
+
+	d.draw(p, false, true)
+	return nil
+}
+
+// ArcTo draws a line from the current position to the start of the arc and
+// the arc, the current position moves to the end of the arc.
+func (d *softDevice) ArcTo(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	a, ok := d.arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd)
+	if !ok {
+		return errors.New("failed to run ArcTo")
+	}
+
+	p := d.lineFrom()
+	d.appendArc(p, a)
+	d.state.cur = a.end()
+
+	if !d.inPath {
+		d.stroke(p)
+	}
+	return nil
+}
+
+// AngleArc draws a line from the current position to the start of an arc of
+// the circle and the arc, the current position moves to the end of the arc.
+// The angles are in degrees counter-clockwise from the x axis, whatever the
+// arc direction.
+func (d *softDevice) AngleArc(x, y int, radius uint32, startAngle, sweepAngle float32) error {
+	// more than a full turn draws the circle, the sweep is clamped to
+	// one turn and the rest of it so that the arc still ends where it
+	// should without a curve per quarter turn
+	sweep := float64(sweepAngle)
+	if math.IsNaN(sweep) || math.IsInf(sweep, 0) {
+		sweep = 0
+	} else if math.Abs(sweep) > 360 {
+		sweep = math.Copysign(360+math.Mod(math.Abs(sweep), 360), sweep)
+	}
+
+	a := softArc{
+		center: raster.Pt(float64(x), float64(y)),
+		rx:     float64(radius),
+		ry:     float64(radius),
+		a0:     -float64(startAngle) * math.Pi / 180,
+		sweep:  -sweep * math.Pi / 180,
+	}
+
+	p := d.lineFrom()
+	d.appendArc(p, a)
+	d.state.cur = a.end()
+
+	if !d.inPath {
+		d.stroke(p)
+	}
+	return nil
+}
+
+// Chord draws the arc closed by the line between its end points.
+func (d *softDevice) Chord(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	a, ok := d.arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd)
+	if !ok {
+		return errors.New("failed to run Chord")
+	}
+
+	p := &raster.Path{}
+	d.appendArc(p, a)
+	p.Close()
+
+	d.draw(p, true, true)
+	return nil
+}
+
+// Pie draws the arc closed by the radials to its end points.
+func (d *softDevice) Pie(left, top, right, bottom, xStart, yStart, xEnd, yEnd int) error {
+	a, ok := d.arc(left, top, right, bottom, xStart, yStart, xEnd, yEnd)
+	if !ok {
+		return errors.New("failed to run Pie")
+	}
+
+	p := &raster.Path{}
+	p.MoveTo(d.matrix().Apply(a.center))
+	d.appendArc(p, a)
+	p.Close()
+
+	d.draw(p, true, true)
+	return nil
+}
+
+func (d *softDevice) Ellipse(left, top, right, bottom int) error {
+	a := softArc{
+		center: raster.Pt(float64(left+right)/2, float64(top+bottom)/2),
+		rx:     math.Abs(float64(right-left)) / 2,
+		ry:     math.Abs(float64(bottom-top)) / 2,
+		sweep:  2 * math.Pi,
+	}
+
+	if a.rx == 0 || a.ry == 0 {
+		return errors.New("failed to run Ellipse")
+	}
+
+	p := &raster.Path{}
+	d.appendArc(p, a)
+	p.Close()
+
+	d.draw(p, true, true)
+	return nil
+}
+
+// RoundRect draws a rectangle with corners rounded by ellipses of width x
+// height, which are at most the size of the rectangle.
+func (d *softDevice) RoundRect(left, top, right, bottom, width, height int) error {
+	l, r := float64(left), float64(right)
+	t, b := float64(top), float64(bottom)
+	if l > r {
+		l, r = r, l
+	}
+	if t > b {
+		t, b = b, t
+	}
+
+	rx := math.Min(math.Abs(float64(width)), r-l) / 2
+	ry := math.Min(math.Abs(float64(height)), b-t) / 2
+	if rx == 0 || ry == 0 {
+		return d.Rectangle(left, top, right, bottom)
+	}
+
+	corners := []softArc{
+		{center: raster.Pt(r-rx, t+ry), a0: -math.Pi / 2},
+		{center: raster.Pt(r-rx, b-ry), a0: 0},
+		{center: raster.Pt(l+rx, b-ry), a0: math.Pi / 2},
+		{center: raster.Pt(l+rx, t+ry), a0: math.Pi},
+	}
+
+	p := &raster.Path{}
+	for _, a := range corners {
+		a.rx, a.ry, a.sweep = rx, ry, math.Pi/2
+		d.appendArc(p, a)
+	}
+	p.Close()
+
+	d.draw(p, true, true)
+	return nil
+}
+
+func (d *softDevice) SetPixelV(x, y int, c w32.COLORREF) error {
+	pt := d.point(x, y)
+	px, py := math.Floor(pt.X), math.Floor(pt.Y)
+
+	d.painter.Fill(rectPath(raster.Identity(), px, py, px+1, py+1), raster.NonZero, paint{Color: d.colorOf(c)}, d.clipRegion())
+	return nil
+}
+
+func (d *softDevice) FillRgn(rects []w32.RECT, brush interface{}) error {
+	b, ok := brush.(*softBrush)
+	if !ok {
+		return errors.New("Unknown type of object")
+	}
+
+	src, ok := d.brushPaint(b)
+	if !ok {
+		return nil
+	}
+
+	d.painter.Fill(rectsPath(d.matrix(), rects), raster.NonZero, src, d.clipRegion())
+	return nil
+}
+
+func (d *softDevice) FrameRgn(rects []w32.RECT, brush interface{}, width, height int) error {
+	rgn, err := newRegion(d.limits, rects...)
+	if err != nil {
+		return err
+	}
+	frame, err := rgn.frame(int32(width), int32(height), d.limits)
+	if err != nil {
+		return err
+	}
+
+	return d.FillRgn(frame.Rects, brush)
+}
+
+// InvertRgn xors the rectangles of the region with white, the rectangles
+// are made disjoint first so no pixel is inverted twice.
+func (d *softDevice) InvertRgn(rects []w32.RECT) error {
+	rgn, err := newRegion(d.limits, rects...)
+	if err != nil {
+		return err
+	}
+
+	white := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	white.SetRGBA(0, 0, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+
+	for _, rc := range rgn.Rects {
+		err := d.blit(int(rc.Left), int(rc.Top), int(rc.Right-rc.Left), int(rc.Bottom-rc.Top),
+			white, 0, 0, 1, 1, w32.SRCINVERT)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *softDevice) PaintRgn(rects []w32.RECT) error {
+	d.fill(rectsPath(d.matrix(), rects), raster.NonZero)
+	return nil
+}
+
+// textMatrix maps vectors of text space, logical units along the baseline
+// with the Y axis pointing down, to device space. Text stays upright when
+// the mapping mode flips an axis, only the world transform turns it.
+func (d *softDevice) textMatrix() raster.Matrix {
+	page := d.state.page()
+	w := d.state.world
+	w.E, w.F = 0, 0
+
+	return w.Mul(raster.Scale(math.Abs(page.A), math.Abs(page.D)))
+}
+
+// textRotation turns text space counterclockwise, as seen with the Y axis
+// pointing down, by an angle in tenths of degrees.
+func textRotation(angle int32) raster.Matrix {
+	if angle%3600 == 0 {
+		return raster.Identity()
+	}
+
+	sin, cos := math.Sincos(float64(angle) * math.Pi / 1800)
+	return raster.Matrix{A: cos, B: -sin, C: sin, D: cos}
+}
+
+func (d *softDevice) ExtTextOut(x, y int, options uint32, rect *w32.RECT, text []uint16, dx []int32) error {
+	font := d.state.font
+	if font == nil {
+		return errors.New("failed to run ExtTextOut")
+	}
+
+	if font.face == nil {
+		face, match, err := d.fonts.face(font.LogFont)
+		if err != nil {
+			return err
+		}
+		font.face, font.match = face, match
+		d.report.add(match)
+	}
+
+	m := d.matrix()
+	face := font.face
+	em := face.emSize(font.LogFont.Height)
+	scale := em / face.unitsPerEm
+
+	if rect != nil && options&ETO_OPAQUE != 0 {
+		bk := paint{Color: d.colorOf(d.state.bkColor)}
+		d.painter.Fill(rectPath(m, float64(rect.Left), float64(rect.Top), float64(rect.Right), float64(rect.Bottom)), raster.NonZero, bk, d.clipRegion())
+	}
+
+	// glyph indices drawn with another font would be other glyphs, the
+	// text is left out rather than drawn wrong
+	if options&ETO_GLYPH_INDEX != 0 && font.match.Substituted {
+		skipped := font.match
+		skipped.GlyphsSkipped = true
+		d.report.add(skipped)
+		log.Warnf("glyph index text of font %q is not drawn, the font is not found", font.match.Face)
+		return nil
+	}
+
+	clip := d.clipRegion()
+	if rect != nil && options&ETO_CLIPPED != 0 {
+		clip = clip.intersect(rectPath(m, float64(rect.Left), float64(rect.Top), float64(rect.Right), float64(rect.Bottom)), raster.NonZero)
+	}
+
+	// with ETO_PDY the distances are pairs of x and y distances, whose y
+	// axis points up
+	step := 1
+	if options&ETO_PDY != 0 {
+		step = 2
+	}
+
+	distance := func(i int) raster.Point {
+		if (i+1)*step > len(dx) {
+			return raster.Point{}
+		}
+		if step == 2 {
+			return raster.Pt(float64(dx[2*i]), -float64(dx[2*i+1]))
+		}
+		return raster.Pt(float64(dx[i]), 0)
+	}
+
+	// a vertical font turns the glyphs which stand upright in vertical
+	// text, which advance by the em size
+	vertical := strings.HasPrefix(font.LogFont.GetFaceName(), "@")
+
+	// lay out the runes from the reference point, in logical units
+	var runes []rune
+	var offsets []raster.Point
+	var glyphs []sfnt.GlyphIndex
+	var upright []bool
+
+	// with ETO_GLYPH_INDEX the string holds glyphs of the font, their
+	// characters are only known from the font
+	glyphIndex := options&ETO_GLYPH_INDEX != 0
+
+	var advance raster.Point
+	for i := 0; i < len(text); i++ {
+		r := rune(text[i])
+		adv := distance(i)
+
+		var g sfnt.GlyphIndex
+		if glyphIndex {
+			g = sfnt.GlyphIndex(text[i])
+			r = face.runeOf(g)
+		} else {
+			if utf16.IsSurrogate(r) && i+1 < len(text) {
+				r = utf16.DecodeRune(r, rune(text[i+1]))
+				i++
+				adv = adv.Add(distance(i))
+			}
+			g = face.glyphIndex(r)
+		}
+
+		up := vertical && isUpright(r)
+		if len(dx) == 0 {
+			adv = raster.Pt(face.advance(g)*scale, 0)
+			if up {
+				adv = raster.Pt(em, 0)
+			}
+		}
+
+		runes = append(runes, r)
+		offsets = append(offsets, advance)
+		glyphs = append(glyphs, g)
+		upright = append(upright, up)
+		advance = advance.Add(adv)
+	}
+	width := advance.X
+
+	align := d.state.textAlign
+
+	ref := raster.Pt(float64(x), float64(y))
+	if align&TA_UPDATECP != 0 {
+		ref = d.state.cur
+	}
+
+	// alignment offset of the first origin in text space
+	var shift raster.Point
+	switch align & TA_CENTER {
+	case TA_RIGHT:
+		shift = advance.Mul(-1)
+	case TA_CENTER:
+		shift = advance.Mul(-0.5)
+	}
+
+	switch align & TA_BASELINE {
+	case TA_BASELINE:
+	case TA_BOTTOM:
+		shift.Y = -face.descent * scale
+	default:
+		shift.Y = face.ascent * scale
+	}
+
+	// the baseline is turned by the escapement, the glyphs by the
+	// orientation in GM_ADVANCED and by the escapement otherwise
+	orientation := font.LogFont.Escapement
+	if d.textMode == w32.GM_ADVANCED {
+		orientation = font.LogFont.Orientation
+	}
+
+	t := textRotation(font.LogFont.Escapement).Mul(d.textMatrix())
+	glyphT := textRotation(orientation).Mul(d.textMatrix())
+	origin := m.Apply(ref).Add(t.ApplyVector(shift))
+
+	toDevice := func(p raster.Point) raster.Point {
+		return origin.Add(t.ApplyVector(p))
+	}
+
+	if d.state.bkMode == OPAQUE && options&ETO_OPAQUE == 0 {
+		box := rectPath(t.Mul(raster.Translate(origin.X, origin.Y)), 0, -face.ascent*scale, width, face.descent*scale)
+		d.painter.Fill(box, raster.NonZero, paint{Color: d.colorOf(d.state.bkColor)}, clip)
+	}
+
+	newRun := func(glyph raster.Matrix) *textRun {
+		return &textRun{
+			Font:      strings.TrimPrefix(font.LogFont.GetFaceName(), "@"),
+			Weight:    int(font.LogFont.Weight),
+			Italic:    font.LogFont.Italic != 0,
+			Underline: font.LogFont.Underline != 0,
+			StrikeOut: font.LogFont.StrikeOut != 0,
+			Size:      em * glyph.ScaleFactor(),
+			Matrix:    raster.Scale(em, em).Mul(glyph),
+			Color:     d.colorOf(d.state.textColor),
+			Outline:   &raster.Path{},
+			Lines:     &raster.Path{},
+			Face:      face,
+		}
+	}
+
+	// the upright glyphs of vertical text are a run of their own, turned a
+	// quarter counterclockwise so their tops face the start of the line
+	quarter := raster.Matrix{A: 0, B: -1, C: 1, D: 0}.Mul(glyphT)
+
+	run, uprightRun := newRun(glyphT), newRun(quarter)
+	uprightRun.Underline, uprightRun.StrikeOut = false, false
+
+	for i := range runes {
+		r, g, o := run, glyphT, toDevice(offsets[i])
+		if upright[i] {
+			// the glyph is centered across the baseline, its top at the
+			// start of its em
+			top := em * face.ascent / (face.ascent + face.descent)
+			across := (face.advance(glyphs[i]) + face.descent - face.ascent) * scale / 2
+
+			r, g = uprightRun, quarter
+			o = o.Add(glyphT.ApplyVector(raster.Pt(top, across)))
+		}
+
+		r.Text = append(r.Text, runes[i])
+		r.Glyphs = append(r.Glyphs, glyphs[i])
+		r.Origins = append(r.Origins, o)
+		r.Outline.Append(face.outline(glyphs[i]).Transform(raster.Scale(scale, scale).Mul(g).Mul(raster.Translate(o.X, o.Y))))
+	}
+
+	lines := raster.Scale(scale, scale).Mul(t).Mul(raster.Translate(origin.X, origin.Y))
+	if font.LogFont.Underline != 0 {
+		top := face.underline
+		run.Lines.Append(rectPath(lines, 0, top, width/scale, top+face.lineWidth))
+	}
+	if font.LogFont.StrikeOut != 0 {
+		top := -face.ascent * 0.3
+		run.Lines.Append(rectPath(lines, 0, top, width/scale, top+face.lineWidth))
+	}
+	run.Outline.Append(run.Lines)
+
+	d.painter.Text(run, clip)
+	if len(uprightRun.Glyphs) > 0 {
+		d.painter.Text(uprightRun, clip)
+	}
+
+	// the current position moves to the other end of the text, the
+	// advance is turned from text space to logical units
+	if align&TA_UPDATECP != 0 && align&TA_CENTER != TA_CENTER {
+		if inv, ok := m.Invert(); ok {
+			end := inv.ApplyVector(t.ApplyVector(advance))
+			if align&TA_CENTER == TA_RIGHT {
+				end = end.Mul(-1)
+			}
+			d.state.cur = ref.Add(end)
+		}
+	}
+
+	return nil
+}
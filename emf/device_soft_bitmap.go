@@ -0,0 +1,206 @@
+package emf
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+)
+
+// dibImage decodes a bitmap, looking up DIB_PAL_COLORS indexes in the
+// selected palette.
+func (d *softDevice) dibImage(src *Bitmap, usage uint32) (image.Image, error) {
+	if usage != DIB_PAL_COLORS {
+		return decodeDIB(src)
+	}
+
+	// every RGBQUAD holds two 16-bit indexes into the logical palette
+	colors := make([]w32.RGBQUAD, 0, len(src.Colors)*2)
+	for _, q := range src.Colors {
+		for _, idx := range []uint16{uint16(q.RgbBlue) | uint16(q.RgbGreen)<<8, uint16(q.RgbRed) | uint16(q.RgbReserved)<<8} {
+			c := d.colorOf(0x01000000 | w32.COLORREF(idx))
+			colors = append(colors, w32.RGBQUAD{RgbBlue: c.B, RgbGreen: c.G, RgbRed: c.R})
+		}
+	}
+
+	return decodeDIB(&Bitmap{Info: src.Info, Colors: colors, Bits: src.Bits})
+}
+
+// fillRop paints the destination rectangle for raster operations which do
+// not use the source. The second result is false for other operations.
+func (d *softDevice) fillRop(x, y, cx, cy int, rop uint32) (bool, error) {
+	var src paint
+
+	switch rop {
+	case w32.BLACKNESS:
+		src = paint{Color: color.RGBA{0, 0, 0, 0xFF}}
+	case w32.WHITENESS:
+		src = paint{Color: color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}}
+	case w32.PATCOPY:
+		var ok bool
+		if src, ok = d.brushPaint(d.state.brush); !ok {
+			return true, nil
+		}
+	default:
+		return false, nil
+	}
+
+	p := rectPath(d.matrix(), float64(x), float64(y), float64(x+cx), float64(y+cy))
+	d.painter.Fill(p, raster.NonZero, src, d.clipRegion())
+
+	return true, nil
+}
+
+func invertImage(img image.Image) image.Image {
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			out.SetNRGBA(x, y, color.NRGBA{^c.R, ^c.G, ^c.B, c.A})
+		}
+	}
+	return out
+}
+
+// blit draws the source rectangle of img stretched onto the destination
+// rectangle, both in logical units.
+func (d *softDevice) blit(x, y, cx, cy int, img image.Image, xSrc, ySrc, cxSrc, cySrc int, rop uint32) error {
+	if cxSrc == 0 || cySrc == 0 {
+		return errors.New("invalid source rectangle")
+	}
+
+	op := raster.ImageCopy
+	switch rop {
+	case w32.SRCCOPY:
+	case w32.SRCPAINT:
+		op = raster.ImageOr
+	case w32.SRCAND:
+		op = raster.ImageAnd
+	case w32.SRCINVERT:
+		op = raster.ImageXor
+	case w32.NOTSRCCOPY:
+		img = invertImage(img)
+	default:
+		log.Tracef("raster operation 0x%08X is drawn as SRCCOPY", rop)
+	}
+
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if ok {
+		img = sub.SubImage(image.Rect(xSrc, ySrc, xSrc+cxSrc, ySrc+cySrc))
+	}
+
+	m := raster.Translate(float64(-xSrc), float64(-ySrc)).
+		Mul(raster.Scale(float64(cx)/float64(cxSrc), float64(cy)/float64(cySrc))).
+		Mul(raster.Translate(float64(x), float64(y))).
+		Mul(d.matrix())
+
+	d.painter.DrawImage(img, m, op, d.state.stretchMode == STRETCH_HALFTONE, d.clipRegion())
+	return nil
+}
+
+func (d *softDevice) BitBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc int, rop uint32) error {
+	return d.StretchBlt(x, y, cx, cy, src, xSrc, ySrc, cx, cy, rop)
+}
+
+func (d *softDevice) StretchBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, cxSrc, cySrc int, rop uint32) error {
+	if done, err := d.fillRop(x, y, cx, cy, rop); done || err != nil {
+		return err
+	}
+
+	if src == nil {
+		return nil
+	}
+
+	img, err := decodeDIB(src)
+	if err != nil {
+		return err
+	}
+
+	return d.blit(x, y, cx, cy, img, xSrc, ySrc, cxSrc, cySrc, rop)
+}
+
+func (d *softDevice) MaskBlt(x, y, cx, cy int, src *Bitmap, xSrc, ySrc int, mask *Bitmap, xMask, yMask int, rop uint32) error {
+	if src == nil {
+		return nil
+	}
+
+	img, err := decodeDIB(src)
+	if err != nil {
+		return err
+	}
+
+	if mask == nil {
+		return d.blit(x, y, cx, cy, img, xSrc, ySrc, cx, cy, rop)
+	}
+
+	maskImg, err := decodeDIB(mask)
+	if err != nil {
+		return err
+	}
+
+	// source pixels are kept where the mask is set, the rest is transparent
+	masked := image.NewNRGBA(image.Rect(xSrc, ySrc, xSrc+cx, ySrc+cy).Intersect(img.Bounds()))
+	b := masked.Bounds()
+	for py := b.Min.Y; py < b.Max.Y; py++ {
+		for px := b.Min.X; px < b.Max.X; px++ {
+			r, _, _, _ := maskImg.At(xMask+px-xSrc, yMask+py-ySrc).RGBA()
+			if r == 0 {
+				continue
+			}
+			masked.Set(px, py, img.At(px, py))
+		}
+	}
+
+	m := raster.Translate(float64(x-xSrc), float64(y-ySrc)).Mul(d.matrix())
+	d.painter.DrawImage(masked, m, raster.ImageOver, false, d.clipRegion())
+
+	return nil
+}
+
+func (d *softDevice) StretchDIBits(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, cxSrc, cySrc int, usage, rop uint32) error {
+	if done, err := d.fillRop(x, y, cx, cy, rop); done || err != nil {
+		return err
+	}
+
+	if src == nil {
+		return nil
+	}
+
+	img, err := d.dibImage(src, usage)
+	if err != nil {
+		return err
+	}
+
+	// the source rectangle of a bottom-up DIB is measured from its last row
+	if src.Info.BiHeight > 0 {
+		ySrc = int(src.Info.BiHeight) - ySrc - cySrc
+	}
+
+	return d.blit(x, y, cx, cy, img, xSrc, ySrc, cxSrc, cySrc, rop)
+}
+
+func (d *softDevice) SetDIBitsToDevice(x, y, cx, cy int, src *Bitmap, xSrc, ySrc, startScan, scans int, usage uint32) error {
+	if src == nil {
+		return nil
+	}
+
+	img, err := d.dibImage(src, usage)
+	if err != nil {
+		return err
+	}
+
+	// the bitmap holds the scan lines from startScan, counted from the
+	// bottom of the source
+	top := startScan + scans - ySrc - cy
+	if src.Info.BiHeight < 0 {
+		top = ySrc - startScan
+	}
+
+	return d.blit(x, y, cx, cy, img, xSrc, top, cx, cy, w32.SRCCOPY)
+}
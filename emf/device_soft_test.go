@@ -0,0 +1,34 @@
+package emf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAngleArcSweep(t *testing.T) {
+	tests := []struct {
+		name  string
+		sweep float32
+		x, y  float64 // end of the arc, y down
+	}{
+		{"quarter", 90, 0, -10},
+		{"full turn", 360, 10, 0},
+		{"clockwise", -90, 0, 10},
+		{"many turns", 36000180, -10, 0},
+		{"many turns clockwise", -3600270, 0, -10},
+		{"infinite", float32(math.Inf(1)), 10, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newSoftDevice(20, 20, newRasterPainter(20, 20))
+			if err := d.AngleArc(0, 0, 10, 0, tt.sweep); err != nil {
+				t.Fatal(err)
+			}
+
+			if cur := d.state.cur; math.Abs(cur.X-tt.x) > 1e-6 || math.Abs(cur.Y-tt.y) > 1e-6 {
+				t.Errorf("arc ends at %v, want %v,%v", cur, tt.x, tt.y)
+			}
+		})
+	}
+}
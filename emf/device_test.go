@@ -0,0 +1,74 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// pngClaiming returns a PNG of one pixel whose header claims width x height.
+func pngClaiming(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the IHDR chunk follows the signature
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestBitmapEmbeddedLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height uint32
+		err           error
+	}{
+		{"small", 1, 1, nil},
+		{"huge", 20000, 20000, ErrLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(w32.RECT{Right: 9, Bottom: 9}, w32.RECT{})
+			rec := &StretchDIBitsRecord{
+				Record: Record{Type: EMR_STRETCHDIBITS},
+				StretchDIBitsInfo: StretchDIBitsInfo{
+					CxSrc:     1,
+					CySrc:     1,
+					BitBltROP: w32.SRCCOPY,
+					CxDest:    9,
+					CyDest:    9,
+				},
+				BitsSrc: pngClaiming(t, tt.width, tt.height),
+			}
+			// the header is one pixel whatever the PNG claims
+			rec.BmiSrc.BITMAPINFOHEADER = w32.BITMAPINFOHEADER{
+				BiSize:        40,
+				BiWidth:       1,
+				BiHeight:      1,
+				BiPlanes:      1,
+				BiCompression: BI_PNG,
+				BiSizeImage:   uint32(len(rec.BitsSrc)),
+			}
+			b.Add(rec)
+
+			f := b.File()
+			f.SetOptions(&ReadOptions{Strict: true})
+			if err := f.DrawToDevice(NewRasterDevice(10, 10)); !errors.Is(err, tt.err) {
+				t.Errorf("DrawToDevice returned %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package emf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // BI_JPEG bitmaps
+	_ "image/png"  // BI_PNG bitmaps
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// Image decodes the bitmap.
+func (b *Bitmap) Image() (image.Image, error) {
+	return decodeDIB(b)
+}
+
+// decodeDIB converts a device-independent bitmap to a top-down image.
+func decodeDIB(src *Bitmap) (image.Image, error) {
+	h := src.Info.BITMAPINFOHEADER
+
+	switch h.BiCompression {
+	case BI_JPEG, BI_PNG:
+		img, _, err := image.Decode(bytes.NewReader(src.Bits))
+		return img, err
+	}
+
+	width := int(h.BiWidth)
+	height := int(h.BiHeight)
+	bottomUp := height > 0
+	if height < 0 {
+		height = -height
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("invalid bitmap size")
+	}
+
+	bits := src.Bits
+	switch h.BiCompression {
+	case BI_RLE8:
+		bits = decodeRLE(bits, width, height, 8)
+	case BI_RLE4:
+		bits = decodeRLE(bits, width, height, 4)
+	case BI_RGB, BI_BITFIELDS:
+	default:
+		return nil, fmt.Errorf("unsupported bitmap compression %d", h.BiCompression)
+	}
+
+	bitCount := int(h.BiBitCount)
+	stride := ((width*bitCount + 31) / 32) * 4
+	if len(bits) < stride*height {
+		return nil, errors.New("bitmap data too short")
+	}
+
+	palette := make([]color.NRGBA, len(src.Colors))
+	for i, c := range src.Colors {
+		palette[i] = color.NRGBA{c.RgbRed, c.RgbGreen, c.RgbBlue, 0xFF}
+	}
+
+	rMask, gMask, bMask := uint32(0x7C00), uint32(0x03E0), uint32(0x001F)
+	if bitCount == 32 {
+		rMask, gMask, bMask = 0x00FF0000, 0x0000FF00, 0x000000FF
+	}
+	if h.BiCompression == BI_BITFIELDS && len(src.Colors) >= 3 {
+		rMask = rgbQuadToUint32(src.Colors[0])
+		gMask = rgbQuadToUint32(src.Colors[1])
+		bMask = rgbQuadToUint32(src.Colors[2])
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		row := bits[y*stride : (y+1)*stride]
+		dy := y
+		if bottomUp {
+			dy = height - 1 - y
+		}
+		dst := img.Pix[dy*img.Stride:]
+
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+
+			switch bitCount {
+			case 1, 2, 4, 8:
+				perByte := 8 / bitCount
+				shift := uint(8 - bitCount*(x%perByte+1))
+				idx := int(row[x/perByte]>>shift) & (1<<uint(bitCount) - 1)
+				if idx < len(palette) {
+					c = palette[idx]
+				} else {
+					c = color.NRGBA{A: 0xFF}
+				}
+			case 16:
+				v := uint32(row[x*2]) | uint32(row[x*2+1])<<8
+				c = color.NRGBA{maskChannel(v, rMask), maskChannel(v, gMask), maskChannel(v, bMask), 0xFF}
+			case 24:
+				c = color.NRGBA{row[x*3+2], row[x*3+1], row[x*3], 0xFF}
+			case 32:
+				v := uint32(row[x*4]) | uint32(row[x*4+1])<<8 | uint32(row[x*4+2])<<16 | uint32(row[x*4+3])<<24
+				c = color.NRGBA{maskChannel(v, rMask), maskChannel(v, gMask), maskChannel(v, bMask), 0xFF}
+			default:
+				return nil, fmt.Errorf("unsupported bit count %d", bitCount)
+			}
+
+			dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = c.R, c.G, c.B, c.A
+		}
+	}
+
+	return img, nil
+}
+
+func rgbQuadToUint32(q w32.RGBQUAD) uint32 {
+	return uint32(q.RgbBlue) | uint32(q.RgbGreen)<<8 | uint32(q.RgbRed)<<16 | uint32(q.RgbReserved)<<24
+}
+
+// maskChannel extracts the channel selected by mask and scales it to 8 bits.
+func maskChannel(v, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+
+	shift := uint(0)
+	for mask&1 == 0 {
+		mask >>= 1
+		shift++
+	}
+
+	max := mask
+	value := (v >> shift) & mask
+
+	return uint8(value * 255 / max)
+}
+
+// decodeRLE expands BI_RLE8 and BI_RLE4 data to uncompressed bottom-up rows.
+func decodeRLE(data []byte, width, height, bitCount int) []byte {
+	stride := ((width*bitCount + 31) / 32) * 4
+	out := make([]byte, stride*height)
+
+	set := func(x, y int, v byte) {
+		if x < 0 || x >= width || y < 0 || y >= height {
+			return
+		}
+		if bitCount == 8 {
+			out[y*stride+x] = v
+			return
+		}
+		i := y*stride + x/2
+		if x%2 == 0 {
+			out[i] = out[i]&0x0F | v<<4
+		} else {
+			out[i] = out[i]&0xF0 | v&0x0F
+		}
+	}
+
+	x, y := 0, 0
+	for i := 0; i+1 < len(data); {
+		count, value := int(data[i]), data[i+1]
+		i += 2
+
+		if count > 0 {
+			for k := 0; k < count; k++ {
+				if bitCount == 8 {
+					set(x, y, value)
+				} else if k%2 == 0 {
+					set(x, y, value>>4)
+				} else {
+					set(x, y, value&0x0F)
+				}
+				x++
+			}
+			continue
+		}
+
+		switch value {
+		case 0: // end of line
+			x, y = 0, y+1
+		case 1: // end of bitmap
+			return out
+		case 2: // delta
+			if i+1 >= len(data) {
+				return out
+			}
+			x += int(data[i])
+			y += int(data[i+1])
+			i += 2
+		default: // absolute mode
+			n := int(value)
+			for k := 0; k < n; k++ {
+				var v byte
+				if bitCount == 8 {
+					if i+k >= len(data) {
+						return out
+					}
+					v = data[i+k]
+				} else {
+					if i+k/2 >= len(data) {
+						return out
+					}
+					v = data[i+k/2]
+					if k%2 == 0 {
+						v >>= 4
+					} else {
+						v &= 0x0F
+					}
+				}
+				set(x, y, v)
+				x++
+			}
+			size := n
+			if bitCount == 4 {
+				size = (n + 1) / 2
+			}
+			i += (size + 1) &^ 1 // runs are word aligned
+		}
+	}
+
+	return out
+}
@@ -4,52 +4,29 @@ import (
 	"image"
 
 	im "github.com/disintegration/imaging"
+	"github.com/lokks307/go-emf/raster"
 	"github.com/lokks307/go-emf/w32"
 	log "github.com/sirupsen/logrus"
 )
 
-var StockObjects map[uint32]interface{}
-
-func init() {
-	StockObjects = map[uint32]interface{}{
-		WHITE_BRUSH:         w32.HBRUSH(w32.GetStockObject(WHITE_BRUSH)),
-		LTGRAY_BRUSH:        w32.HBRUSH(w32.GetStockObject(LTGRAY_BRUSH)),
-		GRAY_BRUSH:          w32.HBRUSH(w32.GetStockObject(GRAY_BRUSH)),
-		DKGRAY_BRUSH:        w32.HBRUSH(w32.GetStockObject(DKGRAY_BRUSH)),
-		BLACK_BRUSH:         w32.HBRUSH(w32.GetStockObject(BLACK_BRUSH)),
-		NULL_BRUSH:          w32.HBRUSH(w32.GetStockObject(NULL_BRUSH)),
-		DC_BRUSH:            w32.HBRUSH(w32.GetStockObject(DC_BRUSH)),
-		WHITE_PEN:           w32.HPEN(w32.GetStockObject(WHITE_PEN)),
-		BLACK_PEN:           w32.HPEN(w32.GetStockObject(BLACK_PEN)),
-		DC_PEN:              w32.HPEN(w32.GetStockObject(DC_PEN)),
-		NULL_PEN:            w32.HPEN(w32.GetStockObject(NULL_BRUSH)),
-		OEM_FIXED_FONT:      w32.HFONT(w32.GetStockObject(OEM_FIXED_FONT)),
-		ANSI_FIXED_FONT:     w32.HFONT(w32.GetStockObject(ANSI_FIXED_FONT)),
-		ANSI_VAR_FONT:       w32.HFONT(w32.GetStockObject(ANSI_VAR_FONT)),
-		SYSTEM_FONT:         w32.HFONT(w32.GetStockObject(SYSTEM_FONT)),
-		DEVICE_DEFAULT_FONT: w32.HFONT(w32.GetStockObject(DEVICE_DEFAULT_FONT)),
-		SYSTEM_FIXED_FONT:   w32.HFONT(w32.GetStockObject(SYSTEM_FIXED_FONT)),
-		DEFAULT_GUI_FONT:    w32.HFONT(w32.GetStockObject(DEFAULT_GUI_FONT)),
-		DEFAULT_PALETTE:     w32.HPALETTE(w32.GetStockObject(DEFAULT_PALETTE)),
-	}
-}
-
 type EmfContext struct {
-	MDC          w32.HDC
+	dev          Device
 	Width        int
 	Height       int
 	Objects      map[uint32]interface{}
-	BitCount     int
 	GraphicsMode int
-	XForm        w32.XFORM
 	View         w32.RECT
 	Window       w32.SIZE
+
+	plus   *plusContext // EMF+ playback, created by the first EMF+ record
+	strict bool         // stop at the first EMF+ record which fails
+	limits *Limits
+	fonts  *FontResolver
+	report fontReport // of the faces the software devices substituted
 }
 
 func (e *EmfContext) Release() {
-	if !w32.DeleteDC(e.MDC) {
-		log.Error("Error on DeleteDC")
-	}
+	e.dev.Release()
 }
 
 func (e *EmfContext) GetWidth() int {
@@ -60,71 +37,107 @@ func (e *EmfContext) GetHeight() int {
 	return e.Height
 }
 
-func NewEmfContext(view w32.RECT, window w32.SIZE) *EmfContext {
-	memDC := w32.CreateCompatibleDC(0)
-	hBitmap := w32.CreateCompatibleBitmap(memDC, int(window.CX), int(window.CY))
-
-	if hBitmap == 0 {
-		log.Error("failed to create CreateCompatibleBitmap")
+func (e *EmfContext) Device() Device {
+	if d, ok := e.dev.(*compatDevice); ok {
+		return d.Device
 	}
+	return e.dev
+}
+
+// ClipRegion returns the clip region in device units, nil when there is
+// none. Drawing is clipped by its intersection with the meta region.
+func (e *EmfContext) ClipRegion() (*Region, error) {
+	return e.dev.GetClipRgn()
+}
+
+// MetaRegion returns the meta region set by EMR_SETMETARGN in device
+// units, nil when there is none.
+func (e *EmfContext) MetaRegion() (*Region, error) {
+	return e.dev.GetMetaRgn()
+}
+
+func NewEmfContext(view w32.RECT, window w32.SIZE) *EmfContext {
+	return NewEmfContextWithDevice(view, window, newDevice(window))
+}
 
+// NewEmfContextWithDevice returns a context which draws the records on dev.
+// The mapping of a device in GM_COMPATIBLE is kept by the context.
+func NewEmfContextWithDevice(view w32.RECT, window w32.SIZE, dev Device) *EmfContext {
 	log.Info("EMF-View = ", view)
 	log.Info("EMF-Window = ", window)
 
-	defer func() {
-		w32.DeleteObject(w32.HGDIOBJ(hBitmap))
-	}()
+	mode := dev.GraphicsMode()
+	if mode != w32.GM_ADVANCED {
+		dev = newCompatDevice(dev, int(window.CX), int(window.CY))
+	}
 
-	emf := &EmfContext{
-		MDC:          memDC,
+	e := &EmfContext{
+		dev:          dev,
 		Objects:      make(map[uint32]interface{}),
-		BitCount:     w32.GetDeviceCaps(memDC, w32.COLORRES),
-		GraphicsMode: w32.GM_COMPATIBLE,
+		GraphicsMode: mode,
 		View:         view,
 		Window:       window,
+		limits:       &DefaultLimits,
+		fonts:        DefaultFontResolver,
+	}
+	if d, ok := e.Device().(interface{ setFontReport(*fontReport) }); ok {
+		d.setFontReport(&e.report)
 	}
 
-	emf.SetDefaultXForm()
-	emf.ScaleView()
-
-	// w32.SetTextAlign(memDC, TA_LEFT|TA_TOP)
-	w32.SetBkColor(emf.MDC, 0x00FFFFFF)
-
-	w32.SetGraphicsMode(emf.MDC, emf.GraphicsMode)
+	return e
+}
 
-	w32.SelectObject(emf.MDC, w32.HGDIOBJ(hBitmap))
-	w32.Rectangle(emf.MDC, 0, 0, int(window.CX), int(window.CY)) // too fill white background
+// FontReport returns the faces of the text drawn so far which were not
+// found under their own name, sorted by face name. Text drawn by gdi32 is
+// not reported.
+func (e *EmfContext) FontReport() []FontMatch {
+	return e.report.list()
+}
 
-	return emf
+// setPixelSize sets the size in mm of a device pixel, which the metric and
+// English mapping modes depend on.
+func (e *EmfContext) setPixelSize(size raster.Point) {
+	if d, ok := e.dev.(interface{ setPixelSize(raster.Point) }); ok {
+		d.setPixelSize(size)
+	}
 }
 
-func (e *EmfContext) SetXForm(xform w32.XFORM) {
-	e.XForm = xform
+// setFonts sets the resolver of the faces of the text drawn by the
+// software devices.
+func (e *EmfContext) setFonts(fonts *FontResolver) {
+	e.fonts = fonts
+	if d, ok := e.Device().(interface{ setFonts(*FontResolver) }); ok {
+		d.setFonts(fonts)
+	}
 }
 
-func (e *EmfContext) SetDefaultXForm() {
-	e.SetXForm(w32.XFORM{
-		M11: 1.0,
-		M12: 0.0,
-		M21: 0.0,
-		M22: 1.0,
-		Dx:  0.0,
-		Dy:  0.0,
-	})
+// setLimits sets the limits of the bitmaps and regions drawn, which the
+// software devices check when they combine regions.
+func (e *EmfContext) setLimits(limits *Limits) {
+	e.limits = limits
+	if d, ok := e.Device().(interface{ setLimits(*Limits) }); ok {
+		d.setLimits(limits)
+	}
 }
 
-func (e *EmfContext) ScaleXForm(m11, m22, dx, dy float32) {
-	e.XForm.M11 *= m11
-	e.XForm.M22 *= m22
-	e.XForm.Dx = dx
-	e.XForm.Dy = dy
+// setTextMode tells the software devices the graphics mode of the text
+// record drawn next, which decides whether the glyphs follow the
+// orientation or the escapement of the font.
+func (e *EmfContext) setTextMode(mode uint32) {
+	if d, ok := e.Device().(interface{ setTextMode(int) }); ok {
+		d.setTextMode(int(mode))
+	}
 }
 
-func (e *EmfContext) ScaleView() {
-	w32.SetWindowExtEx(e.MDC, int(float32(e.Window.CX)*e.XForm.M11), int(float32(e.Window.CY)*e.XForm.M22), nil)
-	w32.SetViewportExtEx(e.MDC, int(float32(e.View.Right-e.View.Left)*e.XForm.M11), int(float32(e.View.Bottom-e.View.Top)*e.XForm.M22), nil)
-	// w32.SetWindowOrgEx(e.MDC, int(e.XForm.Dx), int(e.XForm.Dy), nil)
-	// w32.SetViewportOrgEx(e.MDC, int(-e.XForm.Dx), int(-e.XForm.Dy), nil)
+// object returns the stock object or the object created by a record for the
+// index ih.
+func (e *EmfContext) object(ih uint32) (interface{}, bool) {
+	if object, ok := e.dev.StockObject(ih); ok {
+		return object, true
+	}
+
+	object, ok := e.Objects[ih]
+	return object, ok
 }
 
 func (e *EmfContext) DrawToColorImage(pMode int) (interface{}, error) {
@@ -158,7 +171,7 @@ func (e *EmfContext) drawToImage(pMode int, cMode int) (interface{}, error) {
 	width := int(device.CX)
 	height := int(device.CY)
 
-	if gImg, cimg, err := DeviceContextToImage(e.MDC, width, height); err != nil {
+	if cimg, err := e.dev.Image(); err != nil {
 		return nil, err
 	} else {
 
@@ -169,6 +182,11 @@ func (e *EmfContext) drawToImage(pMode int, cMode int) (interface{}, error) {
 				return im.Crop(cimg, image.Rect(0, 0, width, height)), nil
 			}
 		} else {
+			gImg := make([]byte, width*height)
+			for i := range gImg {
+				gImg[i] = cimg.Pix[i*4] // R channel, as DeviceContextToImage
+			}
+
 			if pMode == CROP_AREA {
 				width = int(bound.Right - bound.Left)
 				height = int(bound.Bottom - bound.Top)
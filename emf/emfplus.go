@@ -0,0 +1,1539 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/lokks307/go-emf/raster"
+	log "github.com/sirupsen/logrus"
+)
+
+// EmfPlusRecorder is a record of the EMF+ stream which GDI+ embeds in
+// EMR_COMMENT records.
+type EmfPlusRecorder interface {
+	Draw(*EmfContext) error
+}
+
+type EmfPlusRecord struct {
+	Type     uint16
+	Flags    uint16
+	Size     uint32
+	DataSize uint32
+}
+
+func (r *EmfPlusRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Unsupported EMF+ Draw")
+	return nil
+}
+
+// objectID returns the object index most records keep in the low byte of
+// the flags.
+func (r *EmfPlusRecord) objectID() uint8 {
+	return uint8(r.Flags)
+}
+
+// EmfPlusRawRecord is an EMF+ record without a reader.
+type EmfPlusRawRecord struct {
+	EmfPlusRecord
+	Data []byte
+}
+
+// CommentEmfPlusRecord is an EMR_COMMENT holding EMF+ records. Data keeps
+// the whole comment, so the record is written back unchanged.
+type CommentEmfPlusRecord struct {
+	CommentRecord
+	Records []EmfPlusRecorder
+}
+
+func (r *CommentEmfPlusRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT_EMFPLUS")
+
+	return ctx.playPlus(r.Records)
+}
+
+// readEmfPlusRecords reads the EMF+ records following the comment
+// identifier.
+func readEmfPlusRecords(data []byte) ([]EmfPlusRecorder, error) {
+	var recs []EmfPlusRecorder
+
+	for len(data) > 0 {
+		var hdr EmfPlusRecord
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr); err != nil {
+			return recs, err
+		}
+
+		if hdr.Size < 12 || hdr.DataSize > hdr.Size-12 || uint64(hdr.Size) > uint64(len(data)) {
+			return recs, fmt.Errorf("invalid size of EMF+ record %#04x", hdr.Type)
+		}
+
+		log.Tracef("EMF+ record type = %04x\n", hdr.Type)
+
+		reader := bytes.NewReader(data[12 : 12+hdr.DataSize])
+
+		var rec EmfPlusRecorder
+		var err error
+
+		if fn := plusRecords[hdr.Type]; fn != nil {
+			rec, err = fn(reader, hdr)
+		} else {
+			r := &EmfPlusRawRecord{EmfPlusRecord: hdr, Data: make([]byte, hdr.DataSize)}
+			_, err = io.ReadFull(reader, r.Data)
+			rec = r
+		}
+
+		if err != nil {
+			return recs, fmt.Errorf("failed to read EMF+ record %#04x: %v", hdr.Type, err)
+		}
+
+		recs = append(recs, rec)
+		data = data[hdr.Size:]
+	}
+
+	return recs, nil
+}
+
+func readValues(reader *bytes.Reader, values ...interface{}) error {
+	for _, v := range values {
+		if err := binary.Read(reader, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmfPlusARGB is a color with alpha.
+type EmfPlusARGB struct {
+	Blue, Green, Red, Alpha uint8
+}
+
+func argbFromUint32(v uint32) EmfPlusARGB {
+	return EmfPlusARGB{Blue: uint8(v), Green: uint8(v >> 8), Red: uint8(v >> 16), Alpha: uint8(v >> 24)}
+}
+
+func (c EmfPlusARGB) nrgba() color.NRGBA {
+	return color.NRGBA{R: c.Red, G: c.Green, B: c.Blue, A: c.Alpha}
+}
+
+// rgba returns the color with premultiplied alpha, as painters expect.
+func (c EmfPlusARGB) rgba() color.RGBA {
+	return color.RGBAModel.Convert(c.nrgba()).(color.RGBA)
+}
+
+type EmfPlusPointF struct {
+	X, Y float32
+}
+
+func (p EmfPlusPointF) point() raster.Point {
+	return raster.Pt(float64(p.X), float64(p.Y))
+}
+
+type EmfPlusRectF struct {
+	X, Y, Width, Height float32
+}
+
+// EmfPlusTransformMatrix has the layout of an XFORM.
+type EmfPlusTransformMatrix struct {
+	M11, M12, M21, M22, Dx, Dy float32
+}
+
+func (m EmfPlusTransformMatrix) matrix() raster.Matrix {
+	return raster.Matrix{
+		A: float64(m.M11), B: float64(m.M12),
+		C: float64(m.M21), D: float64(m.M22),
+		E: float64(m.Dx), F: float64(m.Dy),
+	}
+}
+
+// checkCount fails when count items of at least size bytes cannot be in the
+// rest of the record.
+func checkCount(reader *bytes.Reader, count uint32, size int) error {
+	if uint64(count)*uint64(size) > uint64(reader.Len()) {
+		return errors.New("count exceeds record size")
+	}
+	return nil
+}
+
+// readPlusPoints reads count points stored as floats, as 16-bit integers
+// when compressed or as relative offsets.
+func readPlusPoints(reader *bytes.Reader, count uint32, compressed, relative bool) ([]EmfPlusPointF, error) {
+	switch {
+	case relative:
+		if err := checkCount(reader, count, 2); err != nil {
+			return nil, err
+		}
+
+		points := make([]EmfPlusPointF, count)
+		var x, y float32
+		for i := range points {
+			dx, err := readInteger7or15(reader)
+			if err != nil {
+				return nil, err
+			}
+			dy, err := readInteger7or15(reader)
+			if err != nil {
+				return nil, err
+			}
+			x += float32(dx)
+			y += float32(dy)
+			points[i] = EmfPlusPointF{X: x, Y: y}
+		}
+		return points, nil
+
+	case compressed:
+		if err := checkCount(reader, count, 4); err != nil {
+			return nil, err
+		}
+
+		ps := make([]PointS, count)
+		if err := binary.Read(reader, binary.LittleEndian, ps); err != nil {
+			return nil, err
+		}
+
+		points := make([]EmfPlusPointF, count)
+		for i, p := range ps {
+			points[i] = EmfPlusPointF{X: float32(p.X), Y: float32(p.Y)}
+		}
+		return points, nil
+	}
+
+	if err := checkCount(reader, count, 8); err != nil {
+		return nil, err
+	}
+
+	points := make([]EmfPlusPointF, count)
+	if err := binary.Read(reader, binary.LittleEndian, points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// readInteger7or15 reads a signed 7-bit integer from one byte, or a signed
+// 15-bit integer from two bytes in big-endian order when the high bit of the
+// first byte is set.
+func readInteger7or15(reader *bytes.Reader) (int16, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if b&0x80 == 0 {
+		return int16(int8(b<<1) >> 1), nil
+	}
+
+	lo, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	v := uint16(b&0x7F)<<8 | uint16(lo)
+	return int16(v<<1) >> 1, nil
+}
+
+func readPlusRects(reader *bytes.Reader, count uint32, compressed bool) ([]EmfPlusRectF, error) {
+	if !compressed {
+		if err := checkCount(reader, count, 16); err != nil {
+			return nil, err
+		}
+
+		rects := make([]EmfPlusRectF, count)
+		if err := binary.Read(reader, binary.LittleEndian, rects); err != nil {
+			return nil, err
+		}
+		return rects, nil
+	}
+
+	if err := checkCount(reader, count, 8); err != nil {
+		return nil, err
+	}
+
+	rs := make([]struct{ X, Y, Width, Height int16 }, count)
+	if err := binary.Read(reader, binary.LittleEndian, rs); err != nil {
+		return nil, err
+	}
+
+	rects := make([]EmfPlusRectF, count)
+	for i, r := range rs {
+		rects[i] = EmfPlusRectF{X: float32(r.X), Y: float32(r.Y), Width: float32(r.Width), Height: float32(r.Height)}
+	}
+	return rects, nil
+}
+
+func (r *EmfPlusRecord) compressed() bool {
+	return r.Flags&EMFPLUS_FLAG_COMPRESSED != 0
+}
+
+func (r *EmfPlusRecord) relative() bool {
+	return r.Flags&EMFPLUS_FLAG_RELATIVE != 0
+}
+
+type EmfPlusHeaderRecord struct {
+	EmfPlusRecord
+	Version      uint32
+	EmfPlusFlags uint32
+	LogicalDpiX  uint32
+	LogicalDpiY  uint32
+}
+
+func readEmfPlusHeaderRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusHeaderRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Version, &r.EmfPlusFlags, &r.LogicalDpiX, &r.LogicalDpiY); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusHeaderRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusHeader")
+
+	p := ctx.plus
+	p.active = true
+	p.dual = r.Flags&EMFPLUS_FLAG_DUAL != 0
+	if r.LogicalDpiX > 0 && r.LogicalDpiY > 0 {
+		p.dpiX, p.dpiY = float64(r.LogicalDpiX), float64(r.LogicalDpiY)
+	}
+	return nil
+}
+
+type EmfPlusEndOfFileRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusEndOfFileRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusEndOfFileRecord{EmfPlusRecord: rec}, nil
+}
+
+func (r *EmfPlusEndOfFileRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusEndOfFile")
+
+	ctx.plus.active = false
+
+	return nil
+}
+
+type EmfPlusCommentRecord struct {
+	EmfPlusRecord
+	PrivateData []byte
+}
+
+func readEmfPlusCommentRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusCommentRecord{EmfPlusRecord: rec, PrivateData: make([]byte, reader.Len())}
+
+	if _, err := io.ReadFull(reader, r.PrivateData); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusCommentRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusComment")
+	return nil
+}
+
+// EmfPlusGetDCRecord hands drawing over to the EMF records which follow,
+// up to the next EMF+ record.
+type EmfPlusGetDCRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusGetDCRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusGetDCRecord{EmfPlusRecord: rec}, nil
+}
+
+func (r *EmfPlusGetDCRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusGetDC")
+
+	ctx.plus.getDC = true
+
+	return nil
+}
+
+// EmfPlusObjectRecord defines an object. Large objects are split over
+// several records, the data of the first ones is marked as continued and
+// Object is only set when the data of the record is complete.
+type EmfPlusObjectRecord struct {
+	EmfPlusRecord
+	TotalObjectSize uint32 // only when continued
+	Data            []byte
+	Object          interface{}
+}
+
+func readEmfPlusObjectRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusObjectRecord{EmfPlusRecord: rec}
+
+	if r.Continued() {
+		if err := binary.Read(reader, binary.LittleEndian, &r.TotalObjectSize); err != nil {
+			return nil, err
+		}
+	}
+
+	r.Data = make([]byte, reader.Len())
+	if _, err := io.ReadFull(reader, r.Data); err != nil {
+		return nil, err
+	}
+
+	if !r.Continued() {
+		object, err := parsePlusObject(r.ObjectType(), r.Data)
+		if err != nil {
+			return nil, err
+		}
+		r.Object = object
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusObjectRecord) ObjectID() uint8 {
+	return r.objectID()
+}
+
+func (r *EmfPlusObjectRecord) ObjectType() uint8 {
+	return uint8(r.Flags>>8) & 0x7F
+}
+
+// Continued reports whether the next object record carries more data of
+// the object.
+func (r *EmfPlusObjectRecord) Continued() bool {
+	return r.Flags&EMFPLUS_FLAG_CONTINUED != 0
+}
+
+func (r *EmfPlusObjectRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusObject")
+
+	return ctx.plus.setObject(r)
+}
+
+type EmfPlusClearRecord struct {
+	EmfPlusRecord
+	Color EmfPlusARGB
+}
+
+func readEmfPlusClearRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusClearRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Color); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusClearRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusClear")
+
+	p := ctx.plus
+	p.painter.Fill(rectPath(raster.Identity(), 0, 0, float64(p.width), float64(p.height)), raster.NonZero,
+		paint{Color: r.Color.rgba()}, p.clipRegion())
+
+	return nil
+}
+
+type EmfPlusFillRectsRecord struct {
+	EmfPlusRecord
+	BrushID uint32
+	Rects   []EmfPlusRectF
+}
+
+func readEmfPlusFillRectsRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillRectsRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.BrushID, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Rects, err = readPlusRects(reader, count, r.compressed()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillRectsRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillRects")
+
+	p := ctx.plus
+	p.fill(p.rectsPath(r.Rects), raster.NonZero, r.Flags, r.BrushID)
+
+	return nil
+}
+
+type EmfPlusDrawRectsRecord struct {
+	EmfPlusRecord
+	Rects []EmfPlusRectF
+}
+
+func readEmfPlusDrawRectsRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawRectsRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Rects, err = readPlusRects(reader, count, r.compressed()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawRectsRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawRects")
+
+	p := ctx.plus
+	p.stroke(p.rectsPath(r.Rects), r.objectID())
+
+	return nil
+}
+
+type EmfPlusFillPolygonRecord struct {
+	EmfPlusRecord
+	BrushID uint32
+	Points  []EmfPlusPointF
+}
+
+func readEmfPlusFillPolygonRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillPolygonRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.BrushID, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), r.relative()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillPolygonRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillPolygon")
+
+	p := ctx.plus
+	p.fill(p.linesPath(r.Points, true), raster.EvenOdd, r.Flags, r.BrushID)
+
+	return nil
+}
+
+type EmfPlusDrawLinesRecord struct {
+	EmfPlusRecord
+	Points []EmfPlusPointF
+}
+
+func readEmfPlusDrawLinesRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawLinesRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), r.relative()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawLinesRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawLines")
+
+	p := ctx.plus
+	p.stroke(p.linesPath(r.Points, r.Flags&EMFPLUS_FLAG_CLOSED != 0), r.objectID())
+
+	return nil
+}
+
+// readPlusRect reads a rectangle which is compressed to 16-bit integers
+// when the record has the C flag.
+func readPlusRect(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRectF, error) {
+	rects, err := readPlusRects(reader, 1, rec.compressed())
+	if err != nil {
+		return EmfPlusRectF{}, err
+	}
+	return rects[0], nil
+}
+
+type EmfPlusFillEllipseRecord struct {
+	EmfPlusRecord
+	BrushID uint32
+	Rect    EmfPlusRectF
+}
+
+func readEmfPlusFillEllipseRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillEllipseRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.BrushID); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Rect, err = readPlusRect(reader, rec); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillEllipseRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillEllipse")
+
+	p := ctx.plus
+	p.fill(p.arcPath(r.Rect, 0, 360, false), raster.NonZero, r.Flags, r.BrushID)
+
+	return nil
+}
+
+type EmfPlusDrawEllipseRecord struct {
+	EmfPlusRecord
+	Rect EmfPlusRectF
+}
+
+func readEmfPlusDrawEllipseRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawEllipseRecord{EmfPlusRecord: rec}
+
+	var err error
+	if r.Rect, err = readPlusRect(reader, rec); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawEllipseRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawEllipse")
+
+	p := ctx.plus
+	p.stroke(p.arcPath(r.Rect, 0, 360, false), r.objectID())
+
+	return nil
+}
+
+type EmfPlusFillPieRecord struct {
+	EmfPlusRecord
+	BrushID    uint32
+	StartAngle float32
+	SweepAngle float32
+	Rect       EmfPlusRectF
+}
+
+func readEmfPlusFillPieRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillPieRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.BrushID, &r.StartAngle, &r.SweepAngle); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Rect, err = readPlusRect(reader, rec); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillPieRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillPie")
+
+	p := ctx.plus
+	p.fill(p.arcPath(r.Rect, r.StartAngle, r.SweepAngle, true), raster.NonZero, r.Flags, r.BrushID)
+
+	return nil
+}
+
+// EmfPlusDrawPieRecord is used for EmfPlusDrawPie and EmfPlusDrawArc, which
+// have the same fields.
+type EmfPlusDrawPieRecord struct {
+	EmfPlusRecord
+	StartAngle float32
+	SweepAngle float32
+	Rect       EmfPlusRectF
+}
+
+func readEmfPlusDrawPieRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawPieRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.StartAngle, &r.SweepAngle); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Rect, err = readPlusRect(reader, rec); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawPieRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawPie")
+
+	p := ctx.plus
+	p.stroke(p.arcPath(r.Rect, r.StartAngle, r.SweepAngle, r.Type == EMFPLUS_DRAWPIE), r.objectID())
+
+	return nil
+}
+
+type EmfPlusFillRegionRecord struct {
+	EmfPlusRecord
+	BrushID uint32
+}
+
+func readEmfPlusFillRegionRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillRegionRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.BrushID); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillRegionRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillRegion")
+
+	p := ctx.plus
+	region, ok := p.objects[r.objectID()].(*EmfPlusRegion)
+	if !ok {
+		return errors.New("failed to run EmfPlusFillRegion")
+	}
+
+	p.fillRegion(p.regionClip(region), r.Flags, r.BrushID)
+
+	return nil
+}
+
+type EmfPlusFillPathRecord struct {
+	EmfPlusRecord
+	BrushID uint32
+}
+
+func readEmfPlusFillPathRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillPathRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.BrushID); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillPathRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillPath")
+
+	p := ctx.plus
+	path, ok := p.objects[r.objectID()].(*EmfPlusPath)
+	if !ok {
+		return errors.New("failed to run EmfPlusFillPath")
+	}
+
+	p.fill(path.path(p.matrix()), path.fillRule(), r.Flags, r.BrushID)
+
+	return nil
+}
+
+type EmfPlusDrawPathRecord struct {
+	EmfPlusRecord
+	PenID uint32
+}
+
+func readEmfPlusDrawPathRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawPathRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.PenID); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawPathRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawPath")
+
+	p := ctx.plus
+	path, ok := p.objects[r.objectID()].(*EmfPlusPath)
+	if !ok {
+		return errors.New("failed to run EmfPlusDrawPath")
+	}
+
+	p.stroke(path.path(p.matrix()), uint8(r.PenID))
+
+	return nil
+}
+
+type EmfPlusFillClosedCurveRecord struct {
+	EmfPlusRecord
+	BrushID uint32
+	Tension float32
+	Points  []EmfPlusPointF
+}
+
+func readEmfPlusFillClosedCurveRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusFillClosedCurveRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.BrushID, &r.Tension, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), r.relative()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusFillClosedCurveRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusFillClosedCurve")
+
+	rule := raster.EvenOdd
+	if r.Flags&EMFPLUS_FLAG_WINDING != 0 {
+		rule = raster.NonZero
+	}
+
+	p := ctx.plus
+	p.fill(p.curvePath(r.Points, r.Tension, 0, len(r.Points), true), rule, r.Flags, r.BrushID)
+
+	return nil
+}
+
+type EmfPlusDrawClosedCurveRecord struct {
+	EmfPlusRecord
+	Tension float32
+	Points  []EmfPlusPointF
+}
+
+func readEmfPlusDrawClosedCurveRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawClosedCurveRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.Tension, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), r.relative()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawClosedCurveRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawClosedCurve")
+
+	p := ctx.plus
+	p.stroke(p.curvePath(r.Points, r.Tension, 0, len(r.Points), true), r.objectID())
+
+	return nil
+}
+
+type EmfPlusDrawCurveRecord struct {
+	EmfPlusRecord
+	Tension     float32
+	Offset      uint32
+	NumSegments uint32
+	Points      []EmfPlusPointF
+}
+
+func readEmfPlusDrawCurveRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawCurveRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.Tension, &r.Offset, &r.NumSegments, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), false); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawCurveRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawCurve")
+
+	if uint64(r.Offset)+uint64(r.NumSegments) >= uint64(len(r.Points)) {
+		return errors.New("failed to run EmfPlusDrawCurve")
+	}
+
+	p := ctx.plus
+	p.stroke(p.curvePath(r.Points, r.Tension, int(r.Offset), int(r.NumSegments), false), r.objectID())
+
+	return nil
+}
+
+type EmfPlusDrawBeziersRecord struct {
+	EmfPlusRecord
+	Points []EmfPlusPointF
+}
+
+func readEmfPlusDrawBeziersRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawBeziersRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), r.relative()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawBeziersRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawBeziers")
+
+	if len(r.Points) < 4 {
+		return errors.New("failed to run EmfPlusDrawBeziers")
+	}
+
+	p := ctx.plus
+	m := p.matrix()
+
+	path := &raster.Path{}
+	path.MoveTo(m.Apply(r.Points[0].point()))
+	for i := 1; i+2 < len(r.Points); i += 3 {
+		path.CubeTo(m.Apply(r.Points[i].point()), m.Apply(r.Points[i+1].point()), m.Apply(r.Points[i+2].point()))
+	}
+
+	p.stroke(path, r.objectID())
+
+	return nil
+}
+
+type EmfPlusDrawImageRecord struct {
+	EmfPlusRecord
+	ImageAttributesID uint32
+	SrcUnit           int32
+	SrcRect           EmfPlusRectF
+	Rect              EmfPlusRectF
+}
+
+func readEmfPlusDrawImageRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawImageRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.ImageAttributesID, &r.SrcUnit, &r.SrcRect); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Rect, err = readPlusRect(reader, rec); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawImageRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawImage")
+
+	dst := [3]EmfPlusPointF{
+		{X: r.Rect.X, Y: r.Rect.Y},
+		{X: r.Rect.X + r.Rect.Width, Y: r.Rect.Y},
+		{X: r.Rect.X, Y: r.Rect.Y + r.Rect.Height},
+	}
+
+	return ctx.plus.drawImage(r.objectID(), r.SrcUnit, r.SrcRect, dst)
+}
+
+type EmfPlusDrawImagePointsRecord struct {
+	EmfPlusRecord
+	ImageAttributesID uint32
+	SrcUnit           int32
+	SrcRect           EmfPlusRectF
+	Points            []EmfPlusPointF // upper-left, upper-right and lower-left corners
+}
+
+func readEmfPlusDrawImagePointsRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawImagePointsRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.ImageAttributesID, &r.SrcUnit, &r.SrcRect, &count); err != nil {
+		return nil, err
+	}
+
+	if count != 3 {
+		return nil, errors.New("invalid number of image points")
+	}
+
+	var err error
+	if r.Points, err = readPlusPoints(reader, count, r.compressed(), r.relative()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawImagePointsRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawImagePoints")
+
+	dst := [3]EmfPlusPointF{r.Points[0], r.Points[1], r.Points[2]}
+	return ctx.plus.drawImage(r.objectID(), r.SrcUnit, r.SrcRect, dst)
+}
+
+type EmfPlusDrawStringRecord struct {
+	EmfPlusRecord
+	BrushID    uint32
+	FormatID   uint32
+	LayoutRect EmfPlusRectF
+	String     []uint16
+}
+
+func readEmfPlusDrawStringRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawStringRecord{EmfPlusRecord: rec}
+
+	var length uint32
+	if err := readValues(reader, &r.BrushID, &r.FormatID, &length, &r.LayoutRect); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, length, 2); err != nil {
+		return nil, err
+	}
+
+	r.String = make([]uint16, length)
+	if err := binary.Read(reader, binary.LittleEndian, r.String); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawStringRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawString")
+
+	return ctx.plus.drawString(r)
+}
+
+type EmfPlusDrawDriverStringRecord struct {
+	EmfPlusRecord
+	BrushID                  uint32
+	DriverStringOptionsFlags uint32
+	MatrixPresent            uint32
+	Glyphs                   []uint16
+	GlyphPos                 []EmfPlusPointF
+	TransformMatrix          EmfPlusTransformMatrix
+}
+
+func readEmfPlusDrawDriverStringRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusDrawDriverStringRecord{EmfPlusRecord: rec}
+
+	var count uint32
+	if err := readValues(reader, &r.BrushID, &r.DriverStringOptionsFlags, &r.MatrixPresent, &count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, count, 10); err != nil {
+		return nil, err
+	}
+
+	r.Glyphs = make([]uint16, count)
+	r.GlyphPos = make([]EmfPlusPointF, count)
+	if err := readValues(reader, r.Glyphs, r.GlyphPos); err != nil {
+		return nil, err
+	}
+
+	if r.MatrixPresent != 0 {
+		if err := readValues(reader, &r.TransformMatrix); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusDrawDriverStringRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusDrawDriverString")
+
+	return ctx.plus.drawDriverString(r)
+}
+
+type EmfPlusSetRenderingOriginRecord struct {
+	EmfPlusRecord
+	X, Y int32
+}
+
+func readEmfPlusSetRenderingOriginRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusSetRenderingOriginRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.X, &r.Y); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusSetRenderingOriginRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSetRenderingOrigin")
+
+	ctx.plus.state.origin = raster.Pt(float64(r.X), float64(r.Y))
+
+	return nil
+}
+
+// EmfPlusSetModeRecord is one of the records which keep a rendering mode in
+// the flags: EmfPlusSetAntiAliasMode, EmfPlusSetTextRenderingHint,
+// EmfPlusSetTextContrast, EmfPlusSetInterpolationMode,
+// EmfPlusSetPixelOffsetMode, EmfPlusSetCompositingMode and
+// EmfPlusSetCompositingQuality.
+type EmfPlusSetModeRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusSetModeRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusSetModeRecord{EmfPlusRecord: rec}, nil
+}
+
+// Mode returns the mode set by the record.
+func (r *EmfPlusSetModeRecord) Mode() uint16 {
+	switch r.Type {
+	case EMFPLUS_SETANTIALIASMODE:
+		return r.Flags & 0x01
+	case EMFPLUS_SETTEXTCONTRAST:
+		return r.Flags & 0x0FFF
+	}
+	return r.Flags & 0xFF
+}
+
+func (r *EmfPlusSetModeRecord) Draw(ctx *EmfContext) error {
+	log.Tracef("Draw EmfPlusSetMode %04x", r.Type)
+
+	s := &ctx.plus.state
+	switch r.Type {
+	case EMFPLUS_SETINTERPOLATIONMODE:
+		s.interpolation = r.Mode()
+	case EMFPLUS_SETCOMPOSITINGMODE:
+		s.compositing = r.Mode()
+	}
+	return nil
+}
+
+type EmfPlusSaveRecord struct {
+	EmfPlusRecord
+	StackIndex uint32
+}
+
+func readEmfPlusSaveRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusSaveRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.StackIndex); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusSaveRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSave")
+
+	ctx.plus.save(r.StackIndex)
+
+	return nil
+}
+
+type EmfPlusRestoreRecord struct {
+	EmfPlusRecord
+	StackIndex uint32
+}
+
+func readEmfPlusRestoreRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusRestoreRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.StackIndex); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusRestoreRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusRestore")
+
+	return ctx.plus.restore(r.StackIndex)
+}
+
+type EmfPlusBeginContainerRecord struct {
+	EmfPlusRecord
+	DestRect   EmfPlusRectF
+	SrcRect    EmfPlusRectF
+	StackIndex uint32
+}
+
+func readEmfPlusBeginContainerRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusBeginContainerRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.DestRect, &r.SrcRect, &r.StackIndex); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// PageUnit returns the unit of SrcRect.
+func (r *EmfPlusBeginContainerRecord) PageUnit() uint8 {
+	return uint8(r.Flags >> 8)
+}
+
+func (r *EmfPlusBeginContainerRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusBeginContainer")
+
+	p := ctx.plus
+	p.save(r.StackIndex)
+
+	src, dst := r.SrcRect, r.DestRect
+	if src.Width == 0 || src.Height == 0 {
+		return errors.New("failed to run EmfPlusBeginContainer")
+	}
+
+	// the source rectangle, converted to the page unit, is mapped onto the
+	// destination rectangle
+	k := p.unitScale(r.PageUnit()) / p.pageScale()
+	m := raster.Translate(-float64(src.X), -float64(src.Y)).
+		Mul(raster.Scale(float64(dst.Width)/float64(src.Width)*k, float64(dst.Height)/float64(src.Height)*k)).
+		Mul(raster.Translate(float64(dst.X), float64(dst.Y)))
+
+	p.state.world = m.Mul(p.state.world)
+
+	return nil
+}
+
+type EmfPlusBeginContainerNoParamsRecord struct {
+	EmfPlusRecord
+	StackIndex uint32
+}
+
+func readEmfPlusBeginContainerNoParamsRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusBeginContainerNoParamsRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.StackIndex); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusBeginContainerNoParamsRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusBeginContainerNoParams")
+
+	ctx.plus.save(r.StackIndex)
+
+	return nil
+}
+
+type EmfPlusEndContainerRecord struct {
+	EmfPlusRecord
+	StackIndex uint32
+}
+
+func readEmfPlusEndContainerRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusEndContainerRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.StackIndex); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusEndContainerRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusEndContainer")
+
+	return ctx.plus.restore(r.StackIndex)
+}
+
+type EmfPlusSetWorldTransformRecord struct {
+	EmfPlusRecord
+	Matrix EmfPlusTransformMatrix
+}
+
+func readEmfPlusSetWorldTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusSetWorldTransformRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Matrix); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusSetWorldTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSetWorldTransform")
+
+	ctx.plus.state.world = r.Matrix.matrix()
+
+	return nil
+}
+
+type EmfPlusResetWorldTransformRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusResetWorldTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusResetWorldTransformRecord{EmfPlusRecord: rec}, nil
+}
+
+func (r *EmfPlusResetWorldTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusResetWorldTransform")
+
+	ctx.plus.state.world = raster.Identity()
+
+	return nil
+}
+
+type EmfPlusMultiplyWorldTransformRecord struct {
+	EmfPlusRecord
+	Matrix EmfPlusTransformMatrix
+}
+
+func readEmfPlusMultiplyWorldTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusMultiplyWorldTransformRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Matrix); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusMultiplyWorldTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusMultiplyWorldTransform")
+
+	ctx.plus.transform(r.Matrix.matrix(), r.Flags)
+
+	return nil
+}
+
+type EmfPlusTranslateWorldTransformRecord struct {
+	EmfPlusRecord
+	Dx, Dy float32
+}
+
+func readEmfPlusTranslateWorldTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusTranslateWorldTransformRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Dx, &r.Dy); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusTranslateWorldTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusTranslateWorldTransform")
+
+	ctx.plus.transform(raster.Translate(float64(r.Dx), float64(r.Dy)), r.Flags)
+
+	return nil
+}
+
+type EmfPlusScaleWorldTransformRecord struct {
+	EmfPlusRecord
+	Sx, Sy float32
+}
+
+func readEmfPlusScaleWorldTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusScaleWorldTransformRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Sx, &r.Sy); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusScaleWorldTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusScaleWorldTransform")
+
+	ctx.plus.transform(raster.Scale(float64(r.Sx), float64(r.Sy)), r.Flags)
+
+	return nil
+}
+
+type EmfPlusRotateWorldTransformRecord struct {
+	EmfPlusRecord
+	Angle float32 // degrees, clockwise on screen
+}
+
+func readEmfPlusRotateWorldTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusRotateWorldTransformRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Angle); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusRotateWorldTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusRotateWorldTransform")
+
+	ctx.plus.transform(raster.Rotate(float64(r.Angle)*math.Pi/180), r.Flags)
+
+	return nil
+}
+
+type EmfPlusSetPageTransformRecord struct {
+	EmfPlusRecord
+	PageScale float32
+}
+
+func readEmfPlusSetPageTransformRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusSetPageTransformRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.PageScale); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// PageUnit returns the unit of page space.
+func (r *EmfPlusSetPageTransformRecord) PageUnit() uint8 {
+	return uint8(r.Flags)
+}
+
+func (r *EmfPlusSetPageTransformRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSetPageTransform")
+
+	s := &ctx.plus.state
+	s.pageUnit = r.PageUnit()
+	s.pageScale = float64(r.PageScale)
+
+	return nil
+}
+
+type EmfPlusResetClipRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusResetClipRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusResetClipRecord{EmfPlusRecord: rec}, nil
+}
+
+func (r *EmfPlusResetClipRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusResetClip")
+
+	ctx.plus.state.clip = nil
+
+	return nil
+}
+
+// combineMode returns the CombineMode of the clip records.
+func (r *EmfPlusRecord) combineMode() uint32 {
+	return uint32(r.Flags>>8) & 0x0F
+}
+
+type EmfPlusSetClipRectRecord struct {
+	EmfPlusRecord
+	Rect EmfPlusRectF
+}
+
+func readEmfPlusSetClipRectRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusSetClipRectRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Rect); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusSetClipRectRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSetClipRect")
+
+	p := ctx.plus
+	shape := (*clipRegion)(nil).intersect(p.rectsPath([]EmfPlusRectF{r.Rect}), raster.NonZero)
+	p.combineClip(shape, r.combineMode())
+
+	return nil
+}
+
+type EmfPlusSetClipPathRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusSetClipPathRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusSetClipPathRecord{EmfPlusRecord: rec}, nil
+}
+
+func (r *EmfPlusSetClipPathRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSetClipPath")
+
+	p := ctx.plus
+	path, ok := p.objects[r.objectID()].(*EmfPlusPath)
+	if !ok {
+		return errors.New("failed to run EmfPlusSetClipPath")
+	}
+
+	shape := (*clipRegion)(nil).intersect(path.path(p.matrix()), path.fillRule())
+	p.combineClip(shape, r.combineMode())
+
+	return nil
+}
+
+type EmfPlusSetClipRegionRecord struct {
+	EmfPlusRecord
+}
+
+func readEmfPlusSetClipRegionRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	return &EmfPlusSetClipRegionRecord{EmfPlusRecord: rec}, nil
+}
+
+func (r *EmfPlusSetClipRegionRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusSetClipRegion")
+
+	p := ctx.plus
+	region, ok := p.objects[r.objectID()].(*EmfPlusRegion)
+	if !ok {
+		return errors.New("failed to run EmfPlusSetClipRegion")
+	}
+
+	p.combineClip(p.regionClip(region), r.combineMode())
+
+	return nil
+}
+
+type EmfPlusOffsetClipRecord struct {
+	EmfPlusRecord
+	Dx, Dy float32
+}
+
+func readEmfPlusOffsetClipRecord(reader *bytes.Reader, rec EmfPlusRecord) (EmfPlusRecorder, error) {
+	r := &EmfPlusOffsetClipRecord{EmfPlusRecord: rec}
+
+	if err := readValues(reader, &r.Dx, &r.Dy); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *EmfPlusOffsetClipRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EmfPlusOffsetClip")
+
+	p := ctx.plus
+	d := p.matrix().ApplyVector(raster.Pt(float64(r.Dx), float64(r.Dy)))
+	p.state.clip = p.state.clip.translate(d.X, d.Y)
+
+	return nil
+}
@@ -0,0 +1,1205 @@
+package emf
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/raster"
+	log "github.com/sirupsen/logrus"
+)
+
+// plusDevice is implemented by devices which can play EMF+ records. EMF+
+// keeps its own graphics state and draws straight on the painter, in the
+// device space of the EMF records.
+type plusDevice interface {
+	plusPainter() (p painter, width, height int)
+}
+
+// plusState is the part of the EMF+ state saved by EmfPlusSave and
+// EmfPlusBeginContainer.
+type plusState struct {
+	world         raster.Matrix
+	pageUnit      uint8
+	pageScale     float64
+	clip          *clipRegion // in device space, nil does not clip
+	origin        raster.Point
+	interpolation uint16
+	compositing   uint16
+}
+
+// plusContext plays the EMF+ records of a file.
+type plusContext struct {
+	painter painter
+	width   int
+	height  int
+
+	active bool // an EMF+ header was played, EMF records are not drawn
+	dual   bool // the EMF records are an alternative to the EMF+ records
+	getDC  bool // EMF records are drawn up to the next EMF+ record
+
+	dpiX, dpiY float64
+
+	objects map[uint8]interface{}
+	partial map[uint8]*partialObject
+	state   plusState
+	saved   map[uint32]plusState
+	limits  *Limits
+	fonts   *FontResolver
+	report  *fontReport
+}
+
+func newPlusContext(p painter, width, height int) *plusContext {
+	return &plusContext{
+		painter: p,
+		width:   width,
+		height:  height,
+		dpiX:    96,
+		dpiY:    96,
+		objects: make(map[uint8]interface{}),
+		partial: make(map[uint8]*partialObject),
+		saved:   make(map[uint32]plusState),
+		state: plusState{
+			world:     raster.Identity(),
+			pageUnit:  UNITTYPE_DISPLAY,
+			pageScale: 1,
+		},
+	}
+}
+
+// playPlus draws the records of an EMF+ comment. Devices which cannot
+// play EMF+ get the EMF records instead, which an EMF+ only metafile does
+// not have, so it fails with ErrPlusUnsupported.
+func (e *EmfContext) playPlus(recs []EmfPlusRecorder) error {
+	if e.plus == nil {
+		dev, ok := e.Device().(plusDevice)
+		if !ok {
+			for _, rec := range recs {
+				if h, ok := rec.(*EmfPlusHeaderRecord); ok && h.Flags&EMFPLUS_FLAG_DUAL == 0 {
+					return ErrPlusUnsupported
+				}
+			}
+			return nil
+		}
+
+		e.plus = newPlusContext(dev.plusPainter())
+		e.plus.limits = e.limits
+		e.plus.fonts = e.fonts
+		e.plus.report = &e.report
+	}
+
+	e.plus.getDC = false
+	for _, rec := range recs {
+		if err := rec.Draw(e); err != nil {
+			err = fmt.Errorf("EMF+ record %#04x: %w", plusRecordType(rec), err)
+			if e.strict {
+				return err
+			}
+			log.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// skipRecord reports whether an EMF record is replaced by the EMF+ records.
+func (e *EmfContext) skipRecord(rec Recorder) bool {
+	if e.plus == nil || !e.plus.active || e.plus.getDC {
+		return false
+	}
+
+	_, ok := rec.(*CommentEmfPlusRecord)
+	return !ok
+}
+
+// unitScale returns the size of unit in device pixels.
+func (p *plusContext) unitScale(unit uint8) float64 {
+	switch unit {
+	case UNITTYPE_POINT:
+		return p.dpiX / 72
+	case UNITTYPE_INCH:
+		return p.dpiX
+	case UNITTYPE_DOCUMENT:
+		return p.dpiX / 300
+	case UNITTYPE_MILLIMETER:
+		return p.dpiX / 25.4
+	}
+
+	// world, display and pixel units are device pixels in a metafile
+	return 1
+}
+
+func (p *plusContext) pageScale() float64 {
+	return p.unitScale(p.state.pageUnit) * p.state.pageScale
+}
+
+// matrix returns the mapping from world space to device space.
+func (p *plusContext) matrix() raster.Matrix {
+	k := p.pageScale()
+	return p.state.world.Mul(raster.Scale(k, k))
+}
+
+// transform combines m with the world transform, after it when the record
+// has the A flag.
+func (p *plusContext) transform(m raster.Matrix, flags uint16) {
+	if flags&EMFPLUS_FLAG_APPEND != 0 {
+		p.state.world = p.state.world.Mul(m)
+	} else {
+		p.state.world = m.Mul(p.state.world)
+	}
+}
+
+func (p *plusContext) save(index uint32) {
+	p.saved[index] = p.state
+}
+
+func (p *plusContext) restore(index uint32) error {
+	s, ok := p.saved[index]
+	if !ok {
+		return errors.New("failed to run EmfPlusRestore")
+	}
+
+	p.state = s
+	delete(p.saved, index)
+	return nil
+}
+
+// partialObject is the data of an object split over several records,
+// collected up to the size declared by the first of them.
+type partialObject struct {
+	size uint32
+	data []byte
+}
+
+// add appends the data of a record, false when it goes past the size.
+func (o *partialObject) add(data []byte) bool {
+	if uint64(len(o.data))+uint64(len(data)) > uint64(o.size) {
+		return false
+	}
+	o.data = append(o.data, data...)
+	return true
+}
+
+// setObject stores the object of a record, collecting the data of objects
+// split over several records. An object which does not fit the size it
+// declares, or the limits, is dropped.
+func (p *plusContext) setObject(r *EmfPlusObjectRecord) error {
+	id := r.ObjectID()
+	partial := p.partial[id]
+
+	if r.Continued() {
+		if partial != nil && partial.size != r.TotalObjectSize {
+			delete(p.partial, id)
+			return errors.New("continued EMF+ object changes its size")
+		}
+
+		if partial == nil {
+			if p.limits != nil && p.limits.MaxRecordSize > 0 && r.TotalObjectSize > p.limits.MaxRecordSize {
+				return fmt.Errorf("%w: EMF+ object of %d bytes", ErrLimit, r.TotalObjectSize)
+			}
+			partial = &partialObject{size: r.TotalObjectSize}
+			p.partial[id] = partial
+		}
+
+		if !partial.add(r.Data) {
+			delete(p.partial, id)
+			return errors.New("continued EMF+ object exceeds its size")
+		}
+		return nil
+	}
+
+	object := r.Object
+	if partial != nil {
+		delete(p.partial, id)
+
+		if !partial.add(r.Data) {
+			return errors.New("continued EMF+ object exceeds its size")
+		}
+
+		var err error
+		if object, err = parsePlusObject(r.ObjectType(), partial.data); err != nil {
+			return err
+		}
+	}
+
+	p.objects[id] = object
+	return nil
+}
+
+func (p *plusContext) clipRegion() *clipRegion {
+	return p.state.clip
+}
+
+func (p *plusContext) deviceRect() *raster.Path {
+	return rectPath(raster.Identity(), 0, 0, float64(p.width), float64(p.height))
+}
+
+// emptyClip clips everything away.
+func (p *plusContext) emptyClip() *clipRegion {
+	return (*clipRegion)(nil).intersect(rectPath(raster.Identity(), 0, 0, 0, 0), raster.NonZero)
+}
+
+// complement returns the part of the device outside of c. Like the EMF
+// clipping of the software device it is exact for a single shape, several
+// shapes are treated as their union.
+func (p *plusContext) complement(c *clipRegion) *clipRegion {
+	if c == nil {
+		return p.emptyClip()
+	}
+
+	path := p.deviceRect()
+	for _, part := range c.parts {
+		path.Append(part.path)
+	}
+	return (*clipRegion)(nil).intersect(path, raster.EvenOdd)
+}
+
+// union joins two shapes, exactly when both are single shapes filled with
+// NonZero, otherwise by filling all of their outlines.
+func (p *plusContext) union(a, b *clipRegion) *clipRegion {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	path := &raster.Path{}
+	for _, part := range append(append([]clipPart{}, a.parts...), b.parts...) {
+		if part.rule != raster.NonZero || len(a.parts) > 1 || len(b.parts) > 1 {
+			log.Warn("inexact union of EMF+ shapes")
+		}
+		path.Append(part.path)
+	}
+	return (*clipRegion)(nil).intersect(path, raster.NonZero)
+}
+
+// combine applies a CombineMode to two device space shapes, nil being the
+// infinite shape.
+func (p *plusContext) combine(a, b *clipRegion, mode uint32) *clipRegion {
+	switch mode {
+	case COMBINEMODE_REPLACE:
+		return b
+	case COMBINEMODE_INTERSECT:
+		return a.intersectRegion(b)
+	case COMBINEMODE_UNION:
+		return p.union(a, b)
+	case COMBINEMODE_XOR:
+		return p.union(a, b).intersectRegion(p.complement(a.intersectRegion(b)))
+	case COMBINEMODE_EXCLUDE:
+		return a.intersectRegion(p.complement(b))
+	case COMBINEMODE_COMPLEMENT:
+		return b.intersectRegion(p.complement(a))
+	}
+
+	log.Errorf("invalid combine mode %d", mode)
+	return a
+}
+
+func (p *plusContext) combineClip(shape *clipRegion, mode uint32) {
+	p.state.clip = p.combine(p.state.clip, shape, mode)
+}
+
+// regionClip returns the device space shape of a region.
+func (p *plusContext) regionClip(r *EmfPlusRegion) *clipRegion {
+	var node func(n *EmfPlusRegionNode) *clipRegion
+	node = func(n *EmfPlusRegionNode) *clipRegion {
+		switch n.Type {
+		case REGIONNODE_RECT:
+			return (*clipRegion)(nil).intersect(p.rectsPath([]EmfPlusRectF{n.Rect}), raster.NonZero)
+		case REGIONNODE_PATH:
+			return (*clipRegion)(nil).intersect(n.Path.path(p.matrix()), n.Path.fillRule())
+		case REGIONNODE_EMPTY:
+			return p.emptyClip()
+		case REGIONNODE_INFINITE:
+			return nil
+		}
+
+		// the node types of the operations follow the combine modes
+		return p.combine(node(n.Left), node(n.Right), n.Type)
+	}
+
+	return node(r.Root)
+}
+
+func (p *plusContext) rectsPath(rects []EmfPlusRectF) *raster.Path {
+	m := p.matrix()
+
+	path := &raster.Path{}
+	for _, r := range rects {
+		path.Append(rectPath(m, float64(r.X), float64(r.Y), float64(r.X+r.Width), float64(r.Y+r.Height)))
+	}
+	return path
+}
+
+func (p *plusContext) linesPath(points []EmfPlusPointF, closed bool) *raster.Path {
+	m := p.matrix()
+
+	path := &raster.Path{}
+	for i, pt := range points {
+		if i == 0 {
+			path.MoveTo(m.Apply(pt.point()))
+		} else {
+			path.LineTo(m.Apply(pt.point()))
+		}
+	}
+	if closed {
+		path.Close()
+	}
+	return path
+}
+
+// arcPath returns an arc of the ellipse in rect, closed to a pie when pie is
+// set. Angles are in degrees, clockwise on screen, and measured on the
+// ellipse as on a circle.
+func (p *plusContext) arcPath(rect EmfPlusRectF, start, sweep float32, pie bool) *raster.Path {
+	rx, ry := float64(rect.Width)/2, float64(rect.Height)/2
+	center := raster.Pt(float64(rect.X)+rx, float64(rect.Y)+ry)
+
+	path := &raster.Path{}
+	if rx == 0 || ry == 0 {
+		return path
+	}
+
+	// parametric angle of the point of the ellipse in direction a
+	param := func(a float64) float64 {
+		s, c := math.Sincos(a)
+		return math.Atan2(rx*s, ry*c)
+	}
+
+	a0 := float64(start) * math.Pi / 180
+	a1 := float64(start+sweep) * math.Pi / 180
+
+	t0 := param(a0)
+	t := param(a1) - t0
+	full := math.Abs(float64(sweep)) >= 360
+	switch {
+	case full:
+		t = math.Copysign(2*math.Pi, float64(sweep))
+	case sweep > 0:
+		for t < 0 {
+			t += 2 * math.Pi
+		}
+		t += math.Floor((a1-a0)/(2*math.Pi)) * 2 * math.Pi
+	case sweep < 0:
+		for t > 0 {
+			t -= 2 * math.Pi
+		}
+	}
+
+	if pie && !full {
+		path.MoveTo(center)
+	}
+	path.ArcToCubics(center, rx, ry, t0, t)
+	if pie || full {
+		path.Close()
+	}
+
+	return path.Transform(p.matrix())
+}
+
+// curvePath returns a cardinal spline through points, of segments segments
+// from offset.
+func (p *plusContext) curvePath(points []EmfPlusPointF, tension float32, offset, segments int, closed bool) *raster.Path {
+	m := p.matrix()
+	path := &raster.Path{}
+
+	n := len(points)
+	if n < 2 {
+		return path
+	}
+
+	pt := func(i int) raster.Point {
+		if closed {
+			i = (i%n + n) % n
+		} else if i < 0 {
+			i = 0
+		} else if i >= n {
+			i = n - 1
+		}
+		return points[i].point()
+	}
+
+	k := float64(tension) / 3
+	if closed {
+		segments = n
+	}
+
+	path.MoveTo(m.Apply(pt(offset)))
+	for i := offset; i < offset+segments; i++ {
+		p0, p1, p2, p3 := pt(i-1), pt(i), pt(i+1), pt(i+2)
+		c1 := p1.Add(p2.Sub(p0).Mul(k))
+		c2 := p2.Sub(p3.Sub(p1).Mul(k))
+		path.CubeTo(m.Apply(c1), m.Apply(c2), m.Apply(p2))
+	}
+	if closed {
+		path.Close()
+	}
+
+	return path
+}
+
+// brush returns the brush of a record, which is a color when the record
+// has the S flag.
+func (p *plusContext) brush(flags uint16, id uint32) (*EmfPlusBrush, error) {
+	if flags&EMFPLUS_FLAG_COLOR != 0 {
+		return &EmfPlusBrush{Type: BRUSHTYPE_SOLIDCOLOR, Data: &EmfPlusSolidBrushData{SolidColor: argbFromUint32(id)}}, nil
+	}
+
+	b, ok := p.objects[uint8(id)].(*EmfPlusBrush)
+	if !ok {
+		return nil, fmt.Errorf("EMF+ object %d is not a brush", id)
+	}
+	return b, nil
+}
+
+// brushColor returns a single color for the brush, for strokes and text.
+func (b *EmfPlusBrush) color() color.RGBA {
+	switch d := b.Data.(type) {
+	case *EmfPlusSolidBrushData:
+		return d.SolidColor.rgba()
+	case *EmfPlusHatchBrushData:
+		return d.ForeColor.rgba()
+	case *EmfPlusLinearGradientBrushData:
+		return d.StartColor.rgba()
+	case *EmfPlusPathGradientBrushData:
+		return d.CenterColor.rgba()
+	}
+	return color.RGBA{0, 0, 0, 0xFF}
+}
+
+func (p *plusContext) fill(path *raster.Path, rule raster.FillRule, flags uint16, id uint32) {
+	b, err := p.brush(flags, id)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	p.fillBrush((*clipRegion)(nil).intersect(path, rule), b)
+}
+
+func (p *plusContext) fillRegion(shape *clipRegion, flags uint16, id uint32) {
+	b, err := p.brush(flags, id)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if shape == nil {
+		shape = (*clipRegion)(nil).intersect(p.deviceRect(), raster.NonZero)
+	}
+
+	p.fillBrush(shape, b)
+}
+
+// fillBrush fills the intersection of the shapes with a brush.
+func (p *plusContext) fillBrush(shape *clipRegion, b *EmfPlusBrush) {
+	clip := p.clipRegion()
+
+	// the last shape is filled, the others clip it
+	last := shape.parts[len(shape.parts)-1]
+	if len(shape.parts) > 1 {
+		clip = clip.intersectRegion(&clipRegion{parts: shape.parts[:len(shape.parts)-1]})
+	}
+
+	switch d := b.Data.(type) {
+	case *EmfPlusSolidBrushData:
+		if d.SolidColor.Alpha == 0 {
+			return
+		}
+		p.painter.Fill(last.path, last.rule, paint{Color: d.SolidColor.rgba()}, clip)
+
+	case *EmfPlusHatchBrushData:
+		origin := image.Pt(int(math.Round(p.state.origin.X)), int(math.Round(p.state.origin.Y)))
+		p.painter.Fill(last.path, last.rule, paint{Color: d.ForeColor.rgba(), Pattern: hatchTile(d), Origin: origin}, clip)
+
+	default:
+		img, m, err := p.brushImage(b, last.path)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if img != nil {
+			p.painter.DrawImage(img, m, raster.ImageOver, true, clip.intersect(last.path, last.rule))
+		}
+	}
+}
+
+// hatchTile returns the 8x8 pattern of a hatch brush. The percentage
+// styles are ordered dithers, the other styles without a GDI equivalent
+// are drawn as 50 percent.
+func hatchTile(d *EmfPlusHatchBrushData) *image.RGBA {
+	bayer := [8][8]int{
+		{0, 32, 8, 40, 2, 34, 10, 42},
+		{48, 16, 56, 24, 50, 18, 58, 26},
+		{12, 44, 4, 36, 14, 46, 6, 38},
+		{60, 28, 52, 20, 62, 30, 54, 22},
+		{3, 35, 11, 43, 1, 33, 9, 41},
+		{51, 19, 59, 27, 49, 17, 57, 25},
+		{15, 47, 7, 39, 13, 45, 5, 37},
+		{63, 31, 55, 23, 61, 29, 53, 21},
+	}
+	percents := []int{5, 10, 20, 25, 30, 40, 50, 60, 70, 75, 80, 90}
+
+	hatch, ok := hatchPatterns[d.HatchStyle]
+	if !ok {
+		percent := 50
+		if d.HatchStyle >= 6 && d.HatchStyle < 6+uint32(len(percents)) {
+			percent = percents[d.HatchStyle-6]
+		}
+		hatch = func(x, y int) bool {
+			return bayer[y][x] < percent*64/100
+		}
+	}
+
+	fore, back := d.ForeColor.rgba(), d.BackColor.rgba()
+
+	tile := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if hatch(x, y) {
+				tile.SetRGBA(x, y, fore)
+			} else {
+				tile.SetRGBA(x, y, back)
+			}
+		}
+	}
+	return tile
+}
+
+// maxBrushPixels limits the images made for gradient and texture brushes.
+const maxBrushPixels = 1 << 22
+
+// brushImage renders a gradient or texture brush over the bounds of shape.
+// It returns the image and its mapping to device space.
+func (p *plusContext) brushImage(b *EmfPlusBrush, shape *raster.Path) (image.Image, raster.Matrix, error) {
+	toDevice := func(t *EmfPlusTransformMatrix) raster.Matrix {
+		m := p.matrix()
+		if t != nil {
+			m = t.matrix().Mul(m)
+		}
+		return m
+	}
+
+	switch d := b.Data.(type) {
+	case *EmfPlusLinearGradientBrushData:
+		return linearGradientImage(d, toDevice(d.Transform), shape)
+	case *EmfPlusPathGradientBrushData:
+		return pathGradientImage(d, toDevice(d.Transform), shape)
+	case *EmfPlusTextureBrushData:
+		return textureImage(d, toDevice(d.Transform), shape, p.limits)
+	}
+
+	return nil, raster.Matrix{}, fmt.Errorf("unknown EMF+ brush type %d", b.Type)
+}
+
+// brushBounds returns the bounds of the device space shape in the space m
+// maps to device space.
+func brushBounds(m raster.Matrix, shape *raster.Path) (raster.Point, raster.Point, bool) {
+	inv, ok := m.Invert()
+	if !ok || shape.Empty() {
+		return raster.Point{}, raster.Point{}, false
+	}
+
+	lo, hi := shape.Bounds()
+	corners := []raster.Point{lo, {X: hi.X, Y: lo.Y}, hi, {X: lo.X, Y: hi.Y}}
+
+	min, max := inv.Apply(corners[0]), inv.Apply(corners[0])
+	for _, c := range corners[1:] {
+		q := inv.Apply(c)
+		min.X, min.Y = math.Min(min.X, q.X), math.Min(min.Y, q.Y)
+		max.X, max.Y = math.Max(max.X, q.X), math.Max(max.Y, q.Y)
+	}
+	return min, max, true
+}
+
+func lerpColor(a, b color.NRGBA, t float64) color.NRGBA {
+	t = math.Max(0, math.Min(1, t))
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// wrapPosition folds a position along a gradient or texture into [0, 1).
+func wrapPosition(t float64, flip bool) float64 {
+	i := math.Floor(t)
+	t -= i
+	if flip && int64(i)%2 != 0 {
+		t = 1 - t
+	}
+	return t
+}
+
+// gradientColor returns the color at t of a linear gradient.
+func (d *EmfPlusLinearGradientBrushData) gradientColor(t float64) color.NRGBA {
+	if n := len(d.PresetColors); n > 0 {
+		if t <= float64(d.PresetPositions[0]) {
+			return d.PresetColors[0].nrgba()
+		}
+		for i := 1; i < n; i++ {
+			p0, p1 := float64(d.PresetPositions[i-1]), float64(d.PresetPositions[i])
+			if t <= p1 {
+				if p1 <= p0 {
+					return d.PresetColors[i].nrgba()
+				}
+				return lerpColor(d.PresetColors[i-1].nrgba(), d.PresetColors[i].nrgba(), (t-p0)/(p1-p0))
+			}
+		}
+		return d.PresetColors[n-1].nrgba()
+	}
+
+	f := t
+	if n := len(d.BlendFactors); n > 0 {
+		f = float64(d.BlendFactors[n-1])
+		for i := 0; i < n; i++ {
+			p1 := float64(d.BlendPositions[i])
+			if t <= p1 {
+				if i == 0 {
+					f = float64(d.BlendFactors[0])
+					break
+				}
+				p0 := float64(d.BlendPositions[i-1])
+				f0, f1 := float64(d.BlendFactors[i-1]), float64(d.BlendFactors[i])
+				if p1 > p0 {
+					f = f0 + (f1-f0)*(t-p0)/(p1-p0)
+				} else {
+					f = f1
+				}
+				break
+			}
+		}
+	}
+
+	return lerpColor(d.StartColor.nrgba(), d.EndColor.nrgba(), f)
+}
+
+// linearGradientImage renders a linear gradient, which runs along the X axis
+// of its rectangle, as one row of pixels stretched over the shape.
+func linearGradientImage(d *EmfPlusLinearGradientBrushData, m raster.Matrix, shape *raster.Path) (image.Image, raster.Matrix, error) {
+	r := d.Rect
+	if r.Width == 0 || r.Height == 0 {
+		return nil, raster.Matrix{}, errors.New("empty linear gradient")
+	}
+
+	// brush space with the rectangle as unit square
+	m = raster.Scale(float64(r.Width), float64(r.Height)).Mul(raster.Translate(float64(r.X), float64(r.Y))).Mul(m)
+
+	min, max, ok := brushBounds(m, shape)
+	if !ok {
+		return nil, raster.Matrix{}, nil
+	}
+
+	length := m.ApplyVector(raster.Pt(max.X-min.X, 0)).Len()
+	n := int(math.Min(math.Max(math.Ceil(length), 2), 4096))
+
+	img := image.NewNRGBA(image.Rect(0, 0, n, 1))
+	flip := d.WrapMode == WRAPMODE_TILEFLIPX || d.WrapMode == WRAPMODE_TILEFLIPXY
+	for i := 0; i < n; i++ {
+		t := min.X + (float64(i)+0.5)*(max.X-min.X)/float64(n)
+		img.SetNRGBA(i, 0, d.gradientColor(wrapPosition(t, flip)))
+	}
+
+	h := max.Y - min.Y
+	if h == 0 {
+		h = 1
+	}
+	toBrush := raster.Scale((max.X-min.X)/float64(n), h).Mul(raster.Translate(min.X, min.Y))
+
+	return img, toBrush.Mul(m), nil
+}
+
+// pathGradientImage renders a path gradient, which blends from the center
+// color to the surrounding colors at the boundary and paints nothing
+// outside of it.
+func pathGradientImage(d *EmfPlusPathGradientBrushData, m raster.Matrix, shape *raster.Path) (image.Image, raster.Matrix, error) {
+	var boundary []raster.Point
+	if d.BoundaryPath != nil {
+		for _, l := range d.BoundaryPath.path(raster.Identity()).Flatten(raster.DefaultTolerance) {
+			boundary = append(boundary, l.Points...)
+		}
+	} else {
+		for _, pt := range d.BoundaryPoints {
+			boundary = append(boundary, pt.point())
+		}
+	}
+
+	if len(boundary) < 3 {
+		return nil, raster.Matrix{}, errors.New("invalid path gradient boundary")
+	}
+
+	// render in device pixels over the shape
+	lo, hi := shape.Bounds()
+	lo.X, lo.Y = math.Max(math.Floor(lo.X), -1e6), math.Max(math.Floor(lo.Y), -1e6)
+	w, h := int(math.Ceil(hi.X-lo.X)), int(math.Ceil(hi.Y-lo.Y))
+	if w <= 0 || h <= 0 {
+		return nil, raster.Matrix{}, nil
+	}
+
+	step := 1.0
+	for float64(w)*float64(h)/(step*step) > maxBrushPixels/4 {
+		step *= 2
+	}
+	iw, ih := int(math.Ceil(float64(w)/step)), int(math.Ceil(float64(h)/step))
+
+	inv, ok := m.Invert()
+	if !ok {
+		return nil, raster.Matrix{}, nil
+	}
+
+	center := d.CenterPoint.point()
+	centerColor := d.CenterColor.nrgba()
+
+	surround := func(edge int, mu float64) color.NRGBA {
+		n := len(d.SurroundingColors)
+		switch {
+		case n == 0:
+			return centerColor
+		case n == 1 || d.BoundaryPath != nil:
+			return d.SurroundingColors[0].nrgba()
+		}
+		at := func(i int) color.NRGBA {
+			if i >= n {
+				i = n - 1
+			}
+			return d.SurroundingColors[i].nrgba()
+		}
+		return lerpColor(at(edge), at((edge+1)%len(boundary)), mu)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, iw, ih))
+	for y := 0; y < ih; y++ {
+		for x := 0; x < iw; x++ {
+			q := inv.Apply(raster.Pt(lo.X+(float64(x)+0.5)*step, lo.Y+(float64(y)+0.5)*step))
+			dir := q.Sub(center)
+
+			// the farthest crossing of the ray from the center through q
+			// with the boundary, q being at 1
+			best, edge, at := 0.0, -1, 0.0
+			for i := range boundary {
+				a, b := boundary[i], boundary[(i+1)%len(boundary)]
+				e := b.Sub(a)
+				den := dir.Cross(e)
+				if den == 0 {
+					continue
+				}
+				ac := a.Sub(center)
+				lambda := ac.Cross(e) / den
+				mu := ac.Cross(dir) / den
+				if lambda > best && mu >= 0 && mu <= 1 {
+					best, edge, at = lambda, i, mu
+				}
+			}
+
+			if edge < 0 || best < 1 {
+				continue
+			}
+
+			img.SetNRGBA(x, y, lerpColor(centerColor, surround(edge, at), 1/best))
+		}
+	}
+
+	return img, raster.Scale(step, step).Mul(raster.Translate(lo.X, lo.Y)), nil
+}
+
+// textureImage repeats the image of a texture brush over the shape, or
+// draws it once when it is clamped.
+func textureImage(d *EmfPlusTextureBrushData, m raster.Matrix, shape *raster.Path, limits *Limits) (image.Image, raster.Matrix, error) {
+	tex, err := d.Image.image(limits)
+	if err != nil {
+		return nil, raster.Matrix{}, err
+	}
+
+	tb := tex.Bounds()
+	if tb.Empty() {
+		return nil, raster.Matrix{}, nil
+	}
+	if d.WrapMode == WRAPMODE_CLAMP {
+		return tex, raster.Translate(-float64(tb.Min.X), -float64(tb.Min.Y)).Mul(m), nil
+	}
+
+	min, max, ok := brushBounds(m, shape)
+	if !ok {
+		return nil, raster.Matrix{}, nil
+	}
+
+	tw, th := tb.Dx(), tb.Dy()
+	x0, y0 := int(math.Floor(min.X/float64(tw)))*tw, int(math.Floor(min.Y/float64(th)))*th
+	x1, y1 := int(math.Ceil(max.X/float64(tw)))*tw, int(math.Ceil(max.Y/float64(th)))*th
+	if float64(x1-x0)*float64(y1-y0) > maxBrushPixels {
+		return nil, raster.Matrix{}, errors.New("texture brush too large")
+	}
+
+	flipX := d.WrapMode == WRAPMODE_TILEFLIPX || d.WrapMode == WRAPMODE_TILEFLIPXY
+	flipY := d.WrapMode == WRAPMODE_TILEFLIPY || d.WrapMode == WRAPMODE_TILEFLIPXY
+
+	img := image.NewNRGBA(image.Rect(0, 0, x1-x0, y1-y0))
+	for y := y0; y < y1; y++ {
+		ty := int(wrapPosition((float64(y)+0.5)/float64(th), flipY) * float64(th))
+		for x := x0; x < x1; x++ {
+			tx := int(wrapPosition((float64(x)+0.5)/float64(tw), flipX) * float64(tw))
+			img.Set(x-x0, y-y0, tex.At(tb.Min.X+tx, tb.Min.Y+ty))
+		}
+	}
+
+	return img, raster.Translate(float64(x0), float64(y0)).Mul(m), nil
+}
+
+// pen returns the stroke and paint of a pen object in device space.
+func (p *plusContext) pen(id uint8) (raster.Stroke, paint, bool) {
+	pen, ok := p.objects[id].(*EmfPlusPen)
+	if !ok {
+		log.Errorf("EMF+ object %d is not a pen", id)
+		return raster.Stroke{}, paint{}, false
+	}
+
+	scale := p.matrix().ScaleFactor()
+	if pen.PenUnit != UNITTYPE_WORLD {
+		scale = p.unitScale(uint8(pen.PenUnit))
+	}
+
+	width := float64(pen.PenWidth) * scale
+	s := raster.Stroke{
+		Width:      math.Max(1, width),
+		Cap:        raster.CapFlat,
+		Join:       raster.JoinMiter,
+		MiterLimit: float64(pen.MiterLimit),
+	}
+
+	switch pen.StartCap {
+	case LINECAPTYPE_SQUARE:
+		s.Cap = raster.CapSquare
+	case LINECAPTYPE_ROUND:
+		s.Cap = raster.CapRound
+	}
+
+	switch pen.Join {
+	case LINEJOINTYPE_BEVEL:
+		s.Join = raster.JoinBevel
+	case LINEJOINTYPE_ROUND:
+		s.Join = raster.JoinRound
+	}
+
+	// dash lengths are in pen widths
+	var dashes []float32
+	switch pen.LineStyle {
+	case LINESTYLE_DASH:
+		dashes = []float32{3, 1}
+	case LINESTYLE_DOT:
+		dashes = []float32{1, 1}
+	case LINESTYLE_DASHDOT:
+		dashes = []float32{3, 1, 1, 1}
+	case LINESTYLE_DASHDOTDOT:
+		dashes = []float32{3, 1, 1, 1, 1, 1}
+	case LINESTYLE_CUSTOM:
+		dashes = pen.DashedLineData
+	}
+	for _, v := range dashes {
+		s.Dashes = append(s.Dashes, float64(v)*s.Width)
+	}
+	s.DashOffset = float64(pen.DashOffset) * s.Width
+
+	src := paint{Color: color.RGBA{0, 0, 0, 0xFF}}
+	if pen.Brush != nil {
+		src.Color = pen.Brush.color()
+	}
+
+	return s, src, src.Color.A != 0
+}
+
+func (p *plusContext) stroke(path *raster.Path, id uint8) {
+	s, src, ok := p.pen(id)
+	if !ok || path.Empty() {
+		return
+	}
+
+	p.painter.Stroke(path, s, src, p.clipRegion())
+}
+
+func (p *plusContext) drawImage(id uint8, srcUnit int32, src EmfPlusRectF, dst [3]EmfPlusPointF) error {
+	object, ok := p.objects[id].(*EmfPlusImage)
+	if !ok {
+		return fmt.Errorf("EMF+ object %d is not an image", id)
+	}
+
+	img, err := object.image(p.limits)
+	if err != nil {
+		return err
+	}
+
+	// the source rectangle in pixels of the image
+	k := p.unitScale(uint8(srcUnit))
+	sx, sy := float64(src.X)*k, float64(src.Y)*k
+	sw, sh := float64(src.Width)*k, float64(src.Height)*k
+	if sw == 0 || sh == 0 {
+		return errors.New("failed to run EmfPlusDrawImage")
+	}
+
+	p0, p1, p2 := dst[0].point(), dst[1].point(), dst[2].point()
+	a := p1.Sub(p0).Mul(1 / sw)
+	c := p2.Sub(p0).Mul(1 / sh)
+	m := raster.Matrix{A: a.X, B: a.Y, C: c.X, D: c.Y}
+	m.E = p0.X - m.A*sx - m.C*sy
+	m.F = p0.Y - m.B*sx - m.D*sy
+
+	b := img.Bounds()
+	m = raster.Translate(-float64(b.Min.X), -float64(b.Min.Y)).Mul(m).Mul(p.matrix())
+
+	// only the source rectangle is drawn
+	area := &raster.Path{}
+	world := p.matrix()
+	area.MoveTo(world.Apply(p0))
+	area.LineTo(world.Apply(p1))
+	area.LineTo(world.Apply(p1.Add(p2.Sub(p0))))
+	area.LineTo(world.Apply(p2))
+	area.Close()
+
+	const nearestNeighbor = 5
+	smooth := p.state.interpolation != nearestNeighbor
+
+	p.painter.DrawImage(img, m, raster.ImageOver, smooth, p.clipRegion().intersect(area, raster.NonZero))
+	return nil
+}
+
+// font returns a font object and its face.
+func (p *plusContext) font(id uint8) (*EmfPlusFont, error) {
+	font, ok := p.objects[id].(*EmfPlusFont)
+	if !ok {
+		return nil, fmt.Errorf("EMF+ object %d is not a font", id)
+	}
+
+	if font.face == nil {
+		face, match, err := p.fonts.face(font.logFont())
+		if err != nil {
+			return nil, err
+		}
+		font.face = face
+		p.report.add(match)
+	}
+
+	return font, nil
+}
+
+// emSize returns the em size of a font in world units.
+func (p *plusContext) emSize(font *EmfPlusFont) float64 {
+	if font.SizeUnit == UNITTYPE_WORLD {
+		return float64(font.EmSize)
+	}
+	return float64(font.EmSize) * p.unitScale(uint8(font.SizeUnit)) / p.pageScale()
+}
+
+// textRun places runes at origins given in world space, m mapping world
+// space to device space.
+func (p *plusContext) textRun(font *EmfPlusFont, em float64, m raster.Matrix, runes []rune, origins []raster.Point, width []float64, c color.RGBA) *textRun {
+	face := font.face
+	scale := em / face.unitsPerEm
+
+	t := m
+	t.E, t.F = 0, 0
+
+	run := &textRun{
+		Text:      runes,
+		Font:      font.GetFamilyName(),
+		Weight:    400,
+		Italic:    font.FontStyleFlags&FONTSTYLE_ITALIC != 0,
+		Underline: font.FontStyleFlags&FONTSTYLE_UNDERLINE != 0,
+		StrikeOut: font.FontStyleFlags&FONTSTYLE_STRIKEOUT != 0,
+		Size:      em * t.ScaleFactor(),
+		Matrix:    raster.Scale(em, em).Mul(t),
+		Color:     c,
+		Outline:   &raster.Path{},
+		Lines:     &raster.Path{},
+		Face:      face,
+	}
+	if font.FontStyleFlags&FONTSTYLE_BOLD != 0 {
+		run.Weight = 700
+	}
+
+	glyph := raster.Scale(scale, scale).Mul(t)
+	for i, r := range runes {
+		g := face.glyphIndex(r)
+		o := m.Apply(origins[i])
+
+		run.Glyphs = append(run.Glyphs, g)
+		run.Origins = append(run.Origins, o)
+		run.Outline.Append(face.outline(g).Transform(glyph.Mul(raster.Translate(o.X, o.Y))))
+
+		// decorations run under every glyph to the origin of the next one
+		lines := glyph.Mul(raster.Translate(o.X, o.Y))
+		if run.Underline {
+			top := face.underline
+			run.Lines.Append(rectPath(lines, 0, top, width[i]/scale, top+face.lineWidth))
+		}
+		if run.StrikeOut {
+			top := -face.ascent * 0.3
+			run.Lines.Append(rectPath(lines, 0, top, width[i]/scale, top+face.lineWidth))
+		}
+	}
+	run.Outline.Append(run.Lines)
+
+	return run
+}
+
+// drawString lays out the text in the layout rectangle, breaking lines at
+// line feeds and, unless the format forbids it, between words.
+func (p *plusContext) drawString(r *EmfPlusDrawStringRecord) error {
+	font, err := p.font(r.objectID())
+	if err != nil {
+		return err
+	}
+
+	b, err := p.brush(r.Flags, r.BrushID)
+	if err != nil {
+		return err
+	}
+
+	format, _ := p.objects[uint8(r.FormatID)].(*EmfPlusStringFormat)
+	if format == nil {
+		// StringFormat.GenericDefault
+		format = &EmfPlusStringFormat{LeadingMargin: 1.0 / 6, TrailingMargin: 1.0 / 6}
+	}
+
+	face := font.face
+	em := p.emSize(font)
+	scale := em / face.unitsPerEm
+	rect := r.LayoutRect
+
+	lead := float64(format.LeadingMargin) * em
+	trail := float64(format.TrailingMargin) * em
+	avail := float64(rect.Width) - lead - trail
+	wrap := rect.Width > 0 && format.StringFormatFlags&STRINGFORMAT_NOWRAP == 0
+
+	advance := func(r rune) float64 {
+		return face.advance(face.glyphIndex(r)) * scale
+	}
+	measure := func(rs []rune) float64 {
+		w := 0.0
+		for _, r := range rs {
+			w += advance(r)
+		}
+		return w
+	}
+
+	// break the text into lines
+	var lines [][]rune
+	text := strings.ReplaceAll(string(utf16.Decode(r.String)), "\r\n", "\n")
+	for _, para := range strings.Split(text, "\n") {
+		words := strings.SplitAfter(para, " ")
+		var line []rune
+		for _, word := range words {
+			w := []rune(word)
+			if wrap && len(line) > 0 && measure(line)+measure([]rune(strings.TrimRight(word, " "))) > avail {
+				lines = append(lines, line)
+				line = nil
+			}
+			line = append(line, w...)
+		}
+		lines = append(lines, line)
+	}
+
+	lineHeight := (face.ascent + face.descent) * scale
+	height := lineHeight * float64(len(lines))
+
+	top := float64(rect.Y)
+	switch format.LineAlign {
+	case STRINGALIGNMENT_CENTER:
+		top += (float64(rect.Height) - height) / 2
+	case STRINGALIGNMENT_FAR:
+		top += float64(rect.Height) - height
+	}
+
+	clip := p.clipRegion()
+	if rect.Width > 0 && rect.Height > 0 && format.StringFormatFlags&STRINGFORMAT_NOCLIP == 0 {
+		clip = clip.intersect(p.rectsPath([]EmfPlusRectF{rect}), raster.NonZero)
+	}
+
+	m := p.matrix()
+	for i, line := range lines {
+		line = []rune(strings.TrimRight(string(line), " "))
+		if len(line) == 0 {
+			continue
+		}
+
+		width := measure(line)
+		x := float64(rect.X) + lead
+		switch format.StringAlignment {
+		case STRINGALIGNMENT_CENTER:
+			x += (avail - width) / 2
+		case STRINGALIGNMENT_FAR:
+			x += avail - width
+		}
+		y := top + face.ascent*scale + float64(i)*lineHeight
+
+		origins := make([]raster.Point, len(line))
+		widths := make([]float64, len(line))
+		for j, r := range line {
+			origins[j] = raster.Pt(x, y)
+			widths[j] = advance(r)
+			x += widths[j]
+		}
+
+		p.painter.Text(p.textRun(font, em, m, line, origins, widths, b.color()), clip)
+	}
+
+	return nil
+}
+
+// drawDriverString draws characters at given positions. Glyph indices of
+// the original font mean nothing to the substituted face, so only strings
+// of characters are drawn.
+func (p *plusContext) drawDriverString(r *EmfPlusDrawDriverStringRecord) error {
+	if r.DriverStringOptionsFlags&DRIVERSTRING_CMAPLOOKUP == 0 {
+		return errors.New("EmfPlusDrawDriverString with glyph indices is not supported")
+	}
+	if len(r.Glyphs) == 0 {
+		return nil
+	}
+
+	font, err := p.font(r.objectID())
+	if err != nil {
+		return err
+	}
+
+	b, err := p.brush(r.Flags, r.BrushID)
+	if err != nil {
+		return err
+	}
+
+	face := font.face
+	em := p.emSize(font)
+	scale := em / face.unitsPerEm
+
+	m := p.matrix()
+	if r.MatrixPresent != 0 {
+		m = r.TransformMatrix.matrix().Mul(m)
+	}
+
+	var runes []rune
+	var origins []raster.Point
+	var widths []float64
+
+	pos := r.GlyphPos[0].point()
+	for i := 0; i < len(r.Glyphs); i++ {
+		c := rune(r.Glyphs[i])
+		if utf16.IsSurrogate(c) && i+1 < len(r.Glyphs) {
+			c = utf16.DecodeRune(c, rune(r.Glyphs[i+1]))
+		}
+
+		if r.DriverStringOptionsFlags&DRIVERSTRING_REALIZEDADVANCE == 0 {
+			pos = r.GlyphPos[i].point()
+		}
+		if c > 0xFFFF {
+			i++
+		}
+
+		w := face.advance(face.glyphIndex(c)) * scale
+		runes = append(runes, c)
+		origins = append(origins, pos)
+		widths = append(widths, w)
+		pos.X += w
+	}
+
+	p.painter.Text(p.textRun(font, em, m, runes, origins, widths, b.color()), p.clipRegion())
+	return nil
+}
@@ -0,0 +1,887 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// parsePlusObject returns the object defined by the data of EmfPlusObject
+// records. Custom line caps are not parsed and give nil.
+func parsePlusObject(typ uint8, data []byte) (interface{}, error) {
+	reader := bytes.NewReader(data)
+
+	switch typ {
+	case OBJECTTYPE_BRUSH:
+		return readEmfPlusBrush(reader)
+	case OBJECTTYPE_PEN:
+		return readEmfPlusPen(reader)
+	case OBJECTTYPE_PATH:
+		return readEmfPlusPath(reader)
+	case OBJECTTYPE_REGION:
+		return readEmfPlusRegion(reader)
+	case OBJECTTYPE_IMAGE:
+		return readEmfPlusImage(reader)
+	case OBJECTTYPE_FONT:
+		return readEmfPlusFont(reader)
+	case OBJECTTYPE_STRINGFORMAT:
+		return readEmfPlusStringFormat(reader)
+	case OBJECTTYPE_IMAGEATTRIBUTES:
+		return readEmfPlusImageAttributes(reader)
+	case OBJECTTYPE_CUSTOMLINECAP:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown EMF+ object type %#02x", typ)
+}
+
+// EmfPlusBrush fills shapes. Data is one of the Emf...BrushData types
+// selected by Type.
+type EmfPlusBrush struct {
+	Version uint32
+	Type    uint32
+	Data    interface{}
+}
+
+type EmfPlusSolidBrushData struct {
+	SolidColor EmfPlusARGB
+}
+
+type EmfPlusHatchBrushData struct {
+	HatchStyle uint32
+	ForeColor  EmfPlusARGB
+	BackColor  EmfPlusARGB
+}
+
+type EmfPlusTextureBrushData struct {
+	BrushDataFlags uint32
+	WrapMode       int32
+	Transform      *EmfPlusTransformMatrix
+	Image          *EmfPlusImage
+}
+
+type EmfPlusLinearGradientBrushData struct {
+	BrushDataFlags uint32
+	WrapMode       int32
+	Rect           EmfPlusRectF
+	StartColor     EmfPlusARGB
+	EndColor       EmfPlusARGB
+	Transform      *EmfPlusTransformMatrix
+
+	// colors at positions along the gradient, when present
+	PresetPositions []float32
+	PresetColors    []EmfPlusARGB
+
+	// amounts of the end color at positions along the gradient, when
+	// present
+	BlendPositions []float32
+	BlendFactors   []float32
+}
+
+type EmfPlusPathGradientBrushData struct {
+	BrushDataFlags    uint32
+	WrapMode          int32
+	CenterColor       EmfPlusARGB
+	CenterPoint       EmfPlusPointF
+	SurroundingColors []EmfPlusARGB
+	BoundaryPath      *EmfPlusPath    // when BRUSHDATA_PATH is set
+	BoundaryPoints    []EmfPlusPointF // otherwise
+	Transform         *EmfPlusTransformMatrix
+}
+
+func readEmfPlusBrush(reader *bytes.Reader) (*EmfPlusBrush, error) {
+	b := &EmfPlusBrush{}
+
+	if err := readValues(reader, &b.Version, &b.Type); err != nil {
+		return nil, err
+	}
+
+	switch b.Type {
+	case BRUSHTYPE_SOLIDCOLOR:
+		d := &EmfPlusSolidBrushData{}
+		if err := readValues(reader, d); err != nil {
+			return nil, err
+		}
+		b.Data = d
+
+	case BRUSHTYPE_HATCHFILL:
+		d := &EmfPlusHatchBrushData{}
+		if err := readValues(reader, d); err != nil {
+			return nil, err
+		}
+		b.Data = d
+
+	case BRUSHTYPE_TEXTUREFILL:
+		d := &EmfPlusTextureBrushData{}
+		if err := readValues(reader, &d.BrushDataFlags, &d.WrapMode); err != nil {
+			return nil, err
+		}
+
+		if d.BrushDataFlags&BRUSHDATA_TRANSFORM != 0 {
+			d.Transform = &EmfPlusTransformMatrix{}
+			if err := readValues(reader, d.Transform); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		if d.Image, err = readEmfPlusImage(reader); err != nil {
+			return nil, err
+		}
+		b.Data = d
+
+	case BRUSHTYPE_LINEARGRADIENT:
+		d := &EmfPlusLinearGradientBrushData{}
+
+		var reserved [2]EmfPlusARGB
+		if err := readValues(reader, &d.BrushDataFlags, &d.WrapMode, &d.Rect, &d.StartColor, &d.EndColor, &reserved); err != nil {
+			return nil, err
+		}
+
+		if d.BrushDataFlags&BRUSHDATA_TRANSFORM != 0 {
+			d.Transform = &EmfPlusTransformMatrix{}
+			if err := readValues(reader, d.Transform); err != nil {
+				return nil, err
+			}
+		}
+
+		if d.BrushDataFlags&BRUSHDATA_PRESETCOLORS != 0 {
+			var count uint32
+			if err := readValues(reader, &count); err != nil {
+				return nil, err
+			}
+			if err := checkCount(reader, count, 8); err != nil {
+				return nil, err
+			}
+			d.PresetPositions = make([]float32, count)
+			d.PresetColors = make([]EmfPlusARGB, count)
+			if err := readValues(reader, d.PresetPositions, d.PresetColors); err != nil {
+				return nil, err
+			}
+		} else if d.BrushDataFlags&BRUSHDATA_BLENDFACTORSH != 0 {
+			var count uint32
+			if err := readValues(reader, &count); err != nil {
+				return nil, err
+			}
+			if err := checkCount(reader, count, 8); err != nil {
+				return nil, err
+			}
+			d.BlendPositions = make([]float32, count)
+			d.BlendFactors = make([]float32, count)
+			if err := readValues(reader, d.BlendPositions, d.BlendFactors); err != nil {
+				return nil, err
+			}
+		}
+		b.Data = d
+
+	case BRUSHTYPE_PATHGRADIENT:
+		d := &EmfPlusPathGradientBrushData{}
+
+		var count uint32
+		if err := readValues(reader, &d.BrushDataFlags, &d.WrapMode, &d.CenterColor, &d.CenterPoint, &count); err != nil {
+			return nil, err
+		}
+
+		if err := checkCount(reader, count, 4); err != nil {
+			return nil, err
+		}
+		d.SurroundingColors = make([]EmfPlusARGB, count)
+		if err := readValues(reader, d.SurroundingColors); err != nil {
+			return nil, err
+		}
+
+		if d.BrushDataFlags&BRUSHDATA_PATH != 0 {
+			var size int32
+			if err := readValues(reader, &size); err != nil {
+				return nil, err
+			}
+			if size < 0 || int(size) > reader.Len() {
+				return nil, errors.New("invalid size of boundary path")
+			}
+
+			data := make([]byte, size)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, err
+			}
+
+			var err error
+			if d.BoundaryPath, err = readEmfPlusPath(bytes.NewReader(data)); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := readValues(reader, &count); err != nil {
+				return nil, err
+			}
+
+			var err error
+			if d.BoundaryPoints, err = readPlusPoints(reader, count, false, false); err != nil {
+				return nil, err
+			}
+		}
+
+		if d.BrushDataFlags&BRUSHDATA_TRANSFORM != 0 {
+			d.Transform = &EmfPlusTransformMatrix{}
+			if err := readValues(reader, d.Transform); err != nil {
+				return nil, err
+			}
+		}
+		b.Data = d
+
+	default:
+		return nil, fmt.Errorf("unknown EMF+ brush type %d", b.Type)
+	}
+
+	return b, nil
+}
+
+// EmfPlusPen strokes lines with a brush.
+type EmfPlusPen struct {
+	Version          uint32
+	Type             uint32
+	PenDataFlags     uint32
+	PenUnit          uint32
+	PenWidth         float32
+	Transform        *EmfPlusTransformMatrix
+	StartCap         int32
+	EndCap           int32
+	Join             int32
+	MiterLimit       float32
+	LineStyle        int32
+	DashedLineCap    int32
+	DashOffset       float32
+	DashedLineData   []float32
+	PenAlignment     int32
+	CompoundLineData []float32
+	CustomStartCap   []byte
+	CustomEndCap     []byte
+	Brush            *EmfPlusBrush
+}
+
+func readEmfPlusPen(reader *bytes.Reader) (*EmfPlusPen, error) {
+	p := &EmfPlusPen{MiterLimit: 10}
+
+	if err := readValues(reader, &p.Version, &p.Type, &p.PenDataFlags, &p.PenUnit, &p.PenWidth); err != nil {
+		return nil, err
+	}
+
+	flags := p.PenDataFlags
+
+	if flags&PENDATA_TRANSFORM != 0 {
+		p.Transform = &EmfPlusTransformMatrix{}
+		if err := readValues(reader, p.Transform); err != nil {
+			return nil, err
+		}
+	}
+
+	optional := []struct {
+		flag  uint32
+		value interface{}
+	}{
+		{PENDATA_STARTCAP, &p.StartCap},
+		{PENDATA_ENDCAP, &p.EndCap},
+		{PENDATA_JOIN, &p.Join},
+		{PENDATA_MITERLIMIT, &p.MiterLimit},
+		{PENDATA_LINESTYLE, &p.LineStyle},
+		{PENDATA_DASHEDLINECAP, &p.DashedLineCap},
+		{PENDATA_DASHEDLINEOFFSET, &p.DashOffset},
+	}
+	for _, o := range optional {
+		if flags&o.flag != 0 {
+			if err := readValues(reader, o.value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	readFloats := func() ([]float32, error) {
+		var count uint32
+		if err := readValues(reader, &count); err != nil {
+			return nil, err
+		}
+		if err := checkCount(reader, count, 4); err != nil {
+			return nil, err
+		}
+		v := make([]float32, count)
+		return v, readValues(reader, v)
+	}
+
+	readBytes := func() ([]byte, error) {
+		var size int32
+		if err := readValues(reader, &size); err != nil {
+			return nil, err
+		}
+		if size < 0 || int(size) > reader.Len() {
+			return nil, errors.New("invalid size of custom line cap")
+		}
+		v := make([]byte, size)
+		_, err := io.ReadFull(reader, v)
+		return v, err
+	}
+
+	var err error
+
+	if flags&PENDATA_DASHEDLINE != 0 {
+		if p.DashedLineData, err = readFloats(); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&PENDATA_NONCENTER != 0 {
+		if err := readValues(reader, &p.PenAlignment); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&PENDATA_COMPOUNDLINE != 0 {
+		if p.CompoundLineData, err = readFloats(); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&PENDATA_CUSTOMSTARTCAP != 0 {
+		if p.CustomStartCap, err = readBytes(); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&PENDATA_CUSTOMENDCAP != 0 {
+		if p.CustomEndCap, err = readBytes(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Brush, err = readEmfPlusBrush(reader); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// EmfPlusPath is a sequence of figures. Every point has a type, the low
+// bits tell whether it starts a figure, ends a line or belongs to a cubic
+// Bézier curve, the high bits mark the end of a closed figure.
+type EmfPlusPath struct {
+	Version        uint32
+	PathPointFlags uint32
+	Points         []EmfPlusPointF
+	Types          []uint8
+}
+
+func readEmfPlusPath(reader *bytes.Reader) (*EmfPlusPath, error) {
+	p := &EmfPlusPath{}
+
+	var count uint32
+	if err := readValues(reader, &p.Version, &count, &p.PathPointFlags); err != nil {
+		return nil, err
+	}
+
+	flags := p.PathPointFlags
+	var err error
+	if p.Points, err = readPlusPoints(reader, count, flags&EMFPLUS_FLAG_COMPRESSED != 0, flags&EMFPLUS_FLAG_RELATIVE != 0); err != nil {
+		return nil, err
+	}
+
+	p.Types = make([]uint8, 0, count)
+
+	if flags&PATHPOINT_RLE != 0 {
+		for uint32(len(p.Types)) < count {
+			var run [2]uint8
+			if err := readValues(reader, &run); err != nil {
+				return nil, err
+			}
+
+			n := int(run[0] & 0x3F)
+			if n > int(count)-len(p.Types) {
+				return nil, errors.New("invalid run of path point types")
+			}
+
+			for i := 0; i < n; i++ {
+				p.Types = append(p.Types, run[1])
+			}
+		}
+	} else {
+		if err := checkCount(reader, count, 1); err != nil {
+			return nil, err
+		}
+
+		p.Types = p.Types[:count]
+		if _, err := io.ReadFull(reader, p.Types); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// path returns the figures transformed by m.
+func (p *EmfPlusPath) path(m raster.Matrix) *raster.Path {
+	out := &raster.Path{}
+
+	for i := 0; i < len(p.Points); i++ {
+		pt := m.Apply(p.Points[i].point())
+
+		switch p.Types[i] & 0x07 {
+		case PATHPOINTTYPE_START:
+			out.MoveTo(pt)
+		case PATHPOINTTYPE_BEZIER:
+			if i+2 < len(p.Points) {
+				c2 := m.Apply(p.Points[i+1].point())
+				end := m.Apply(p.Points[i+2].point())
+				out.CubeTo(pt, c2, end)
+				i += 2
+			}
+		default:
+			out.LineTo(pt)
+		}
+
+		if p.Types[i]&PATHPOINTTYPE_CLOSE != 0 {
+			out.Close()
+		}
+	}
+
+	return out
+}
+
+// fillRule returns the rule GDI+ fills paths with, unless the path was
+// created with FillModeWinding, which the object does not record.
+func (p *EmfPlusPath) fillRule() raster.FillRule {
+	return raster.EvenOdd
+}
+
+// EmfPlusRegion is a tree of shapes combined by boolean operations.
+type EmfPlusRegion struct {
+	Version   uint32
+	NodeCount uint32
+	Root      *EmfPlusRegionNode
+}
+
+// EmfPlusRegionNode is a leaf with a rectangle or a path, an empty or
+// infinite leaf, or a combination of Left and Right.
+type EmfPlusRegionNode struct {
+	Type        uint32
+	Rect        EmfPlusRectF
+	Path        *EmfPlusPath
+	Left, Right *EmfPlusRegionNode
+}
+
+func readEmfPlusRegion(reader *bytes.Reader) (*EmfPlusRegion, error) {
+	r := &EmfPlusRegion{}
+
+	if err := readValues(reader, &r.Version, &r.NodeCount); err != nil {
+		return nil, err
+	}
+
+	// the root node is not counted
+	remaining := int(r.NodeCount) + 1
+
+	var err error
+	if r.Root, err = readEmfPlusRegionNode(reader, &remaining); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// readEmfPlusRegionNode reads a node and its children, failing when there
+// are more nodes than remaining.
+func readEmfPlusRegionNode(reader *bytes.Reader, remaining *int) (*EmfPlusRegionNode, error) {
+	if *remaining <= 0 {
+		return nil, errors.New("too many region nodes")
+	}
+	*remaining--
+
+	n := &EmfPlusRegionNode{}
+	if err := readValues(reader, &n.Type); err != nil {
+		return nil, err
+	}
+
+	switch n.Type {
+	case REGIONNODE_RECT:
+		if err := readValues(reader, &n.Rect); err != nil {
+			return nil, err
+		}
+
+	case REGIONNODE_PATH:
+		var size int32
+		if err := readValues(reader, &size); err != nil {
+			return nil, err
+		}
+		if size < 0 || int(size) > reader.Len() {
+			return nil, errors.New("invalid size of region path")
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if n.Path, err = readEmfPlusPath(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+
+	case REGIONNODE_EMPTY, REGIONNODE_INFINITE:
+
+	case REGIONNODE_AND, REGIONNODE_OR, REGIONNODE_XOR, REGIONNODE_EXCLUDE, REGIONNODE_COMPLEMENT:
+		var err error
+		if n.Left, err = readEmfPlusRegionNode(reader, remaining); err != nil {
+			return nil, err
+		}
+		if n.Right, err = readEmfPlusRegionNode(reader, remaining); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown region node type %#x", n.Type)
+	}
+
+	return n, nil
+}
+
+// EmfPlusImage is a bitmap or an embedded metafile.
+type EmfPlusImage struct {
+	Version  uint32
+	Type     uint32
+	Bitmap   *EmfPlusBitmap
+	Metafile *EmfPlusMetafile
+
+	decoded image.Image
+}
+
+// EmfPlusBitmap holds pixels in PixelFormat, or a compressed image file
+// such as PNG or JPEG when Type is BITMAPDATATYPE_COMPRESSED.
+type EmfPlusBitmap struct {
+	Width       int32
+	Height      int32
+	Stride      int32
+	PixelFormat uint32
+	Type        uint32
+	Palette     []EmfPlusARGB // indexed formats only
+	Data        []byte
+}
+
+type EmfPlusMetafile struct {
+	Type uint32
+	Data []byte
+}
+
+func readEmfPlusImage(reader *bytes.Reader) (*EmfPlusImage, error) {
+	img := &EmfPlusImage{}
+
+	if err := readValues(reader, &img.Version, &img.Type); err != nil {
+		return nil, err
+	}
+
+	switch img.Type {
+	case IMAGEDATATYPE_BITMAP:
+		b := &EmfPlusBitmap{}
+		if err := readValues(reader, &b.Width, &b.Height, &b.Stride, &b.PixelFormat, &b.Type); err != nil {
+			return nil, err
+		}
+
+		if b.Type == BITMAPDATATYPE_PIXEL && b.PixelFormat&PIXELFORMAT_INDEXED != 0 {
+			var flags, count uint32
+			if err := readValues(reader, &flags, &count); err != nil {
+				return nil, err
+			}
+			if err := checkCount(reader, count, 4); err != nil {
+				return nil, err
+			}
+			b.Palette = make([]EmfPlusARGB, count)
+			if err := readValues(reader, b.Palette); err != nil {
+				return nil, err
+			}
+		}
+
+		b.Data = make([]byte, reader.Len())
+		if _, err := io.ReadFull(reader, b.Data); err != nil {
+			return nil, err
+		}
+		img.Bitmap = b
+
+	case IMAGEDATATYPE_METAFILE:
+		m := &EmfPlusMetafile{}
+
+		var size uint32
+		if err := readValues(reader, &m.Type, &size); err != nil {
+			return nil, err
+		}
+		if err := checkCount(reader, size, 1); err != nil {
+			return nil, err
+		}
+
+		m.Data = make([]byte, size)
+		if _, err := io.ReadFull(reader, m.Data); err != nil {
+			return nil, err
+		}
+		img.Metafile = m
+
+	default:
+		return nil, fmt.Errorf("unknown EMF+ image type %d", img.Type)
+	}
+
+	return img, nil
+}
+
+// image decodes the image, metafiles are rendered to a bitmap. Images
+// larger than the limits are not decoded.
+func (img *EmfPlusImage) image(limits *Limits) (image.Image, error) {
+	if img.decoded != nil {
+		return img.decoded, nil
+	}
+
+	var decoded image.Image
+	var err error
+
+	switch {
+	case img.Bitmap != nil && img.Bitmap.Type == BITMAPDATATYPE_COMPRESSED:
+		var cfg image.Config
+		if cfg, _, err = image.DecodeConfig(bytes.NewReader(img.Bitmap.Data)); err == nil {
+			if err = limits.checkPixels(int64(cfg.Width), int64(cfg.Height)); err == nil {
+				decoded, _, err = image.Decode(bytes.NewReader(img.Bitmap.Data))
+			}
+		}
+	case img.Bitmap != nil:
+		if err = limits.checkPixels(int64(img.Bitmap.Width), int64(img.Bitmap.Height)); err == nil {
+			decoded, err = img.Bitmap.decode()
+		}
+	case img.Metafile != nil:
+		decoded, err = img.Metafile.render(limits)
+	default:
+		err = errors.New("empty EMF+ image")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	img.decoded = decoded
+	return decoded, nil
+}
+
+// decode converts the pixels, which are stored from the top row down, with
+// the channels of a pixel in BGRA order.
+func (b *EmfPlusBitmap) decode() (image.Image, error) {
+	w, h := int(b.Width), int(b.Height)
+	bpp := int(b.PixelFormat>>8) & 0xFF
+
+	if w <= 0 || h <= 0 || bpp == 0 {
+		return nil, errors.New("invalid EMF+ bitmap")
+	}
+
+	stride := int(b.Stride)
+	if stride <= 0 {
+		stride = (w*bpp + 31) / 32 * 4
+	}
+	if uint64(stride)*uint64(h) > uint64(len(b.Data)) || uint64(w*bpp) > uint64(stride)*8 {
+		return nil, errors.New("EMF+ bitmap data too short")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		row := b.Data[y*stride : (y+1)*stride]
+		for x := 0; x < w; x++ {
+			var c color.NRGBA
+
+			switch b.PixelFormat {
+			case PIXELFORMAT_1BPPINDEXED, PIXELFORMAT_4BPPINDEXED, PIXELFORMAT_8BPPINDEXED:
+				bit := x * bpp
+				idx := int(row[bit/8]>>(8-bpp-bit%8)) & (1<<bpp - 1)
+				if idx < len(b.Palette) {
+					c = b.Palette[idx].nrgba()
+				}
+			case PIXELFORMAT_16BPPRGB555, PIXELFORMAT_16BPPARGB1555:
+				v := binary.LittleEndian.Uint16(row[x*2:])
+				c = color.NRGBA{scaleBits(v>>10, 5), scaleBits(v>>5, 5), scaleBits(v, 5), 0xFF}
+				if b.PixelFormat == PIXELFORMAT_16BPPARGB1555 && v&0x8000 == 0 {
+					c.A = 0
+				}
+			case PIXELFORMAT_16BPPRGB565:
+				v := binary.LittleEndian.Uint16(row[x*2:])
+				c = color.NRGBA{scaleBits(v>>11, 5), scaleBits(v>>5, 6), scaleBits(v, 5), 0xFF}
+			case PIXELFORMAT_16BPPGRAYSCALE:
+				v := uint8(binary.LittleEndian.Uint16(row[x*2:]) >> 8)
+				c = color.NRGBA{v, v, v, 0xFF}
+			case PIXELFORMAT_24BPPRGB:
+				c = color.NRGBA{row[x*3+2], row[x*3+1], row[x*3], 0xFF}
+			case PIXELFORMAT_32BPPRGB:
+				c = color.NRGBA{row[x*4+2], row[x*4+1], row[x*4], 0xFF}
+			case PIXELFORMAT_32BPPARGB:
+				c = color.NRGBA{row[x*4+2], row[x*4+1], row[x*4], row[x*4+3]}
+			case PIXELFORMAT_32BPPPARGB:
+				pc := color.RGBA{row[x*4+2], row[x*4+1], row[x*4], row[x*4+3]}
+				c = color.NRGBAModel.Convert(pc).(color.NRGBA)
+			case PIXELFORMAT_48BPPRGB:
+				c = color.NRGBA{row[x*6+5], row[x*6+3], row[x*6+1], 0xFF}
+			case PIXELFORMAT_64BPPARGB:
+				c = color.NRGBA{row[x*8+5], row[x*8+3], row[x*8+1], row[x*8+7]}
+			case PIXELFORMAT_64BPPPARGB:
+				pc := color.RGBA{row[x*8+5], row[x*8+3], row[x*8+1], row[x*8+7]}
+				c = color.NRGBAModel.Convert(pc).(color.NRGBA)
+			default:
+				return nil, fmt.Errorf("unsupported EMF+ pixel format %#08x", b.PixelFormat)
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img, nil
+}
+
+// scaleBits expands the low n bits of v to eight bits.
+func scaleBits(v uint16, n uint) uint8 {
+	max := uint32(1)<<n - 1
+	return uint8(uint32(v) & max * 255 / max)
+}
+
+// render draws an embedded EMF into a bitmap of its bounds.
+func (m *EmfPlusMetafile) render(limits *Limits) (image.Image, error) {
+	if m.Type != METAFILEDATATYPE_EMF && m.Type != METAFILEDATATYPE_EMFPLUSONLY && m.Type != METAFILEDATATYPE_EMFPLUSDUAL {
+		return nil, fmt.Errorf("unsupported EMF+ metafile type %d", m.Type)
+	}
+
+	f, err := ReadFileWithOptions(m.Data, &ReadOptions{Limits: limits})
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := f.Header.Original
+	if hdr.Device.CX <= 0 || hdr.Device.CY <= 0 || hdr.Bounds.Right < hdr.Bounds.Left || hdr.Bounds.Bottom < hdr.Bounds.Top {
+		return nil, errors.New("invalid size of embedded EMF")
+	}
+
+	if err := limits.checkPixels(int64(hdr.Device.CX), int64(hdr.Device.CY)); err != nil {
+		return nil, err
+	}
+
+	dev := NewRasterDevice(int(hdr.Device.CX), int(hdr.Device.CY))
+	if err := f.DrawToDevice(dev); err != nil {
+		return nil, err
+	}
+
+	img, err := dev.Image()
+	if err != nil {
+		return nil, err
+	}
+
+	return img.SubImage(image.Rect(int(hdr.Bounds.Left), int(hdr.Bounds.Top), int(hdr.Bounds.Right)+1, int(hdr.Bounds.Bottom)+1)), nil
+}
+
+// EmfPlusFont is a font family with a size in SizeUnit.
+type EmfPlusFont struct {
+	Version        uint32
+	EmSize         float32
+	SizeUnit       uint32
+	FontStyleFlags int32
+	Reserved       uint32
+	FamilyName     []uint16
+
+	face *fontFace
+}
+
+func readEmfPlusFont(reader *bytes.Reader) (*EmfPlusFont, error) {
+	f := &EmfPlusFont{}
+
+	var length uint32
+	if err := readValues(reader, &f.Version, &f.EmSize, &f.SizeUnit, &f.FontStyleFlags, &f.Reserved, &length); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, length, 2); err != nil {
+		return nil, err
+	}
+
+	f.FamilyName = make([]uint16, length)
+	if err := readValues(reader, f.FamilyName); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *EmfPlusFont) GetFamilyName() string {
+	return utf16ToString(f.FamilyName)
+}
+
+// logFont returns the LOGFONT used to pick a face for the font.
+func (f *EmfPlusFont) logFont() w32.LOGFONT {
+	lf := w32.LOGFONT{Weight: w32.FW_NORMAL}
+	if f.FontStyleFlags&FONTSTYLE_BOLD != 0 {
+		lf.Weight = w32.FW_BOLD
+	}
+	if f.FontStyleFlags&FONTSTYLE_ITALIC != 0 {
+		lf.Italic = 1
+	}
+	if f.FontStyleFlags&FONTSTYLE_UNDERLINE != 0 {
+		lf.Underline = 1
+	}
+	if f.FontStyleFlags&FONTSTYLE_STRIKEOUT != 0 {
+		lf.StrikeOut = 1
+	}
+	lf.SetFaceName(f.GetFamilyName())
+	return lf
+}
+
+// EmfPlusStringFormat describes the layout of EmfPlusDrawString text. The
+// tab stops and character ranges following the fixed fields are not kept.
+type EmfPlusStringFormat struct {
+	Version           uint32
+	StringFormatFlags uint32
+	Language          uint32
+	StringAlignment   uint32
+	LineAlign         uint32
+	DigitSubstitution uint32
+	DigitLanguage     uint32
+	FirstTabOffset    float32
+	HotkeyPrefix      int32
+	LeadingMargin     float32 // in em
+	TrailingMargin    float32 // in em
+	Tracking          float32
+	Trimming          uint32
+	TabStopCount      int32
+	RangeCount        int32
+}
+
+func readEmfPlusStringFormat(reader *bytes.Reader) (*EmfPlusStringFormat, error) {
+	f := &EmfPlusStringFormat{}
+
+	if err := readValues(reader, f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+type EmfPlusImageAttributes struct {
+	Version     uint32
+	Reserved1   uint32
+	WrapMode    uint32
+	ClampColor  EmfPlusARGB
+	ObjectClamp int32
+	Reserved2   uint32
+}
+
+func readEmfPlusImageAttributes(reader *bytes.Reader) (*EmfPlusImageAttributes, error) {
+	a := &EmfPlusImageAttributes{}
+
+	if err := readValues(reader, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
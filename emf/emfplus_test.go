@@ -0,0 +1,125 @@
+package emf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// plainDevice hides the EMF+ support of the device it wraps.
+type plainDevice struct {
+	Device
+}
+
+func plusFile(flags uint16) *EmfFile {
+	b := NewBuilder(w32.RECT{Right: 9, Bottom: 9}, w32.RECT{})
+	b.Add(&CommentEmfPlusRecord{
+		CommentRecord: CommentRecord{Record: Record{Type: EMR_COMMENT}},
+		Records: []EmfPlusRecorder{&EmfPlusHeaderRecord{
+			EmfPlusRecord: EmfPlusRecord{Type: EMFPLUS_HEADER, Flags: flags},
+			LogicalDpiX:   96,
+			LogicalDpiY:   96,
+		}},
+	})
+	b.Rectangle(1, 1, 5, 5)
+	return b.File()
+}
+
+func TestPlayPlusDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		dev  Device
+		dual bool
+		err  error
+	}{
+		{"plus device", NewRasterDevice(10, 10), false, nil},
+		{"dual", &plainDevice{NewRasterDevice(10, 10)}, true, nil},
+		{"plus only", &plainDevice{NewRasterDevice(10, 10)}, false, ErrPlusUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := uint16(0)
+			if tt.dual {
+				flags = EMFPLUS_FLAG_DUAL
+			}
+
+			err := plusFile(flags).DrawToDevice(tt.dev)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("DrawToDevice returned %v, want %v", err, tt.err)
+			}
+
+			var rerr *RecordError
+			if tt.err != nil && (!errors.As(err, &rerr) || rerr.Index != 0) {
+				t.Errorf("DrawToDevice returned %v, want a RecordError of the first record", err)
+			}
+		})
+	}
+}
+
+func TestPlusContinuedObject(t *testing.T) {
+	// a solid brush split in chunks of 4 bytes
+	brush := []byte{0x02, 0x10, 0xC0, 0xDB, 0, 0, 0, 0, 0x11, 0x22, 0x33, 0xFF}
+
+	chunk := func(data []byte, continued bool, total uint32) *EmfPlusObjectRecord {
+		flags := uint16(OBJECTTYPE_BRUSH)<<8 | 5
+		if continued {
+			flags |= EMFPLUS_FLAG_CONTINUED
+		}
+		return &EmfPlusObjectRecord{
+			EmfPlusRecord:   EmfPlusRecord{Type: EMFPLUS_OBJECT, Flags: flags},
+			TotalObjectSize: total,
+			Data:            data,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		records []*EmfPlusObjectRecord
+		limit   uint32
+		err     bool  // of the last record
+		isErr   error // cause of the error, when known
+		object  bool
+	}{
+		{"whole", []*EmfPlusObjectRecord{
+			chunk(brush[:4], true, 12), chunk(brush[4:8], true, 12), chunk(brush[8:], false, 0),
+		}, 0, false, nil, true},
+		{"past the size", []*EmfPlusObjectRecord{
+			chunk(brush[:4], true, 6), chunk(brush[4:8], true, 6),
+		}, 0, true, nil, false},
+		{"last past the size", []*EmfPlusObjectRecord{
+			chunk(brush[:4], true, 8), chunk(brush[4:8], true, 8), chunk(brush[8:], false, 0),
+		}, 0, true, nil, false},
+		{"size grows", []*EmfPlusObjectRecord{
+			chunk(brush[:4], true, 4), chunk(brush[4:8], true, 8),
+		}, 0, true, nil, false},
+		{"over the limit", []*EmfPlusObjectRecord{
+			chunk(brush[:4], true, 1<<30),
+		}, 1 << 20, true, ErrLimit, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPlusContext(nil, 10, 10)
+			p.limits = &Limits{MaxRecordSize: tt.limit}
+
+			var err error
+			for i, r := range tt.records {
+				if err = p.setObject(r); err != nil && i < len(tt.records)-1 {
+					t.Fatalf("record %d returned %v", i, err)
+				}
+			}
+
+			if (err != nil) != tt.err || tt.isErr != nil && !errors.Is(err, tt.isErr) {
+				t.Errorf("last record returned %v", err)
+			}
+			if _, ok := p.partial[5]; ok && tt.err {
+				t.Error("failed object is kept")
+			}
+			if _, ok := p.objects[5].(*EmfPlusBrush); ok != tt.object {
+				t.Errorf("object is %v", p.objects[5])
+			}
+		})
+	}
+}
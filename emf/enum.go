@@ -201,6 +201,20 @@ const (
 	WINDING   = 0x02
 )
 
+// ArcDirection
+const (
+	AD_COUNTERCLOCKWISE = 0x01
+	AD_CLOCKWISE        = 0x02
+)
+
+// Point
+const (
+	PT_CLOSEFIGURE = 0x01
+	PT_LINETO      = 0x02
+	PT_BEZIERTO    = 0x04
+	PT_MOVETO      = 0x06
+)
+
 // ExtTextOutOptions
 const (
 	ETO_OPAQUE            = uint32(0x00000002)
@@ -265,6 +279,11 @@ const (
 	RGN_COPY = 0x05
 )
 
+// RegionData type
+const (
+	RDH_RECTANGLES = 0x01
+)
+
 // BrushStyle
 const (
 	BS_SOLID         = 0x0000
@@ -327,8 +346,326 @@ const (
 	TA_TOP        = 0x0000
 	TA_UPDATECP   = 0x0001
 	TA_RIGHT      = 0x0002
-	TA_CENTER     = 0x0003
+	TA_CENTER     = 0x0006
 	TA_BOTTOM     = 0x0008
 	TA_BASELINE   = 0x0018
 	TA_RTLREADING = 0x0100
 )
+
+// BinaryRasterOperation
+const (
+	R2_BLACK       = 0x0001
+	R2_NOTMERGEPEN = 0x0002
+	R2_MASKNOTPEN  = 0x0003
+	R2_NOTCOPYPEN  = 0x0004
+	R2_MASKPENNOT  = 0x0005
+	R2_NOT         = 0x0006
+	R2_XORPEN      = 0x0007
+	R2_NOTMASKPEN  = 0x0008
+	R2_MASKPEN     = 0x0009
+	R2_NOTXORPEN   = 0x000A
+	R2_NOP         = 0x000B
+	R2_MERGENOTPEN = 0x000C
+	R2_COPYPEN     = 0x000D
+	R2_MERGEPENNOT = 0x000E
+	R2_MERGEPEN    = 0x000F
+	R2_WHITE       = 0x0010
+)
+
+// CommentIdentifier
+const (
+	EMR_COMMENT_EMFSPOOL = uint32(0x00000000)
+	EMR_COMMENT_EMFPLUS  = uint32(0x2B464D45)
+	EMR_COMMENT_PUBLIC   = uint32(0x43494447)
+)
+
+// EmrComment public comment identifiers
+const (
+	EMR_COMMENT_WINDOWS_METAFILE = uint32(0x80000001)
+	EMR_COMMENT_BEGINGROUP       = uint32(0x00000002)
+	EMR_COMMENT_ENDGROUP         = uint32(0x00000003)
+	EMR_COMMENT_MULTIFORMATS     = uint32(0x40000004)
+	EMR_COMMENT_UNICODE_STRING   = uint32(0x00000040)
+	EMR_COMMENT_UNICODE_END      = uint32(0x00000080)
+)
+
+// FormatSignature of EmrFormat, besides ENHMETA_SIGNATURE
+const EPS_SIGNATURE = 0x46535045
+
+// EMFSpoolRecordIdentifier
+const (
+	EMFSPOOL_FONT = uint32(0x544F4E46)
+)
+
+// EmfPlusRecordType [MS-EMFPLUS]
+const (
+	EMFPLUS_HEADER                  = uint16(0x4001)
+	EMFPLUS_ENDOFFILE               = uint16(0x4002)
+	EMFPLUS_COMMENT                 = uint16(0x4003)
+	EMFPLUS_GETDC                   = uint16(0x4004)
+	EMFPLUS_MULTIFORMATSTART        = uint16(0x4005)
+	EMFPLUS_MULTIFORMATSECTION      = uint16(0x4006)
+	EMFPLUS_MULTIFORMATEND          = uint16(0x4007)
+	EMFPLUS_OBJECT                  = uint16(0x4008)
+	EMFPLUS_CLEAR                   = uint16(0x4009)
+	EMFPLUS_FILLRECTS               = uint16(0x400A)
+	EMFPLUS_DRAWRECTS               = uint16(0x400B)
+	EMFPLUS_FILLPOLYGON             = uint16(0x400C)
+	EMFPLUS_DRAWLINES               = uint16(0x400D)
+	EMFPLUS_FILLELLIPSE             = uint16(0x400E)
+	EMFPLUS_DRAWELLIPSE             = uint16(0x400F)
+	EMFPLUS_FILLPIE                 = uint16(0x4010)
+	EMFPLUS_DRAWPIE                 = uint16(0x4011)
+	EMFPLUS_DRAWARC                 = uint16(0x4012)
+	EMFPLUS_FILLREGION              = uint16(0x4013)
+	EMFPLUS_FILLPATH                = uint16(0x4014)
+	EMFPLUS_DRAWPATH                = uint16(0x4015)
+	EMFPLUS_FILLCLOSEDCURVE         = uint16(0x4016)
+	EMFPLUS_DRAWCLOSEDCURVE         = uint16(0x4017)
+	EMFPLUS_DRAWCURVE               = uint16(0x4018)
+	EMFPLUS_DRAWBEZIERS             = uint16(0x4019)
+	EMFPLUS_DRAWIMAGE               = uint16(0x401A)
+	EMFPLUS_DRAWIMAGEPOINTS         = uint16(0x401B)
+	EMFPLUS_DRAWSTRING              = uint16(0x401C)
+	EMFPLUS_SETRENDERINGORIGIN      = uint16(0x401D)
+	EMFPLUS_SETANTIALIASMODE        = uint16(0x401E)
+	EMFPLUS_SETTEXTRENDERINGHINT    = uint16(0x401F)
+	EMFPLUS_SETTEXTCONTRAST         = uint16(0x4020)
+	EMFPLUS_SETINTERPOLATIONMODE    = uint16(0x4021)
+	EMFPLUS_SETPIXELOFFSETMODE      = uint16(0x4022)
+	EMFPLUS_SETCOMPOSITINGMODE      = uint16(0x4023)
+	EMFPLUS_SETCOMPOSITINGQUALITY   = uint16(0x4024)
+	EMFPLUS_SAVE                    = uint16(0x4025)
+	EMFPLUS_RESTORE                 = uint16(0x4026)
+	EMFPLUS_BEGINCONTAINER          = uint16(0x4027)
+	EMFPLUS_BEGINCONTAINERNOPARAMS  = uint16(0x4028)
+	EMFPLUS_ENDCONTAINER            = uint16(0x4029)
+	EMFPLUS_SETWORLDTRANSFORM       = uint16(0x402A)
+	EMFPLUS_RESETWORLDTRANSFORM     = uint16(0x402B)
+	EMFPLUS_MULTIPLYWORLDTRANSFORM  = uint16(0x402C)
+	EMFPLUS_TRANSLATEWORLDTRANSFORM = uint16(0x402D)
+	EMFPLUS_SCALEWORLDTRANSFORM     = uint16(0x402E)
+	EMFPLUS_ROTATEWORLDTRANSFORM    = uint16(0x402F)
+	EMFPLUS_SETPAGETRANSFORM        = uint16(0x4030)
+	EMFPLUS_RESETCLIP               = uint16(0x4031)
+	EMFPLUS_SETCLIPRECT             = uint16(0x4032)
+	EMFPLUS_SETCLIPPATH             = uint16(0x4033)
+	EMFPLUS_SETCLIPREGION           = uint16(0x4034)
+	EMFPLUS_OFFSETCLIP              = uint16(0x4035)
+	EMFPLUS_DRAWDRIVERSTRING        = uint16(0x4036)
+	EMFPLUS_STROKEFILLPATH          = uint16(0x4037)
+	EMFPLUS_SERIALIZABLEOBJECT      = uint16(0x4038)
+	EMFPLUS_SETTSGRAPHICS           = uint16(0x4039)
+	EMFPLUS_SETTSCLIP               = uint16(0x403A)
+)
+
+// EmfPlus record flags
+const (
+	EMFPLUS_FLAG_DUAL       = 0x0001 // header, the EMF records are an alternative
+	EMFPLUS_FLAG_COLOR      = 0x8000 // S, the brush is a color
+	EMFPLUS_FLAG_COMPRESSED = 0x4000 // C, 16-bit integer coordinates
+	EMFPLUS_FLAG_CLOSED     = 0x2000 // L, closed lines
+	EMFPLUS_FLAG_WINDING    = 0x2000 // W, winding fill
+	EMFPLUS_FLAG_APPEND     = 0x2000 // A, append the transform
+	EMFPLUS_FLAG_RELATIVE   = 0x0800 // R, relative coordinates
+	EMFPLUS_FLAG_CONTINUED  = 0x8000 // E, object continued in the next record
+)
+
+// ObjectType [MS-EMFPLUS]
+const (
+	OBJECTTYPE_INVALID         = 0x00
+	OBJECTTYPE_BRUSH           = 0x01
+	OBJECTTYPE_PEN             = 0x02
+	OBJECTTYPE_PATH            = 0x03
+	OBJECTTYPE_REGION          = 0x04
+	OBJECTTYPE_IMAGE           = 0x05
+	OBJECTTYPE_FONT            = 0x06
+	OBJECTTYPE_STRINGFORMAT    = 0x07
+	OBJECTTYPE_IMAGEATTRIBUTES = 0x08
+	OBJECTTYPE_CUSTOMLINECAP   = 0x09
+)
+
+// BrushType [MS-EMFPLUS]
+const (
+	BRUSHTYPE_SOLIDCOLOR     = 0x00000000
+	BRUSHTYPE_HATCHFILL      = 0x00000001
+	BRUSHTYPE_TEXTUREFILL    = 0x00000002
+	BRUSHTYPE_PATHGRADIENT   = 0x00000003
+	BRUSHTYPE_LINEARGRADIENT = 0x00000004
+)
+
+// BrushData flags [MS-EMFPLUS]
+const (
+	BRUSHDATA_PATH             = 0x00000001
+	BRUSHDATA_TRANSFORM        = 0x00000002
+	BRUSHDATA_PRESETCOLORS     = 0x00000004
+	BRUSHDATA_BLENDFACTORSH    = 0x00000008
+	BRUSHDATA_BLENDFACTORSV    = 0x00000010
+	BRUSHDATA_FOCUSSCALES      = 0x00000040
+	BRUSHDATA_ISGAMMACORRECTED = 0x00000080
+	BRUSHDATA_DONOTTRANSFORM   = 0x00000100
+)
+
+// WrapMode [MS-EMFPLUS]
+const (
+	WRAPMODE_TILE       = 0x00000000
+	WRAPMODE_TILEFLIPX  = 0x00000001
+	WRAPMODE_TILEFLIPY  = 0x00000002
+	WRAPMODE_TILEFLIPXY = 0x00000003
+	WRAPMODE_CLAMP      = 0x00000004
+)
+
+// PenData flags [MS-EMFPLUS]
+const (
+	PENDATA_TRANSFORM        = 0x00000001
+	PENDATA_STARTCAP         = 0x00000002
+	PENDATA_ENDCAP           = 0x00000004
+	PENDATA_JOIN             = 0x00000008
+	PENDATA_MITERLIMIT       = 0x00000010
+	PENDATA_LINESTYLE        = 0x00000020
+	PENDATA_DASHEDLINECAP    = 0x00000040
+	PENDATA_DASHEDLINEOFFSET = 0x00000080
+	PENDATA_DASHEDLINE       = 0x00000100
+	PENDATA_NONCENTER        = 0x00000200
+	PENDATA_COMPOUNDLINE     = 0x00000400
+	PENDATA_CUSTOMSTARTCAP   = 0x00000800
+	PENDATA_CUSTOMENDCAP     = 0x00001000
+)
+
+// LineCapType [MS-EMFPLUS]
+const (
+	LINECAPTYPE_FLAT   = 0x00000000
+	LINECAPTYPE_SQUARE = 0x00000001
+	LINECAPTYPE_ROUND  = 0x00000002
+)
+
+// LineJoinType [MS-EMFPLUS]
+const (
+	LINEJOINTYPE_MITER        = 0x00000000
+	LINEJOINTYPE_BEVEL        = 0x00000001
+	LINEJOINTYPE_ROUND        = 0x00000002
+	LINEJOINTYPE_MITERCLIPPED = 0x00000003
+)
+
+// LineStyle [MS-EMFPLUS]
+const (
+	LINESTYLE_SOLID      = 0x00000000
+	LINESTYLE_DASH       = 0x00000001
+	LINESTYLE_DOT        = 0x00000002
+	LINESTYLE_DASHDOT    = 0x00000003
+	LINESTYLE_DASHDOTDOT = 0x00000004
+	LINESTYLE_CUSTOM     = 0x00000005
+)
+
+// Path point flags and types [MS-EMFPLUS]
+const (
+	PATHPOINT_RLE = 0x1000 // L, run-length encoded point types
+
+	PATHPOINTTYPE_START  = 0x00
+	PATHPOINTTYPE_LINE   = 0x01
+	PATHPOINTTYPE_BEZIER = 0x03
+	PATHPOINTTYPE_CLOSE  = 0x80
+)
+
+// RegionNodeDataType [MS-EMFPLUS]
+const (
+	REGIONNODE_AND        = 0x00000001
+	REGIONNODE_OR         = 0x00000002
+	REGIONNODE_XOR        = 0x00000003
+	REGIONNODE_EXCLUDE    = 0x00000004
+	REGIONNODE_COMPLEMENT = 0x00000005
+	REGIONNODE_RECT       = 0x10000000
+	REGIONNODE_PATH       = 0x10000001
+	REGIONNODE_EMPTY      = 0x10000002
+	REGIONNODE_INFINITE   = 0x10000003
+)
+
+// CombineMode [MS-EMFPLUS]
+const (
+	COMBINEMODE_REPLACE    = 0x00000000
+	COMBINEMODE_INTERSECT  = 0x00000001
+	COMBINEMODE_UNION      = 0x00000002
+	COMBINEMODE_XOR        = 0x00000003
+	COMBINEMODE_EXCLUDE    = 0x00000004
+	COMBINEMODE_COMPLEMENT = 0x00000005
+)
+
+// ImageDataType, BitmapDataType and MetafileDataType [MS-EMFPLUS]
+const (
+	IMAGEDATATYPE_BITMAP   = 0x00000001
+	IMAGEDATATYPE_METAFILE = 0x00000002
+
+	BITMAPDATATYPE_PIXEL      = 0x00000000
+	BITMAPDATATYPE_COMPRESSED = 0x00000001
+
+	METAFILEDATATYPE_WMF          = 0x00000001
+	METAFILEDATATYPE_WMFPLACEABLE = 0x00000002
+	METAFILEDATATYPE_EMF          = 0x00000003
+	METAFILEDATATYPE_EMFPLUSONLY  = 0x00000004
+	METAFILEDATATYPE_EMFPLUSDUAL  = 0x00000005
+)
+
+// PixelFormat [MS-EMFPLUS]
+const (
+	PIXELFORMAT_1BPPINDEXED    = 0x00030101
+	PIXELFORMAT_4BPPINDEXED    = 0x00030402
+	PIXELFORMAT_8BPPINDEXED    = 0x00030803
+	PIXELFORMAT_16BPPGRAYSCALE = 0x00101004
+	PIXELFORMAT_16BPPRGB555    = 0x00021005
+	PIXELFORMAT_16BPPRGB565    = 0x00021006
+	PIXELFORMAT_16BPPARGB1555  = 0x00061007
+	PIXELFORMAT_24BPPRGB       = 0x00021808
+	PIXELFORMAT_32BPPRGB       = 0x00022009
+	PIXELFORMAT_32BPPARGB      = 0x0026200A
+	PIXELFORMAT_32BPPPARGB     = 0x000E200B
+	PIXELFORMAT_48BPPRGB       = 0x0010300C
+	PIXELFORMAT_64BPPARGB      = 0x0034400D
+	PIXELFORMAT_64BPPPARGB     = 0x001A400E
+
+	PIXELFORMAT_INDEXED = 0x00010000
+)
+
+// UnitType [MS-EMFPLUS]
+const (
+	UNITTYPE_WORLD      = 0x00
+	UNITTYPE_DISPLAY    = 0x01
+	UNITTYPE_PIXEL      = 0x02
+	UNITTYPE_POINT      = 0x03
+	UNITTYPE_INCH       = 0x04
+	UNITTYPE_DOCUMENT   = 0x05
+	UNITTYPE_MILLIMETER = 0x06
+)
+
+// FontStyle [MS-EMFPLUS]
+const (
+	FONTSTYLE_BOLD      = 0x00000001
+	FONTSTYLE_ITALIC    = 0x00000002
+	FONTSTYLE_UNDERLINE = 0x00000004
+	FONTSTYLE_STRIKEOUT = 0x00000008
+)
+
+// StringFormat flags and StringAlignment [MS-EMFPLUS]
+const (
+	STRINGFORMAT_DIRECTIONRIGHTTOLEFT = 0x00000001
+	STRINGFORMAT_DIRECTIONVERTICAL    = 0x00000002
+	STRINGFORMAT_NOCLIP               = 0x00004000
+	STRINGFORMAT_NOWRAP               = 0x00001000
+
+	STRINGALIGNMENT_NEAR   = 0x00000000
+	STRINGALIGNMENT_CENTER = 0x00000001
+	STRINGALIGNMENT_FAR    = 0x00000002
+)
+
+// DriverStringOptions flags [MS-EMFPLUS]
+const (
+	DRIVERSTRING_CMAPLOOKUP      = 0x00000001
+	DRIVERSTRING_VERTICAL        = 0x00000002
+	DRIVERSTRING_REALIZEDADVANCE = 0x00000004
+	DRIVERSTRING_LIMITSUBPIXEL   = 0x00000008
+)
+
+// CompositingMode [MS-EMFPLUS]
+const (
+	COMPOSITINGMODE_SOURCEOVER = 0x00
+	COMPOSITINGMODE_SOURCECOPY = 0x01
+)
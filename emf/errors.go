@@ -0,0 +1,76 @@
+package emf
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownRecord is the cause of a RecordError for a record type
+	// which is not defined by [MS-EMF].
+	ErrUnknownRecord = errors.New("unknown record type")
+
+	// ErrRecordSize is the cause of a RecordError for a record which does
+	// not fit its size, or the data.
+	ErrRecordSize = errors.New("invalid record size")
+
+	// ErrLimit is the cause of a RecordError for a record which exceeds the
+	// Limits of the file.
+	ErrLimit = errors.New("limit exceeded")
+
+	// ErrNoHeader is returned when the data does not start with an
+	// EMR_HEADER record.
+	ErrNoHeader = errors.New("missing EMF header")
+
+	// ErrNoEof is returned when the records end without an EMR_EOF record.
+	ErrNoEof = errors.New("missing EMF end of file")
+
+	// ErrPlusUnsupported is returned when a metafile with only EMF+ records
+	// is drawn on a device which cannot play them.
+	ErrPlusUnsupported = errors.New("EMF+ records are not supported by the device")
+)
+
+// RecordError records the record which failed to be read or drawn, and the
+// cause of the failure.
+type RecordError struct {
+	Op     string // "read" or "draw"
+	Offset int64  // byte offset of the record in the data, for read errors
+	Index  int    // index in EmfFile.Records, for draw errors
+	Type   uint32 // EMR_* type of the record
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	if e.Op == "draw" {
+		return fmt.Sprintf("draw record %#x at index %d: %v", e.Type, e.Index, e.Err)
+	}
+	return fmt.Sprintf("%s record %#x at offset %d: %v", e.Op, e.Type, e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// recordType returns the EMR_* type of a record.
+func recordType(rec Recorder) uint32 {
+	if r, ok := rec.(interface{ recordType() uint32 }); ok {
+		return r.recordType()
+	}
+	return 0
+}
+
+func (r *Record) recordType() uint32 {
+	return r.Type
+}
+
+// plusRecordType returns the type of an EMF+ record.
+func plusRecordType(rec EmfPlusRecorder) uint16 {
+	if r, ok := rec.(interface{ recordType() uint16 }); ok {
+		return r.recordType()
+	}
+	return 0
+}
+
+func (r *EmfPlusRecord) recordType() uint16 {
+	return r.Type
+}
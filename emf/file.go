@@ -2,7 +2,10 @@ package emf
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"image"
+	"io"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -21,17 +24,101 @@ type EmfFile struct {
 	Header  *HeaderRecord
 	Records []Recorder
 	Eof     *EofRecord
+
+	strict bool
+	limits *Limits
+	fonts  *FontResolver
+	report []FontMatch // of the last drawing
+}
+
+// ReadOptions are the options of ReadFileWithOptions, nil means the
+// defaults.
+type ReadOptions struct {
+	// Strict fails on the first record which cannot be read or drawn.
+	// Otherwise unknown and unreadable records are kept as RawRecord, draw
+	// errors are logged, and a file which cannot be read to the end is
+	// returned with the records read so far.
+	Strict bool
+
+	// Limits bound the memory the file can make reading and drawing
+	// allocate, nil means DefaultLimits.
+	Limits *Limits
+
+	// Fonts resolves the faces of the text drawn without gdi32, nil means
+	// DefaultFontResolver.
+	Fonts *FontResolver
+}
+
+// Limits bound the sizes read from untrusted data, a zero field means no
+// limit.
+type Limits struct {
+	// MaxRecordSize is the size in bytes of the largest record.
+	MaxRecordSize uint32
+
+	// MaxImagePixels is the number of pixels of the largest bitmap, or
+	// reference device, which drawing decodes or allocates.
+	MaxImagePixels int64
+
+	// MaxRegionRects is the number of rectangles of the largest region
+	// which drawing combines.
+	MaxRegionRects int
+}
+
+// DefaultLimits are the limits of ReadFile.
+var DefaultLimits = Limits{
+	MaxRecordSize:  256 << 20,
+	MaxImagePixels: 1 << 26,
+	MaxRegionRects: 1 << 16,
+}
+
+// checkPixels fails when an image of width x height exceeds the limits.
+func (l *Limits) checkPixels(width, height int64) error {
+	if width < 0 {
+		width = -width
+	}
+	if height < 0 {
+		height = -height
+	}
+
+	if l != nil && l.MaxImagePixels > 0 && width*height > l.MaxImagePixels {
+		return fmt.Errorf("%w: image of %dx%d pixels", ErrLimit, width, height)
+	}
+	return nil
+}
+
+// checkRects fails when a region of count rectangles exceeds the limits.
+func (l *Limits) checkRects(count int) error {
+	if l != nil && l.MaxRegionRects > 0 && count > l.MaxRegionRects {
+		return fmt.Errorf("%w: region of %d rectangles", ErrLimit, count)
+	}
+	return nil
+}
+
+// ReadFile reads the records of data in lenient mode. The file is returned
+// with the error when only part of it could be read.
+func ReadFile(data []byte) (*EmfFile, error) {
+	return ReadFileWithOptions(data, nil)
 }
 
-func ReadFile(data []byte) *EmfFile {
-	reader := bytes.NewReader(data)
-	emfFile := &EmfFile{}
+// ReadFileWithOptions reads the records of data. A record which cannot be
+// read is reported as a *RecordError.
+func ReadFileWithOptions(data []byte, opts *ReadOptions) (*EmfFile, error) {
+	dec := NewDecoderWithOptions(bytes.NewReader(data), opts)
+	emfFile := &EmfFile{strict: dec.strict, limits: dec.limits}
+	if opts != nil {
+		emfFile.fonts = opts.Fonts
+	}
 
-	for reader.Len() > 0 {
-		rec, err := readRecord(reader)
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			return emfFile, nil
+		}
 		if err != nil {
-			log.Error(err)
-			break
+			if dec.strict || emfFile.Header == nil {
+				return nil, err
+			}
+			return emfFile, err
 		}
 
 		switch rec := rec.(type) {
@@ -39,13 +126,29 @@ func ReadFile(data []byte) *EmfFile {
 			emfFile.Header = rec
 		case *EofRecord:
 			emfFile.Eof = rec
-			return emfFile
 		default:
 			emfFile.Records = append(emfFile.Records, rec)
 		}
 	}
+}
+
+// SetOptions sets the options the file is drawn with, which are those it
+// was read with, nil means the defaults. It lets a file which is built or
+// converted be drawn in strict mode, with other limits or fonts.
+func (f *EmfFile) SetOptions(opts *ReadOptions) {
+	if opts == nil {
+		opts = &ReadOptions{}
+	}
 
-	return emfFile
+	f.strict = opts.Strict
+	f.limits = opts.Limits
+	f.fonts = opts.Fonts
+}
+
+// FontReport returns the faces of the text which were not found under
+// their own name the last time the file was drawn, sorted by face name.
+func (f *EmfFile) FontReport() []FontMatch {
+	return f.report
 }
 
 func (f *EmfFile) DrawToGrayPNG(output string) error {
@@ -57,14 +160,16 @@ func (f *EmfFile) DrawToColorPNG(output string) error {
 }
 
 func (f *EmfFile) DrawToImg(mode int) (image.Image, error) {
-	emfdc := NewEmfContext(f.Header.Original.Bounds, f.Header.Original.Device)
+	emfdc, err := f.newContext()
+	if err != nil {
+		return nil, err
+	}
 
-	for idx := range f.Records {
-		f.Records[idx].Draw(emfdc)
+	if err := f.play(emfdc); err != nil {
+		return nil, err
 	}
 
 	var img interface{}
-	var err error
 
 	if mode == DRAW_COLOR_IMAGE {
 		img, err = emfdc.DrawToColorImage(PAGE_AREA)
@@ -92,11 +197,82 @@ func (f *EmfFile) DrawToImg(mode int) (image.Image, error) {
 	return imgx, nil
 }
 
+// newContext returns a context which draws to a bitmap of the reference
+// device, unless the bitmap exceeds the limits.
+func (f *EmfFile) newContext() (*EmfContext, error) {
+	limits := f.limits
+	if limits == nil {
+		limits = &DefaultLimits
+	}
+
+	device := f.Header.Original.Device
+	if err := limits.checkPixels(int64(device.CX), int64(device.CY)); err != nil {
+		return nil, err
+	}
+
+	ctx := NewEmfContext(f.Header.Original.Bounds, device)
+	ctx.setPixelSize(f.Header.pixelSize())
+
+	return ctx, nil
+}
+
+// play draws the records in ctx. Once an EMF+ header is played the EMF
+// records are skipped, except for those following an EmfPlusGetDC record.
+// In strict mode it stops at the first record which fails, otherwise the
+// errors are logged. An EMF+ only metafile on a device without EMF+ fails
+// in both modes, as nothing of it would be drawn.
+func (f *EmfFile) play(ctx *EmfContext) error {
+	defer func() { f.report = ctx.FontReport() }()
+
+	ctx.strict = f.strict
+	if f.limits != nil {
+		ctx.setLimits(f.limits)
+	}
+	if f.fonts != nil {
+		ctx.setFonts(f.fonts)
+	}
+
+	for idx, rec := range f.Records {
+		if err := ctx.Play(rec); err != nil {
+			rerr := &RecordError{Op: "draw", Index: idx, Type: recordType(rec), Err: err}
+			if f.strict || errors.Is(err, ErrPlusUnsupported) {
+				return rerr
+			}
+			log.Error(rerr)
+		}
+	}
+
+	return nil
+}
+
+// Play draws a record, which lets a file be drawn as it is decoded. The
+// records must be played in order, and those replaced by EMF+ records are
+// skipped as when the whole file is drawn.
+func (e *EmfContext) Play(rec Recorder) error {
+	if e.skipRecord(rec) {
+		return nil
+	}
+
+	return rec.Draw(e)
+}
+
+// DrawToDevice plays the records on dev, which is left for the caller to
+// read and release.
+func (f *EmfFile) DrawToDevice(dev Device) error {
+	emfdc := NewEmfContextWithDevice(f.Header.Original.Bounds, f.Header.Original.Device, dev)
+	emfdc.setPixelSize(f.Header.pixelSize())
+
+	return f.play(emfdc)
+}
+
 func (f *EmfFile) drawToPNG(output string, mode int) error {
-	emfdc := NewEmfContext(f.Header.Original.Bounds, f.Header.Original.Device)
+	emfdc, err := f.newContext()
+	if err != nil {
+		return err
+	}
 
-	for idx := range f.Records {
-		f.Records[idx].Draw(emfdc)
+	if err := f.play(emfdc); err != nil {
+		return err
 	}
 
 	if mode == DRAW_COLOR_IMAGE {
@@ -0,0 +1,266 @@
+package emf
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+var goFonts = struct {
+	sync.Mutex
+	parsed map[string]*sfnt.Font
+}{parsed: map[string]*sfnt.Font{}}
+
+func parseGoFont(name string, data []byte) (*sfnt.Font, error) {
+	goFonts.Lock()
+	defer goFonts.Unlock()
+
+	if f, ok := goFonts.parsed[name]; ok {
+		return f, nil
+	}
+
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	goFonts.parsed[name] = f
+	return f, nil
+}
+
+// isFixedPitch guesses from the LOGFONT whether a monospaced face is wanted.
+func isFixedPitch(lf w32.LOGFONT) bool {
+	if lf.PitchAndFamily&0x03 == FIXED_PITCH || lf.PitchAndFamily>>4 == FF_MODERN {
+		return true
+	}
+
+	face := strings.ToLower(lf.GetFaceName())
+	for _, name := range []string{"courier", "mono", "consolas", "fixed", "terminal"} {
+		if strings.Contains(face, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadGoFont returns the Go font closest to the weight, slant and pitch of
+// the LOGFONT.
+func loadGoFont(lf w32.LOGFONT) (*fontFace, error) {
+	bold := lf.Weight >= w32.FW_SEMIBOLD
+	italic := lf.Italic != 0
+
+	name, data := "goregular", goregular.TTF
+	if isFixedPitch(lf) {
+		switch {
+		case bold && italic:
+			name, data = "gomonobolditalic", gomonobolditalic.TTF
+		case bold:
+			name, data = "gomonobold", gomonobold.TTF
+		case italic:
+			name, data = "gomonoitalic", gomonoitalic.TTF
+		default:
+			name, data = "gomono", gomono.TTF
+		}
+	} else {
+		switch {
+		case bold && italic:
+			name, data = "gobolditalic", gobolditalic.TTF
+		case bold:
+			name, data = "gobold", gobold.TTF
+		case italic:
+			name, data = "goitalic", goitalic.TTF
+		}
+	}
+
+	f, err := parseGoFont(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	face, err := newFontFace(f)
+	if err != nil {
+		return nil, err
+	}
+	face.data = data
+
+	return face, nil
+}
+
+// fontFace is a scalable font used by the software device. Outlines and
+// metrics are in font units with the Y axis pointing down.
+type fontFace struct {
+	font       *sfnt.Font
+	data       []byte // the font file, for embedding
+	buf        sfnt.Buffer
+	unitsPerEm float64
+	ascent     float64
+	descent    float64
+	underline  float64 // distance of the underline below the baseline
+	lineWidth  float64 // thickness of underline and strikeout
+	glyphs     map[sfnt.GlyphIndex]*raster.Path
+}
+
+func newFontFace(f *sfnt.Font) (*fontFace, error) {
+	face := &fontFace{
+		font:       f,
+		unitsPerEm: float64(f.UnitsPerEm()),
+		glyphs:     map[sfnt.GlyphIndex]*raster.Path{},
+	}
+
+	m, err := f.Metrics(&face.buf, face.ppem(), font.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+
+	face.ascent = float64(m.Ascent) / 64
+	face.descent = float64(m.Descent) / 64
+	face.underline = face.unitsPerEm / 10
+	face.lineWidth = face.unitsPerEm / 20
+
+	if post := f.PostTable(); post != nil && post.UnderlineThickness > 0 {
+		face.underline = -float64(post.UnderlinePosition)
+		face.lineWidth = float64(post.UnderlineThickness)
+	}
+
+	return face, nil
+}
+
+// ppem requests outlines in font units.
+func (f *fontFace) ppem() fixed.Int26_6 {
+	return fixed.Int26_6(f.font.UnitsPerEm()) << 6
+}
+
+// emSize converts a LOGFONT height to the em size in the same units. A
+// negative height is the em size, a positive one the cell height.
+func (f *fontFace) emSize(height int32) float64 {
+	switch {
+	case height < 0:
+		return float64(-height)
+	case height > 0:
+		return float64(height) * f.unitsPerEm / (f.ascent + f.descent)
+	}
+	return 12
+}
+
+func (f *fontFace) glyphIndex(r rune) sfnt.GlyphIndex {
+	idx, err := f.font.GlyphIndex(&f.buf, r)
+	if err != nil {
+		return 0
+	}
+	return idx
+}
+
+// isUpright reports whether a character stands upright in vertical text,
+// as the ideographs, the kana, the hangul and their punctuation do.
+func isUpright(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana, unicode.Bopomofo):
+		return true
+	case r >= 0x3000 && r <= 0x303F, // CJK symbols and punctuation
+		r >= 0x3200 && r <= 0x33FF, // enclosed CJK letters and compatibility
+		r >= 0xFE30 && r <= 0xFE4F, // CJK compatibility forms
+		r >= 0xFF01 && r <= 0xFF60, // full width forms
+		r >= 0xFFE0 && r <= 0xFFE6:
+		return true
+	}
+	return false
+}
+
+// glyphRunes are the characters of the glyphs of the fonts, which are
+// found by looking up every character of the basic multilingual plane the
+// first time a glyph index of the font is drawn.
+var glyphRunes = struct {
+	sync.Mutex
+	fonts map[*sfnt.Font]map[sfnt.GlyphIndex]rune
+}{fonts: map[*sfnt.Font]map[sfnt.GlyphIndex]rune{}}
+
+// runeOf returns the character of a glyph, unicode.ReplacementChar when the
+// glyph is not a character of the basic multilingual plane on its own, as
+// ligatures are.
+func (f *fontFace) runeOf(idx sfnt.GlyphIndex) rune {
+	glyphRunes.Lock()
+	defer glyphRunes.Unlock()
+
+	runes, ok := glyphRunes.fonts[f.font]
+	if !ok {
+		runes = map[sfnt.GlyphIndex]rune{}
+		for r := rune(0x20); r <= 0xFFFF; r++ {
+			if utf16.IsSurrogate(r) {
+				continue
+			}
+
+			// the first character of a glyph wins
+			if g := f.glyphIndex(r); g != 0 {
+				if _, ok := runes[g]; !ok {
+					runes[g] = r
+				}
+			}
+		}
+		glyphRunes.fonts[f.font] = runes
+	}
+
+	if r, ok := runes[idx]; ok {
+		return r
+	}
+	return unicode.ReplacementChar
+}
+
+func (f *fontFace) advance(idx sfnt.GlyphIndex) float64 {
+	adv, err := f.font.GlyphAdvance(&f.buf, idx, f.ppem(), font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return float64(adv) / 64
+}
+
+// outline returns the shape of the glyph with its origin at (0, 0).
+func (f *fontFace) outline(idx sfnt.GlyphIndex) *raster.Path {
+	if p, ok := f.glyphs[idx]; ok {
+		return p
+	}
+
+	p := &raster.Path{}
+	f.glyphs[idx] = p
+
+	segments, err := f.font.LoadGlyph(&f.buf, idx, f.ppem(), nil)
+	if err != nil {
+		return p
+	}
+
+	pt := func(v fixed.Point26_6) raster.Point {
+		return raster.Pt(float64(v.X)/64, float64(v.Y)/64)
+	}
+
+	for _, s := range segments {
+		switch s.Op {
+		case sfnt.SegmentOpMoveTo:
+			p.Close()
+			p.MoveTo(pt(s.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			p.LineTo(pt(s.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			p.QuadTo(pt(s.Args[0]), pt(s.Args[1]))
+		case sfnt.SegmentOpCubeTo:
+			p.CubeTo(pt(s.Args[0]), pt(s.Args[1]), pt(s.Args[2]))
+		}
+	}
+	p.Close()
+
+	return p
+}
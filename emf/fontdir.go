@@ -0,0 +1,433 @@
+package emf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/font/sfnt"
+)
+
+// FontResolver finds the fonts of LOGFONT faces in font files, so that
+// text, and glyph index text above all, is drawn with the font it was laid
+// out with. A face which is not found is replaced by the first of its
+// substitutes which is found, then by the fallbacks of its charset, and at
+// last by the Go font closest to its weight, slant and pitch. Glyph index
+// text of a face which is not found is left out, as its glyphs are those of
+// the missing font.
+type FontResolver struct {
+	// Dirs are searched with their subdirectories for TrueType and
+	// OpenType fonts and collections, the first time a face is resolved.
+	Dirs []string
+
+	// Substitutes are the families tried in order for a face which is not
+	// found, by lower case face name.
+	Substitutes map[string][]string
+
+	// CharsetFallbacks are the families tried in order for a face of a
+	// charset whose script the Go fonts do not have, when neither the face
+	// nor its substitutes are found.
+	CharsetFallbacks map[uint8][]string
+
+	mu       sync.Mutex
+	indexed  bool
+	families map[string][]*localFont // by lower case family name
+	loaded   map[string][]byte       // font files by path
+}
+
+// DefaultFontResolver resolves the faces of the software devices when no
+// other resolver is given. It only draws with the Go fonts, so that a file
+// draws the same on every machine, NewFontResolver(SystemFontDirs()...)
+// draws with the fonts installed instead.
+var DefaultFontResolver = NewFontResolver()
+
+// NewFontResolver returns a resolver of the fonts in dirs, with the default
+// substitutes and charset fallbacks. A resolver without dirs only draws
+// with the Go fonts, the same way on every machine.
+func NewFontResolver(dirs ...string) *FontResolver {
+	r := &FontResolver{
+		Dirs:             dirs,
+		Substitutes:      map[string][]string{},
+		CharsetFallbacks: map[uint8][]string{},
+	}
+
+	for _, s := range defaultSubstitutes {
+		for _, face := range s.faces {
+			r.Substitutes[face] = s.families
+		}
+	}
+	for charset, families := range defaultCharsetFallbacks {
+		r.CharsetFallbacks[charset] = families
+	}
+
+	return r
+}
+
+// defaultSubstitutes are metric compatible or look-alike open fonts of the
+// faces of Windows.
+var defaultSubstitutes = []struct {
+	faces    []string
+	families []string
+}{
+	{[]string{"arial", "helvetica", "arial unicode ms"}, []string{"Liberation Sans", "Arimo", "DejaVu Sans"}},
+	{[]string{"times new roman", "times"}, []string{"Liberation Serif", "Tinos", "DejaVu Serif"}},
+	{[]string{"courier new", "courier"}, []string{"Liberation Mono", "Cousine", "DejaVu Sans Mono"}},
+	{[]string{"calibri"}, []string{"Carlito", "Liberation Sans", "DejaVu Sans"}},
+	{[]string{"cambria"}, []string{"Caladea", "Liberation Serif", "DejaVu Serif"}},
+	{[]string{"segoe ui", "tahoma", "verdana", "ms shell dlg", "ms shell dlg 2", "ms sans serif", "microsoft sans serif"}, []string{"DejaVu Sans", "Noto Sans", "Liberation Sans"}},
+	{[]string{"consolas", "lucida console"}, []string{"DejaVu Sans Mono", "Liberation Mono"}},
+	{[]string{"malgun gothic", "맑은 고딕", "gulim", "굴림", "gulimche", "굴림체", "dotum", "돋움", "dotumche", "돋움체"}, []string{"Noto Sans CJK KR", "Noto Sans KR", "NanumGothic"}},
+	{[]string{"batang", "바탕", "batangche", "바탕체", "gungsuh", "궁서"}, []string{"Noto Serif CJK KR", "Noto Serif KR", "NanumMyeongjo", "Noto Sans CJK KR"}},
+	{[]string{"ms gothic", "ｍｓ ゴシック", "ms pgothic", "ｍｓ ｐゴシック", "ms ui gothic", "meiryo", "メイリオ", "yu gothic", "游ゴシック"}, []string{"Noto Sans CJK JP", "Noto Sans JP", "IPAGothic", "IPAexGothic"}},
+	{[]string{"ms mincho", "ｍｓ 明朝", "ms pmincho", "ｍｓ ｐ明朝", "yu mincho", "游明朝"}, []string{"Noto Serif CJK JP", "Noto Serif JP", "IPAMincho", "Noto Sans CJK JP"}},
+	{[]string{"simsun", "宋体", "nsimsun", "新宋体"}, []string{"Noto Serif CJK SC", "Noto Sans CJK SC"}},
+	{[]string{"simhei", "黑体", "microsoft yahei", "微软雅黑"}, []string{"Noto Sans CJK SC", "Noto Sans SC"}},
+	{[]string{"mingliu", "細明體", "pmingliu", "新細明體"}, []string{"Noto Serif CJK TC", "Noto Sans CJK TC"}},
+	{[]string{"microsoft jhenghei", "微軟正黑體"}, []string{"Noto Sans CJK TC", "Noto Sans TC"}},
+}
+
+var defaultCharsetFallbacks = map[uint8][]string{
+	uint8(HANGUL_CHARSET):      {"Noto Sans CJK KR", "Noto Sans KR", "NanumGothic", "Malgun Gothic"},
+	uint8(SHIFTJIS_CHARSET):    {"Noto Sans CJK JP", "Noto Sans JP", "IPAGothic", "MS Gothic"},
+	uint8(GB2312_CHARSET):      {"Noto Sans CJK SC", "Noto Sans SC", "Microsoft YaHei", "SimSun"},
+	uint8(CHINESEBIG5_CHARSET): {"Noto Sans CJK TC", "Noto Sans TC", "Microsoft JhengHei", "MingLiU"},
+	uint8(ARABIC_CHARSET):      {"Noto Sans Arabic", "DejaVu Sans", "Arial"},
+	uint8(HEBREW_CHARSET):      {"Noto Sans Hebrew", "DejaVu Sans", "Arial"},
+	uint8(THAI_CHARSET):        {"Noto Sans Thai", "Tahoma"},
+}
+
+// FontMatch is the font a LOGFONT face resolves to.
+type FontMatch struct {
+	Face        string // face name of the LOGFONT
+	Family      string // family of the font used
+	Path        string // font file, empty for the Go fonts
+	Index       int    // of the font in a collection
+	Substituted bool   // the face was not found under its own name
+
+	// GlyphsSkipped is set when glyph index text of the face was not
+	// drawn, as the indices only fit the font the face names.
+	GlyphsSkipped bool
+}
+
+// localFont is a font of a font file, which is read when it is first used.
+type localFont struct {
+	family string
+	path   string
+	index  int // of the font in a collection
+	weight int
+	italic bool
+	font   *sfnt.Font
+}
+
+// SystemFontDirs returns the directories where the system and the user
+// install fonts, which depend on the machine.
+func SystemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+
+	switch runtime.GOOS {
+	case "windows":
+		dirs := []string{filepath.Join(os.Getenv("WINDIR"), "Fonts")}
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			dirs = append(dirs, filepath.Join(local, "Microsoft", "Windows", "Fonts"))
+		}
+		return dirs
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	}
+
+	return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".local", "share", "fonts"), filepath.Join(home, ".fonts")}
+}
+
+// AddDir adds a directory of fonts, which is searched before the others.
+func (r *FontResolver) AddDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Dirs = append([]string{dir}, r.Dirs...)
+	r.indexed = false
+}
+
+// Substitute makes the families the substitutes of a face, in the order
+// they are tried.
+func (r *FontResolver) Substitute(face string, families ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Substitutes == nil {
+		r.Substitutes = map[string][]string{}
+	}
+	r.Substitutes[strings.ToLower(face)] = families
+}
+
+// Resolve returns the font the LOGFONT face is drawn with. The height of
+// the LOGFONT does not matter as the fonts are scalable.
+func (r *FontResolver) Resolve(lf w32.LOGFONT) FontMatch {
+	m, _ := r.resolve(lf)
+	return m
+}
+
+// face returns the font of the LOGFONT face and its match.
+func (r *FontResolver) face(lf w32.LOGFONT) (*fontFace, FontMatch, error) {
+	m, f := r.resolve(lf)
+	if f != nil {
+		face, err := r.load(f)
+		if err == nil {
+			return face, m, nil
+		}
+		log.Warn("failed to load font ", m.Path, ": ", err)
+		m = FontMatch{Face: m.Face, Family: "Go", Substituted: true}
+	}
+
+	face, err := loadGoFont(lf)
+	return face, m, err
+}
+
+// fontReport collects the faces a drawing resolved which were not found
+// under their own name, a nil report collects nothing.
+type fontReport struct {
+	faces map[string]FontMatch // by lower case name
+}
+
+// add reports the match of a face unless it was found or has no name. A
+// face is reported once, with the glyphs skipped for any of its matches.
+func (r *fontReport) add(m FontMatch) {
+	if r == nil || !m.Substituted || m.Face == "" {
+		return
+	}
+
+	key := strings.ToLower(m.Face)
+	if r.faces == nil {
+		r.faces = map[string]FontMatch{}
+	}
+	if reported, ok := r.faces[key]; ok {
+		reported.GlyphsSkipped = reported.GlyphsSkipped || m.GlyphsSkipped
+		r.faces[key] = reported
+		return
+	}
+
+	r.faces[key] = m
+	log.Infof("font %q is drawn with %q", m.Face, m.Family)
+}
+
+// list returns the reported faces sorted by face name.
+func (r *fontReport) list() []FontMatch {
+	if r == nil {
+		return nil
+	}
+
+	list := make([]FontMatch, 0, len(r.faces))
+	for _, m := range r.faces {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Face < list[j].Face })
+
+	return list
+}
+
+// resolve returns the match of the LOGFONT and its font, which is nil for
+// the Go fonts.
+func (r *FontResolver) resolve(lf w32.LOGFONT) (FontMatch, *localFont) {
+	// a vertical font is the font of its face without the @
+	face := strings.TrimPrefix(strings.TrimSpace(lf.GetFaceName()), "@")
+	key := strings.ToLower(face)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.indexed {
+		r.index()
+	}
+
+	candidates := append([]string{face}, r.Substitutes[key]...)
+	candidates = append(candidates, r.CharsetFallbacks[lf.CharSet]...)
+
+	m := FontMatch{Face: face}
+
+	var found *localFont
+	for _, family := range candidates {
+		if found = r.find(family, int(lf.Weight), lf.Italic != 0); found != nil {
+			m.Family, m.Path, m.Index = found.family, found.path, found.index
+			break
+		}
+	}
+
+	if found == nil {
+		m.Family = "Go"
+		if isFixedPitch(lf) {
+			m.Family = "Go Mono"
+		}
+	}
+
+	m.Substituted = !strings.EqualFold(m.Family, face)
+
+	return m, found
+}
+
+// find returns the font of the family closest to the weight and slant, the
+// fonts must be indexed.
+func (r *FontResolver) find(family string, weight int, italic bool) *localFont {
+	family = strings.ToLower(strings.TrimSpace(family))
+	if family == "" {
+		return nil
+	}
+
+	if weight == 0 {
+		weight = 400
+	}
+
+	var best *localFont
+	bestScore := 0
+	for _, f := range r.families[family] {
+		score := f.weight - weight
+		if score < 0 {
+			score = -score
+		}
+		if f.italic != italic {
+			score += 1000
+		}
+
+		if best == nil || score < bestScore {
+			best, bestScore = f, score
+		}
+	}
+
+	return best
+}
+
+// index reads the names of the fonts in the directories.
+func (r *FontResolver) index() {
+	r.families = map[string][]*localFont{}
+	r.indexed = true
+
+	seen := map[string]bool{}
+	for _, dir := range r.Dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ttf", ".otf", ".ttc", ".otc":
+				r.indexFile(path)
+			}
+			return nil
+		})
+	}
+}
+
+func (r *FontResolver) indexFile(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	c, err := sfnt.ParseCollectionReaderAt(file)
+	if err != nil {
+		return
+	}
+
+	var buf sfnt.Buffer
+	for i := 0; i < c.NumFonts(); i++ {
+		f, err := c.Font(i)
+		if err != nil {
+			continue
+		}
+
+		style, _ := f.Name(&buf, sfnt.NameIDSubfamily)
+		weight, italic := parseFontStyle(style)
+
+		// a face is found by its family name, or by its typographic family
+		// name which groups the weights beyond the four styles of a family
+		names := map[string]string{}
+		for _, id := range []sfnt.NameID{sfnt.NameIDFamily, sfnt.NameIDTypographicFamily} {
+			if name, err := f.Name(&buf, id); err == nil && name != "" {
+				names[strings.ToLower(name)] = name
+			}
+		}
+
+		for key, name := range names {
+			r.families[key] = append(r.families[key], &localFont{family: name, path: path, index: i, weight: weight, italic: italic})
+		}
+	}
+}
+
+// parseFontStyle returns the weight and the slant of a style name such as
+// "Bold Italic".
+func parseFontStyle(style string) (int, bool) {
+	style = strings.ToLower(strings.Replace(style, " ", "", -1))
+
+	weight := 400
+	for _, w := range []struct {
+		name   string
+		weight int
+	}{
+		{"thin", 100}, {"hairline", 100},
+		{"extralight", 200}, {"ultralight", 200},
+		{"light", 300},
+		{"medium", 500},
+		{"semibold", 600}, {"demibold", 600},
+		{"extrabold", 800}, {"ultrabold", 800},
+		{"black", 900}, {"heavy", 900},
+	} {
+		if strings.Contains(style, w.name) {
+			weight = w.weight
+			break
+		}
+	}
+
+	if weight == 400 && strings.Contains(style, "bold") {
+		weight = 700
+	}
+
+	return weight, strings.Contains(style, "italic") || strings.Contains(style, "oblique")
+}
+
+// load reads the font of f, a font file is read once.
+func (r *FontResolver) load(f *localFont) (*fontFace, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loaded == nil {
+		r.loaded = map[string][]byte{}
+	}
+
+	data, ok := r.loaded[f.path]
+	if !ok {
+		var err error
+		if data, err = ioutil.ReadFile(f.path); err != nil {
+			return nil, err
+		}
+		r.loaded[f.path] = data
+	}
+
+	if f.font == nil {
+		c, err := sfnt.ParseCollection(data)
+		if err != nil {
+			return nil, err
+		}
+		if f.font, err = c.Font(f.index); err != nil {
+			return nil, err
+		}
+	}
+
+	face, err := newFontFace(f.font)
+	if err != nil {
+		return nil, err
+	}
+
+	// the font of a collection cannot be embedded on its own
+	if !bytes.HasPrefix(data, []byte("ttcf")) {
+		face.data = data
+	}
+
+	return face, nil
+}
@@ -0,0 +1,140 @@
+package emf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// fontDir returns a directory of Go fonts, the mono one in a subdirectory.
+func fontDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "mono"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"Go-Regular.ttf":   goregular.TTF,
+		"Go-Bold.TTF":      gobold.TTF,
+		"mono/Go-Mono.ttf": gomono.TTF,
+		"readme.txt":       []byte("not a font"),
+		"broken.ttf":       []byte("not a font either"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func logFont(face string, weight int32, pitchAndFamily, charset uint8) w32.LOGFONT {
+	lf := w32.LOGFONT{Weight: weight, PitchAndFamily: pitchAndFamily, CharSet: charset}
+	lf.SetFaceName(face)
+	return lf
+}
+
+func TestFontResolver(t *testing.T) {
+	dir := fontDir(t)
+	regular := filepath.Join(dir, "Go-Regular.ttf")
+	bold := filepath.Join(dir, "Go-Bold.TTF")
+	mono := filepath.Join(dir, "mono", "Go-Mono.ttf")
+
+	r := NewFontResolver(dir)
+	r.Substitute("Malgun Gothic", "Missing", "Go Mono")
+	r.CharsetFallbacks[uint8(HANGUL_CHARSET)] = []string{"Go"}
+
+	tests := []struct {
+		name string
+		lf   w32.LOGFONT
+		want FontMatch
+	}{
+		{"found", logFont("Go", w32.FW_NORMAL, 0, 0), FontMatch{Face: "Go", Family: "Go", Path: regular}},
+		{"weight", logFont("go", w32.FW_BOLD, 0, 0), FontMatch{Face: "go", Family: "Go", Path: bold}},
+		{"vertical", logFont("@Go", 0, 0, 0), FontMatch{Face: "Go", Family: "Go", Path: regular}},
+		{"subdirectory", logFont("Go Mono", 0, 0, 0), FontMatch{Face: "Go Mono", Family: "Go Mono", Path: mono}},
+		{"substitute", logFont("Malgun Gothic", 0, 0, 0), FontMatch{Face: "Malgun Gothic", Family: "Go Mono", Path: mono, Substituted: true}},
+		{"charset fallback", logFont("Batang", 0, 0, uint8(HANGUL_CHARSET)), FontMatch{Face: "Batang", Family: "Go", Path: regular, Substituted: true}},
+		{"go font", logFont("Arial", 0, 0, 0), FontMatch{Face: "Arial", Family: "Go", Substituted: true}},
+		{"go mono font", logFont("Courier New", 0, FIXED_PITCH, 0), FontMatch{Face: "Courier New", Family: "Go Mono", Substituted: true}},
+		{"no face", logFont("", 0, 0, 0), FontMatch{Family: "Go", Substituted: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := r.Resolve(tt.lf); m != tt.want {
+				t.Errorf("%q resolves to %+v, want %+v", tt.lf.GetFaceName(), m, tt.want)
+			}
+		})
+	}
+}
+
+// fontFile returns a file drawing a word in each face.
+func fontFile(t *testing.T, fonts *FontResolver, faces ...string) *EmfFile {
+	t.Helper()
+
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	for _, face := range faces {
+		b.SelectFont(logFont(face, w32.FW_NORMAL, 0, 0))
+		if err := b.Text(10, 10, "word"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := b.File()
+	f.SetOptions(&ReadOptions{Strict: true, Fonts: fonts})
+	return f
+}
+
+func TestFontReport(t *testing.T) {
+	fonts := NewFontResolver(fontDir(t))
+
+	// the report of a file has the faces it substituted once, in the order
+	// of their names, and leaves out those found and those without a name
+	tests := []struct {
+		faces []string
+		want  []string
+	}{
+		{[]string{"Go", "Malgun Gothic", "Arial", "arial", ""}, []string{"Arial", "Malgun Gothic"}},
+		{[]string{"Courier New"}, []string{"Courier New"}},
+		{[]string{"Go Mono"}, nil},
+	}
+
+	for _, tt := range tests {
+		f := fontFile(t, fonts, tt.faces...)
+		if err := f.DrawToDevice(NewRasterDevice(100, 100)); err != nil {
+			t.Fatal(err)
+		}
+
+		var faces []string
+		for _, m := range f.FontReport() {
+			faces = append(faces, m.Face)
+		}
+		if !reflect.DeepEqual(faces, tt.want) {
+			t.Errorf("report of %q has %q, want %q", tt.faces, faces, tt.want)
+		}
+	}
+}
+
+func TestFontResolverFace(t *testing.T) {
+	r := NewFontResolver(fontDir(t))
+
+	face, _, err := r.face(logFont("Go Mono", 0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every glyph of a mono font has the same advance
+	if a, b := face.advance(face.glyphIndex('i')), face.advance(face.glyphIndex('W')); a != b {
+		t.Errorf("advances of the mono font are %v and %v", a, b)
+	}
+}
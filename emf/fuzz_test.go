@@ -0,0 +1,48 @@
+package emf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// fuzzLimits keep the inputs of the fuzzer fast to draw.
+var fuzzLimits = Limits{MaxRecordSize: 1 << 20, MaxImagePixels: 1 << 20}
+
+// FuzzReadFile reads files in lenient mode, what could be read is drawn to
+// a bitmap and to SVG. Run it with go test -fuzz FuzzReadFile.
+func FuzzReadFile(f *testing.F) {
+	seed := func(file *EmfFile) []byte {
+		var buf bytes.Buffer
+		if _, err := file.WriteTo(&buf); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+		return buf.Bytes()
+	}
+
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	seed(b.File())
+
+	b.SelectPen(PS_DASH, 3, 0x0000FF)
+	b.SelectBrush(BS_HATCHED, 0x00FF00, w32.HS_FDIAGONAL)
+	b.Rectangle(10, 10, 50, 60)
+	b.Polygon([]w32.POINT{{X: 0, Y: 0}, {X: 90, Y: 5}, {X: 7, Y: 9}})
+	b.Add(&AngleArcRecord{Record: Record{Type: EMR_ANGLEARC}, Center: w32.POINT{X: 20, Y: 20}, Radius: 10, StartAngle: 30, SweepAngle: 120})
+	b.Add(&FillRgnRecord{Record: Record{Type: EMR_FILLRGN}, IhBrush: b.brush, RgnData: RegionData{Data: []w32.RECT{{Left: 1, Top: 2, Right: 30, Bottom: 20}}}})
+	data := seed(b.File())
+	f.Add(data[:len(data)-7])
+	seed(plusFile(0))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, _ := ReadFileWithOptions(data, &ReadOptions{Limits: &fuzzLimits})
+		if file == nil {
+			return
+		}
+
+		file.DrawToImg(DRAW_COLOR_IMAGE)
+		file.WriteSVG(ioutil.Discard)
+	})
+}
@@ -1,13 +1,10 @@
 package emf
 
 import (
-	"errors"
 	"image"
 	"image/png"
 	"os"
-	"unsafe"
 
-	"github.com/lokks307/go-emf/w32"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -109,75 +106,6 @@ func PixelConvert(src []byte, width, height, srcBppBit, destBppBit int) []byte {
 	return dest
 }
 
-func DeviceContextToImage(srcDC w32.HDC, width, height int) ([]uint8, *image.RGBA, error) {
-
-	destDC := w32.CreateCompatibleDC(srcDC)
-
-	if destDC == 0 {
-		return []uint8{}, nil, errors.New("CreateCompatibleDC failed")
-	}
-	defer w32.DeleteDC(destDC)
-
-	bitmap := w32.CreateCompatibleBitmap(srcDC, width, height)
-
-	oobj := w32.SelectObject(destDC, w32.HGDIOBJ(bitmap)) // attach bitmap to destDC
-	if oobj == 0 {
-		return []uint8{}, nil, errors.New("SelectObject failed")
-	}
-	defer w32.SelectObject(destDC, oobj)
-
-	if bitmap == 0 {
-		return []uint8{}, nil, errors.New("CreateCompatibleBitmap failed")
-	}
-	defer w32.DeleteObject(w32.HGDIOBJ(bitmap))
-
-	var header w32.BITMAPINFO
-	header.BiSize = uint32(unsafe.Sizeof(header))
-	header.BiPlanes = 1
-	header.BiBitCount = 32
-	header.BiWidth = int32(width)
-	header.BiHeight = int32(-height)
-	header.BiCompression = w32.BI_RGB
-	header.BiSizeImage = 0
-
-	bitmapDataSize := uintptr(((int64(width)*int64(header.BiBitCount) + 31) / 32) * 4 * int64(height))
-	hmem := w32.GlobalAlloc(w32.GMEM_MOVEABLE, bitmapDataSize)
-	memptr := w32.GlobalLock(hmem)
-	defer func() {
-		w32.GlobalUnlock(hmem)
-		w32.GlobalFree(hmem)
-	}()
-
-	if !w32.BitBlt(destDC, 0, 0, width, height, srcDC, 0, 0, w32.SRCCOPY) { // copy srcDC to destDC(bitmap)
-		return []uint8{}, nil, errors.New("BitBlt failed")
-	}
-
-	if w32.GetDIBits(destDC, bitmap, 0, w32.UINT(height), memptr, &header, w32.DIB_RGB_COLORS) == 0 { // bitmap on destDC to memptr
-		return []uint8{}, nil, errors.New("GetDIBits failed")
-	}
-
-	dim := height * width
-	grayImg := make([]uint8, dim)
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	src := uintptr(memptr)
-
-	k := 0
-
-	for i := 0; i < dim; i++ {
-		v0 := *(*uint8)(unsafe.Pointer(src))     // B
-		v1 := *(*uint8)(unsafe.Pointer(src + 1)) // G
-		v2 := *(*uint8)(unsafe.Pointer(src + 2)) // R
-
-		img.Pix[k], img.Pix[k+1], img.Pix[k+2], img.Pix[k+3] = v2, v1, v0, 255 // BGRA => RGBA, and set A to 255
-
-		grayImg[i] = v2
-		k += 4
-		src += 4
-	}
-
-	return grayImg, img, nil
-}
-
 func CropImageByte(img []uint8, width, height, left, top, right, bottom int) []byte {
 
 	// rect (left, top, right, bottom) is inclusive image
@@ -5,13 +5,13 @@ import "bytes"
 // map of readers for records
 var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_HEADER:                  readHeaderRecord,
-	EMR_POLYBEZIER:              nil,
-	EMR_POLYGON:                 nil,
-	EMR_POLYLINE:                nil,
-	EMR_POLYBEZIERTO:            nil,
-	EMR_POLYLINETO:              nil,
-	EMR_POLYPOLYLINE:            nil,
-	EMR_POLYPOLYGON:             nil,
+	EMR_POLYBEZIER:              readPolyBezierRecord,
+	EMR_POLYGON:                 readPolygonRecord,
+	EMR_POLYLINE:                readPolyLineRecord,
+	EMR_POLYBEZIERTO:            readPolyBezierToRecord,
+	EMR_POLYLINETO:              readPolyLineToRecord,
+	EMR_POLYPOLYLINE:            readPolyPolyLineRecord,
+	EMR_POLYPOLYGON:             readPolyPolygonRecord,
 	EMR_SETWINDOWEXTEX:          readSetWindowExtExRecord,
 	EMR_SETWINDOWORGEX:          readSetWindowOrgExRecord,
 	EMR_SETVIEWPORTEXTEX:        readSetViewportExtExRecord,
@@ -32,9 +32,9 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_OFFSETCLIPRGN:           readOffSetClipRgnRecord,
 	EMR_MOVETOEX:                readMoveToExRecord,
 	EMR_SETMETARGN:              readSetMetaRgnRecord,
-	EMR_EXCLUDECLIPRECT:         nil,
+	EMR_EXCLUDECLIPRECT:         readExcludeClipRectRecord,
 	EMR_INTERSECTCLIPRECT:       readIntersectClipRectRecord,
-	EMR_SCALEVIEWPORTEXTEX:      nil,
+	EMR_SCALEVIEWPORTEXTEX:      readScaleViewportExtExRecord,
 	EMR_SCALEWINDOWEXTEX:        readScaleWindowExtExRecord,
 	EMR_SAVEDC:                  readSaveDCRecord,
 	EMR_RESTOREDC:               readRestoreDCRecord,
@@ -44,13 +44,13 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_CREATEPEN:               readCreatePenRecord,
 	EMR_CREATEBRUSHINDIRECT:     readCreateBrushIndirectRecord,
 	EMR_DELETEOBJECT:            readDeleteObjectRecord,
-	EMR_ANGLEARC:                nil,
-	EMR_ELLIPSE:                 nil,
+	EMR_ANGLEARC:                readAngleArcRecord,
+	EMR_ELLIPSE:                 readEllipseRecord,
 	EMR_RECTANGLE:               readRectangleRecord,
-	EMR_ROUNDRECT:               nil,
+	EMR_ROUNDRECT:               readRoundRectRecord,
 	EMR_ARC:                     readArcRecord,
-	EMR_CHORD:                   nil,
-	EMR_PIE:                     nil,
+	EMR_CHORD:                   readChordRecord,
+	EMR_PIE:                     readPieRecord,
 	EMR_SELECTPALETTE:           readSelectPaletteRecord,
 	EMR_CREATEPALETTE:           readCreatePaletteRecord,
 	EMR_SETPALETTEENTRIES:       nil,
@@ -58,9 +58,9 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_REALIZEPALETTE:          nil,
 	EMR_EXTFLOODFILL:            nil,
 	EMR_LINETO:                  readLineToRecord,
-	EMR_ARCTO:                   nil,
-	EMR_POLYDRAW:                nil,
-	EMR_SETARCDIRECTION:         nil,
+	EMR_ARCTO:                   readArcToRecord,
+	EMR_POLYDRAW:                readPolyDrawRecord,
+	EMR_SETARCDIRECTION:         readSetArcDirectionRecord,
 	EMR_SETMITERLIMIT:           readSetMiterLimitRecord,
 	EMR_BEGINPATH:               readBeginPathRecord,
 	EMR_ENDPATH:                 readEndPathRecord,
@@ -68,15 +68,15 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_FILLPATH:                readFillPathRecord,
 	EMR_STROKEANDFILLPATH:       readStrokeAndFillPathRecord,
 	EMR_STROKEPATH:              readStrokePathRecord,
-	EMR_FLATTENPATH:             nil,
-	EMR_WIDENPATH:               nil,
+	EMR_FLATTENPATH:             readFlattenPathRecord,
+	EMR_WIDENPATH:               readWidenPathRecord,
 	EMR_SELECTCLIPPATH:          readSelectClipPathRecord,
 	EMR_ABORTPATH:               readAbortPathRecord,
 	EMR_COMMENT:                 readCommentRecord,
 	EMR_FILLRGN:                 readFillRgnRecord,
-	EMR_FRAMERGN:                nil,
-	EMR_INVERTRGN:               nil,
-	EMR_PAINTRGN:                nil,
+	EMR_FRAMERGN:                readFrameRgnRecord,
+	EMR_INVERTRGN:               readInvertRgnRecord,
+	EMR_PAINTRGN:                readPaintRgnRecord,
 	EMR_EXTSELECTCLIPRGN:        readExtSelectClipRgnRecord,
 	EMR_BITBLT:                  readBitBltRecord,
 	EMR_STRETCHBLT:              readStretchBltRecord,
@@ -85,21 +85,21 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_SETDIBITSTODEVICE:       readSetDIBitsToDeviceRecord,
 	EMR_STRETCHDIBITS:           readStretchDIBitsRecord,
 	EMR_EXTCREATEFONTINDIRECTW:  readExtCreateFontIndirectWRecord,
-	EMR_EXTTEXTOUTA:             nil,
+	EMR_EXTTEXTOUTA:             readExtTextOutARecord,
 	EMR_EXTTEXTOUTW:             readExtTextOutWRecord,
 	EMR_POLYBEZIER16:            readPolyBezier16Record,
 	EMR_POLYGON16:               readPolygon16Record,
 	EMR_POLYLINE16:              readPolyLine16Record,
 	EMR_POLYBEZIERTO16:          readPolyBezierTo16Record,
 	EMR_POLYLINETO16:            readPolyLineTo16Record,
-	EMR_POLYPOLYLINE16:          nil,
+	EMR_POLYPOLYLINE16:          readPolyPolyLine16Record,
 	EMR_POLYPOLYGON16:           readPolyPolygon16Record,
-	EMR_POLYDRAW16:              nil,
+	EMR_POLYDRAW16:              readPolyDraw16Record,
 	EMR_CREATEMONOBRUSH:         nil,
 	EMR_CREATEDIBPATTERNBRUSHPT: nil,
 	EMR_EXTCREATEPEN:            readExtCreatePenRecord,
-	EMR_POLYTEXTOUTA:            nil,
-	EMR_POLYTEXTOUTW:            nil,
+	EMR_POLYTEXTOUTA:            readPolyTextOutARecord,
+	EMR_POLYTEXTOUTW:            readPolyTextOutWRecord,
 	EMR_SETICMMODE:              readSetICMModeRecord,
 	EMR_CREATECOLORSPACE:        nil,
 	EMR_SETCOLORSPACE:           nil,
@@ -109,7 +109,7 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_PIXELFORMAT:             nil,
 	EMR_DRAWESCAPE:              nil,
 	EMR_EXTESCAPE:               nil,
-	EMR_SMALLTEXTOUT:            nil,
+	EMR_SMALLTEXTOUT:            readSmallTextOutRecord,
 	EMR_FORCEUFIMAPPING:         nil,
 	EMR_NAMEDESCAPE:             nil,
 	EMR_COLORCORRECTPALETTE:     nil,
@@ -124,3 +124,65 @@ var records = map[uint32]func(*bytes.Reader, uint32) (Recorder, error){
 	EMR_COLORMATCHTOTARGETW:     nil,
 	EMR_CREATECOLORSPACEW:       nil,
 }
+
+// map of readers for EMF+ records
+var plusRecords = map[uint16]func(*bytes.Reader, EmfPlusRecord) (EmfPlusRecorder, error){
+	EMFPLUS_HEADER:                  readEmfPlusHeaderRecord,
+	EMFPLUS_ENDOFFILE:               readEmfPlusEndOfFileRecord,
+	EMFPLUS_COMMENT:                 readEmfPlusCommentRecord,
+	EMFPLUS_GETDC:                   readEmfPlusGetDCRecord,
+	EMFPLUS_MULTIFORMATSTART:        nil,
+	EMFPLUS_MULTIFORMATSECTION:      nil,
+	EMFPLUS_MULTIFORMATEND:          nil,
+	EMFPLUS_OBJECT:                  readEmfPlusObjectRecord,
+	EMFPLUS_CLEAR:                   readEmfPlusClearRecord,
+	EMFPLUS_FILLRECTS:               readEmfPlusFillRectsRecord,
+	EMFPLUS_DRAWRECTS:               readEmfPlusDrawRectsRecord,
+	EMFPLUS_FILLPOLYGON:             readEmfPlusFillPolygonRecord,
+	EMFPLUS_DRAWLINES:               readEmfPlusDrawLinesRecord,
+	EMFPLUS_FILLELLIPSE:             readEmfPlusFillEllipseRecord,
+	EMFPLUS_DRAWELLIPSE:             readEmfPlusDrawEllipseRecord,
+	EMFPLUS_FILLPIE:                 readEmfPlusFillPieRecord,
+	EMFPLUS_DRAWPIE:                 readEmfPlusDrawPieRecord,
+	EMFPLUS_DRAWARC:                 readEmfPlusDrawPieRecord,
+	EMFPLUS_FILLREGION:              readEmfPlusFillRegionRecord,
+	EMFPLUS_FILLPATH:                readEmfPlusFillPathRecord,
+	EMFPLUS_DRAWPATH:                readEmfPlusDrawPathRecord,
+	EMFPLUS_FILLCLOSEDCURVE:         readEmfPlusFillClosedCurveRecord,
+	EMFPLUS_DRAWCLOSEDCURVE:         readEmfPlusDrawClosedCurveRecord,
+	EMFPLUS_DRAWCURVE:               readEmfPlusDrawCurveRecord,
+	EMFPLUS_DRAWBEZIERS:             readEmfPlusDrawBeziersRecord,
+	EMFPLUS_DRAWIMAGE:               readEmfPlusDrawImageRecord,
+	EMFPLUS_DRAWIMAGEPOINTS:         readEmfPlusDrawImagePointsRecord,
+	EMFPLUS_DRAWSTRING:              readEmfPlusDrawStringRecord,
+	EMFPLUS_SETRENDERINGORIGIN:      readEmfPlusSetRenderingOriginRecord,
+	EMFPLUS_SETANTIALIASMODE:        readEmfPlusSetModeRecord,
+	EMFPLUS_SETTEXTRENDERINGHINT:    readEmfPlusSetModeRecord,
+	EMFPLUS_SETTEXTCONTRAST:         readEmfPlusSetModeRecord,
+	EMFPLUS_SETINTERPOLATIONMODE:    readEmfPlusSetModeRecord,
+	EMFPLUS_SETPIXELOFFSETMODE:      readEmfPlusSetModeRecord,
+	EMFPLUS_SETCOMPOSITINGMODE:      readEmfPlusSetModeRecord,
+	EMFPLUS_SETCOMPOSITINGQUALITY:   readEmfPlusSetModeRecord,
+	EMFPLUS_SAVE:                    readEmfPlusSaveRecord,
+	EMFPLUS_RESTORE:                 readEmfPlusRestoreRecord,
+	EMFPLUS_BEGINCONTAINER:          readEmfPlusBeginContainerRecord,
+	EMFPLUS_BEGINCONTAINERNOPARAMS:  readEmfPlusBeginContainerNoParamsRecord,
+	EMFPLUS_ENDCONTAINER:            readEmfPlusEndContainerRecord,
+	EMFPLUS_SETWORLDTRANSFORM:       readEmfPlusSetWorldTransformRecord,
+	EMFPLUS_RESETWORLDTRANSFORM:     readEmfPlusResetWorldTransformRecord,
+	EMFPLUS_MULTIPLYWORLDTRANSFORM:  readEmfPlusMultiplyWorldTransformRecord,
+	EMFPLUS_TRANSLATEWORLDTRANSFORM: readEmfPlusTranslateWorldTransformRecord,
+	EMFPLUS_SCALEWORLDTRANSFORM:     readEmfPlusScaleWorldTransformRecord,
+	EMFPLUS_ROTATEWORLDTRANSFORM:    readEmfPlusRotateWorldTransformRecord,
+	EMFPLUS_SETPAGETRANSFORM:        readEmfPlusSetPageTransformRecord,
+	EMFPLUS_RESETCLIP:               readEmfPlusResetClipRecord,
+	EMFPLUS_SETCLIPRECT:             readEmfPlusSetClipRectRecord,
+	EMFPLUS_SETCLIPPATH:             readEmfPlusSetClipPathRecord,
+	EMFPLUS_SETCLIPREGION:           readEmfPlusSetClipRegionRecord,
+	EMFPLUS_OFFSETCLIP:              readEmfPlusOffsetClipRecord,
+	EMFPLUS_DRAWDRIVERSTRING:        readEmfPlusDrawDriverStringRecord,
+	EMFPLUS_STROKEFILLPATH:          nil,
+	EMFPLUS_SERIALIZABLEOBJECT:      nil,
+	EMFPLUS_SETTSGRAPHICS:           nil,
+	EMFPLUS_SETTSCLIP:               nil,
+}
@@ -0,0 +1,266 @@
+package emf
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+	"golang.org/x/image/font/sfnt"
+)
+
+// painter is the output of the software device. The device keeps the GDI
+// state and hands over shapes in device space, so a painter only has to
+// know how to put them on its surface.
+type painter interface {
+	Image() (*image.RGBA, error)
+	Clear(c color.RGBA)
+	Fill(path *raster.Path, rule raster.FillRule, src paint, clip *clipRegion)
+	Stroke(path *raster.Path, s raster.Stroke, src paint, clip *clipRegion)
+	DrawImage(img image.Image, m raster.Matrix, op raster.ImageOp, smooth bool, clip *clipRegion)
+	Text(run *textRun, clip *clipRegion)
+}
+
+// paint is the source used to fill a shape, a solid color or a pattern
+// repeated from origin.
+type paint struct {
+	Color   color.RGBA
+	Pattern *image.RGBA
+	Origin  image.Point
+}
+
+// unpremultiply returns the straight components of a premultiplied color,
+// for formats which keep the opacity apart.
+func unpremultiply(c color.RGBA) color.RGBA {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return color.RGBA{n.R, n.G, n.B, n.A}
+}
+
+func (p paint) image() image.Image {
+	if p.Pattern == nil {
+		return image.NewUniform(p.Color)
+	}
+	return &tiledImage{tile: p.Pattern, origin: p.Origin}
+}
+
+// tiledImage repeats tile over the whole plane.
+type tiledImage struct {
+	tile   *image.RGBA
+	origin image.Point
+}
+
+func (t *tiledImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (t *tiledImage) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+func (t *tiledImage) At(x, y int) color.Color {
+	b := t.tile.Bounds()
+	tx := (x - t.origin.X) % b.Dx()
+	ty := (y - t.origin.Y) % b.Dy()
+	if tx < 0 {
+		tx += b.Dx()
+	}
+	if ty < 0 {
+		ty += b.Dy()
+	}
+	return t.tile.RGBAAt(b.Min.X+tx, b.Min.Y+ty)
+}
+
+// textRun is a line of text placed in device space. Outline holds the glyph
+// shapes together with the underline and strikeout Lines, the other fields
+// describe the text for painters that keep it as text.
+type textRun struct {
+	Text      []rune
+	Origins   []raster.Point // baseline origin of every rune
+	Font      string
+	Weight    int
+	Italic    bool
+	Underline bool
+	StrikeOut bool
+	Size      float64       // em size in device units
+	Matrix    raster.Matrix // maps em-relative glyph space to device space
+	Color     color.RGBA
+	Outline   *raster.Path
+	Lines     *raster.Path
+	Face      *fontFace
+	Glyphs    []sfnt.GlyphIndex // glyph of every rune in Face
+}
+
+// clipRegion is the intersection of device space shapes. It is never
+// modified once created, so painters may cache what they derive from it.
+// A nil region does not clip.
+type clipRegion struct {
+	parts []clipPart
+	rgn   *Region // the same area in device pixels, when made of rectangles
+}
+
+type clipPart struct {
+	path *raster.Path
+	rule raster.FillRule
+}
+
+// rectsClip returns the shape of a region in device pixels, an empty region
+// clips everything.
+func rectsClip(r *Region) *clipRegion {
+	rects := r.Rects
+	if len(rects) == 0 {
+		rects = []w32.RECT{{}}
+	}
+
+	path := rectsPath(raster.Identity(), rects)
+	return &clipRegion{parts: []clipPart{{path: path, rule: raster.NonZero}}, rgn: r}
+}
+
+func (c *clipRegion) intersect(path *raster.Path, rule raster.FillRule) *clipRegion {
+	r := &clipRegion{}
+	if c != nil {
+		r.parts = append(r.parts, c.parts...)
+	}
+	r.parts = append(r.parts, clipPart{path: path, rule: rule})
+	return r
+}
+
+func (c *clipRegion) intersectRegion(o *clipRegion) *clipRegion {
+	if c == nil {
+		return o
+	}
+	if o == nil {
+		return c
+	}
+	if c.rgn != nil && o.rgn != nil {
+		return rectsClip(c.rgn.Intersect(o.rgn))
+	}
+	r := &clipRegion{}
+	r.parts = append(append(r.parts, c.parts...), o.parts...)
+	return r
+}
+
+func (c *clipRegion) translate(dx, dy float64) *clipRegion {
+	if c == nil {
+		return nil
+	}
+	if c.rgn != nil && dx == math.Trunc(dx) && dy == math.Trunc(dy) {
+		return rectsClip(c.rgn.Offset(int32(dx), int32(dy)))
+	}
+	m := raster.Translate(dx, dy)
+	r := &clipRegion{parts: make([]clipPart, len(c.parts))}
+	for i, p := range c.parts {
+		r.parts[i] = clipPart{path: p.path.Transform(m), rule: p.rule}
+	}
+	return r
+}
+
+// region returns the pixels of a device of width x height inside c, those
+// at least half covered as GDI does when a path becomes a region.
+func (c *clipRegion) region(width, height int) *Region {
+	if c == nil {
+		return NewRegion(w32.RECT{Right: int32(width), Bottom: int32(height)})
+	}
+	if c.rgn != nil {
+		return c.rgn
+	}
+
+	bounds := image.Rect(0, 0, width, height)
+	inside := make([]bool, width*height)
+	for i := range inside {
+		inside[i] = true
+	}
+	for _, part := range c.parts {
+		mask := raster.Rasterize(part.path.Flatten(raster.DefaultTolerance), part.rule, bounds)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				covered := mask != nil && image.Pt(x, y).In(mask.Rect) && mask.AlphaAt(x, y).A >= 0x80
+				inside[y*width+x] = inside[y*width+x] && covered
+			}
+		}
+	}
+
+	var out bandBuilder
+	for y := 0; y < height; y++ {
+		var spans []int32
+		row := inside[y*width : (y+1)*width]
+		for x := 0; x < width; x++ {
+			if row[x] != (x > 0 && row[x-1]) {
+				spans = append(spans, int32(x))
+			}
+		}
+		if len(spans)%2 == 1 {
+			spans = append(spans, int32(width))
+		}
+		out.add(int32(y), int32(y+1), spans)
+	}
+
+	return &Region{Rects: out.rects}
+}
+
+// rasterPainter paints into an RGBA image with anti-aliasing.
+type rasterPainter struct {
+	canvas   *raster.Canvas
+	clip     *clipRegion
+	clipMask *image.Alpha
+}
+
+func newRasterPainter(width, height int) *rasterPainter {
+	return &rasterPainter{canvas: raster.NewCanvas(width, height)}
+}
+
+func (p *rasterPainter) Image() (*image.RGBA, error) {
+	return p.canvas.Image(), nil
+}
+
+func (p *rasterPainter) Clear(c color.RGBA) {
+	p.canvas.Clear(c)
+}
+
+func (p *rasterPainter) Fill(path *raster.Path, rule raster.FillRule, src paint, clip *clipRegion) {
+	p.setClip(clip)
+	p.canvas.Fill(path, rule, src.image())
+}
+
+func (p *rasterPainter) Stroke(path *raster.Path, s raster.Stroke, src paint, clip *clipRegion) {
+	p.setClip(clip)
+	// GDI lines run through pixel centers
+	p.canvas.Stroke(path.Transform(raster.Translate(0.5, 0.5)), s, src.image())
+}
+
+func (p *rasterPainter) DrawImage(img image.Image, m raster.Matrix, op raster.ImageOp, smooth bool, clip *clipRegion) {
+	p.setClip(clip)
+	p.canvas.DrawImage(img, m, op, smooth)
+}
+
+func (p *rasterPainter) Text(run *textRun, clip *clipRegion) {
+	p.setClip(clip)
+	p.canvas.Fill(run.Outline, raster.NonZero, image.NewUniform(run.Color))
+}
+
+func (p *rasterPainter) setClip(clip *clipRegion) {
+	if clip != p.clip {
+		p.clip = clip
+		p.clipMask = nil
+
+		for _, part := range clip.partsOrNil() {
+			mask := p.canvas.Mask(part.path, part.rule)
+			if p.clipMask == nil {
+				p.clipMask = mask
+				continue
+			}
+			for i := range p.clipMask.Pix {
+				p.clipMask.Pix[i] = uint8((uint32(p.clipMask.Pix[i])*uint32(mask.Pix[i]) + 127) / 255)
+			}
+		}
+	}
+
+	p.canvas.SetClip(p.clipMask)
+}
+
+func (c *clipRegion) partsOrNil() []clipPart {
+	if c == nil {
+		return nil
+	}
+	return c.parts
+}
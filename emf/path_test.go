@@ -0,0 +1,164 @@
+package emf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+)
+
+// geometricPen selects a solid geometric pen of the width, cap and join.
+func geometricPen(t *testing.T, d *softDevice, width uint32, style uint32) {
+	t.Helper()
+
+	pen := d.ExtCreatePen(w32.LOGPENEX{PenStyle: PS_GEOMETRIC | PS_SOLID | style, Width: width, BrushStyle: BS_SOLID})
+	if err := d.SelectObject(pen); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closedLine returns a device with the path of the polyline from x0, y0.
+func closedLine(t *testing.T, x0, y0 int, points ...w32.POINT) *softDevice {
+	t.Helper()
+
+	d := newSoftDevice(100, 100, newRasterPainter(100, 100))
+	d.BeginPath()
+	d.MoveToEx(x0, y0)
+	if err := d.PolylineTo(points); err != nil {
+		t.Fatal(err)
+	}
+	d.EndPath()
+	return d
+}
+
+func TestFlattenPath(t *testing.T) {
+	d := newSoftDevice(100, 100, newRasterPainter(100, 100))
+	if err := d.FlattenPath(); err == nil {
+		t.Error("FlattenPath succeeded without a path")
+	}
+
+	d.BeginPath()
+	d.MoveToEx(0, 0)
+	d.PolyBezierTo([]w32.POINT{{X: 0, Y: 40}, {X: 40, Y: 40}, {X: 40, Y: 0}})
+	if err := d.FlattenPath(); err == nil {
+		t.Error("FlattenPath succeeded in an open path bracket")
+	}
+	d.EndPath()
+
+	if err := d.FlattenPath(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := d.path.Segments
+	if len(segs) < 8 {
+		t.Fatalf("flattened curve has %d segments", len(segs))
+	}
+	if segs[0].Op != raster.MoveTo || segs[0].Pts[0] != raster.Pt(0, 0) {
+		t.Errorf("flattened curve starts with %v", segs[0])
+	}
+	if last := segs[len(segs)-1]; last.Pts[0] != raster.Pt(40, 0) {
+		t.Errorf("flattened curve ends with %v", last)
+	}
+
+	// the points lie on the curve, whose top is at 20,30
+	top := 0.0
+	for _, s := range segs[1:] {
+		if s.Op != raster.LineTo {
+			t.Fatalf("flattened curve has segment %v", s)
+		}
+		p := s.Pts[0]
+		if p.X < 0 || p.X > 40 || p.Y < 0 || p.Y > 30+1e-9 {
+			t.Errorf("point %v is off the curve", p)
+		}
+		top = math.Max(top, p.Y)
+	}
+	if top < 29.5 {
+		t.Errorf("flattened curve reaches %v, want 30", top)
+	}
+}
+
+func TestWidenPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		style    uint32
+		min, max raster.Point
+	}{
+		{"flat", PS_ENDCAP_FLAT, raster.Pt(10, 45), raster.Pt(90, 55)},
+		{"square", PS_ENDCAP_SQUARE, raster.Pt(5, 45), raster.Pt(95, 55)},
+		{"round", PS_ENDCAP_ROUND, raster.Pt(5, 45), raster.Pt(95, 55)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := closedLine(t, 10, 50, w32.POINT{X: 90, Y: 50})
+			geometricPen(t, d, 10, tt.style)
+
+			if err := d.WidenPath(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range d.path.Segments {
+				if s.Op == raster.CubeTo {
+					t.Fatal("widened path has curves")
+				}
+			}
+
+			min, max := d.path.Bounds()
+			if !within(min, tt.min, 0.5) || !within(max, tt.max, 0.5) {
+				t.Errorf("widened path covers %v-%v, want %v-%v", min, max, tt.min, tt.max)
+			}
+			if !d.widened {
+				t.Error("widened path is not filled with the winding rule")
+			}
+		})
+	}
+
+	// a null pen cannot widen
+	d := closedLine(t, 10, 50, w32.POINT{X: 90, Y: 50})
+	d.SelectObject(d.CreatePen(w32.LOGPEN{PenStyle: PS_NULL}))
+	if err := d.WidenPath(); err == nil {
+		t.Error("WidenPath succeeded with a null pen")
+	}
+}
+
+func within(a, b raster.Point, tolerance float64) bool {
+	return math.Abs(a.X-b.X) <= tolerance && math.Abs(a.Y-b.Y) <= tolerance
+}
+
+func TestMiterLimit(t *testing.T) {
+	// the miter of the apex is 2.24 times the half width long, the limit
+	// decides whether it is kept or beveled
+	widen := func(limit float32) float64 {
+		d := closedLine(t, 10, 90, w32.POINT{X: 50, Y: 10}, w32.POINT{X: 90, Y: 90})
+		geometricPen(t, d, 10, PS_ENDCAP_FLAT|PS_JOIN_MITER)
+		if err := d.SetMiterLimit(limit); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.WidenPath(); err != nil {
+			t.Fatal(err)
+		}
+
+		min, _ := d.path.Bounds()
+		return min.Y
+	}
+
+	if top := widen(10); math.Abs(top-(10-5*math.Sqrt(5))) > 0.5 {
+		t.Errorf("mitered apex reaches %v, want %v", top, 10-5*math.Sqrt(5))
+	}
+	if top := widen(2); top < 10-5*math.Sqrt(5)+2 {
+		t.Errorf("beveled apex reaches %v", top)
+	}
+
+	// the record sets the limit of the device
+	b := NewBuilder(w32.RECT{Right: 9, Bottom: 9}, w32.RECT{})
+	b.Add(&SetMiterLimitRecord{Record: Record{Type: EMR_SETMITERLIMIT}, MiterLimit: 3})
+
+	d := newSoftDevice(10, 10, newRasterPainter(10, 10))
+	if err := readFile(t, writeFile(t, b.File())).DrawToDevice(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.state.miterLimit != 3 {
+		t.Errorf("miter limit is %v, want 3", d.state.miterLimit)
+	}
+}
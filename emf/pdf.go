@@ -0,0 +1,799 @@
+package emf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/raster"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// PDFOptions are the options of WritePDF. A nil value uses the defaults.
+type PDFOptions struct {
+	Title        string // title of the document information dictionary
+	Author       string
+	Uncompressed bool // write streams without compression, for debugging
+}
+
+// WritePDF plays the records and writes the result to w as a single page
+// PDF document. The page is the picture frame of the header, shapes are
+// written as PDF paths, bitmaps as image XObjects and text with an embedded
+// font, so it can be selected and searched.
+func (f *EmfFile) WritePDF(w io.Writer, opts *PDFOptions) error {
+	if f.Header == nil {
+		return errors.New("missing EMF header")
+	}
+	if opts == nil {
+		opts = &PDFOptions{}
+	}
+
+	hdr := f.Header.Original
+	if hdr.Device.CX <= 0 || hdr.Device.CY <= 0 {
+		return errors.New("invalid reference device size")
+	}
+
+	// size of a device pixel in 0.01mm
+	px := f.Header.pixelSize()
+	pxW, pxH := px.X*100, px.Y*100
+
+	frame := hdr.Frame
+	if frame.Right <= frame.Left || frame.Bottom <= frame.Top {
+		b := hdr.Bounds
+		frame.Left = int32(float64(b.Left) * pxW)
+		frame.Top = int32(float64(b.Top) * pxH)
+		frame.Right = int32(float64(b.Right+1) * pxW)
+		frame.Bottom = int32(float64(b.Bottom+1) * pxH)
+	}
+
+	// 0.01mm to points
+	const k = 72.0 / 2540
+	width := float64(frame.Right-frame.Left) * k
+	height := float64(frame.Bottom-frame.Top) * k
+
+	page := raster.Matrix{
+		A: pxW * k,
+		D: -pxH * k,
+		E: -float64(frame.Left) * k,
+		F: height + float64(frame.Top)*k,
+	}
+
+	p := newPdfPainter(int(hdr.Device.CX), int(hdr.Device.CY), page)
+	dev := newSoftDevice(int(hdr.Device.CX), int(hdr.Device.CY), p)
+	err := f.DrawToDevice(dev)
+	dev.Release()
+	if err != nil {
+		return err
+	}
+
+	return p.write(w, width, height, opts)
+}
+
+type pdfImage struct {
+	name        string
+	width       int
+	height      int
+	rgb         []byte
+	alpha       []byte // nil for opaque images
+	interpolate bool
+	num         int
+}
+
+type pdfPattern struct {
+	name   string
+	image  *pdfImage
+	origin image.Point
+	num    int
+}
+
+type pdfFont struct {
+	name  string
+	face  *fontFace
+	runes map[sfnt.GlyphIndex]rune
+	num   int
+}
+
+// pdfPainter collects the content stream and the resources of a page.
+type pdfPainter struct {
+	width   int
+	height  int
+	page    raster.Matrix // device space to PDF user space
+	content bytes.Buffer
+
+	clip     *clipRegion // clip of the open q ... Q block
+	clipOpen bool
+
+	images   []*pdfImage
+	patterns map[svgPatternKey]*pdfPattern
+	fonts    map[*sfnt.Font]*pdfFont
+	gstates  map[string]string
+}
+
+func newPdfPainter(width, height int, page raster.Matrix) *pdfPainter {
+	p := &pdfPainter{
+		width:    width,
+		height:   height,
+		page:     page,
+		patterns: make(map[svgPatternKey]*pdfPattern),
+		fonts:    make(map[*sfnt.Font]*pdfFont),
+		gstates:  make(map[string]string),
+	}
+
+	p.printf("%s cm\n", pdfMatrix(page))
+	return p
+}
+
+func (p *pdfPainter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.content, format, args...)
+}
+
+func (p *pdfPainter) Image() (*image.RGBA, error) {
+	return nil, errors.New("PDF output has no image")
+}
+
+func (p *pdfPainter) Clear(c color.RGBA) {
+	p.setClip(nil)
+	p.printf("%s rg 0 0 %d %d re f\n", pdfColor(c), p.width, p.height)
+}
+
+func (p *pdfPainter) Fill(path *raster.Path, rule raster.FillRule, src paint, clip *clipRegion) {
+	if path.Empty() {
+		return
+	}
+
+	p.setClip(clip)
+	alpha := src.Pattern == nil && p.beginAlpha(src.Color, false)
+	p.setPaint(src, false)
+	p.path(path)
+
+	if rule == raster.EvenOdd {
+		p.printf("f*\n")
+	} else {
+		p.printf("f\n")
+	}
+
+	if alpha {
+		p.printf("Q\n")
+	}
+}
+
+func (p *pdfPainter) Stroke(path *raster.Path, s raster.Stroke, src paint, clip *clipRegion) {
+	if path.Empty() {
+		return
+	}
+
+	p.setClip(clip)
+	alpha := src.Pattern == nil && p.beginAlpha(src.Color, true)
+	p.setPaint(src, true)
+
+	width := s.Width
+	if width <= 0 {
+		width = 1
+	}
+
+	capStyle := 0
+	switch s.Cap {
+	case raster.CapRound:
+		capStyle = 1
+	case raster.CapSquare:
+		capStyle = 2
+	}
+
+	join := 0
+	switch s.Join {
+	case raster.JoinRound:
+		join = 1
+	case raster.JoinBevel:
+		join = 2
+	}
+
+	miter := s.MiterLimit
+	if miter < 1 {
+		miter = 10
+	}
+
+	dashes := make([]string, len(s.Dashes))
+	for i, v := range s.Dashes {
+		dashes[i] = pdfNum(v)
+	}
+
+	p.printf("%s w %d J %d j %s M [%s] %s d\n", pdfNum(width), capStyle, join, pdfNum(miter), strings.Join(dashes, " "), pdfNum(s.DashOffset))
+
+	// GDI lines run through pixel centers
+	p.path(path.Transform(raster.Translate(0.5, 0.5)))
+	p.printf("S\n")
+
+	if alpha {
+		p.printf("Q\n")
+	}
+}
+
+func (p *pdfPainter) DrawImage(img image.Image, m raster.Matrix, op raster.ImageOp, smooth bool, clip *clipRegion) {
+	b := img.Bounds()
+	if b.Empty() {
+		return
+	}
+
+	im := newPdfImage(img, smooth)
+	im.name = "Im" + strconv.Itoa(len(p.images)+1)
+	p.images = append(p.images, im)
+
+	p.setClip(clip)
+	p.printf("q\n")
+
+	switch op {
+	case raster.ImageAnd:
+		p.printf("/%s gs\n", p.gstate("/BM /Multiply"))
+	case raster.ImageOr:
+		p.printf("/%s gs\n", p.gstate("/BM /Screen"))
+	case raster.ImageXor:
+		p.printf("/%s gs\n", p.gstate("/BM /Difference"))
+	}
+
+	// images fill the unit square with the first row at the top
+	unit := raster.Matrix{A: float64(b.Dx()), D: -float64(b.Dy()), E: float64(b.Min.X), F: float64(b.Max.Y)}
+	p.printf("%s cm /%s Do\nQ\n", pdfMatrix(unit.Mul(m)), im.name)
+}
+
+func (p *pdfPainter) Text(run *textRun, clip *clipRegion) {
+	if len(run.Glyphs) == 0 || run.Face == nil || run.Face.data == nil || run.Size <= 0 {
+		// without an embeddable font the outlines are drawn
+		p.Fill(run.Outline, raster.NonZero, paint{Color: run.Color}, clip)
+		return
+	}
+
+	// text space has the font size as em and the Y axis pointing up
+	t := raster.Scale(1/run.Size, -1/run.Size).Mul(run.Matrix)
+	inv, ok := t.Invert()
+	if !ok {
+		return
+	}
+
+	font := p.font(run.Face)
+	for i, g := range run.Glyphs {
+		if _, ok := font.runes[g]; !ok {
+			font.runes[g] = run.Text[i]
+		}
+	}
+
+	p.setClip(clip)
+	alpha := p.beginAlpha(run.Color, false)
+	p.printf("BT\n/%s %s Tf\n%s rg\n", font.name, pdfNum(run.Size), pdfColor(run.Color))
+
+	// origins relative to the first one in text space
+	pos := make([]raster.Point, len(run.Origins))
+	straight := true
+	for i, o := range run.Origins {
+		pos[i] = inv.ApplyVector(o.Sub(run.Origins[0]))
+		if pos[i].Y > 0.01 || pos[i].Y < -0.01 {
+			straight = false
+		}
+	}
+
+	em := run.Face.unitsPerEm
+	if straight {
+		tm := t
+		tm.E, tm.F = run.Origins[0].X, run.Origins[0].Y
+		p.printf("%s Tm\n[", pdfMatrix(tm))
+
+		for i, g := range run.Glyphs {
+			p.printf("<%04X>", uint16(g))
+			if i+1 < len(run.Glyphs) {
+				// difference to the advance of the font in thousandths of em
+				adv := run.Face.advance(g) / em * run.Size
+				if d := (pos[i+1].X - pos[i].X - adv) * 1000 / run.Size; d > 0.01 || d < -0.01 {
+					p.printf(" %s ", pdfNum(-d))
+				}
+			}
+		}
+
+		p.printf("] TJ\n")
+	} else {
+		for i, g := range run.Glyphs {
+			tm := t
+			tm.E, tm.F = run.Origins[i].X, run.Origins[i].Y
+			p.printf("%s Tm <%04X> Tj\n", pdfMatrix(tm), uint16(g))
+		}
+	}
+
+	p.printf("ET\n")
+	if alpha {
+		p.printf("Q\n")
+	}
+
+	if run.Lines != nil && !run.Lines.Empty() {
+		p.Fill(run.Lines, raster.NonZero, paint{Color: run.Color}, clip)
+	}
+}
+
+// setClip opens a q ... Q block with the clip paths of clip, reusing the
+// block when the clip did not change.
+func (p *pdfPainter) setClip(clip *clipRegion) {
+	if p.clipOpen && clip == p.clip {
+		return
+	}
+
+	if p.clipOpen {
+		p.printf("Q\n")
+		p.clipOpen = false
+	}
+
+	p.clip = clip
+	if clip == nil {
+		return
+	}
+
+	p.printf("q\n")
+	for _, part := range clip.parts {
+		p.path(part.path)
+		if part.rule == raster.EvenOdd {
+			p.printf("W* n\n")
+		} else {
+			p.printf("W n\n")
+		}
+	}
+	p.clipOpen = true
+}
+
+func (p *pdfPainter) setPaint(src paint, stroke bool) {
+	if src.Pattern == nil {
+		if stroke {
+			p.printf("%s RG\n", pdfColor(src.Color))
+		} else {
+			p.printf("%s rg\n", pdfColor(src.Color))
+		}
+		return
+	}
+
+	key := svgPatternKey{tile: src.Pattern, origin: src.Origin}
+	pat, ok := p.patterns[key]
+	if !ok {
+		pat = &pdfPattern{
+			name:   "P" + strconv.Itoa(len(p.patterns)+1),
+			image:  newPdfImage(src.Pattern, false),
+			origin: src.Origin,
+		}
+		pat.image.name = "Im0"
+		p.patterns[key] = pat
+	}
+
+	if stroke {
+		p.printf("/Pattern CS /%s SCN\n", pat.name)
+	} else {
+		p.printf("/Pattern cs /%s scn\n", pat.name)
+	}
+}
+
+func (p *pdfPainter) path(path *raster.Path) {
+	for _, s := range path.Segments {
+		switch s.Op {
+		case raster.MoveTo:
+			p.printf("%s %s m\n", pdfNum(s.Pts[0].X), pdfNum(s.Pts[0].Y))
+		case raster.LineTo:
+			p.printf("%s %s l\n", pdfNum(s.Pts[0].X), pdfNum(s.Pts[0].Y))
+		case raster.CubeTo:
+			p.printf("%s %s %s %s %s %s c\n",
+				pdfNum(s.Pts[0].X), pdfNum(s.Pts[0].Y),
+				pdfNum(s.Pts[1].X), pdfNum(s.Pts[1].Y),
+				pdfNum(s.Pts[2].X), pdfNum(s.Pts[2].Y))
+		case raster.Close:
+			p.printf("h\n")
+		}
+	}
+}
+
+// gstate returns the name of the graphics state with the dictionary entries.
+func (p *pdfPainter) gstate(entries string) string {
+	name, ok := p.gstates[entries]
+	if !ok {
+		name = "GS" + strconv.Itoa(len(p.gstates)+1)
+		p.gstates[entries] = name
+	}
+	return name
+}
+
+// beginAlpha opens a q ... Q block with the constant alpha of a translucent
+// color. It reports whether the block needs to be closed.
+func (p *pdfPainter) beginAlpha(c color.RGBA, stroke bool) bool {
+	if c.A == 0xFF {
+		return false
+	}
+
+	op := "/ca "
+	if stroke {
+		op = "/CA "
+	}
+	p.printf("q /%s gs\n", p.gstate(op+pdfNum(float64(c.A)/0xFF)))
+	return true
+}
+
+func (p *pdfPainter) font(face *fontFace) *pdfFont {
+	f, ok := p.fonts[face.font]
+	if !ok {
+		f = &pdfFont{
+			name:  "F" + strconv.Itoa(len(p.fonts)+1),
+			face:  face,
+			runes: make(map[sfnt.GlyphIndex]rune),
+		}
+		p.fonts[face.font] = f
+	}
+	return f
+}
+
+func newPdfImage(img image.Image, smooth bool) *pdfImage {
+	b := img.Bounds()
+	im := &pdfImage{
+		width:       b.Dx(),
+		height:      b.Dy(),
+		rgb:         make([]byte, 0, b.Dx()*b.Dy()*3),
+		alpha:       make([]byte, 0, b.Dx()*b.Dy()),
+		interpolate: smooth,
+	}
+
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			im.rgb = append(im.rgb, c.R, c.G, c.B)
+			im.alpha = append(im.alpha, c.A)
+			if c.A != 0xFF {
+				opaque = false
+			}
+		}
+	}
+
+	if opaque {
+		im.alpha = nil
+	}
+
+	return im
+}
+
+// pdfWriter writes numbered objects and remembers their offsets for the
+// cross-reference table.
+type pdfWriter struct {
+	w        io.Writer
+	n        int
+	err      error
+	offsets  []int
+	compress bool
+}
+
+func (w *pdfWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += n
+	w.err = err
+}
+
+func (w *pdfWriter) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(data)
+	w.n += n
+	w.err = err
+}
+
+// alloc reserves the number of the next object.
+func (w *pdfWriter) alloc() int {
+	w.offsets = append(w.offsets, -1)
+	return len(w.offsets)
+}
+
+func (w *pdfWriter) object(num int, body string) {
+	w.offsets[num-1] = w.n
+	w.printf("%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+// stream writes a stream object, dict holds the entries besides the length
+// and the filter.
+func (w *pdfWriter) stream(num int, dict string, data []byte) {
+	if w.compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+
+	w.offsets[num-1] = w.n
+	w.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", num, dict, len(data))
+	w.write(data)
+	w.printf("\nendstream\nendobj\n")
+}
+
+func (p *pdfPainter) write(out io.Writer, width, height float64, opts *PDFOptions) error {
+	p.setClip(nil)
+
+	w := &pdfWriter{w: out, compress: !opts.Uncompressed}
+	w.printf("%%PDF-1.4\n%%\xE2\xE3\xCF\xD3\n")
+
+	catalog := w.alloc()
+	pages := w.alloc()
+	page := w.alloc()
+	content := w.alloc()
+
+	// number the resources first, so they can refer to each other
+	images := append([]*pdfImage{}, p.images...)
+
+	patterns := make([]*pdfPattern, 0, len(p.patterns))
+	for _, pat := range p.patterns {
+		patterns = append(patterns, pat)
+		images = append(images, pat.image)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].name < patterns[j].name })
+
+	for _, im := range images {
+		im.num = w.alloc()
+		if im.alpha != nil {
+			w.alloc()
+		}
+	}
+	for _, pat := range patterns {
+		pat.num = w.alloc()
+	}
+
+	fonts := make([]*pdfFont, 0, len(p.fonts))
+	for _, f := range p.fonts {
+		fonts = append(fonts, f)
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].name < fonts[j].name })
+	for _, f := range fonts {
+		// Type0 font, CIDFont, descriptor, font file and ToUnicode map
+		f.num = w.alloc()
+		for i := 0; i < 4; i++ {
+			w.alloc()
+		}
+	}
+
+	info := 0
+	if opts.Title != "" || opts.Author != "" {
+		info = w.alloc()
+	}
+
+	w.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	w.object(pages, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", page))
+
+	var res strings.Builder
+	res.WriteString("<< /ProcSet [/PDF /Text /ImageC]")
+	if len(p.images) > 0 {
+		res.WriteString(" /XObject <<")
+		for _, im := range p.images {
+			fmt.Fprintf(&res, " /%s %d 0 R", im.name, im.num)
+		}
+		res.WriteString(" >>")
+	}
+	if len(patterns) > 0 {
+		res.WriteString(" /Pattern <<")
+		for _, pat := range patterns {
+			fmt.Fprintf(&res, " /%s %d 0 R", pat.name, pat.num)
+		}
+		res.WriteString(" >>")
+	}
+	if len(fonts) > 0 {
+		res.WriteString(" /Font <<")
+		for _, f := range fonts {
+			fmt.Fprintf(&res, " /%s %d 0 R", f.name, f.num)
+		}
+		res.WriteString(" >>")
+	}
+	if len(p.gstates) > 0 {
+		entries := make([]string, 0, len(p.gstates))
+		for e := range p.gstates {
+			entries = append(entries, e)
+		}
+		sort.Strings(entries)
+
+		res.WriteString(" /ExtGState <<")
+		for _, e := range entries {
+			fmt.Fprintf(&res, " /%s << /Type /ExtGState %s >>", p.gstates[e], e)
+		}
+		res.WriteString(" >>")
+	}
+	res.WriteString(" >>")
+
+	w.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+		pages, pdfNum(width), pdfNum(height), res.String(), content))
+	w.stream(content, "", p.content.Bytes())
+
+	for _, im := range images {
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8", im.width, im.height)
+		if im.interpolate {
+			dict += " /Interpolate true"
+		}
+		if im.alpha != nil {
+			dict += fmt.Sprintf(" /SMask %d 0 R", im.num+1)
+		}
+		w.stream(im.num, dict, im.rgb)
+
+		if im.alpha != nil {
+			w.stream(im.num+1, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8", im.width, im.height), im.alpha)
+		}
+	}
+
+	for _, pat := range patterns {
+		im := pat.image
+		dict := fmt.Sprintf("/Type /Pattern /PatternType 1 /PaintType 1 /TilingType 1 /BBox [0 0 %d %d] /XStep %d /YStep %d /Resources << /XObject << /%s %d 0 R >> >> /Matrix %s",
+			im.width, im.height, im.width, im.height, im.name, im.num,
+			"["+pdfMatrix(raster.Translate(float64(pat.origin.X), float64(pat.origin.Y)).Mul(p.page))+"]")
+		w.stream(pat.num, dict, []byte(fmt.Sprintf("q %d 0 0 %d 0 %d cm /%s Do Q", im.width, -im.height, im.height, im.name)))
+	}
+
+	for _, f := range fonts {
+		f.write(w)
+	}
+
+	if info != 0 {
+		var b strings.Builder
+		b.WriteString("<< /Producer (go-emf)")
+		if opts.Title != "" {
+			b.WriteString(" /Title " + pdfString(opts.Title))
+		}
+		if opts.Author != "" {
+			b.WriteString(" /Author " + pdfString(opts.Author))
+		}
+		b.WriteString(" >>")
+		w.object(info, b.String())
+	}
+
+	xref := w.n
+	w.printf("xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		w.printf("%010d 00000 n \n", off)
+	}
+
+	w.printf("trailer\n<< /Size %d /Root %d 0 R", len(w.offsets)+1, catalog)
+	if info != 0 {
+		w.printf(" /Info %d 0 R", info)
+	}
+	w.printf(" >>\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return w.err
+}
+
+// write writes the objects of an embedded TrueType font with Identity-H
+// encoding, where character codes are glyph indexes.
+func (f *pdfFont) write(w *pdfWriter) {
+	face := f.face
+	cid, desc, file, toUnicode := f.num+1, f.num+2, f.num+3, f.num+4
+
+	name := f.name
+	if ps, err := face.font.Name(&face.buf, sfnt.NameIDPostScript); err == nil && ps != "" {
+		name = ps
+	}
+	name = pdfName(name)
+
+	scale := 1000 / face.unitsPerEm
+
+	glyphs := make([]int, 0, len(f.runes))
+	for g := range f.runes {
+		glyphs = append(glyphs, int(g))
+	}
+	sort.Ints(glyphs)
+
+	var widths strings.Builder
+	for _, g := range glyphs {
+		fmt.Fprintf(&widths, "%d [%s] ", g, pdfNum(face.advance(sfnt.GlyphIndex(g))*scale))
+	}
+
+	bbox := "[0 0 0 0]"
+	if b, err := face.font.Bounds(&face.buf, face.ppem(), font.HintingNone); err == nil {
+		bbox = fmt.Sprintf("[%s %s %s %s]",
+			pdfNum(float64(b.Min.X)/64*scale), pdfNum(-float64(b.Max.Y)/64*scale),
+			pdfNum(float64(b.Max.X)/64*scale), pdfNum(-float64(b.Min.Y)/64*scale))
+	}
+
+	italic := 0.0
+	flags := 32 // nonsymbolic
+	if post := face.font.PostTable(); post != nil {
+		italic = post.ItalicAngle
+		if post.IsFixedPitch {
+			flags |= 1
+		}
+	}
+	if italic != 0 {
+		flags |= 64
+	}
+
+	w.object(f.num, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cid, toUnicode))
+	w.object(cid, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /W [%s] /CIDToGIDMap /Identity >>",
+		name, desc, strings.TrimSpace(widths.String())))
+	w.object(desc, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox %s /ItalicAngle %s /Ascent %s /Descent %s /CapHeight %s /StemV 80 /FontFile2 %d 0 R >>",
+		name, flags, bbox, pdfNum(italic), pdfNum(face.ascent*scale), pdfNum(-face.descent*scale), pdfNum(face.ascent*scale), file))
+	w.stream(file, fmt.Sprintf("/Length1 %d", len(face.data)), face.data)
+
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(glyphs); i += 100 {
+		end := i + 100
+		if end > len(glyphs) {
+			end = len(glyphs)
+		}
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", end-i)
+		for _, g := range glyphs[i:end] {
+			fmt.Fprintf(&cmap, "<%04X> <", g)
+			for _, u := range utf16.Encode([]rune{f.runes[sfnt.GlyphIndex(g)]}) {
+				fmt.Fprintf(&cmap, "%04X", u)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	w.stream(toUnicode, "", []byte(cmap.String()))
+}
+
+func pdfMatrix(m raster.Matrix) string {
+	return pdfNum(m.A) + " " + pdfNum(m.B) + " " + pdfNum(m.C) + " " + pdfNum(m.D) + " " + pdfNum(m.E) + " " + pdfNum(m.F)
+}
+
+// pdfColor returns the components of a premultiplied color.
+func pdfColor(c color.RGBA) string {
+	if c.A != 0 && c.A != 0xFF {
+		c = unpremultiply(c)
+	}
+	return pdfNum(float64(c.R)/0xFF) + " " + pdfNum(float64(c.G)/0xFF) + " " + pdfNum(float64(c.B)/0xFF)
+}
+
+// pdfNum formats v with at most four decimals, PDF has no exponents.
+func pdfNum(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 4, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// pdfName keeps the characters of s which need no escaping in a name.
+func pdfName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > ' ' && r < 0x7F && !strings.ContainsRune("()<>[]{}/%#", r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// pdfString returns s as a literal string, or as UTF-16 hex string when it
+// is not ASCII.
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`, "\n", `\n`)
+		return "(" + r.Replace(s) + ")"
+	}
+
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
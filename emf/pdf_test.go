@@ -0,0 +1,78 @@
+package emf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePDF(t *testing.T) {
+	var buf bytes.Buffer
+	opts := &PDFOptions{Title: "Chart (1)", Uncompressed: true}
+	if err := exportFile(t).WritePDF(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatal("document does not start and end as a PDF")
+	}
+
+	// the cross-reference table points at every object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(m[1])
+	if !strings.HasPrefix(doc[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point at the table", xref)
+	}
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc[xref:], -1)
+	if len(offsets) == 0 {
+		t.Fatal("no objects in the table")
+	}
+	for i, o := range offsets {
+		off, _ := strconv.Atoi(o[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(doc[off:], want) {
+			t.Errorf("object %d is not at %d", i+1, off)
+		}
+	}
+
+	want := []struct {
+		name string
+		re   string
+	}{
+		{"page", `/MediaBox \[0 0 [\d.]+ [\d.]+\]`},
+		{"filled path", `1 0 0 rg\n[\d. ]+ m\n(?:[\d. ]+ l\n)+h\nf\*?\n`},
+		{"stroked path", `0 0 0 RG\n[\d. ]+ w \d J \d j [\d.]+ M \[\] 0 d\n[\d. ]+ m\n[\d. ]+ l\nS\n`},
+		{"clip", `\nW n\n`},
+		{"image", `cm /Im1 Do\nQ`},
+		{"image object", `/Subtype /Image /Width 2 /Height 2 /ColorSpace /DeviceRGB`},
+		{"text", `BT\n/F1 20 Tf\n0 1 0 rg\n[-\d. ]+ Tm\n\[<[0-9A-F]{4}>`},
+		{"font", `/Subtype /Type0 /BaseFont /Go-Bold /Encoding /Identity-H`},
+		{"font file", `/FontFile2 \d+ 0 R`},
+		{"text is selectable", `<[0-9A-F]{4}> <0048>\n`},
+		{"info", `/Title \(Chart \\\(1\\\)\)`},
+	}
+	for _, w := range want {
+		if !regexp.MustCompile(w.re).MatchString(doc) {
+			t.Errorf("no %s in the document", w.name)
+		}
+	}
+}
+
+func TestWritePDFCompressed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportFile(t).WritePDF(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := buf.String()
+	if !strings.Contains(doc, "/Filter /FlateDecode") || strings.Contains(doc, "/Info") {
+		t.Error("streams are not compressed or the document has an info dictionary")
+	}
+}
@@ -0,0 +1,285 @@
+package emf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+)
+
+// pointsOf returns the points of the coordinates x0, y0, x1, y1...
+func pointsOf(xy ...int32) []w32.POINTL {
+	points := make([]w32.POINTL, len(xy)/2)
+	for i := range points {
+		points[i] = w32.POINTL{X: xy[2*i], Y: xy[2*i+1]}
+	}
+	return points
+}
+
+// pathString returns the segments of p as "M x,y L x,y C x,y x,y x,y Z".
+func pathString(p *raster.Path) string {
+	if p == nil {
+		return ""
+	}
+
+	var parts []string
+	for _, s := range p.Segments {
+		switch s.Op {
+		case raster.MoveTo:
+			parts = append(parts, fmt.Sprintf("M %g,%g", s.Pts[0].X, s.Pts[0].Y))
+		case raster.LineTo:
+			parts = append(parts, fmt.Sprintf("L %g,%g", s.Pts[0].X, s.Pts[0].Y))
+		case raster.CubeTo:
+			parts = append(parts, fmt.Sprintf("C %g,%g %g,%g %g,%g", s.Pts[0].X, s.Pts[0].Y, s.Pts[1].X, s.Pts[1].Y, s.Pts[2].X, s.Pts[2].Y))
+		case raster.Close:
+			parts = append(parts, "Z")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// pathOf writes and reads the records in a path bracket, draws them on a
+// soft device and returns the path they define.
+func pathOf(t *testing.T, recs ...Recorder) *raster.Path {
+	t.Helper()
+
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	b.Add(&BeginPathRecord{Record: Record{Type: EMR_BEGINPATH}})
+	for _, rec := range recs {
+		b.Add(rec)
+	}
+	b.Add(&EndPathRecord{Record: Record{Type: EMR_ENDPATH}})
+
+	f := readFile(t, writeFile(t, b.File()))
+	for i, rec := range recs {
+		if got := f.Records[i+1]; reflect.TypeOf(got) != reflect.TypeOf(rec) {
+			t.Fatalf("record %d is read as %T, want %T", i, got, rec)
+		}
+	}
+
+	d := newSoftDevice(100, 100, newRasterPainter(100, 100))
+	if err := f.DrawToDevice(d); err != nil {
+		t.Fatal(err)
+	}
+	return d.path
+}
+
+func moveTo(x, y int32) *MoveToExRecord {
+	return &MoveToExRecord{Record: Record{Type: EMR_MOVETOEX}, Offset: w32.POINT{X: x, Y: y}}
+}
+
+func TestPolyRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		recs []Recorder
+		path string
+	}{
+		{"polyline", []Recorder{
+			&PolyLineRecord{Record: Record{Type: EMR_POLYLINE}, Count: 3, APoints: pointsOf(1, 2, 3, 4, 70000, 6)},
+		}, "M 1,2 L 3,4 L 70000,6"},
+		{"polyline to", []Recorder{
+			moveTo(1, 1),
+			&PolyLineToRecord{Record: Record{Type: EMR_POLYLINETO}, Count: 2, APoints: pointsOf(2, 2, 3, -70000)},
+			&PolyLineToRecord{Record: Record{Type: EMR_POLYLINETO}, Count: 1, APoints: pointsOf(4, 4)},
+		}, "M 1,1 L 2,2 L 3,-70000 L 4,4"},
+		{"polybezier", []Recorder{
+			&PolyBezierRecord{Record: Record{Type: EMR_POLYBEZIER}, Count: 4, APoints: pointsOf(0, 0, 1, 1, 2, 2, 3, 3)},
+		}, "M 0,0 C 1,1 2,2 3,3"},
+		{"polybezier to", []Recorder{
+			moveTo(5, 5),
+			&PolyBezierToRecord{Record: Record{Type: EMR_POLYBEZIERTO}, Count: 3, APoints: pointsOf(6, 6, 7, 7, 8, 8)},
+			&PolyLineToRecord{Record: Record{Type: EMR_POLYLINETO}, Count: 1, APoints: pointsOf(9, 9)},
+		}, "M 5,5 C 6,6 7,7 8,8 L 9,9"},
+		{"polypolyline", []Recorder{
+			&PolyPolyLineRecord{Record: Record{Type: EMR_POLYPOLYLINE}, NumberOfPolylines: 2, Count: 5,
+				PolylinePointCount: []uint32{2, 3}, APoints: pointsOf(0, 0, 1, 1, 10, 10, 11, 11, 12, 12)},
+		}, "M 0,0 L 1,1 M 10,10 L 11,11 L 12,12"},
+		{"polypolygon", []Recorder{
+			&PolyPolygonRecord{Record: Record{Type: EMR_POLYPOLYGON}, NumberOfPolygons: 2, Count: 6,
+				PolygonPointCount: []uint32{3, 3}, APoints: pointsOf(0, 0, 4, 0, 4, 4, 10, 10, 14, 10, 14, 14)},
+		}, "M 0,0 L 4,0 L 4,4 Z M 10,10 L 14,10 L 14,14 Z"},
+		{"polygon", []Recorder{
+			&PolygonRecord{Record: Record{Type: EMR_POLYGON}, Count: 3, APoints: pointsOf(0, 0, 4, 0, 4, 4)},
+		}, "M 0,0 L 4,0 L 4,4 Z"},
+		{"line after a closed figure", []Recorder{
+			moveTo(1, 1),
+			&PolygonRecord{Record: Record{Type: EMR_POLYGON}, Count: 3, APoints: pointsOf(0, 0, 4, 0, 4, 4)},
+			&PolyLineToRecord{Record: Record{Type: EMR_POLYLINETO}, Count: 1, APoints: pointsOf(2, 2)},
+		}, "M 0,0 L 4,0 L 4,4 Z M 1,1 L 2,2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathString(pathOf(t, tt.recs...)); got != tt.path {
+				t.Errorf("path is %q, want %q", got, tt.path)
+			}
+		})
+	}
+}
+
+func TestPolyRecordsDrawn(t *testing.T) {
+	// outside a path bracket the 32-bit records paint with the pen and brush
+	b := NewBuilder(w32.RECT{Right: 19, Bottom: 19}, w32.RECT{})
+	b.SelectPen(PS_SOLID, 1, 0x000000)
+	b.SelectBrush(BS_SOLID, 0x000000, 0)
+	b.Add(&PolyPolygonRecord{Record: Record{Type: EMR_POLYPOLYGON}, NumberOfPolygons: 1, Count: 4,
+		PolygonPointCount: []uint32{4}, APoints: pointsOf(2, 2, 8, 2, 8, 8, 2, 8)})
+	b.Add(&PolyLineRecord{Record: Record{Type: EMR_POLYLINE}, Count: 2, APoints: pointsOf(12, 15, 18, 15)})
+
+	f := readFile(t, writeFile(t, b.File()))
+	dev := NewRasterDevice(20, 20)
+	if err := f.DrawToDevice(dev); err != nil {
+		t.Fatal(err)
+	}
+	img, err := dev.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range [][2]int{{5, 5}, {15, 15}} {
+		if c := img.RGBAAt(p[0], p[1]); c.R != 0 {
+			t.Errorf("pixel %v is %v, want it drawn", p, c)
+		}
+	}
+	if c := img.RGBAAt(15, 5); c.R == 0 {
+		t.Errorf("pixel 15,5 is drawn")
+	}
+}
+
+func TestPolyRecordsTruncated(t *testing.T) {
+	data, _ := decoderData(t)
+
+	bounds := []uint32{0, 0, 10, 10}
+	params := func(values ...uint32) []uint32 {
+		return append(append([]uint32{}, bounds...), values...)
+	}
+
+	tests := []struct {
+		name   string
+		typ    uint32
+		params []uint32
+	}{
+		{"polyline count", EMR_POLYLINE, params(1<<30, 1, 2)},
+		{"polylineto count", EMR_POLYLINETO, params(2, 1, 2)},
+		{"polybezier count", EMR_POLYBEZIER, params(4, 1, 2, 3, 4)},
+		{"polybezierto count", EMR_POLYBEZIERTO, params(0xFFFFFFFF)},
+		{"polygon count", EMR_POLYGON, params(3, 1, 2)},
+		{"polypolyline polylines", EMR_POLYPOLYLINE, params(1<<30, 2, 2)},
+		{"polypolyline points", EMR_POLYPOLYLINE, params(1, 1<<29, 1<<29, 1, 2)},
+		{"polypolyline sum", EMR_POLYPOLYLINE, params(2, 2, 2, 1, 1, 2, 3, 4)},
+		{"polypolygon polygons", EMR_POLYPOLYGON, params(0xFFFFFFFF, 3)},
+		{"polypolygon points", EMR_POLYPOLYGON, params(1, 3, 3, 1, 2)},
+		{"polypolygon sum", EMR_POLYPOLYGON, params(1, 1, 3, 1, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadFileWithOptions(withRecord(data, tt.typ, tt.params...), &ReadOptions{Strict: true})
+
+			var rerr *RecordError
+			if !errors.As(err, &rerr) || rerr.Type != tt.typ {
+				t.Errorf("ReadFile returned %v, want an error of the record", err)
+			}
+		})
+	}
+}
+
+// pointsOf16 returns the 16-bit points of the coordinates x0, y0, x1, y1...
+func pointsOf16(xy ...int16) []PointS {
+	points := make([]PointS, len(xy)/2)
+	for i := range points {
+		points[i] = PointS{X: xy[2*i], Y: xy[2*i+1]}
+	}
+	return points
+}
+
+func TestPolyDrawRecords(t *testing.T) {
+	types := []byte{PT_LINETO, PT_BEZIERTO, PT_BEZIERTO, PT_BEZIERTO | PT_CLOSEFIGURE, PT_MOVETO, PT_LINETO | PT_CLOSEFIGURE, PT_LINETO}
+	want := "M 1,1 L 2,2 C 3,3 4,4 5,5 Z M 10,10 L 11,11 Z M 10,10 L 12,12"
+
+	tests := []struct {
+		name string
+		recs []Recorder
+		path string
+	}{
+		{"polydraw", []Recorder{
+			moveTo(1, 1),
+			&PolyDrawRecord{Record: Record{Type: EMR_POLYDRAW}, Count: 7,
+				APoints: pointsOf(2, 2, 3, 3, 4, 4, 5, 5, 10, 10, 11, 11, 12, 12), AbTypes: types},
+		}, want},
+		{"polydraw16", []Recorder{
+			moveTo(1, 1),
+			&PolyDraw16Record{Record: Record{Type: EMR_POLYDRAW16}, Count: 7,
+				APoints: pointsOf16(2, 2, 3, 3, 4, 4, 5, 5, 10, 10, 11, 11, 12, 12), AbTypes: types},
+		}, want},
+		{"polydraw moves the current position", []Recorder{
+			moveTo(1, 1),
+			&PolyDrawRecord{Record: Record{Type: EMR_POLYDRAW}, Count: 1, APoints: pointsOf(2, 2), AbTypes: []byte{PT_LINETO}},
+			&PolyLineToRecord{Record: Record{Type: EMR_POLYLINETO}, Count: 1, APoints: pointsOf(3, 3)},
+		}, "M 1,1 L 2,2 L 3,3"},
+		{"polypolyline16", []Recorder{
+			&PolyPolyLine16Record{Record: Record{Type: EMR_POLYPOLYLINE16}, NumberOfPolylines: 2, Count: 5,
+				PolylinePointCount: []uint32{3, 2}, APoints: pointsOf16(0, 0, 1, 1, 2, -2, 10, 10, 11, 11)},
+		}, "M 0,0 L 1,1 L 2,-2 M 10,10 L 11,11"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathString(pathOf(t, tt.recs...)); got != tt.path {
+				t.Errorf("path is %q, want %q", got, tt.path)
+			}
+		})
+	}
+}
+
+func TestPolyDrawInvalid(t *testing.T) {
+	points := []w32.POINT{{X: 2, Y: 2}, {X: 3, Y: 3}, {X: 4, Y: 4}}
+
+	tests := []struct {
+		name  string
+		types []byte
+	}{
+		{"fewer types than points", []byte{PT_LINETO, PT_LINETO}},
+		{"more types than points", []byte{PT_LINETO, PT_LINETO, PT_LINETO, PT_LINETO}},
+		{"bezier lacks points", []byte{PT_LINETO, PT_BEZIERTO, PT_BEZIERTO}},
+		{"bezier interrupted", []byte{PT_BEZIERTO, PT_LINETO, PT_BEZIERTO}},
+		{"unknown type", []byte{PT_LINETO, 0x08, PT_LINETO}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newSoftDevice(10, 10, newRasterPainter(10, 10))
+			d.MoveToEx(1, 1)
+			d.BeginPath()
+
+			if err := d.PolyDraw(points, tt.types); err == nil {
+				t.Error("PolyDraw succeeded")
+			}
+			if s := pathString(d.path); s != "" {
+				t.Errorf("path is %q, want nothing drawn", s)
+			}
+			if d.state.cur != raster.Pt(1, 1) {
+				t.Errorf("current position moved to %v", d.state.cur)
+			}
+		})
+	}
+
+	// a record whose type array is shorter than its points is not read
+	data, _ := decoderData(t)
+	for _, typ := range []uint32{EMR_POLYDRAW, EMR_POLYDRAW16} {
+		params := []uint32{0, 0, 10, 10, 5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0x02020202}
+		if typ == EMR_POLYDRAW16 {
+			params = []uint32{0, 0, 10, 10, 5, 1, 2, 3, 4, 5, 0x02020202}
+		}
+
+		_, err := ReadFileWithOptions(withRecord(data, typ, params...), &ReadOptions{Strict: true})
+		var rerr *RecordError
+		if !errors.As(err, &rerr) || rerr.Type != typ {
+			t.Errorf("record %#x with short types read with %v", typ, err)
+		}
+	}
+}
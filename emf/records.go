@@ -5,53 +5,98 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"strings"
 
 	"github.com/lokks307/go-emf/w32"
 	log "github.com/sirupsen/logrus"
 )
 
 type Recorder interface {
-	Draw(*EmfContext)
+	Draw(*EmfContext) error
 }
 type Record struct {
 	Type uint32
 	Size uint32
 }
 
-func (r *Record) Draw(ctx *EmfContext) {
+func (r *Record) Draw(ctx *EmfContext) error {
 	log.Trace("Unsupported Draw")
+	return nil
 }
 
-func readRecord(reader *bytes.Reader) (Recorder, error) {
-	var defaultRecord Record
-
-	if err := binary.Read(reader, binary.LittleEndian, &defaultRecord); err != nil {
-		return nil, err
+// parseRecord parses data, a whole record with its header. The readers get
+// a reader of the record alone, so offsets in the record are positions of
+// the reader and reading cannot go past the record.
+func parseRecord(data []byte) (Recorder, error) {
+	defaultRecord := Record{
+		Type: binary.LittleEndian.Uint32(data),
+		Size: binary.LittleEndian.Uint32(data[4:]),
 	}
 
 	log.Tracef("Record type = %02x\n", defaultRecord.Type)
 
 	fn, ok := records[defaultRecord.Type]
 	if !ok {
-		return nil, fmt.Errorf("Unknown record %#v found", defaultRecord.Type)
+		return nil, ErrUnknownRecord
 	}
 
 	if fn != nil {
-		return fn(reader, defaultRecord.Size)
+		recReader := bytes.NewReader(data)
+		recReader.Seek(8, io.SeekStart)
+		return fn(recReader, defaultRecord.Size)
+	}
+
+	// default implementation keeps record data
+	r := &RawRecord{Record: defaultRecord}
+	if defaultRecord.Size > 8 {
+		r.Data = data[8:]
+	}
+
+	return r, nil
+}
+
+// recordBytes returns the n bytes at offset off of the record.
+func recordBytes(reader *bytes.Reader, off, n uint32) ([]byte, error) {
+	if uint64(off)+uint64(n) > uint64(reader.Size()) {
+		return nil, ErrRecordSize
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	b := make([]byte, n)
+	if _, err := reader.ReadAt(b, int64(off)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// seekRecord moves the reader to the offset off of the record.
+func seekRecord(reader *bytes.Reader, off uint32) error {
+	if int64(off) > reader.Size() {
+		return ErrRecordSize
 	}
 
-	// default implementation skips record data
-	_, err := reader.Seek(int64(defaultRecord.Size-8), os.SEEK_CUR)
-	return &defaultRecord, err
+	_, err := reader.Seek(int64(off), io.SeekStart)
+	return err
+}
+
+// RawRecord is a record without a reader. Its data is kept, so it is
+// written back unchanged.
+type RawRecord struct {
+	Record
+	Data []byte
 }
 
 type HeaderRecord struct {
 	Record
-	Original HeaderOriginal
-	Ext1     HeaderExtension1
-	Ext2     HeaderExtension2
+	Original    HeaderOriginal
+	Ext1        HeaderExtension1
+	Ext2        HeaderExtension2
+	Description []uint16
+	PixelFormat []byte // PIXELFORMATDESCRIPTOR
 }
 
 type HeaderExtension1 struct {
@@ -96,8 +141,8 @@ func readHeaderRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 		return nil, err
 	}
 
-	numBytesDescription := hdr.Original.OffDescription + 2*hdr.Original.NDescription
-	if hdr.Original.OffDescription >= hdr.Original.Size() && numBytesDescription <= size {
+	numBytesDescription := uint64(hdr.Original.OffDescription) + 2*uint64(hdr.Original.NDescription)
+	if hdr.Original.OffDescription >= hdr.Original.Size() && numBytesDescription <= uint64(size) {
 		headerSize = hdr.Original.OffDescription
 	}
 
@@ -106,7 +151,7 @@ func readHeaderRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 			return nil, err
 		}
 
-		if hdr.Ext1.OffPixelFormat >= 100 && (hdr.Ext1.OffPixelFormat+hdr.Ext1.CbPixelFormat) <= size {
+		if hdr.Ext1.OffPixelFormat >= 100 && uint64(hdr.Ext1.OffPixelFormat)+uint64(hdr.Ext1.CbPixelFormat) <= uint64(size) {
 			if hdr.Ext1.OffPixelFormat < headerSize {
 				headerSize = hdr.Ext1.OffPixelFormat
 			}
@@ -119,6 +164,22 @@ func readHeaderRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 		}
 	}
 
+	if hdr.Original.OffDescription >= hdr.Original.Size() && numBytesDescription <= uint64(size) {
+		reader.Seek(int64(hdr.Original.OffDescription), os.SEEK_SET)
+		hdr.Description = make([]uint16, hdr.Original.NDescription)
+		if err := binary.Read(reader, binary.LittleEndian, &hdr.Description); err != nil {
+			return nil, err
+		}
+	}
+
+	if hdr.Ext1.CbPixelFormat > 0 && hdr.Ext1.OffPixelFormat >= 100 && uint64(hdr.Ext1.OffPixelFormat)+uint64(hdr.Ext1.CbPixelFormat) <= uint64(size) {
+		reader.Seek(int64(hdr.Ext1.OffPixelFormat), os.SEEK_SET)
+		hdr.PixelFormat = make([]byte, hdr.Ext1.CbPixelFormat)
+		if _, err := io.ReadFull(reader, hdr.PixelFormat); err != nil {
+			return nil, err
+		}
+	}
+
 	reader.Seek(int64(size), os.SEEK_SET)
 
 	return hdr, nil
@@ -140,12 +201,10 @@ func readSetWindowExtExRecord(reader *bytes.Reader, size uint32) (Recorder, erro
 	return r, nil
 }
 
-func (r *SetWindowExtExRecord) Draw(ctx *EmfContext) {
+func (r *SetWindowExtExRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETWINDOWEXTEX")
 
-	if !w32.SetWindowExtEx(ctx.MDC, int(r.Extent.CX), int(r.Extent.CY), nil) {
-		log.Error("failed to run SetWindowExtEx")
-	}
+	return ctx.dev.SetWindowExtEx(int(r.Extent.CX), int(r.Extent.CY))
 }
 
 type SetWindowOrgExRecord struct {
@@ -164,12 +223,10 @@ func readSetWindowOrgExRecord(reader *bytes.Reader, size uint32) (Recorder, erro
 	return r, nil
 }
 
-func (r *SetWindowOrgExRecord) Draw(ctx *EmfContext) {
+func (r *SetWindowOrgExRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETWINDOWORGEX")
 
-	if !w32.SetWindowOrgEx(ctx.MDC, int(r.Origin.X), int(r.Origin.Y), nil) {
-		log.Error("failed to run SetWindowOrgEx")
-	}
+	return ctx.dev.SetWindowOrgEx(int(r.Origin.X), int(r.Origin.Y))
 }
 
 type SetWiewporTextExRecord struct {
@@ -188,12 +245,10 @@ func readSetViewportExtExRecord(reader *bytes.Reader, size uint32) (Recorder, er
 	return r, nil
 }
 
-func (r *SetWiewporTextExRecord) Draw(ctx *EmfContext) {
+func (r *SetWiewporTextExRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETVIEWPORTEXTEX")
 
-	if !w32.SetViewportExtEx(ctx.MDC, int(r.Extent.CX), int(r.Extent.CY), nil) {
-		log.Error("failed to run SetViewportExtEx")
-	}
+	return ctx.dev.SetViewportExtEx(int(r.Extent.CX), int(r.Extent.CY))
 }
 
 type SetWiewportOrgExRecord struct {
@@ -212,18 +267,17 @@ func readSetViewportOrgExRecord(reader *bytes.Reader, size uint32) (Recorder, er
 	return r, nil
 }
 
-func (r *SetWiewportOrgExRecord) Draw(ctx *EmfContext) {
+func (r *SetWiewportOrgExRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETVIEWPORTORGEX")
 
-	if !w32.SetViewportOrgEx(ctx.MDC, int(r.Origin.X), int(r.Origin.Y), nil) {
-		log.Error("failed to run SetViewportOrgEx")
-	}
+	return ctx.dev.SetViewportOrgEx(int(r.Origin.X), int(r.Origin.Y))
 }
 
 type EofRecord struct {
 	Record
 	NPalEntries   uint32
 	OffPalEntries uint32
+	PalEntries    []w32.COLORREF
 	SizeLast      uint32
 }
 
@@ -240,7 +294,16 @@ func readEofRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	}
 
 	if r.NPalEntries > 0 {
-		log.Error("nPalEntries found - ", r.NPalEntries)
+		if err := seekRecord(reader, r.OffPalEntries); err != nil {
+			return nil, err
+		}
+		if err := checkCount(reader, r.NPalEntries, 4); err != nil {
+			return nil, err
+		}
+		r.PalEntries = make([]w32.COLORREF, r.NPalEntries)
+		if err := binary.Read(reader, binary.LittleEndian, &r.PalEntries); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.SizeLast); err != nil {
@@ -267,12 +330,10 @@ func readSetMapModeRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetMapModeRecord) Draw(ctx *EmfContext) {
+func (r *SetMapModeRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETMAPMODE")
 
-	if w32.SetMapMode(ctx.MDC, int(r.MapMode)) == 0 {
-		log.Error("failed to run SetMapMode")
-	}
+	return ctx.dev.SetMapMode(int(r.MapMode))
 }
 
 type SetBkModeRecord struct {
@@ -291,13 +352,10 @@ func readSetBkModeRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetBkModeRecord) Draw(ctx *EmfContext) {
+func (r *SetBkModeRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SETBKMODE 0x%04x", r.BkMode)
 
-	if w32.SetBkMode(ctx.MDC, int(r.BkMode)) == 0 {
-		log.Error("failed to run SetBkMode")
-	}
-
+	return ctx.dev.SetBkMode(int(r.BkMode))
 }
 
 type SetPolyfillModeRecord struct {
@@ -316,12 +374,32 @@ func readSetPolyfillModeRecord(reader *bytes.Reader, size uint32) (Recorder, err
 	return r, nil
 }
 
-func (r *SetPolyfillModeRecord) Draw(ctx *EmfContext) {
+func (r *SetPolyfillModeRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SETPOLYFILLMODE 0x%02x", r.PolygonFillMode)
 
-	if w32.SetPolyFillMode(ctx.MDC, int(r.PolygonFillMode)) == 0 {
-		log.Error("failed to run SetPolyFillMode")
+	return ctx.dev.SetPolyFillMode(int(r.PolygonFillMode))
+}
+
+type SetArcDirectionRecord struct {
+	Record
+	ArcDirection uint32
+}
+
+func readSetArcDirectionRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &SetArcDirectionRecord{}
+	r.Record = Record{Type: EMR_SETARCDIRECTION, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.ArcDirection); err != nil {
+		return nil, err
 	}
+
+	return r, nil
+}
+
+func (r *SetArcDirectionRecord) Draw(ctx *EmfContext) error {
+	log.Tracef("Draw EMR_SETARCDIRECTION 0x%02x", r.ArcDirection)
+
+	return ctx.dev.SetArcDirection(int(r.ArcDirection))
 }
 
 type SetTextAlignRecord struct {
@@ -340,14 +418,10 @@ func readSetTextAlignRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *SetTextAlignRecord) Draw(ctx *EmfContext) {
+func (r *SetTextAlignRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETTEXTALIGN")
 
-	// FIXME: it does not work properly
-
-	// if w32.SetTextAlign(ctx.MDC, w32.UINT(r.TextAlignmentMode)) == w32.GDI_ERROR {
-	// 	log.Error("failed to run SetTextAlign")
-	// }
+	return ctx.dev.SetTextAlign(r.TextAlignmentMode)
 }
 
 type SetStretchBltModeRecord struct {
@@ -366,12 +440,10 @@ func readSetStretchBltModeRecord(reader *bytes.Reader, size uint32) (Recorder, e
 	return r, nil
 }
 
-func (r *SetStretchBltModeRecord) Draw(ctx *EmfContext) {
+func (r *SetStretchBltModeRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETSTRETCHBLTMODE")
 
-	if ret := w32.SetStretchBltMode(ctx.MDC, int(r.StretchMode)); ret == 0 {
-		log.Error("failed to run SetStretchBltMode")
-	}
+	return ctx.dev.SetStretchBltMode(int(r.StretchMode))
 }
 
 type SetTextColorRecord struct {
@@ -390,12 +462,10 @@ func readSetTextColorRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *SetTextColorRecord) Draw(ctx *EmfContext) {
+func (r *SetTextColorRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SETTEXTCOLOR 0x%08x", r.Color.ColorRef())
 
-	if w32.SetTextColor(ctx.MDC, r.Color.ColorRef()) == w32.COLORREF(w32.CLR_INVALID) {
-		log.Error("failed to run SetTextColor")
-	}
+	return ctx.dev.SetTextColor(r.Color.ColorRef())
 }
 
 type SetBkColorRecord struct {
@@ -414,12 +484,10 @@ func readSetBkColorRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetBkColorRecord) Draw(ctx *EmfContext) {
+func (r *SetBkColorRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SETBKCOLOR")
 
-	if w32.SetBkColor(ctx.MDC, r.Color.ColorRef()) == w32.COLORREF(w32.CLR_INVALID) {
-		log.Error("failed to run SetBkColor")
-	}
+	return ctx.dev.SetBkColor(r.Color.ColorRef())
 }
 
 type XYNumDenon struct {
@@ -428,6 +496,28 @@ type XYNumDenon struct {
 	YNum   uint32
 	YDenon uint32
 }
+type ScaleViewportExtExRecord struct {
+	Record
+	XYNumDenon
+}
+
+func readScaleViewportExtExRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ScaleViewportExtExRecord{}
+	r.Record = Record{Type: EMR_SCALEVIEWPORTEXTEX, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.XYNumDenon); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *ScaleViewportExtExRecord) Draw(ctx *EmfContext) error {
+	log.Tracef("Draw EMR_SCALEVIEWPORTEXTEX")
+
+	return ctx.dev.ScaleViewportExtEx(int(r.XNum), int(r.XDenon), int(r.YNum), int(r.YDenon))
+}
+
 type ScaleWindowExtExRecord struct {
 	Record
 	XYNumDenon
@@ -444,12 +534,10 @@ func readScaleWindowExtExRecord(reader *bytes.Reader, size uint32) (Recorder, er
 	return r, nil
 }
 
-func (r *ScaleWindowExtExRecord) Draw(ctx *EmfContext) {
+func (r *ScaleWindowExtExRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SCALEWINDOWEXTEX")
 
-	if !w32.ScaleWindowExtEx(ctx.MDC, int(r.XNum), int(r.XDenon), int(r.YNum), int(r.YDenon), nil) {
-		log.Error("failed to run ScaleWindowExtEx")
-	}
+	return ctx.dev.ScaleWindowExtEx(int(r.XNum), int(r.XDenon), int(r.YNum), int(r.YDenon))
 }
 
 type SetMetaRgnRecord struct {
@@ -463,12 +551,10 @@ func readSetMetaRgnRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetMetaRgnRecord) Draw(ctx *EmfContext) {
+func (r *SetMetaRgnRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SETMETARGN")
 
-	if w32.SetMetaRgn(ctx.MDC) == w32.ERROR {
-		log.Error("failed to run SetMetaRgn")
-	}
+	return ctx.dev.SetMetaRgn()
 }
 
 type OffSetClipRgnRecord struct {
@@ -487,12 +573,10 @@ func readOffSetClipRgnRecord(reader *bytes.Reader, size uint32) (Recorder, error
 	return r, nil
 }
 
-func (r *OffSetClipRgnRecord) Draw(ctx *EmfContext) {
+func (r *OffSetClipRgnRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_OFFSETCLIPRGN")
 
-	if w32.OffsetClipRgn(ctx.MDC, int(r.Offset.X), int(r.Offset.Y)) == w32.ERROR {
-		log.Error("failed to run OffsetClipRgn")
-	}
+	return ctx.dev.OffsetClipRgn(int(r.Offset.X), int(r.Offset.Y))
 }
 
 type BreakExCn struct {
@@ -515,12 +599,10 @@ func readSetTextJustificationRecord(reader *bytes.Reader, size uint32) (Recorder
 	return r, nil
 }
 
-func (r *SetTextJustificationRecord) Draw(ctx *EmfContext) {
+func (r *SetTextJustificationRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_SETTEXTJUSTIFICATION")
 
-	if !w32.SetTextJustification(ctx.MDC, int(r.NBreakExtra), int(r.NBreakCount)) {
-		log.Error("failed to run SetTextJustification")
-	}
+	return ctx.dev.SetTextJustification(int(r.NBreakExtra), int(r.NBreakCount))
 }
 
 type MoveToExRecord struct {
@@ -539,12 +621,10 @@ func readMoveToExRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *MoveToExRecord) Draw(ctx *EmfContext) {
+func (r *MoveToExRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_MOVETOEX (%d,%d)", r.Offset.X, r.Offset.Y)
 
-	if !w32.MoveToEx(ctx.MDC, int(r.Offset.X), int(r.Offset.Y), nil) {
-		log.Error("failed to run MoveToEx")
-	}
+	return ctx.dev.MoveToEx(int(r.Offset.X), int(r.Offset.Y))
 }
 
 type FillRgnRecord struct {
@@ -571,34 +651,166 @@ func readFillRgnRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 		return nil, err
 	}
 
-	r.RgnData.Data = make([]w32.RECT, r.RgnData.CountRects)
-	if err := binary.Read(reader, binary.LittleEndian, &r.RgnData); err != nil {
+	var err error
+	r.RgnData, err = readRegionData(reader, r.RgnDataSize)
+	if err != nil {
 		return nil, err
 	}
 
 	return r, nil
 }
 
-func (r *FillRgnRecord) Draw(ctx *EmfContext) {
+func (r *FillRgnRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_FILLRGN")
 
-	gdiObject, ok := StockObjects[r.IhBrush]
+	gdiObject, ok := ctx.object(r.IhBrush)
 	if !ok {
-		gdiObject, ok = ctx.Objects[r.IhBrush]
-		if !ok {
-			log.Errorf("Object 0x%x not found\n", r.IhBrush)
-			return
-		}
+		return fmt.Errorf("object 0x%x not found", r.IhBrush)
 	}
 
-	hbrush := gdiObject.(w32.HBRUSH)
+	rects, err := ctx.region(r.RgnData)
+	if err != nil {
+		return err
+	}
 
-	for idx := range r.RgnData.Data {
-		hrgn := w32.CreateRectRgnIndirect(&r.RgnData.Data[idx])
-		if !w32.FillRgn(ctx.MDC, hrgn, hbrush) {
-			log.Error("faile to run FillRgn")
-		}
+	return ctx.dev.FillRgn(rects, gdiObject)
+}
+
+type FrameRgnRecord struct {
+	Record
+	Bounds      w32.RECT
+	RgnDataSize uint32
+	IhBrush     uint32
+	Width       int32
+	Height      int32
+	RgnData     RegionData
+}
+
+func readFrameRgnRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &FrameRgnRecord{}
+	r.Record = Record{Type: EMR_FRAMERGN, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.RgnDataSize); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.IhBrush); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Width); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Height); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.RgnData, err = readRegionData(reader, r.RgnDataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *FrameRgnRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_FRAMERGN")
+
+	gdiObject, ok := ctx.object(r.IhBrush)
+	if !ok {
+		return fmt.Errorf("object 0x%x not found", r.IhBrush)
+	}
+
+	rects, err := ctx.region(r.RgnData)
+	if err != nil {
+		return err
+	}
+
+	return ctx.dev.FrameRgn(rects, gdiObject, int(r.Width), int(r.Height))
+}
+
+type InvertRgnRecord struct {
+	Record
+	Bounds      w32.RECT
+	RgnDataSize uint32
+	RgnData     RegionData
+}
+
+func readInvertRgnRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &InvertRgnRecord{}
+	r.Record = Record{Type: EMR_INVERTRGN, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.RgnDataSize); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.RgnData, err = readRegionData(reader, r.RgnDataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *InvertRgnRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_INVERTRGN")
+
+	rects, err := ctx.region(r.RgnData)
+	if err != nil {
+		return err
+	}
+
+	return ctx.dev.InvertRgn(rects)
+}
+
+type PaintRgnRecord struct {
+	Record
+	Bounds      w32.RECT
+	RgnDataSize uint32
+	RgnData     RegionData
+}
+
+func readPaintRgnRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PaintRgnRecord{}
+	r.Record = Record{Type: EMR_PAINTRGN, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.RgnDataSize); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.RgnData, err = readRegionData(reader, r.RgnDataSize)
+	if err != nil {
+		return nil, err
 	}
+
+	return r, nil
+}
+
+func (r *PaintRgnRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_PAINTRGN")
+
+	rects, err := ctx.region(r.RgnData)
+	if err != nil {
+		return err
+	}
+
+	return ctx.dev.PaintRgn(rects)
 }
 
 type IntersectClipRectRecord struct {
@@ -617,12 +829,32 @@ func readIntersectClipRectRecord(reader *bytes.Reader, size uint32) (Recorder, e
 	return r, nil
 }
 
-func (r *IntersectClipRectRecord) Draw(ctx *EmfContext) {
+func (r *IntersectClipRectRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_INTERSECTCLIPRECT")
 
-	if w32.IntersectClipRect(ctx.MDC, int(r.Clip.Left), int(r.Clip.Top), int(r.Clip.Right), int(r.Clip.Bottom)) == w32.ERROR {
-		log.Error("failed to run IntersectClipRect")
+	return ctx.dev.IntersectClipRect(int(r.Clip.Left), int(r.Clip.Top), int(r.Clip.Right), int(r.Clip.Bottom))
+}
+
+type ExcludeClipRectRecord struct {
+	Record
+	Clip w32.RECT
+}
+
+func readExcludeClipRectRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ExcludeClipRectRecord{}
+	r.Record = Record{Type: EMR_EXCLUDECLIPRECT, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Clip); err != nil {
+		return nil, err
 	}
+
+	return r, nil
+}
+
+func (r *ExcludeClipRectRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_EXCLUDECLIPRECT")
+
+	return ctx.dev.ExcludeClipRect(int(r.Clip.Left), int(r.Clip.Top), int(r.Clip.Right), int(r.Clip.Bottom))
 }
 
 type SaveDCRecord struct {
@@ -633,12 +865,10 @@ func readSaveDCRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return &SaveDCRecord{Record: Record{Type: EMR_SAVEDC, Size: size}}, nil
 }
 
-func (r *SaveDCRecord) Draw(ctx *EmfContext) {
+func (r *SaveDCRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SAVEDC")
 
-	if w32.SaveDC(ctx.MDC) == 0 {
-		log.Error("failed to run SaveDC")
-	}
+	return ctx.dev.SaveDC()
 }
 
 type RestoreDCRecord struct {
@@ -657,12 +887,10 @@ func readRestoreDCRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *RestoreDCRecord) Draw(ctx *EmfContext) {
+func (r *RestoreDCRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_RESTOREDC")
 
-	if !w32.RestoreDC(ctx.MDC, int(r.SavedDC)) {
-		log.Error("failed to run RestoreDC")
-	}
+	return ctx.dev.RestoreDC(int(r.SavedDC))
 }
 
 type SetWorldTransformRecord struct {
@@ -681,17 +909,10 @@ func readSetWorldTransformRecord(reader *bytes.Reader, size uint32) (Recorder, e
 	return r, nil
 }
 
-func (r *SetWorldTransformRecord) Draw(ctx *EmfContext) {
+func (r *SetWorldTransformRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETWORLDTRANSFORM")
 
-	if ctx.GraphicsMode == w32.GM_ADVANCED {
-		if !w32.SetWorldTransform(ctx.MDC, &r.XForm) {
-			log.Error("failed to run SetWorldTransform")
-		}
-	} else {
-		ctx.SetXForm(r.XForm)
-		ctx.ScaleView()
-	}
+	return ctx.dev.SetWorldTransform(r.XForm)
 }
 
 type ModifyWorldTransformRecord struct {
@@ -715,29 +936,10 @@ func readModifyWorldTransformRecord(reader *bytes.Reader, size uint32) (Recorder
 	return r, nil
 }
 
-func (r *ModifyWorldTransformRecord) Draw(ctx *EmfContext) {
+func (r *ModifyWorldTransformRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_MODIFYWORLDTRANSFORM 0x%02x", r.ModifyWorldTransformMode)
 
-	if ctx.GraphicsMode == w32.GM_ADVANCED {
-		if !w32.ModifyWorldTransform(ctx.MDC, &r.XForm, w32.DWORD(r.ModifyWorldTransformMode)) {
-			log.Error("failed to run ModifyWorldTransform")
-		}
-	} else {
-
-		switch r.ModifyWorldTransformMode {
-		case MWT_IDENTITY:
-			ctx.SetDefaultXForm()
-		case MWT_SET:
-			ctx.SetXForm(r.XForm)
-		case MWT_LEFTMULTIPLY:
-			ctx.ScaleXForm(r.XForm.M11, r.XForm.M22, r.XForm.Dx, r.XForm.Dy)
-		case MWT_RIGHTMULTIPLY:
-			ctx.ScaleXForm(1/r.XForm.M11, 1/r.XForm.M22, r.XForm.Dx, r.XForm.Dy)
-		}
-
-		ctx.ScaleView()
-
-	}
+	return ctx.dev.ModifyWorldTransform(r.XForm, r.ModifyWorldTransformMode)
 }
 
 type SelectObjectRecord struct {
@@ -756,29 +958,16 @@ func readSelectObjectRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *SelectObjectRecord) Draw(ctx *EmfContext) {
+func (r *SelectObjectRecord) Draw(ctx *EmfContext) error {
 
 	log.Tracef("Draw EMR_SELECTOBJECT 0x%08x", r.IhObject)
 
-	gdiObject, ok := StockObjects[r.IhObject]
+	gdiObject, ok := ctx.object(r.IhObject)
 	if !ok {
-		gdiObject, ok = ctx.Objects[r.IhObject]
-		if !ok {
-			log.Errorf("Object 0x%x not found\n", r.IhObject)
-			return
-		}
+		return fmt.Errorf("object 0x%x not found", r.IhObject)
 	}
 
-	switch object := gdiObject.(type) {
-	case w32.HPEN:
-		w32.SelectObject(ctx.MDC, w32.HGDIOBJ(object))
-	case w32.HBRUSH:
-		w32.SelectObject(ctx.MDC, w32.HGDIOBJ(object))
-	case w32.HFONT:
-		w32.SelectObject(ctx.MDC, w32.HGDIOBJ(object))
-	default:
-		log.Error("Unknown type of object")
-	}
+	return ctx.dev.SelectObject(gdiObject)
 }
 
 type CreatePenRecord struct {
@@ -802,12 +991,14 @@ func readCreatePenRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *CreatePenRecord) Draw(ctx *EmfContext) {
+func (r *CreatePenRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_CREATEPEN")
 
 	w32logpen := r.LogPen.LogPen()
 
-	ctx.Objects[r.IhPen] = w32.CreatePenIndirect(&w32logpen)
+	ctx.Objects[r.IhPen] = ctx.dev.CreatePen(w32logpen)
+
+	return nil
 }
 
 type CreateBrushIndirectRecord struct {
@@ -831,12 +1022,14 @@ func readCreateBrushIndirectRecord(reader *bytes.Reader, size uint32) (Recorder,
 	return r, nil
 }
 
-func (r *CreateBrushIndirectRecord) Draw(ctx *EmfContext) {
+func (r *CreateBrushIndirectRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_CREATEBRUSHINDIRECT 0x%08x", r.IhBrush)
 
 	w32logbrush := r.LogBrush.LogBrush()
 
-	ctx.Objects[r.IhBrush] = w32.CreateBrushIndirect(&w32logbrush)
+	ctx.Objects[r.IhBrush] = ctx.dev.CreateBrushIndirect(w32logbrush)
+
+	return nil
 }
 
 type CreatePaletteRecord struct {
@@ -847,7 +1040,7 @@ type CreatePaletteRecord struct {
 
 func readCreatePaletteRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	r := &CreatePaletteRecord{}
-	r.Record = Record{Type: EMR_CREATEBRUSHINDIRECT, Size: size}
+	r.Record = Record{Type: EMR_CREATEPALETTE, Size: size}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.IhPal); err != nil {
 		return nil, err
@@ -862,10 +1055,12 @@ func readCreatePaletteRecord(reader *bytes.Reader, size uint32) (Recorder, error
 	return r, nil
 }
 
-func (r *CreatePaletteRecord) Draw(ctx *EmfContext) {
+func (r *CreatePaletteRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_CREATEPALETTE")
 
-	ctx.Objects[r.IhPal] = w32.CreatePalette(&r.LogPalette)
+	ctx.Objects[r.IhPal] = ctx.dev.CreatePalette(r.LogPalette)
+
+	return nil
 }
 
 type SelectPaletteRecord struct {
@@ -884,25 +1079,15 @@ func readSelectPaletteRecord(reader *bytes.Reader, size uint32) (Recorder, error
 	return r, nil
 }
 
-func (r *SelectPaletteRecord) Draw(ctx *EmfContext) {
+func (r *SelectPaletteRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SELECTPALETTE")
 
-	gdiObject, ok := StockObjects[r.IhPal]
+	gdiObject, ok := ctx.object(r.IhPal)
 	if !ok {
-		gdiObject, ok = ctx.Objects[r.IhPal]
-		if !ok {
-			log.Errorf("Object 0x%x not found\n", r.IhPal)
-			return
-		}
-	}
-
-	switch object := gdiObject.(type) {
-	case w32.HPALETTE:
-		w32.SelectPalette(ctx.MDC, object, w32.FALSE)
-	default:
-		log.Error("Unknown type of object")
+		return fmt.Errorf("object 0x%x not found", r.IhPal)
 	}
 
+	return ctx.dev.SelectPalette(gdiObject)
 }
 
 type DeleteObjectRecord struct {
@@ -921,10 +1106,18 @@ func readDeleteObjectRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *DeleteObjectRecord) Draw(ctx *EmfContext) {
+func (r *DeleteObjectRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_DELETEOBJECT 0x%08x", r.IhObject)
 
+	if object, ok := ctx.Objects[r.IhObject]; ok {
+		if err := ctx.dev.DeleteObject(object); err != nil {
+			return err
+		}
+	}
+
 	delete(ctx.Objects, r.IhObject)
+
+	return nil
 }
 
 type RectangleRecord struct {
@@ -942,12 +1135,10 @@ func readRectangleRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *RectangleRecord) Draw(ctx *EmfContext) {
+func (r *RectangleRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_RECTANGLE")
 
-	if !w32.Rectangle(ctx.MDC, int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom)) {
-		log.Error("failed to run Rectangle")
-	}
+	return ctx.dev.Rectangle(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom))
 }
 
 type ArcRecord struct {
@@ -974,53 +1165,221 @@ func readArcRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *ArcRecord) Draw(ctx *EmfContext) {
+func (r *ArcRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_ARC")
 
-	if !w32.Arc(ctx.MDC, int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom),
-		int(r.Start.X), int(r.Start.Y), int(r.End.X), int(r.End.Y)) {
-		log.Error("failed to run Arc")
-	}
+	return ctx.dev.Arc(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom),
+		int(r.Start.X), int(r.Start.Y), int(r.End.X), int(r.End.Y))
 }
 
-type LineToRecord struct {
+type ArcToRecord struct {
 	Record
-	Point w32.POINT
+	Box   w32.RECT
+	Start w32.POINT
+	End   w32.POINT
 }
 
-func readLineToRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
-	r := &LineToRecord{}
-	r.Record = Record{Type: EMR_LINETO, Size: size}
+func readArcToRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ArcToRecord{}
+	r.Record = Record{Type: EMR_ARCTO, Size: size}
 
-	if err := binary.Read(reader, binary.LittleEndian, &r.Point); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &r.Box); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.Start); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.End); err != nil {
 		return nil, err
 	}
+
 	return r, nil
 }
 
-func (r *LineToRecord) Draw(ctx *EmfContext) {
-	log.Tracef("Draw EMR_LINETO (%d,%d)", r.Point.X, r.Point.Y)
+func (r *ArcToRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_ARCTO")
 
-	if !w32.LineTo(ctx.MDC, int(r.Point.X), int(r.Point.Y)) {
-		log.Error("failed to run LineTo")
-	}
+	return ctx.dev.ArcTo(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom),
+		int(r.Start.X), int(r.Start.Y), int(r.End.X), int(r.End.Y))
 }
 
-type BeginPathRecord struct {
+type ChordRecord struct {
 	Record
+	Box   w32.RECT
+	Start w32.POINT
+	End   w32.POINT
 }
 
-func readBeginPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
-	return &BeginPathRecord{Record{Type: EMR_BEGINPATH, Size: size}}, nil
-}
-
-func (r *BeginPathRecord) Draw(ctx *EmfContext) {
-	log.Trace("Draw EMR_BEGINPATH")
+func readChordRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ChordRecord{}
+	r.Record = Record{Type: EMR_CHORD, Size: size}
 
-	if !w32.BeginPath(ctx.MDC) {
-		log.Error("failed to run BeginPath")
+	if err := binary.Read(reader, binary.LittleEndian, &r.Box); err != nil {
+		return nil, err
 	}
-}
+	if err := binary.Read(reader, binary.LittleEndian, &r.Start); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.End); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *ChordRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_CHORD")
+
+	return ctx.dev.Chord(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom),
+		int(r.Start.X), int(r.Start.Y), int(r.End.X), int(r.End.Y))
+}
+
+type PieRecord struct {
+	Record
+	Box   w32.RECT
+	Start w32.POINT
+	End   w32.POINT
+}
+
+func readPieRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PieRecord{}
+	r.Record = Record{Type: EMR_PIE, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Box); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.Start); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.End); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PieRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_PIE")
+
+	return ctx.dev.Pie(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom),
+		int(r.Start.X), int(r.Start.Y), int(r.End.X), int(r.End.Y))
+}
+
+type AngleArcRecord struct {
+	Record
+	Center     w32.POINT
+	Radius     uint32
+	StartAngle float32
+	SweepAngle float32
+}
+
+func readAngleArcRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &AngleArcRecord{}
+	r.Record = Record{Type: EMR_ANGLEARC, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Center); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.Radius); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.StartAngle); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.SweepAngle); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *AngleArcRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_ANGLEARC")
+
+	return ctx.dev.AngleArc(int(r.Center.X), int(r.Center.Y), r.Radius, r.StartAngle, r.SweepAngle)
+}
+
+type EllipseRecord struct {
+	Record
+	Box w32.RECT
+}
+
+func readEllipseRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &EllipseRecord{}
+	r.Record = Record{Type: EMR_ELLIPSE, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Box); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *EllipseRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_ELLIPSE")
+
+	return ctx.dev.Ellipse(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom))
+}
+
+type RoundRectRecord struct {
+	Record
+	Box    w32.RECT
+	Corner w32.SIZE
+}
+
+func readRoundRectRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &RoundRectRecord{}
+	r.Record = Record{Type: EMR_ROUNDRECT, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Box); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &r.Corner); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RoundRectRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_ROUNDRECT")
+
+	return ctx.dev.RoundRect(int(r.Box.Left), int(r.Box.Top), int(r.Box.Right), int(r.Box.Bottom),
+		int(r.Corner.CX), int(r.Corner.CY))
+}
+
+type LineToRecord struct {
+	Record
+	Point w32.POINT
+}
+
+func readLineToRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &LineToRecord{}
+	r.Record = Record{Type: EMR_LINETO, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Point); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *LineToRecord) Draw(ctx *EmfContext) error {
+	log.Tracef("Draw EMR_LINETO (%d,%d)", r.Point.X, r.Point.Y)
+
+	return ctx.dev.LineTo(int(r.Point.X), int(r.Point.Y))
+}
+
+type BeginPathRecord struct {
+	Record
+}
+
+func readBeginPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	return &BeginPathRecord{Record{Type: EMR_BEGINPATH, Size: size}}, nil
+}
+
+func (r *BeginPathRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_BEGINPATH")
+
+	return ctx.dev.BeginPath()
+}
 
 type EndPathRecord struct {
 	Record
@@ -1030,12 +1389,10 @@ func readEndPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return &EndPathRecord{Record{Type: EMR_ENDPATH, Size: size}}, nil
 }
 
-func (r *EndPathRecord) Draw(ctx *EmfContext) {
+func (r *EndPathRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_ENDPATH")
 
-	if !w32.EndPath(ctx.MDC) {
-		log.Error("failed to run EndPath")
-	}
+	return ctx.dev.EndPath()
 }
 
 type AbortPathRecord struct {
@@ -1043,15 +1400,41 @@ type AbortPathRecord struct {
 }
 
 func readAbortPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
-	return &AbortPathRecord{Record{Type: EMR_ENDPATH, Size: size}}, nil
+	return &AbortPathRecord{Record{Type: EMR_ABORTPATH, Size: size}}, nil
 }
 
-func (r *AbortPathRecord) Draw(ctx *EmfContext) {
+func (r *AbortPathRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_ABORTPATH")
 
-	if !w32.AbortPath(ctx.MDC) {
-		log.Error("failed to run AbortPath")
-	}
+	return ctx.dev.AbortPath()
+}
+
+type FlattenPathRecord struct {
+	Record
+}
+
+func readFlattenPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	return &FlattenPathRecord{Record{Type: EMR_FLATTENPATH, Size: size}}, nil
+}
+
+func (r *FlattenPathRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_FLATTENPATH")
+
+	return ctx.dev.FlattenPath()
+}
+
+type WidenPathRecord struct {
+	Record
+}
+
+func readWidenPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	return &WidenPathRecord{Record{Type: EMR_WIDENPATH, Size: size}}, nil
+}
+
+func (r *WidenPathRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_WIDENPATH")
+
+	return ctx.dev.WidenPath()
 }
 
 type CloseFigureRecord struct {
@@ -1062,12 +1445,10 @@ func readCloseFigureRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 	return &CloseFigureRecord{Record{Type: EMR_CLOSEFIGURE, Size: size}}, nil
 }
 
-func (r *CloseFigureRecord) Draw(ctx *EmfContext) {
+func (r *CloseFigureRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_CLOSEFIGURE")
 
-	if !w32.CloseFigure(ctx.MDC) {
-		log.Error("failed to run CloseFigure")
-	}
+	return ctx.dev.CloseFigure()
 }
 
 type FillPathRecord struct {
@@ -1085,26 +1466,10 @@ func readFillPathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *FillPathRecord) Draw(ctx *EmfContext) {
+func (r *FillPathRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_FILLPATH")
 
-	if ctx.GraphicsMode == w32.GM_ADVANCED {
-
-		hrgn := w32.CreateRectRgn(int(r.Bounds.Left), int(r.Bounds.Top), int(r.Bounds.Right), int(r.Bounds.Bottom))
-		oobj := w32.SelectObject(ctx.MDC, w32.HGDIOBJ(hrgn))
-
-		if !w32.FillPath(ctx.MDC) {
-			log.Error("failed to run FillPath")
-		}
-
-		w32.SelectObject(ctx.MDC, oobj)
-
-	} else {
-
-		if !w32.FillPath(ctx.MDC) {
-			log.Error("failed to run FillPath")
-		}
-	}
+	return ctx.dev.FillPath()
 }
 
 type StrokeAndFillPathRecord struct {
@@ -1122,12 +1487,10 @@ func readStrokeAndFillPathRecord(reader *bytes.Reader, size uint32) (Recorder, e
 	return r, nil
 }
 
-func (r *StrokeAndFillPathRecord) Draw(ctx *EmfContext) {
+func (r *StrokeAndFillPathRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_STROKEANDFILLPATH")
 
-	if !w32.StrokeAndFillPath(ctx.MDC) {
-		log.Error("failed to run StrokeAndFillPath")
-	}
+	return ctx.dev.StrokeAndFillPath()
 }
 
 type StrokePathRecord struct {
@@ -1145,12 +1508,10 @@ func readStrokePathRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *StrokePathRecord) Draw(ctx *EmfContext) {
+func (r *StrokePathRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_STROKEPATH")
 
-	if !w32.StrokePath(ctx.MDC) {
-		log.Error("failed to run StrokePath")
-	}
+	return ctx.dev.StrokePath()
 }
 
 type SelectClipPathRecord struct {
@@ -1168,164 +1529,779 @@ func readSelectClipPathRecord(reader *bytes.Reader, size uint32) (Recorder, erro
 	return r, nil
 }
 
-func (r *SelectClipPathRecord) Draw(ctx *EmfContext) {
+func (r *SelectClipPathRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SELECTCLIPPATH")
 
-	if !w32.SelectClipPath(ctx.MDC, int(r.RegionMode)) {
-		log.Error("failed to run StrokePath")
+	return ctx.dev.SelectClipPath(int(r.RegionMode))
+}
+
+type CommentRecord struct {
+	Record
+	Data []byte
+}
+
+func readCommentRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &CommentRecord{}
+	r.Record = Record{Type: EMR_COMMENT, Size: size}
+
+	if size > 8 {
+		r.Data = make([]byte, size-8)
+		if _, err := io.ReadFull(reader, r.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return readCommentData(r)
+}
+
+func (r *CommentRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_COMMENT")
+	return nil
+}
+
+type ExtCreateFontIndirectWRecord struct {
+	Record
+	IhFonts uint32
+	Elw     w32.LOGFONTEXDV
+	isExDV  bool
+}
+
+func readExtCreateFontIndirectWRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ExtCreateFontIndirectWRecord{}
+	r.Record = Record{Type: EMR_EXTCREATEFONTINDIRECTW, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.IhFonts); err != nil {
+		return nil, err
+	}
+
+	sizeElw := size - 12
+
+	if sizeElw > w32.LOGFONTPANOSESIZE { // size of Elw = size - 12
+		r.isExDV = true
+	}
+
+	if !r.isExDV {
+		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.LOGFONT); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.LOGFONTEX); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.Signature); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.NumAxes); err != nil {
+			return nil, err
+		}
+
+		if r.Elw.NumAxes > 0 {
+			if err := checkCount(reader, r.Elw.NumAxes, 4); err != nil {
+				return nil, err
+			}
+			r.Elw.Values = make([]int32, r.Elw.NumAxes)
+			if err := binary.Read(reader, binary.LittleEndian, &r.Elw.Values); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func (r *ExtCreateFontIndirectWRecord) Draw(ctx *EmfContext) error {
+	log.Tracef("Draw EMR_EXTCREATEFONTINDIRECTW 0x%08x %s", r.IhFonts, r.Elw.GetFaceName())
+
+	// if r.isExDV {
+	// 	ctx.Objects[r.IhFonts] = w32.CreateFontIndirectExW(&r.Elw)
+	// } else {
+	// 	ctx.Objects[r.IhFonts] = w32.CreateFontIndirectW(&r.Elw.LOGFONT)
+	// }
+
+	ctx.Objects[r.IhFonts] = ctx.dev.CreateFontIndirect(r.Elw.LOGFONT)
+
+	return nil
+}
+
+type ExtTextOutWRecord struct {
+	Record
+	Bounds        w32.RECT
+	IGraphicsMode uint32
+	ExScale       float32
+	EyScale       float32
+	WEmrText      EmrText
+}
+
+func readExtTextOutWRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ExtTextOutWRecord{}
+	r.Record = Record{Type: EMR_EXTTEXTOUTW, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.IGraphicsMode); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.ExScale); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.EyScale); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.WEmrText, err = readEmrText(reader, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *ExtTextOutWRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_EXTTEXTOUTW ", r.WEmrText.GetString())
+
+	return r.WEmrText.draw(ctx, r.IGraphicsMode)
+}
+
+// draw draws the string at its reference point, which is aligned by the
+// text alignment of the device. An ANSI string is decoded by the charset of
+// the selected font. The bounds of the records are not used, they are only
+// the area the text was drawn to.
+func (t *EmrText) draw(ctx *EmfContext, mode uint32) error {
+	ctx.setTextMode(mode)
+
+	text, dx := t.OutputString, t.OutputDx
+	if t.AnsiString != nil {
+		text, dx = decodeAnsi(uint8(ctx.dev.GetTextCharset()), t.AnsiString, t.OutputDx, t.Options&ETO_PDY != 0)
+	}
+
+	// an empty string still fills its opaque rectangle
+	if len(text) == 0 && t.Options&ETO_OPAQUE == 0 {
+		return nil
+	}
+
+	return ctx.dev.ExtTextOut(int(t.Reference.X), int(t.Reference.Y), t.options(), t.rect(), text, dx)
+}
+
+type ExtTextOutARecord struct {
+	Record
+	Bounds        w32.RECT
+	IGraphicsMode uint32
+	ExScale       float32
+	EyScale       float32
+	AEmrText      EmrText
+}
+
+func readExtTextOutARecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &ExtTextOutARecord{}
+	r.Record = Record{Type: EMR_EXTTEXTOUTA, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.IGraphicsMode); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.ExScale); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.EyScale); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.AEmrText, err = readEmrText(reader, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *ExtTextOutARecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_EXTTEXTOUTA")
+
+	return r.AEmrText.draw(ctx, r.IGraphicsMode)
+}
+
+// PolyTextOutRecord is EMR_POLYTEXTOUTA or EMR_POLYTEXTOUTW, which draw
+// several strings with the same font.
+type PolyTextOutRecord struct {
+	Record
+	Bounds        w32.RECT
+	IGraphicsMode uint32
+	ExScale       float32
+	EyScale       float32
+	Strings       uint32
+	EmrTexts      []EmrText
+}
+
+func readPolyTextOutRecord(reader *bytes.Reader, size uint32, ansi bool) (*PolyTextOutRecord, error) {
+	r := &PolyTextOutRecord{}
+	r.Record = Record{Type: EMR_POLYTEXTOUTW, Size: size}
+	if ansi {
+		r.Type = EMR_POLYTEXTOUTA
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.IGraphicsMode); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.ExScale); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.EyScale); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Strings); err != nil {
+		return nil, err
+	}
+
+	// an EmrText is at least 24 bytes
+	if err := checkCount(reader, r.Strings, 24); err != nil {
+		return nil, err
+	}
+
+	r.EmrTexts = make([]EmrText, r.Strings)
+	for i := range r.EmrTexts {
+		// the string and the distances are read at their offsets, the next
+		// EmrText follows this one
+		pos, _ := reader.Seek(0, io.SeekCurrent)
+
+		t, err := readEmrText(reader, ansi)
+		if err != nil {
+			return nil, err
+		}
+		r.EmrTexts[i] = t
+
+		fixed := int64(40)
+		if t.Options&ETO_NO_RECT != 0 {
+			fixed = 24
+		}
+		if _, err := reader.Seek(pos+fixed, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func readPolyTextOutARecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	// a nil *PolyTextOutRecord is not a nil Recorder
+	r, err := readPolyTextOutRecord(reader, size, true)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func readPolyTextOutWRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	// a nil *PolyTextOutRecord is not a nil Recorder
+	r, err := readPolyTextOutRecord(reader, size, false)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *PolyTextOutRecord) Draw(ctx *EmfContext) error {
+	if r.Type == EMR_POLYTEXTOUTA {
+		log.Trace("Draw EMR_POLYTEXTOUTA")
+	} else {
+		log.Trace("Draw EMR_POLYTEXTOUTW")
+	}
+
+	for i := range r.EmrTexts {
+		if err := r.EmrTexts[i].draw(ctx, r.IGraphicsMode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SmallTextOutRecord draws a string without distances. Its bounds are the
+// clipping or opaquing rectangle, they are not stored with ETO_NO_RECT.
+type SmallTextOutRecord struct {
+	Record
+	X             int32
+	Y             int32
+	Chars         uint32
+	Options       uint32
+	IGraphicsMode uint32
+	ExScale       float32
+	EyScale       float32
+	Bounds        w32.RECT
+	TextString    []uint16 // stored as bytes with ETO_SMALL_CHARS
+}
+
+func readSmallTextOutRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &SmallTextOutRecord{}
+	r.Record = Record{Type: EMR_SMALLTEXTOUT, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.X); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Y); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Chars); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Options); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.IGraphicsMode); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.ExScale); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.EyScale); err != nil {
+		return nil, err
+	}
+
+	if r.Options&ETO_NO_RECT == 0 {
+		if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Options&ETO_SMALL_CHARS != 0 {
+		if err := checkCount(reader, r.Chars, 1); err != nil {
+			return nil, err
+		}
+
+		s := make([]byte, r.Chars)
+		if _, err := io.ReadFull(reader, s); err != nil {
+			return nil, err
+		}
+		r.TextString = widenString(s)
+	} else {
+		if err := checkCount(reader, r.Chars, 2); err != nil {
+			return nil, err
+		}
+
+		r.TextString = make([]uint16, r.Chars)
+		if err := binary.Read(reader, binary.LittleEndian, &r.TextString); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *SmallTextOutRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_SMALLTEXTOUT ", utf16ToString(r.TextString))
+
+	if len(r.TextString) == 0 && r.Options&ETO_OPAQUE == 0 {
+		return nil
+	}
+
+	ctx.setTextMode(r.IGraphicsMode)
+
+	var rect *w32.RECT
+	if r.Options&ETO_NO_RECT == 0 {
+		rect = &r.Bounds
+	}
+
+	return ctx.dev.ExtTextOut(int(r.X), int(r.Y), r.Options&^(ETO_SMALL_CHARS|ETO_NO_RECT), rect, r.TextString, nil)
+}
+
+type PolyBezierRecord struct {
+	Record
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []w32.POINTL
+}
+
+func readPolyBezierRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyBezierRecord{}
+	r.Record = Record{Type: EMR_POLYBEZIER, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyBezierRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYBEZIER")
+
+	return ctx.dev.PolyBezier(pointsL(r.APoints))
+}
+
+type PolygonRecord struct {
+	Record
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []w32.POINTL
+}
+
+func readPolygonRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolygonRecord{}
+	r.Record = Record{Type: EMR_POLYGON, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolygonRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYGON")
+
+	return ctx.dev.Polygon(pointsL(r.APoints))
+}
+
+type PolyLineRecord struct {
+	Record
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []w32.POINTL
+}
+
+func readPolyLineRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyLineRecord{}
+	r.Record = Record{Type: EMR_POLYLINE, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyLineRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYLINE")
+
+	return ctx.dev.Polyline(pointsL(r.APoints))
+}
+
+type PolyBezierToRecord struct {
+	Record
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []w32.POINTL
+}
+
+func readPolyBezierToRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyBezierToRecord{}
+	r.Record = Record{Type: EMR_POLYBEZIERTO, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyBezierToRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYBEZIERTO")
+
+	return ctx.dev.PolyBezierTo(pointsL(r.APoints))
+}
+
+type PolyLineToRecord struct {
+	Record
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []w32.POINTL
+}
+
+func readPolyLineToRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyLineToRecord{}
+	r.Record = Record{Type: EMR_POLYLINETO, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyLineToRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYLINETO")
+
+	return ctx.dev.PolylineTo(pointsL(r.APoints))
+}
+
+type PolyPolyLineRecord struct {
+	Record
+	Bounds             w32.RECT
+	NumberOfPolylines  uint32
+	Count              uint32
+	PolylinePointCount []uint32
+	APoints            []w32.POINTL
+}
+
+func readPolyPolyLineRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyPolyLineRecord{}
+	r.Record = Record{Type: EMR_POLYPOLYLINE, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.NumberOfPolylines); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.NumberOfPolylines, 4); err != nil {
+		return nil, err
+	}
+
+	r.PolylinePointCount = make([]uint32, r.NumberOfPolylines)
+	if err := binary.Read(reader, binary.LittleEndian, &r.PolylinePointCount); err != nil {
+		return nil, err
+	}
+
+	var total uint64
+	for _, n := range r.PolylinePointCount {
+		total += uint64(n)
+	}
+	if total > uint64(r.Count) {
+		return nil, errors.New("polyline point counts exceed the number of points")
+	}
+
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
 	}
-}
 
-type CommentRecord struct {
-	Record
-}
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
 
-func readCommentRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
-	r := &CommentRecord{}
-	r.Record = Record{Type: EMR_COMMENT, Size: size}
-	// skip record data
-	reader.Seek(int64(size-8), os.SEEK_CUR)
 	return r, nil
 }
 
-func (r *CommentRecord) Draw(ctx *EmfContext) {
-	log.Trace("Draw EMR_COMMENT")
-}
-
-type ExtCreateFontIndirectWRecord struct {
+type PolyPolygonRecord struct {
 	Record
-	IhFonts uint32
-	Elw     w32.LOGFONTEXDV
-	isExDV  bool
+	Bounds            w32.RECT
+	NumberOfPolygons  uint32
+	Count             uint32
+	PolygonPointCount []uint32
+	APoints           []w32.POINTL
 }
 
-func readExtCreateFontIndirectWRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
-	r := &ExtCreateFontIndirectWRecord{}
-	r.Record = Record{Type: EMR_EXTCREATEFONTINDIRECTW, Size: size}
+func readPolyPolygonRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyPolygonRecord{}
+	r.Record = Record{Type: EMR_POLYPOLYGON, Size: size}
 
-	if err := binary.Read(reader, binary.LittleEndian, &r.IhFonts); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
 		return nil, err
 	}
 
-	sizeElw := size - 12
+	if err := binary.Read(reader, binary.LittleEndian, &r.NumberOfPolygons); err != nil {
+		return nil, err
+	}
 
-	if sizeElw > w32.LOGFONTPANOSESIZE { // size of Elw = size - 12
-		r.isExDV = true
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
 	}
 
-	var remainSize uint32
+	if err := checkCount(reader, r.NumberOfPolygons, 4); err != nil {
+		return nil, err
+	}
 
-	if !r.isExDV {
-		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.LOGFONT); err != nil {
-			return nil, err
-		}
+	r.PolygonPointCount = make([]uint32, r.NumberOfPolygons)
+	if err := binary.Read(reader, binary.LittleEndian, &r.PolygonPointCount); err != nil {
+		return nil, err
+	}
 
-		remainSize = sizeElw - w32.LOGFONTSIZE
+	var total uint64
+	for _, n := range r.PolygonPointCount {
+		total += uint64(n)
+	}
+	if total > uint64(r.Count) {
+		return nil, errors.New("polygon point counts exceed the number of points")
+	}
 
-	} else {
-		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.LOGFONTEX); err != nil {
-			return nil, err
-		}
+	if err := checkCount(reader, r.Count, 8); err != nil {
+		return nil, err
+	}
 
-		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.Signature); err != nil {
-			return nil, err
-		}
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
 
-		if err := binary.Read(reader, binary.LittleEndian, &r.Elw.NumAxes); err != nil {
-			return nil, err
-		}
+	return r, nil
+}
 
-		if r.Elw.NumAxes > 0 {
-			r.Elw.Values = make([]int32, r.Elw.NumAxes)
-			if err := binary.Read(reader, binary.LittleEndian, &r.Elw.Values); err != nil {
-				return nil, err
-			}
-		}
+func (r *PolyPolyLineRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYPOLYLINE")
 
-		remainSize = sizeElw - w32.LOGFONTEXSIZE - 8 - r.Elw.NumAxes*4
-	}
+	return polyPolyline(ctx, pointsL(r.APoints), r.PolylinePointCount)
+}
 
-	if remainSize > 0 {
-		reader.Seek(int64(remainSize), os.SEEK_CUR)
+func (r *PolyPolygonRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYPOLYGON")
+
+	asz := make([]int, r.NumberOfPolygons)
+	for idx := range r.PolygonPointCount {
+		asz[idx] = int(r.PolygonPointCount[idx])
 	}
 
-	return r, nil
+	return ctx.dev.PolyPolygon(pointsL(r.APoints), asz)
 }
 
-func (r *ExtCreateFontIndirectWRecord) Draw(ctx *EmfContext) {
-	log.Tracef("Draw EMR_EXTCREATEFONTINDIRECTW 0x%08x %s", r.IhFonts, r.Elw.GetFaceName())
-
-	// if r.isExDV {
-	// 	ctx.Objects[r.IhFonts] = w32.CreateFontIndirectExW(&r.Elw)
-	// } else {
-	// 	ctx.Objects[r.IhFonts] = w32.CreateFontIndirectW(&r.Elw.LOGFONT)
-	// }
+// polyPolyline draws the polylines of counts points, which do not change the
+// current position.
+func polyPolyline(ctx *EmfContext, points []w32.POINT, counts []uint32) error {
+	for _, n := range counts {
+		if err := ctx.dev.Polyline(points[:n]); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
 
-	ctx.Objects[r.IhFonts] = w32.CreateFontIndirectW(&r.Elw.LOGFONT)
+	return nil
 }
 
-type ExtTextOutWRecord struct {
+type PolyDrawRecord struct {
 	Record
-	Bounds        w32.RECT
-	IGraphicsMode uint32
-	ExScale       float32
-	EyScale       float32
-	WEmrText      EmrText
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []w32.POINTL
+	AbTypes []byte
 }
 
-func readExtTextOutWRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
-	r := &ExtTextOutWRecord{}
-	r.Record = Record{Type: EMR_EXTTEXTOUTW, Size: size}
+func readPolyDrawRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyDrawRecord{}
+	r.Record = Record{Type: EMR_POLYDRAW, Size: size}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Read(reader, binary.LittleEndian, &r.IGraphicsMode); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Read(reader, binary.LittleEndian, &r.ExScale); err != nil {
+	if err := checkCount(reader, r.Count, 8+1); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Read(reader, binary.LittleEndian, &r.EyScale); err != nil {
+	r.APoints = make([]w32.POINTL, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
 	}
 
-	var err error
-	r.WEmrText, err = readEmrText(reader, reader.Len()+36)
-	if err != nil {
+	r.AbTypes = make([]byte, r.Count)
+	if _, err := io.ReadFull(reader, r.AbTypes); err != nil {
 		return nil, err
 	}
 
 	return r, nil
 }
 
-func (r *ExtTextOutWRecord) Draw(ctx *EmfContext) {
-	log.Trace("Draw EMR_EXTTEXTOUTW ", r.WEmrText.GetString())
-
-	if strings.TrimSpace(r.WEmrText.GetString()) == "" {
-		return
-	}
-
-	//w32.SetGraphicsMode(ctx.MDC, int(r.IGraphicsMode))
+func (r *PolyDrawRecord) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYDRAW")
 
-	hrgn := w32.CreateRectRgn(int(r.Bounds.Left), int(r.Bounds.Top), int(r.Bounds.Right), int(r.Bounds.Bottom))
-	oobj := w32.SelectObject(ctx.MDC, w32.HGDIOBJ(hrgn))
-
-	dx := make([]w32.INT, len(r.WEmrText.OutputDx))
-	for idx := range r.WEmrText.OutputDx {
-		dx[idx] = w32.INT(r.WEmrText.OutputDx[idx])
-	}
+	return ctx.dev.PolyDraw(pointsL(r.APoints), r.AbTypes)
+}
 
-	if !w32.ExtTextOutW(ctx.MDC, int(r.Bounds.Left), int(r.Bounds.Top),
-		w32.UINT(r.WEmrText.Options), &r.WEmrText.Rectangle, r.WEmrText.GetString(), w32.UINT(r.WEmrText.Chars), dx) {
-		log.Error("failed to run ExtTextOutW")
+// pointsL returns the points of a record with 32-bit coordinates.
+func pointsL(ps []w32.POINTL) []w32.POINT {
+	points := make([]w32.POINT, len(ps))
+	for idx := range ps {
+		points[idx] = w32.POINT{X: ps[idx].X, Y: ps[idx].Y}
 	}
-
-	w32.SelectObject(ctx.MDC, oobj)
-
+	return points
 }
 
 type PolyBezier16Record struct {
@@ -1347,6 +2323,10 @@ func readPolyBezier16Record(reader *bytes.Reader, size uint32) (Recorder, error)
 		return nil, err
 	}
 
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
 	r.APoints = make([]PointS, r.Count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
@@ -1355,7 +2335,7 @@ func readPolyBezier16Record(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *PolyBezier16Record) Draw(ctx *EmfContext) {
+func (r *PolyBezier16Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_POLYBEZIER16")
 
 	bezerPoints := make([]w32.POINT, r.Count)
@@ -1366,9 +2346,7 @@ func (r *PolyBezier16Record) Draw(ctx *EmfContext) {
 		}
 	}
 
-	if !w32.PolyBezier(ctx.MDC, bezerPoints, w32.DWORD(r.Count)) {
-		log.Error("failed to run PolyBezier")
-	}
+	return ctx.dev.PolyBezier(bezerPoints)
 }
 
 type Polygon16Record struct {
@@ -1390,6 +2368,10 @@ func readPolygon16Record(reader *bytes.Reader, size uint32) (Recorder, error) {
 		return nil, err
 	}
 
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
 	r.APoints = make([]PointS, r.Count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
@@ -1398,7 +2380,7 @@ func readPolygon16Record(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *Polygon16Record) Draw(ctx *EmfContext) {
+func (r *Polygon16Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_POLYGON16")
 
 	vertexPoints := make([]w32.POINT, r.Count)
@@ -1409,9 +2391,7 @@ func (r *Polygon16Record) Draw(ctx *EmfContext) {
 		}
 	}
 
-	if !w32.Polygon(ctx.MDC, vertexPoints, int(r.Count)) {
-		log.Error("failed to run Polygon")
-	}
+	return ctx.dev.Polygon(vertexPoints)
 }
 
 type PolyLine16Record struct {
@@ -1433,6 +2413,10 @@ func readPolyLine16Record(reader *bytes.Reader, size uint32) (Recorder, error) {
 		return nil, err
 	}
 
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
 	r.APoints = make([]PointS, r.Count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
@@ -1441,7 +2425,7 @@ func readPolyLine16Record(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *PolyLine16Record) Draw(ctx *EmfContext) {
+func (r *PolyLine16Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_POLYLINE16")
 
 	points := make([]w32.POINT, r.Count)
@@ -1452,9 +2436,7 @@ func (r *PolyLine16Record) Draw(ctx *EmfContext) {
 		}
 	}
 
-	if !w32.Polyline(ctx.MDC, points, int(r.Count)) {
-		log.Error("failed to run Polygon")
-	}
+	return ctx.dev.Polyline(points)
 }
 
 type PolyBezierTo16Record struct {
@@ -1476,6 +2458,10 @@ func readPolyBezierTo16Record(reader *bytes.Reader, size uint32) (Recorder, erro
 		return nil, err
 	}
 
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
 	r.APoints = make([]PointS, r.Count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
@@ -1484,7 +2470,7 @@ func readPolyBezierTo16Record(reader *bytes.Reader, size uint32) (Recorder, erro
 	return r, nil
 }
 
-func (r *PolyBezierTo16Record) Draw(ctx *EmfContext) {
+func (r *PolyBezierTo16Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_POLYBEZIERTO16")
 
 	bezerPoints := make([]w32.POINT, r.Count)
@@ -1495,9 +2481,7 @@ func (r *PolyBezierTo16Record) Draw(ctx *EmfContext) {
 		}
 	}
 
-	if !w32.PolyBezierTo(ctx.MDC, bezerPoints, w32.DWORD(r.Count)) {
-		log.Error("failed to run PolyBezier")
-	}
+	return ctx.dev.PolyBezierTo(bezerPoints)
 }
 
 type PolyLineTo16Record struct {
@@ -1519,6 +2503,10 @@ func readPolyLineTo16Record(reader *bytes.Reader, size uint32) (Recorder, error)
 		return nil, err
 	}
 
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
 	r.APoints = make([]PointS, r.Count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
@@ -1527,7 +2515,7 @@ func readPolyLineTo16Record(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *PolyLineTo16Record) Draw(ctx *EmfContext) {
+func (r *PolyLineTo16Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_POLYLINETO16")
 
 	points := make([]w32.POINT, r.Count)
@@ -1538,9 +2526,7 @@ func (r *PolyLineTo16Record) Draw(ctx *EmfContext) {
 		}
 	}
 
-	if !w32.PolylineTo(ctx.MDC, points, w32.DWORD(r.Count)) {
-		log.Error("failed to run Polygon")
-	}
+	return ctx.dev.PolylineTo(points)
 }
 
 type PolyPolygon16Record struct {
@@ -1568,11 +2554,27 @@ func readPolyPolygon16Record(reader *bytes.Reader, size uint32) (Recorder, error
 		return nil, err
 	}
 
+	if err := checkCount(reader, r.NumberOfPolygons, 4); err != nil {
+		return nil, err
+	}
+
 	r.PolygonPointCount = make([]uint32, r.NumberOfPolygons)
 	if err := binary.Read(reader, binary.LittleEndian, &r.PolygonPointCount); err != nil {
 		return nil, err
 	}
 
+	var total uint64
+	for _, n := range r.PolygonPointCount {
+		total += uint64(n)
+	}
+	if total > uint64(r.Count) {
+		return nil, errors.New("polygon point counts exceed the number of points")
+	}
+
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
 	r.APoints = make([]PointS, r.Count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
 		return nil, err
@@ -1581,35 +2583,155 @@ func readPolyPolygon16Record(reader *bytes.Reader, size uint32) (Recorder, error
 	return r, nil
 }
 
-func (r *PolyPolygon16Record) Draw(ctx *EmfContext) {
+func (r *PolyPolygon16Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_POLYPOLYGON16")
 
 	points := make([]w32.POINT, r.Count)
-	asz := make([]int, r.Count)
 	for idx := range r.APoints {
 		points[idx] = w32.POINT{
 			X: int32(r.APoints[idx].X),
 			Y: int32(r.APoints[idx].Y),
 		}
+	}
+
+	asz := make([]int, r.NumberOfPolygons)
+	for idx := range r.PolygonPointCount {
 		asz[idx] = int(r.PolygonPointCount[idx])
 	}
 
-	if !w32.PolyPolygon(ctx.MDC, points, asz, int(r.Count)) {
-		log.Error("failed to run Polygon")
+	return ctx.dev.PolyPolygon(points, asz)
+}
+
+type PolyPolyLine16Record struct {
+	Record
+	Bounds             w32.RECT
+	NumberOfPolylines  uint32
+	Count              uint32
+	PolylinePointCount []uint32
+	APoints            []PointS
+}
+
+func readPolyPolyLine16Record(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyPolyLine16Record{}
+	r.Record = Record{Type: EMR_POLYPOLYLINE16, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.NumberOfPolylines); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.NumberOfPolylines, 4); err != nil {
+		return nil, err
+	}
+
+	r.PolylinePointCount = make([]uint32, r.NumberOfPolylines)
+	if err := binary.Read(reader, binary.LittleEndian, &r.PolylinePointCount); err != nil {
+		return nil, err
+	}
+
+	var total uint64
+	for _, n := range r.PolylinePointCount {
+		total += uint64(n)
+	}
+	if total > uint64(r.Count) {
+		return nil, errors.New("polyline point counts exceed the number of points")
+	}
+
+	if err := checkCount(reader, r.Count, 4); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]PointS, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyPolyLine16Record) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYPOLYLINE16")
+
+	points := make([]w32.POINT, r.Count)
+	for idx := range r.APoints {
+		points[idx] = w32.POINT{
+			X: int32(r.APoints[idx].X),
+			Y: int32(r.APoints[idx].Y),
+		}
+	}
+
+	return polyPolyline(ctx, points, r.PolylinePointCount)
+}
+
+type PolyDraw16Record struct {
+	Record
+	Bounds  w32.RECT
+	Count   uint32
+	APoints []PointS
+	AbTypes []byte
+}
+
+func readPolyDraw16Record(reader *bytes.Reader, size uint32) (Recorder, error) {
+	r := &PolyDraw16Record{}
+	r.Record = Record{Type: EMR_POLYDRAW16, Size: size}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Bounds); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &r.Count); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, r.Count, 4+1); err != nil {
+		return nil, err
+	}
+
+	r.APoints = make([]PointS, r.Count)
+	if err := binary.Read(reader, binary.LittleEndian, &r.APoints); err != nil {
+		return nil, err
+	}
+
+	r.AbTypes = make([]byte, r.Count)
+	if _, err := io.ReadFull(reader, r.AbTypes); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyDraw16Record) Draw(ctx *EmfContext) error {
+	log.Trace("Draw EMR_POLYDRAW16")
+
+	points := make([]w32.POINT, r.Count)
+	for idx := range r.APoints {
+		points[idx] = w32.POINT{
+			X: int32(r.APoints[idx].X),
+			Y: int32(r.APoints[idx].Y),
+		}
 	}
 
+	return ctx.dev.PolyDraw(points, r.AbTypes)
 }
 
 type ExtCreatePenRecord struct {
 	Record
-	IhPen   uint32
-	OffBmi  uint32
-	CbBmi   uint32
-	OffBits uint32
-	CbBits  uint32
-	Elp     w32.LOGPENEX
-	BmiSrc  w32.BITMAPINFOHEADER
-	BitsSrc []byte
+	IhPen     uint32
+	OffBmi    uint32
+	CbBmi     uint32
+	OffBits   uint32
+	CbBits    uint32
+	Elp       w32.LOGPENEX
+	BmiSrc    w32.BITMAPINFOHEADER
+	ColorsSrc []w32.RGBQUAD
+	BitsSrc   []byte
 }
 
 func readExtCreatePenRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
@@ -1648,18 +2770,9 @@ func readExtCreatePenRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 		return r, nil
 	}
 
-	// BitmapBuffer
-
-	reader.Seek(int64(r.OffBmi-52-(r.Elp.NumStyleEntries*4)), os.SEEK_CUR) // skipping UndefinedSpace
-
 	if r.CbBmi > 0 {
-
-		if err := binary.Read(reader, binary.LittleEndian, &r.BmiSrc); err != nil {
-			return nil, err
-		}
-
-		r.BitsSrc = make([]byte, r.CbBits)
-		if _, err := reader.Read(r.BitsSrc); err != nil {
+		r.BmiSrc, r.ColorsSrc, r.BitsSrc, err = readDIB(reader, r.OffBmi, r.CbBmi, r.OffBits, r.CbBits)
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -1667,21 +2780,12 @@ func readExtCreatePenRecord(reader *bytes.Reader, size uint32) (Recorder, error)
 	return r, nil
 }
 
-func (r *ExtCreatePenRecord) Draw(ctx *EmfContext) {
+func (r *ExtCreatePenRecord) Draw(ctx *EmfContext) error {
 	log.Tracef("Draw EMR_EXTCREATEPEN 0x%08x", r.IhPen)
 
-	logbrush := w32.LOGBRUSH{
-		BrushStyle: r.Elp.BrushStyle,
-		Color:      r.Elp.ColorRef,
-		BrushHatch: r.Elp.BrushHatch,
-	}
-
-	styleEntry := make([]w32.DWORD, len(r.Elp.StyleEntry))
-	for idx := range r.Elp.StyleEntry {
-		styleEntry[idx] = w32.DWORD(r.Elp.StyleEntry[idx])
-	}
+	ctx.Objects[r.IhPen] = ctx.dev.ExtCreatePen(r.Elp)
 
-	ctx.Objects[r.IhPen] = w32.ExtCreatePen(w32.DWORD(r.Elp.PenStyle), w32.DWORD(r.Elp.Width), &logbrush, w32.DWORD(r.Elp.NumStyleEntries), styleEntry)
+	return nil
 }
 
 type SetICMMmodeRecord struct {
@@ -1700,8 +2804,9 @@ func readSetICMModeRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetICMMmodeRecord) Draw(ctx *EmfContext) {
+func (r *SetICMMmodeRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETICMMODE")
+	return nil
 }
 
 type SetBrushOrgExRecord struct {
@@ -1720,12 +2825,10 @@ func readSetBrushOrgExRecord(reader *bytes.Reader, size uint32) (Recorder, error
 	return r, nil
 }
 
-func (r *SetBrushOrgExRecord) Draw(ctx *EmfContext) {
+func (r *SetBrushOrgExRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETBRUSHORGEX")
 
-	if !w32.SetBrushOrgEx(ctx.MDC, int(r.Origin.X), int(r.Origin.Y), nil) {
-		log.Error("failed to run SetBrushOrgEx")
-	}
+	return ctx.dev.SetBrushOrgEx(int(r.Origin.X), int(r.Origin.Y))
 }
 
 type SetPixelvRecord struct {
@@ -1749,12 +2852,10 @@ func readSetPixelvRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetPixelvRecord) Draw(ctx *EmfContext) {
+func (r *SetPixelvRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETPIXELV")
 
-	if !w32.SetPixelV(ctx.MDC, int(r.Pixel.X), int(r.Pixel.Y), r.Color.ColorRef()) {
-		log.Error("failed to run SetPixelV")
-	}
+	return ctx.dev.SetPixelV(int(r.Pixel.X), int(r.Pixel.Y), r.Color.ColorRef())
 }
 
 type SetMapperFlagsRecord struct {
@@ -1773,12 +2874,10 @@ func readSetMapperFlagsRecord(reader *bytes.Reader, size uint32) (Recorder, erro
 	return r, nil
 }
 
-func (r *SetMapperFlagsRecord) Draw(ctx *EmfContext) {
+func (r *SetMapperFlagsRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETMAPPERFLAGS")
 
-	if w32.SetMapperFlags(ctx.MDC, w32.DWORD(r.Flags)) == w32.GDI_ERROR {
-		log.Error("failed to run SetMapperFlags")
-	}
+	return ctx.dev.SetMapperFlags(r.Flags)
 }
 
 type SetROP2Record struct {
@@ -1797,12 +2896,10 @@ func readSetROP2Record(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetROP2Record) Draw(ctx *EmfContext) {
+func (r *SetROP2Record) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETROP2")
 
-	if w32.SetROP2(ctx.MDC, int(r.ROP2Mode)) == 0 {
-		log.Error("failed to run SetROP2")
-	}
+	return ctx.dev.SetROP2(int(r.ROP2Mode))
 }
 
 type SetMiterLimitRecord struct {
@@ -1821,17 +2918,10 @@ func readSetMiterLimitRecord(reader *bytes.Reader, size uint32) (Recorder, error
 	return r, nil
 }
 
-func (r *SetMiterLimitRecord) Draw(ctx *EmfContext) {
+func (r *SetMiterLimitRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETMITERLIMIT ", r.MiterLimit)
 
-	/* FIXME
-
-	var old float32
-
-	if !w32.SetMiterLimit(ctx.MDC, float32(r.MiterLimit), &old) {
-		log.Error("failed to run SetMiterLimit")
-	}
-	*/
+	return ctx.dev.SetMiterLimit(float32(r.MiterLimit))
 }
 
 type ExtSelectClipRgnRecord struct {
@@ -1841,12 +2931,22 @@ type ExtSelectClipRgnRecord struct {
 	RgnData     RegionData
 }
 
-func readRegionData(reader *bytes.Reader) (RegionData, error) {
+// readRegionData reads a region of size bytes, whose rectangles must fit in
+// it.
+func readRegionData(reader *bytes.Reader, size uint32) (RegionData, error) {
 	r := RegionData{}
 	if err := binary.Read(reader, binary.LittleEndian, &r.RegionDataHeader); err != nil {
 		return r, err
 	}
 
+	if uint64(r.CountRects)*16+32 > uint64(size) {
+		return r, errors.New("region rectangles exceed region size")
+	}
+
+	if err := checkCount(reader, r.RegionDataHeader.CountRects, 16); err != nil {
+		return r, err
+	}
+
 	r.Data = make([]w32.RECT, r.RegionDataHeader.CountRects)
 	if err := binary.Read(reader, binary.LittleEndian, &r.Data); err != nil {
 		return r, err
@@ -1867,37 +2967,29 @@ func readExtSelectClipRgnRecord(reader *bytes.Reader, size uint32) (Recorder, er
 		return nil, err
 	}
 
-	if r.RegionMode != RGN_COPY {
+	// RGN_COPY without data selects the default clipping region
+	if r.RgnDataSize > 0 {
 
 		var err error
-		r.RgnData, err = readRegionData(reader)
+		r.RgnData, err = readRegionData(reader, r.RgnDataSize)
 		if err != nil {
 			return nil, err
 		}
 
-	} else {
-		reader.Seek(int64(size-16), os.SEEK_CUR) // skip
 	}
 
 	return r, nil
 }
 
-func (r *ExtSelectClipRgnRecord) Draw(ctx *EmfContext) {
+func (r *ExtSelectClipRgnRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_EXTSELECTCLIPRGN")
 
-	if r.RegionMode == RGN_COPY {
-		if w32.ExtSelectClipRgn(ctx.MDC, 0, RGN_COPY) == 0 { // default cliping region = null region
-			log.Error("failed to run ExtSelectClipRgn")
-		}
-	} else {
-		for _, rect := range r.RgnData.Data {
-			hrgn := w32.CreateRectRgn(int(rect.Left), int(rect.Top), int(rect.Right), int(rect.Bottom))
-
-			if w32.ExtSelectClipRgn(ctx.MDC, hrgn, int(r.RegionMode)) == 0 {
-				log.Error("failed to run ExtSelectClipRgn")
-			}
-		}
+	rects, err := ctx.region(r.RgnData)
+	if err != nil {
+		return err
 	}
+
+	return ctx.dev.ExtSelectClipRgn(rects, int(r.RegionMode))
 }
 
 type SetLayoutRecord struct {
@@ -1916,6 +3008,7 @@ func readSetLayoutRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *SetLayoutRecord) Draw(ctx *EmfContext) {
+func (r *SetLayoutRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETLAYOUT")
+	return nil
 }
@@ -3,7 +3,7 @@ package emf
 import (
 	"bytes"
 	"encoding/binary"
-	"os"
+	"errors"
 
 	"github.com/lokks307/go-emf/w32"
 	log "github.com/sirupsen/logrus"
@@ -27,10 +27,72 @@ type CommonBitmapInfo struct {
 	CbBitsSrc  uint32
 }
 
+// readBitmapColors reads the rest of a BITMAPINFO after its header. For
+// BI_BITFIELDS the three color masks come first, otherwise the color table.
+func readBitmapColors(reader *bytes.Reader, bmi w32.BITMAPINFOHEADER, cbBmi uint32) ([]w32.RGBQUAD, error) {
+	if cbBmi <= 40 {
+		return nil, nil
+	}
+
+	if err := checkCount(reader, (cbBmi-40)/4, 4); err != nil {
+		return nil, err
+	}
+
+	entries := make([]w32.RGBQUAD, (cbBmi-40)/4)
+	if err := binary.Read(reader, binary.LittleEndian, &entries); err != nil {
+		return nil, err
+	}
+
+	// BITMAPV4HEADER and BITMAPV5HEADER keep the masks right after the
+	// BITMAPINFOHEADER fields
+	if bmi.BiSize > 40 && bmi.BiCompression != BI_BITFIELDS {
+		skip := int(bmi.BiSize-40) / 4
+		if skip > len(entries) {
+			skip = len(entries)
+		}
+		entries = entries[skip:]
+	}
+
+	return entries, nil
+}
+
+// readDIB reads the bitmap of a record, the BITMAPINFO at offBmi and the
+// bits at offBits. The offsets are from the start of the record.
+func readDIB(reader *bytes.Reader, offBmi, cbBmi, offBits, cbBits uint32) (w32.BITMAPINFOHEADER, []w32.RGBQUAD, []byte, error) {
+	var bmi w32.BITMAPINFOHEADER
+
+	if cbBmi < 40 {
+		return bmi, nil, nil, errors.New("invalid bitmap header size")
+	}
+
+	info, err := recordBytes(reader, offBmi, cbBmi)
+	if err != nil {
+		return bmi, nil, nil, err
+	}
+
+	infoReader := bytes.NewReader(info)
+	if err := binary.Read(infoReader, binary.LittleEndian, &bmi); err != nil {
+		return bmi, nil, nil, err
+	}
+
+	colors, err := readBitmapColors(infoReader, bmi, cbBmi)
+	if err != nil {
+		return bmi, nil, nil, err
+	}
+
+	bits, err := recordBytes(reader, offBits, cbBits)
+	if err != nil {
+		return bmi, nil, nil, err
+	}
+
+	return bmi, colors, bits, nil
+}
+
 type BitBltRecord struct {
 	Record           // 8 bytes
 	CommonBitmapInfo // 92 bytes
 	BmiSrc           w32.BITMAPINFO
+	ColorsSrc        []w32.RGBQUAD
 	BitsSrc          []byte
 }
 
@@ -39,60 +101,30 @@ func readBitBltRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	r.Record = Record{Type: EMR_BITBLT, Size: size}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.CommonBitmapInfo); err != nil {
-		return r, err
+		return nil, err
 	}
 
-	// BitmapBuffer
-
 	if r.OffBmiSrc > 0 {
-
-		sizeUndefinedSpace1 := r.OffBmiSrc - 100
-		if sizeUndefinedSpace1 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace1), os.SEEK_CUR) // skipping UndefinedSpace1
-		}
-
-		if err := binary.Read(reader, binary.LittleEndian, &r.BmiSrc.BITMAPINFOHEADER); err != nil {
-			return nil, err
-		}
-
-		sizeUndefinedSpace2 := r.OffBitsSrc - r.OffBmiSrc - r.CbBmiSrc
-		if sizeUndefinedSpace2 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace2), os.SEEK_CUR) // skipping UndefinedSpace2
-		}
-
-		r.BitsSrc = make([]byte, r.CbBitsSrc)
-		if _, err := reader.Read(r.BitsSrc); err != nil {
+		var err error
+		r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc, err = readDIB(reader, r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc)
+		if err != nil {
 			return nil, err
 		}
-
 	}
 
 	return r, nil
 }
 
-func (r *BitBltRecord) Draw(ctx *EmfContext) {
+func (r *BitBltRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_BITBLT")
 
-	if r.OffBmiSrc > 0 {
-
-		BitsData := PixelConvert(r.BitsSrc, int(r.BmiSrc.BiWidth), int(-r.BmiSrc.BiHeight), int(r.BmiSrc.BiBitCount), ctx.BitCount)
-		r.BmiSrc.BiBitCount = uint16(ctx.BitCount)
-
-		hbitmap := w32.CreateBitmap(int(r.XSrc), int(r.YSrc), w32.UINT(r.BmiSrc.BiPlanes), w32.UINT(r.BmiSrc.BiBitCount), BitsData)
-		srcDC := w32.CreateCompatibleDC(ctx.MDC)
-		w32.SelectObject(srcDC, w32.HGDIOBJ(hbitmap))
-
-		if !w32.BitBlt(
-			ctx.MDC, int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
-			srcDC, int(r.XSrc), int(r.YSrc), // src
-			w32.DWORD(r.BitBltROP)) {
-			log.Error("failed to run BitBlt")
-		}
-
-		w32.DeleteObject(w32.HGDIOBJ(hbitmap))
-		w32.DeleteDC(srcDC)
-
+	src, err := ctx.bitmap(r.BmiSrc, r.ColorsSrc, r.BitsSrc)
+	if err != nil {
+		return err
 	}
+
+	return ctx.dev.BitBlt(int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest),
+		src, int(r.XSrc), int(r.YSrc), r.BitBltROP)
 }
 
 type MaskAdditionInfo struct {
@@ -110,8 +142,10 @@ type MaskBltRecord struct {
 	CommonBitmapInfo // 92 bytes
 	MaskAdditionInfo // 28 bytes
 	BmiSrc           w32.BITMAPINFO
+	ColorsSrc        []w32.RGBQUAD
 	BitsSrc          []byte
 	BmiMask          w32.BITMAPINFO
+	ColorsMask       []w32.RGBQUAD
 	BitsMask         []byte
 }
 
@@ -120,79 +154,46 @@ func readMaskBltRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	r.Record = Record{Type: EMR_MASKBLT, Size: size}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.CommonBitmapInfo); err != nil {
-		return r, err
-	}
-
-	if err := binary.Read(reader, binary.LittleEndian, &r.MaskAdditionInfo); err != nil {
-		return r, err
-	}
-
-	// BitmapBuffer
-
-	sizeUndefinedSpace1 := r.OffBmiSrc - 128
-	if sizeUndefinedSpace1 > 0 {
-		reader.Seek(int64(sizeUndefinedSpace1), os.SEEK_CUR) // skipping UndefinedSpace1
-	}
-
-	if err := binary.Read(reader, binary.LittleEndian, &r.BmiSrc.BITMAPINFOHEADER); err != nil {
 		return nil, err
 	}
 
-	sizeUndefinedSpace2 := r.OffBitsSrc - r.OffBmiSrc - r.CbBmiSrc
-	if sizeUndefinedSpace2 > 0 {
-		reader.Seek(int64(sizeUndefinedSpace2), os.SEEK_CUR) // skipping UndefinedSpace2
-	}
-
-	r.BitsSrc = make([]byte, r.CbBitsSrc)
-	if _, err := reader.Read(r.BitsSrc); err != nil {
+	if err := binary.Read(reader, binary.LittleEndian, &r.MaskAdditionInfo); err != nil {
 		return nil, err
 	}
 
-	sizeUndefinedSpace3 := r.OffBmiMask - r.OffBitsSrc - r.CbBitsSrc
-	if sizeUndefinedSpace3 > 0 {
-		reader.Seek(int64(sizeUndefinedSpace3), os.SEEK_CUR) // skipping UndefinedSpace1
-	}
-
-	if err := binary.Read(reader, binary.LittleEndian, &r.BmiMask.BITMAPINFOHEADER); err != nil {
+	var err error
+	r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc, err = readDIB(reader, r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc)
+	if err != nil {
 		return nil, err
 	}
 
-	sizeUndefinedSpace4 := r.OffBitsMask - r.OffBmiMask - r.CbBitsMask
-	if sizeUndefinedSpace4 > 0 {
-		reader.Seek(int64(sizeUndefinedSpace4), os.SEEK_CUR) // skipping UndefinedSpace1
-	}
-
-	r.BitsMask = make([]byte, r.CbBitsMask)
-	if _, err := reader.Read(r.BitsMask); err != nil {
-		return nil, err
+	// the mask is optional
+	if r.OffBmiMask > 0 {
+		r.BmiMask.BITMAPINFOHEADER, r.ColorsMask, r.BitsMask, err = readDIB(reader, r.OffBmiMask, r.CbBmiMask, r.OffBitsMask, r.CbBitsMask)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return r, nil
 }
 
-func (r *MaskBltRecord) Draw(ctx *EmfContext) {
+func (r *MaskBltRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_MASKBLT")
 
-	BitsData := PixelConvert(r.BitsSrc, int(r.BmiSrc.BiWidth), int(-r.BmiSrc.BiHeight), int(r.BmiSrc.BiBitCount), ctx.BitCount)
-	r.BmiSrc.BiBitCount = uint16(ctx.BitCount)
-
-	hbitmap := w32.CreateBitmap(int(r.XSrc), int(r.YSrc), w32.UINT(r.BmiSrc.BiPlanes), w32.UINT(r.BmiSrc.BiBitCount), BitsData)
-	srcDC := w32.CreateCompatibleDC(ctx.MDC)
-	w32.SelectObject(srcDC, w32.HGDIOBJ(hbitmap))
-
-	maskBitmap := w32.CreateBitmap(int(r.BmiMask.BiWidth), int(-r.BmiMask.BiHeight), w32.UINT(r.BmiMask.BiPlanes), w32.UINT(r.BmiMask.BiBitCount), r.BitsMask)
-
-	if !w32.MaskBlt(
-		ctx.MDC, int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
-		srcDC, int(r.XSrc), int(r.YSrc), // src
-		maskBitmap, int(r.XMask), int(r.YMask), // mask
-		w32.DWORD(r.BitBltROP)) {
-		log.Error("failed to run MaskBlt")
+	src, err := ctx.bitmap(r.BmiSrc, r.ColorsSrc, r.BitsSrc)
+	if err != nil {
+		return err
+	}
+	mask, err := ctx.bitmap(r.BmiMask, r.ColorsMask, r.BitsMask)
+	if err != nil {
+		return err
 	}
 
-	w32.DeleteObject(w32.HGDIOBJ(hbitmap))
-	w32.DeleteDC(srcDC)
-
+	return ctx.dev.MaskBlt(int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
+		src, int(r.XSrc), int(r.YSrc), // src
+		mask, int(r.XMask), int(r.YMask), // mask
+		r.BitBltROP)
 }
 
 type StretchbltRecord struct {
@@ -201,6 +202,7 @@ type StretchbltRecord struct {
 	CxSrc            int32
 	CySrc            int32
 	BmiSrc           w32.BITMAPINFO
+	ColorsSrc        []w32.RGBQUAD
 	BitsSrc          []byte
 }
 
@@ -209,37 +211,21 @@ func readStretchBltRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	r.Record = Record{Type: EMR_STRETCHBLT, Size: size}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.CommonBitmapInfo); err != nil {
-		return r, err
+		return nil, err
 	}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.CxSrc); err != nil {
-		return r, err
+		return nil, err
 	}
 
 	if err := binary.Read(reader, binary.LittleEndian, &r.CySrc); err != nil {
-		return r, err
+		return nil, err
 	}
 
-	// BitmapBuffer
-
 	if r.OffBmiSrc > 0 {
-
-		sizeUndefinedSpace1 := r.OffBmiSrc - 108
-		if sizeUndefinedSpace1 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace1), os.SEEK_CUR) // skipping UndefinedSpace1
-		}
-
-		if err := binary.Read(reader, binary.LittleEndian, &r.BmiSrc.BITMAPINFOHEADER); err != nil {
-			return nil, err
-		}
-
-		sizeUndefinedSpace2 := r.OffBitsSrc - r.OffBmiSrc - r.CbBmiSrc
-		if sizeUndefinedSpace2 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace2), os.SEEK_CUR) // skipping UndefinedSpace2
-		}
-
-		r.BitsSrc = make([]byte, r.CbBitsSrc)
-		if _, err := reader.Read(r.BitsSrc); err != nil {
+		var err error
+		r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc, err = readDIB(reader, r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc)
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -247,28 +233,17 @@ func readStretchBltRecord(reader *bytes.Reader, size uint32) (Recorder, error) {
 	return r, nil
 }
 
-func (r *StretchbltRecord) Draw(ctx *EmfContext) {
+func (r *StretchbltRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_STRETCHBLT")
 
-	if r.OffBmiSrc > 0 {
-
-		BitsData := PixelConvert(r.BitsSrc, int(r.BmiSrc.BiWidth), int(-r.BmiSrc.BiHeight), int(r.BmiSrc.BiBitCount), ctx.BitCount)
-		r.BmiSrc.BiBitCount = uint16(ctx.BitCount)
-
-		hbitmap := w32.CreateBitmap(int(r.XSrc), int(r.YSrc), w32.UINT(r.BmiSrc.BiPlanes), w32.UINT(r.BmiSrc.BiBitCount), BitsData)
-		srcDC := w32.CreateCompatibleDC(ctx.MDC)
-		w32.SelectObject(srcDC, w32.HGDIOBJ(hbitmap))
-
-		if !w32.StretchBlt(
-			ctx.MDC, int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
-			srcDC, int(r.XSrc), int(r.YSrc), int(r.CxSrc), int(r.CySrc), // src
-			w32.DWORD(r.BitBltROP)) {
-			log.Error("failed to run StretchBlt")
-		}
-
-		w32.DeleteObject(w32.HGDIOBJ(hbitmap))
-		w32.DeleteDC(srcDC)
+	src, err := ctx.bitmap(r.BmiSrc, r.ColorsSrc, r.BitsSrc)
+	if err != nil {
+		return err
 	}
+
+	return ctx.dev.StretchBlt(int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
+		src, int(r.XSrc), int(r.YSrc), int(r.CxSrc), int(r.CySrc), // src
+		r.BitBltROP)
 }
 
 type StretchDIBitsInfo struct {
@@ -292,6 +267,7 @@ type StretchDIBitsRecord struct {
 	Record            // 8 bytes
 	StretchDIBitsInfo // 72 bytes
 	BmiSrc            w32.BITMAPINFO
+	ColorsSrc         []w32.RGBQUAD
 	BitsSrc           []byte
 }
 
@@ -304,46 +280,27 @@ func readStretchDIBitsRecord(reader *bytes.Reader, size uint32) (Recorder, error
 	}
 
 	if r.OffBmiSrc > 0 {
-
-		sizeUndefinedSpace1 := r.OffBmiSrc - 80
-		if sizeUndefinedSpace1 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace1), os.SEEK_CUR) // skipping UndefinedSpace1
-		}
-
-		if err := binary.Read(reader, binary.LittleEndian, &r.BmiSrc.BITMAPINFOHEADER); err != nil {
-			return nil, err
-		}
-
-		sizeUndefinedSpace2 := r.OffBitsSrc - r.OffBmiSrc - r.CbBmiSrc
-		if sizeUndefinedSpace2 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace2), os.SEEK_CUR) // skipping UndefinedSpace2
-		}
-
-		r.BitsSrc = make([]byte, r.CbBitsSrc)
-		if _, err := reader.Read(r.BitsSrc); err != nil {
+		var err error
+		r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc, err = readDIB(reader, r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc)
+		if err != nil {
 			return nil, err
 		}
-
 	}
 
 	return r, nil
 }
 
-func (r *StretchDIBitsRecord) Draw(ctx *EmfContext) {
+func (r *StretchDIBitsRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_STRETCHDIBITS")
 
-	if r.OffBmiSrc > 0 {
-
-		BitsData := PixelConvert(r.BitsSrc, int(r.BmiSrc.BiWidth), int(-r.BmiSrc.BiHeight), int(r.BmiSrc.BiBitCount), ctx.BitCount)
-		r.BmiSrc.BiBitCount = uint16(ctx.BitCount)
-
-		if w32.StretchDIBits(
-			ctx.MDC, int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
-			int(r.XSrc), int(r.YSrc), int(r.CxSrc), int(r.CySrc), BitsData, &r.BmiSrc, // src
-			w32.UINT(r.UsageSrc), w32.DWORD(r.BitBltROP)) == 0 {
-			log.Error("failed to run StretchDIBits")
-		}
+	src, err := ctx.bitmap(r.BmiSrc, r.ColorsSrc, r.BitsSrc)
+	if err != nil {
+		return err
 	}
+
+	return ctx.dev.StretchDIBits(int(r.XDest), int(r.YDest), int(r.CxDest), int(r.CyDest), // dest
+		src, int(r.XSrc), int(r.YSrc), int(r.CxSrc), int(r.CySrc), // src
+		r.UsageSrc, r.BitBltROP)
 }
 
 type SetDIBitsToDeviceInfo struct {
@@ -367,6 +324,7 @@ type SetDIBitsToDeviceRecord struct {
 	Record                // 8 bytes
 	SetDIBitsToDeviceInfo // 68 bytes
 	BmiSrc                w32.BITMAPINFO
+	ColorsSrc             []w32.RGBQUAD
 	BitsSrc               []byte
 }
 
@@ -379,44 +337,25 @@ func readSetDIBitsToDeviceRecord(reader *bytes.Reader, size uint32) (Recorder, e
 	}
 
 	if r.OffBmiSrc > 0 {
-
-		sizeUndefinedSpace1 := r.OffBmiSrc - 76
-		if sizeUndefinedSpace1 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace1), os.SEEK_CUR) // skipping UndefinedSpace1
-		}
-
-		if err := binary.Read(reader, binary.LittleEndian, &r.BmiSrc.BITMAPINFOHEADER); err != nil {
-			return nil, err
-		}
-
-		sizeUndefinedSpace2 := r.OffBitsSrc - r.OffBmiSrc - r.CbBmiSrc
-		if sizeUndefinedSpace2 > 0 {
-			reader.Seek(int64(sizeUndefinedSpace2), os.SEEK_CUR) // skipping UndefinedSpace2
-		}
-
-		r.BitsSrc = make([]byte, r.CbBitsSrc)
-		if _, err := reader.Read(r.BitsSrc); err != nil {
+		var err error
+		r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc, err = readDIB(reader, r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc)
+		if err != nil {
 			return nil, err
 		}
-
 	}
 
 	return r, nil
 }
 
-func (r *SetDIBitsToDeviceRecord) Draw(ctx *EmfContext) {
+func (r *SetDIBitsToDeviceRecord) Draw(ctx *EmfContext) error {
 	log.Trace("Draw EMR_SETDIBITSTODEVICE")
 
-	if r.OffBmiSrc > 0 {
-
-		BitsData := PixelConvert(r.BitsSrc, int(r.BmiSrc.BiWidth), int(-r.BmiSrc.BiHeight), int(r.BmiSrc.BiBitCount), ctx.BitCount)
-		r.BmiSrc.BiBitCount = uint16(ctx.BitCount)
-
-		if w32.SetDIBitsToDevice(
-			ctx.MDC, int(r.XDest), int(r.YDest), w32.DWORD(r.CxSrc), w32.DWORD(r.CySrc), // dest
-			int(r.XSrc), int(r.YSrc), w32.UINT(r.IStartScan), w32.UINT(r.CScans), BitsData, &r.BmiSrc, // src
-			w32.UINT(r.UsageSrc)) == 0 {
-			log.Error("failed to run SetDIBitsToDevice")
-		}
+	src, err := ctx.bitmap(r.BmiSrc, r.ColorsSrc, r.BitsSrc)
+	if err != nil {
+		return err
 	}
+
+	return ctx.dev.SetDIBitsToDevice(int(r.XDest), int(r.YDest), int(r.CxSrc), int(r.CySrc), // dest
+		src, int(r.XSrc), int(r.YSrc), int(r.IStartScan), int(r.CScans), // src
+		r.UsageSrc)
 }
@@ -0,0 +1,332 @@
+package emf
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// Region is an area made of rectangles, which combines as the regions of
+// GDI. The rectangles never overlap and are sorted in bands of equal top
+// and bottom, from top to bottom and from left to right within a band. The
+// right and bottom edges are excluded.
+type Region struct {
+	Rects []w32.RECT
+}
+
+// NewRegion returns the union of the rectangles, which may overlap or be
+// given with swapped edges. Empty rectangles are ignored.
+func NewRegion(rects ...w32.RECT) *Region {
+	r, _ := newRegion(nil, rects...)
+	return r
+}
+
+// newRegion returns the union of the rectangles, or ErrLimit once the
+// region or one of the halves merged into it has more rectangles than the
+// limits allow. Staggered rectangles make far more of them than are given.
+func newRegion(limits *Limits, rects ...w32.RECT) (*Region, error) {
+	// the halves are banded before they are merged, so that a band is
+	// crossed by no more rectangles than the region has in it
+	if len(rects) > 8 {
+		half := len(rects) / 2
+		a, err := newRegion(limits, rects[:half]...)
+		if err != nil {
+			return nil, err
+		}
+		b, err := newRegion(limits, rects[half:]...)
+		if err != nil {
+			return nil, err
+		}
+		return a.combineWithin(b, func(a, b bool) bool { return a || b }, limits)
+	}
+
+	out, err := combineRects(rects, nil, func(a, b bool) bool { return a }, limits)
+	if err != nil {
+		return nil, err
+	}
+	return &Region{Rects: out}, nil
+}
+
+// Empty reports whether the region has no area.
+func (r *Region) Empty() bool {
+	return r == nil || len(r.Rects) == 0
+}
+
+// Bounds returns the smallest rectangle which contains the region.
+func (r *Region) Bounds() w32.RECT {
+	if r.Empty() {
+		return w32.RECT{}
+	}
+
+	// the first band is the top one and the last band the bottom one
+	b := r.Rects[0]
+	b.Bottom = r.Rects[len(r.Rects)-1].Bottom
+	for _, rc := range r.Rects[1:] {
+		if rc.Left < b.Left {
+			b.Left = rc.Left
+		}
+		if rc.Right > b.Right {
+			b.Right = rc.Right
+		}
+	}
+	return b
+}
+
+// Union returns the area in r or o.
+func (r *Region) Union(o *Region) *Region {
+	return r.combine(o, func(a, b bool) bool { return a || b })
+}
+
+// Intersect returns the area in both r and o.
+func (r *Region) Intersect(o *Region) *Region {
+	return r.combine(o, func(a, b bool) bool { return a && b })
+}
+
+// Xor returns the area in r or o but not in both.
+func (r *Region) Xor(o *Region) *Region {
+	return r.combine(o, func(a, b bool) bool { return a != b })
+}
+
+// Diff returns the area in r which is not in o.
+func (r *Region) Diff(o *Region) *Region {
+	return r.combine(o, func(a, b bool) bool { return a && !b })
+}
+
+// Combine combines r with o by an RGN_* region mode. RGN_COPY returns o.
+func (r *Region) Combine(o *Region, mode int) (*Region, error) {
+	return r.combineMode(o, mode, nil)
+}
+
+// combineMode is Combine failing with ErrLimit when the result has more
+// rectangles than the limits allow.
+func (r *Region) combineMode(o *Region, mode int, limits *Limits) (*Region, error) {
+	switch mode {
+	case RGN_AND:
+		return r.combineWithin(o, func(a, b bool) bool { return a && b }, limits)
+	case RGN_OR:
+		return r.combineWithin(o, func(a, b bool) bool { return a || b }, limits)
+	case RGN_XOR:
+		return r.combineWithin(o, func(a, b bool) bool { return a != b }, limits)
+	case RGN_DIFF:
+		return r.combineWithin(o, func(a, b bool) bool { return a && !b }, limits)
+	case RGN_COPY:
+		return o.combineWithin(nil, func(a, b bool) bool { return a }, limits)
+	}
+	return nil, errors.New("invalid region mode")
+}
+
+// Offset returns the region moved by dx, dy.
+func (r *Region) Offset(dx, dy int32) *Region {
+	out := &Region{}
+	if r.Empty() {
+		return out
+	}
+
+	out.Rects = make([]w32.RECT, len(r.Rects))
+	for i, rc := range r.Rects {
+		out.Rects[i] = w32.RECT{Left: rc.Left + dx, Top: rc.Top + dy, Right: rc.Right + dx, Bottom: rc.Bottom + dy}
+	}
+	return out
+}
+
+// Frame returns the border of the region, width wide on the left and right
+// edges and height high on the top and bottom edges, as drawn by FrameRgn.
+// The border is the part of the region within width and height of a point
+// outside of it, which is the outside grown by width and height.
+func (r *Region) Frame(width, height int32) *Region {
+	f, _ := r.frame(width, height, nil)
+	return f
+}
+
+// frame is Frame failing with ErrLimit when the grown outside or the border
+// has more rectangles than the limits allow.
+func (r *Region) frame(width, height int32, limits *Limits) (*Region, error) {
+	if width < 0 {
+		width = -width
+	}
+	if height < 0 {
+		height = -height
+	}
+
+	if r.Empty() {
+		return &Region{}, nil
+	}
+
+	// the points next to the bounds are as near as those farther out
+	b := r.Bounds()
+	bounds := &Region{Rects: []w32.RECT{{Left: b.Left - 1, Top: b.Top - 1, Right: b.Right + 1, Bottom: b.Bottom + 1}}}
+	outside, err := bounds.combineWithin(r, func(a, b bool) bool { return a && !b }, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	grown := make([]w32.RECT, len(outside.Rects))
+	for i, rc := range outside.Rects {
+		grown[i] = w32.RECT{Left: rc.Left - width, Top: rc.Top - height, Right: rc.Right + width, Bottom: rc.Bottom + height}
+	}
+
+	near, err := newRegion(limits, grown...)
+	if err != nil {
+		return nil, err
+	}
+	return r.combineWithin(near, func(a, b bool) bool { return a && b }, limits)
+}
+
+func (r *Region) combine(o *Region, op func(a, b bool) bool) *Region {
+	rgn, _ := r.combineWithin(o, op, nil)
+	return rgn
+}
+
+// combineWithin is combine failing with ErrLimit when the result has more
+// rectangles than the limits allow.
+func (r *Region) combineWithin(o *Region, op func(a, b bool) bool, limits *Limits) (*Region, error) {
+	var a, b []w32.RECT
+	if r != nil {
+		a = r.Rects
+	}
+	if o != nil {
+		b = o.Rects
+	}
+
+	out, err := combineRects(a, b, op, limits)
+	if err != nil {
+		return nil, err
+	}
+	return &Region{Rects: out}, nil
+}
+
+// combineRects returns the banded rectangles of the area where op is true
+// for the coverage of a and b. The bands between two successive edges are
+// swept from top to bottom, with only the rectangles which cross a band, and
+// from left to right within the band. The sweep stops with ErrLimit once
+// it has made more rectangles than the limits allow.
+func combineRects(a, b []w32.RECT, op func(a, b bool) bool, limits *Limits) ([]w32.RECT, error) {
+	type rect struct {
+		w32.RECT
+		inA bool
+	}
+	type edge struct {
+		x      int32
+		da, db int
+	}
+
+	var rects []rect
+	var ys []int32
+	for _, in := range []struct {
+		rects []w32.RECT
+		inA   bool
+	}{{a, true}, {b, false}} {
+		for _, rc := range in.rects {
+			if rc.Left > rc.Right {
+				rc.Left, rc.Right = rc.Right, rc.Left
+			}
+			if rc.Top > rc.Bottom {
+				rc.Top, rc.Bottom = rc.Bottom, rc.Top
+			}
+			if rc.Left < rc.Right && rc.Top < rc.Bottom {
+				rects = append(rects, rect{rc, in.inA})
+				ys = append(ys, rc.Top, rc.Bottom)
+			}
+		}
+	}
+	sort.Slice(rects, func(i, j int) bool { return rects[i].Top < rects[j].Top })
+	sort.Slice(ys, func(i, j int) bool { return ys[i] < ys[j] })
+
+	var out bandBuilder
+	var active []rect
+	var edges []edge
+	var spans []int32
+	next := 0
+	for i := 0; i+1 < len(ys); i++ {
+		top, bottom := ys[i], ys[i+1]
+		if top == bottom {
+			continue
+		}
+
+		// the rectangles ending above the band leave, those starting at
+		// its top enter, and all of them cross the whole band
+		kept := active[:0]
+		for _, rc := range active {
+			if rc.Bottom > top {
+				kept = append(kept, rc)
+			}
+		}
+		active = kept
+		for ; next < len(rects) && rects[next].Top <= top; next++ {
+			active = append(active, rects[next])
+		}
+
+		edges = edges[:0]
+		for _, rc := range active {
+			if rc.inA {
+				edges = append(edges, edge{rc.Left, 1, 0}, edge{rc.Right, -1, 0})
+			} else {
+				edges = append(edges, edge{rc.Left, 0, 1}, edge{rc.Right, 0, -1})
+			}
+		}
+		sort.Slice(edges, func(i, j int) bool { return edges[i].x < edges[j].x })
+
+		spans = spans[:0]
+		inA, inB, inside := 0, 0, false
+		for j := 0; j < len(edges); {
+			x := edges[j].x
+			for ; j < len(edges) && edges[j].x == x; j++ {
+				inA += edges[j].da
+				inB += edges[j].db
+			}
+
+			if in := op(inA > 0, inB > 0); in != inside {
+				spans = append(spans, x)
+				inside = in
+			}
+		}
+
+		out.add(top, bottom, spans)
+		if err := limits.checkRects(len(out.rects)); err != nil {
+			return nil, err
+		}
+	}
+
+	return out.rects, nil
+}
+
+// bandBuilder collects the bands of a region from top to bottom, a band
+// which continues the one above it with the same spans extends it.
+type bandBuilder struct {
+	rects []w32.RECT
+	prev  []int32 // spans of the last band, as left and right pairs
+	start int     // index of the first rectangle of the last band
+}
+
+func (b *bandBuilder) add(top, bottom int32, spans []int32) {
+	if len(spans) == 0 {
+		b.prev = nil
+		return
+	}
+
+	if b.prev != nil && b.rects[len(b.rects)-1].Bottom == top && equalSpans(b.prev, spans) {
+		for k := b.start; k < len(b.rects); k++ {
+			b.rects[k].Bottom = bottom
+		}
+		return
+	}
+
+	b.start = len(b.rects)
+	for k := 0; k+1 < len(spans); k += 2 {
+		b.rects = append(b.rects, w32.RECT{Left: spans[k], Top: top, Right: spans[k+1], Bottom: bottom})
+	}
+	b.prev = append(b.prev[:0], spans...)
+}
+
+func equalSpans(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+package emf
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+func rect(left, top, right, bottom int32) w32.RECT {
+	return w32.RECT{Left: left, Top: top, Right: right, Bottom: bottom}
+}
+
+// sameRects compares the rectangles of two regions, nil and empty are the
+// same.
+func sameRects(got, want []w32.RECT) bool {
+	if len(got) == 0 && len(want) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestRegionCombine(t *testing.T) {
+	a := NewRegion(rect(0, 0, 10, 10))
+	b := NewRegion(rect(5, 5, 15, 15))
+
+	tests := []struct {
+		name string
+		got  *Region
+		want []w32.RECT
+	}{
+		{"union", a.Union(b), []w32.RECT{rect(0, 0, 10, 5), rect(0, 5, 15, 10), rect(5, 10, 15, 15)}},
+		{"intersect", a.Intersect(b), []w32.RECT{rect(5, 5, 10, 10)}},
+		{"xor", a.Xor(b), []w32.RECT{rect(0, 0, 10, 5), rect(0, 5, 5, 10), rect(10, 5, 15, 10), rect(5, 10, 15, 15)}},
+		{"diff", a.Diff(b), []w32.RECT{rect(0, 0, 10, 5), rect(0, 5, 5, 10)}},
+		{"diff reversed", b.Diff(a), []w32.RECT{rect(10, 5, 15, 10), rect(5, 10, 15, 15)}},
+		{"disjoint intersect", a.Intersect(NewRegion(rect(20, 0, 30, 10))), nil},
+		{"diff of itself", a.Diff(a), nil},
+		{"union with nil", a.Union(nil), []w32.RECT{rect(0, 0, 10, 10)}},
+		{"bands joined", NewRegion(rect(0, 0, 10, 5)).Union(NewRegion(rect(0, 5, 10, 10))), []w32.RECT{rect(0, 0, 10, 10)}},
+		{"spans joined", NewRegion(rect(0, 0, 5, 10)).Union(NewRegion(rect(5, 0, 10, 10))), []w32.RECT{rect(0, 0, 10, 10)}},
+		{"swapped edges", NewRegion(rect(10, 10, 0, 0), rect(3, 3, 3, 8)), []w32.RECT{rect(0, 0, 10, 10)}},
+		{"overlapping", NewRegion(rect(0, 0, 4, 4), rect(2, 2, 6, 6), rect(0, 0, 4, 4)), []w32.RECT{rect(0, 0, 4, 2), rect(0, 2, 6, 4), rect(2, 4, 6, 6)}},
+		{"hole", NewRegion(rect(0, 0, 9, 9)).Diff(NewRegion(rect(3, 3, 6, 6))), []w32.RECT{rect(0, 0, 9, 3), rect(0, 3, 3, 6), rect(6, 3, 9, 6), rect(0, 6, 9, 9)}},
+		{"offset", a.Offset(3, -2), []w32.RECT{rect(3, -2, 13, 8)}},
+		{"offset of nil", (*Region)(nil).Offset(3, -2), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !sameRects(tt.got.Rects, tt.want) {
+				t.Errorf("got %v, want %v", tt.got.Rects, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionCombineMode(t *testing.T) {
+	a := NewRegion(rect(0, 0, 10, 10))
+	b := NewRegion(rect(5, 0, 15, 10))
+
+	tests := []struct {
+		mode int
+		want []w32.RECT
+	}{
+		{RGN_AND, []w32.RECT{rect(5, 0, 10, 10)}},
+		{RGN_OR, []w32.RECT{rect(0, 0, 15, 10)}},
+		{RGN_XOR, []w32.RECT{rect(0, 0, 5, 10), rect(10, 0, 15, 10)}},
+		{RGN_DIFF, []w32.RECT{rect(0, 0, 5, 10)}},
+		{RGN_COPY, []w32.RECT{rect(5, 0, 15, 10)}},
+	}
+
+	for _, tt := range tests {
+		got, err := a.Combine(b, tt.mode)
+		if err != nil {
+			t.Errorf("mode %d returned %v", tt.mode, err)
+			continue
+		}
+		if !sameRects(got.Rects, tt.want) {
+			t.Errorf("mode %d gave %v, want %v", tt.mode, got.Rects, tt.want)
+		}
+	}
+
+	if _, err := a.Combine(b, 0); err == nil {
+		t.Error("invalid mode succeeded")
+	}
+}
+
+func TestRegionFrame(t *testing.T) {
+	tests := []struct {
+		name          string
+		rgn           *Region
+		width, height int32
+		want          []w32.RECT
+	}{
+		{"rectangle", NewRegion(rect(0, 0, 10, 10)), 2, 1, []w32.RECT{rect(0, 0, 10, 1), rect(0, 1, 2, 9), rect(8, 1, 10, 9), rect(0, 9, 10, 10)}},
+		{"negative sizes", NewRegion(rect(0, 0, 10, 10)), -2, -1, []w32.RECT{rect(0, 0, 10, 1), rect(0, 1, 2, 9), rect(8, 1, 10, 9), rect(0, 9, 10, 10)}},
+		{"narrow gap", NewRegion(rect(0, 0, 10, 10), rect(12, 0, 22, 10)), 5, 1, []w32.RECT{rect(0, 0, 10, 10), rect(12, 0, 22, 10)}},
+		{"wide gap", NewRegion(rect(0, 0, 10, 3), rect(20, 0, 30, 3)), 2, 1, []w32.RECT{
+			rect(0, 0, 10, 1), rect(20, 0, 30, 1),
+			rect(0, 1, 2, 2), rect(8, 1, 10, 2), rect(20, 1, 22, 2), rect(28, 1, 30, 2),
+			rect(0, 2, 10, 3), rect(20, 2, 30, 3),
+		}},
+		{"inner corner", NewRegion(rect(0, 0, 6, 3), rect(0, 3, 3, 6)), 1, 1, []w32.RECT{
+			rect(0, 0, 6, 1), rect(0, 1, 1, 2), rect(5, 1, 6, 2), rect(0, 2, 1, 3), rect(2, 2, 6, 3),
+			rect(0, 3, 1, 5), rect(2, 3, 3, 5), rect(0, 5, 3, 6),
+		}},
+		{"thicker than the region", NewRegion(rect(0, 0, 4, 4)), 2, 2, []w32.RECT{rect(0, 0, 4, 4)}},
+		{"no width", NewRegion(rect(0, 0, 4, 4)), 0, 0, nil},
+		{"empty", &Region{}, 2, 2, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rgn.Frame(tt.width, tt.height); !sameRects(got.Rects, tt.want) {
+				t.Errorf("got %v, want %v", got.Rects, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionBounds(t *testing.T) {
+	rgn := NewRegion(rect(5, 5, 15, 15), rect(0, 0, 10, 10), rect(-3, 12, 1, 20))
+	if got, want := rgn.Bounds(), rect(-3, 0, 15, 20); got != want {
+		t.Errorf("bounds are %v, want %v", got, want)
+	}
+	if got := (&Region{}).Bounds(); got != (w32.RECT{}) {
+		t.Errorf("bounds of the empty region are %v", got)
+	}
+}
+
+func TestRegionManyRects(t *testing.T) {
+	// a staircase of overlapping rectangles has a band for each of them
+	rects := make([]w32.RECT, 1<<14)
+	for i := range rects {
+		rects[i] = rect(int32(i), int32(i), int32(i)+2, 1<<15)
+	}
+
+	start := time.Now()
+	rgn := NewRegion(rects...)
+	if len(rgn.Rects) != len(rects) {
+		t.Fatalf("got %d rectangles, want %d", len(rgn.Rects), len(rects))
+	}
+	if rgn.Rects[1] != rect(0, 1, 3, 2) {
+		t.Errorf("second band is %v, want %v", rgn.Rects[1], rect(0, 1, 3, 2))
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v", d)
+	}
+}
+
+func TestRegionLimit(t *testing.T) {
+	rgn := RegionData{Data: []w32.RECT{rect(0, 0, 2, 2), rect(4, 0, 6, 2), rect(8, 0, 10, 2)}}
+
+	for _, max := range []int{2, 3} {
+		b := NewBuilder(w32.RECT{Right: 9, Bottom: 9}, w32.RECT{})
+		b.Add(&PaintRgnRecord{Record: Record{Type: EMR_PAINTRGN}, RgnData: rgn})
+
+		f := b.File()
+		f.SetOptions(&ReadOptions{Strict: true, Limits: &Limits{MaxRegionRects: max}})
+
+		err := f.DrawToDevice(NewRasterDevice(10, 10))
+		if max < len(rgn.Data) && !errors.Is(err, ErrLimit) {
+			t.Errorf("limit of %d rectangles returned %v, want %v", max, err, ErrLimit)
+		}
+		if max >= len(rgn.Data) && err != nil {
+			t.Errorf("limit of %d rectangles returned %v", max, err)
+		}
+	}
+}
+
+func TestRegionStaggeredLimit(t *testing.T) {
+	// staggered strips cross each other in every band, so that a few of
+	// them make a region of thousands of rectangles
+	strips := make([]w32.RECT, 64)
+	for i := range strips {
+		strips[i] = rect(int32(2*i), int32(i), int32(2*i+1), int32(i+len(strips)))
+	}
+	limits := &Limits{MaxRegionRects: 1000}
+
+	if rgn := NewRegion(strips...); len(rgn.Rects) <= limits.MaxRegionRects {
+		t.Fatalf("strips make %d rectangles", len(rgn.Rects))
+	}
+	if _, err := newRegion(limits, strips...); !errors.Is(err, ErrLimit) {
+		t.Errorf("newRegion returned %v, want %v", err, ErrLimit)
+	}
+
+	rgn := RegionData{Data: strips}
+	tests := []struct {
+		name string
+		rec  Recorder
+	}{
+		{"clip", &ExtSelectClipRgnRecord{Record: Record{Type: EMR_EXTSELECTCLIPRGN}, RegionMode: RGN_COPY, RgnData: rgn}},
+		{"frame", &FrameRgnRecord{Record: Record{Type: EMR_FRAMERGN}, IhBrush: 0x80000000 | BLACK_BRUSH, Width: 1, Height: 1, RgnData: rgn}},
+		{"invert", &InvertRgnRecord{Record: Record{Type: EMR_INVERTRGN}, RgnData: rgn}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(w32.RECT{Right: 199, Bottom: 199}, w32.RECT{})
+			b.Add(tt.rec)
+
+			f := b.File()
+			f.SetOptions(&ReadOptions{Strict: true, Limits: limits})
+			if err := f.DrawToDevice(NewRasterDevice(200, 200)); !errors.Is(err, ErrLimit) {
+				t.Errorf("drawing returned %v, want %v", err, ErrLimit)
+			}
+
+			f.SetOptions(&ReadOptions{Strict: true})
+			if err := f.DrawToDevice(NewRasterDevice(200, 200)); err != nil {
+				t.Errorf("drawing without the limit returned %v", err)
+			}
+		})
+	}
+}
+
+func TestClip(t *testing.T) {
+	square := []w32.RECT{rect(0, 0, 20, 20)}
+
+	tests := []struct {
+		name string
+		ops  func(d *softDevice)
+		clip []w32.RECT // nil for no clip region
+		meta []w32.RECT
+		both []w32.RECT // region which clips drawing
+	}{
+		{"none", func(d *softDevice) {}, nil, nil, []w32.RECT{rect(0, 0, 100, 100)}},
+		{"intersect", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 50, 50)
+			d.IntersectClipRect(30, 0, 90, 40)
+		}, []w32.RECT{rect(30, 10, 50, 40)}, nil, []w32.RECT{rect(30, 10, 50, 40)}},
+		{"exclude", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 40, 40)
+			d.ExcludeClipRect(20, 20, 30, 30)
+		}, []w32.RECT{rect(10, 10, 40, 20), rect(10, 20, 20, 30), rect(30, 20, 40, 30), rect(10, 30, 40, 40)}, nil, nil},
+		{"exclude without clip", func(d *softDevice) {
+			d.ExcludeClipRect(0, 0, 100, 60)
+		}, []w32.RECT{rect(0, 60, 100, 100)}, nil, nil},
+		{"or", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 30, 30)
+			d.ExtSelectClipRgn(square, RGN_OR)
+		}, []w32.RECT{rect(0, 0, 20, 10), rect(0, 10, 30, 20), rect(10, 20, 30, 30)}, nil, nil},
+		{"xor", func(d *softDevice) {
+			d.IntersectClipRect(10, 0, 30, 20)
+			d.ExtSelectClipRgn(square, RGN_XOR)
+		}, []w32.RECT{rect(0, 0, 10, 20), rect(20, 0, 30, 20)}, nil, nil},
+		{"diff", func(d *softDevice) {
+			d.IntersectClipRect(10, 0, 30, 20)
+			d.ExtSelectClipRgn(square, RGN_DIFF)
+		}, []w32.RECT{rect(20, 0, 30, 20)}, nil, nil},
+		{"and", func(d *softDevice) {
+			d.IntersectClipRect(10, 0, 30, 20)
+			d.ExtSelectClipRgn(square, RGN_AND)
+		}, []w32.RECT{rect(10, 0, 20, 20)}, nil, nil},
+		{"copy", func(d *softDevice) {
+			d.IntersectClipRect(10, 0, 30, 20)
+			d.ExtSelectClipRgn(square, RGN_COPY)
+		}, square, nil, nil},
+		{"default", func(d *softDevice) {
+			d.IntersectClipRect(10, 0, 30, 20)
+			d.ExtSelectClipRgn(nil, RGN_COPY)
+		}, nil, nil, nil},
+		{"offset", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 30, 20)
+			d.OffsetClipRgn(5, -5)
+		}, []w32.RECT{rect(15, 5, 35, 15)}, nil, nil},
+		{"meta", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 50, 50)
+			d.SetMetaRgn()
+		}, nil, []w32.RECT{rect(10, 10, 50, 50)}, []w32.RECT{rect(10, 10, 50, 50)}},
+		{"clip in meta", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 50, 50)
+			d.SetMetaRgn()
+			d.IntersectClipRect(40, 40, 90, 90)
+		}, []w32.RECT{rect(40, 40, 90, 90)}, []w32.RECT{rect(10, 10, 50, 50)}, []w32.RECT{rect(40, 40, 50, 50)}},
+		{"metas intersect", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 50, 50)
+			d.SetMetaRgn()
+			d.ExtSelectClipRgn([]w32.RECT{rect(0, 0, 20, 90)}, RGN_COPY)
+			d.SetMetaRgn()
+		}, nil, []w32.RECT{rect(10, 10, 20, 50)}, []w32.RECT{rect(10, 10, 20, 50)}},
+		{"default keeps meta", func(d *softDevice) {
+			d.IntersectClipRect(10, 10, 50, 50)
+			d.SetMetaRgn()
+			d.IntersectClipRect(0, 0, 20, 20)
+			d.ExtSelectClipRgn(nil, RGN_COPY)
+		}, nil, []w32.RECT{rect(10, 10, 50, 50)}, []w32.RECT{rect(10, 10, 50, 50)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newSoftDevice(100, 100, newRasterPainter(100, 100))
+			tt.ops(d)
+
+			clip, _ := d.GetClipRgn()
+			if (clip == nil) != (tt.clip == nil) || clip != nil && !sameRects(clip.Rects, tt.clip) {
+				t.Errorf("clip region is %v, want %v", clip, tt.clip)
+			}
+
+			meta, _ := d.GetMetaRgn()
+			if (meta == nil) != (tt.meta == nil) || meta != nil && !sameRects(meta.Rects, tt.meta) {
+				t.Errorf("meta region is %v, want %v", meta, tt.meta)
+			}
+
+			if tt.both == nil {
+				tt.both = tt.clip
+			}
+			if tt.both != nil {
+				if got := d.clipRegion().region(100, 100); !sameRects(got.Rects, tt.both) {
+					t.Errorf("drawing is clipped to %v, want %v", got.Rects, tt.both)
+				}
+			}
+		})
+	}
+}
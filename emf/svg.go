@@ -0,0 +1,385 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lokks307/go-emf/raster"
+	log "github.com/sirupsen/logrus"
+)
+
+// WriteSVG plays the records and writes the result to w as an SVG document.
+// Shapes and text are kept as vector elements, bitmaps are embedded as PNG
+// images. The view box is the bounds of the header in device units.
+func (f *EmfFile) WriteSVG(w io.Writer) error {
+	if f.Header == nil {
+		return errors.New("missing EMF header")
+	}
+
+	bounds := f.Header.Original.Bounds
+	device := f.Header.Original.Device
+
+	p := newSvgPainter(w, int(device.CX), int(device.CY), bounds.Left, bounds.Top, bounds.Right-bounds.Left+1, bounds.Bottom-bounds.Top+1)
+	dev := newSoftDevice(int(device.CX), int(device.CY), p)
+	err := f.DrawToDevice(dev)
+	dev.Release()
+	if err != nil {
+		return err
+	}
+
+	return p.close()
+}
+
+// svgPainter writes the shapes it receives as SVG elements.
+type svgPainter struct {
+	w      io.Writer
+	err    error
+	width  int
+	height int
+
+	nextID   int
+	clips    map[*clipRegion]string
+	clipDefs map[svgClipKey]string
+	patterns map[svgPatternKey]string
+}
+
+type svgClipKey struct {
+	parent string
+	path   *raster.Path
+	rule   raster.FillRule
+}
+
+type svgPatternKey struct {
+	tile   *image.RGBA
+	origin image.Point
+}
+
+func newSvgPainter(w io.Writer, width, height int, x, y, cx, cy int32) *svgPainter {
+	p := &svgPainter{
+		w:        w,
+		width:    width,
+		height:   height,
+		clips:    make(map[*clipRegion]string),
+		clipDefs: make(map[svgClipKey]string),
+		patterns: make(map[svgPatternKey]string),
+	}
+
+	p.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	p.printf("<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" version=\"1.1\" width=\"%d\" height=\"%d\" viewBox=\"%d %d %d %d\">\n",
+		cx, cy, x, y, cx, cy)
+
+	return p
+}
+
+func (p *svgPainter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *svgPainter) close() error {
+	p.printf("</svg>\n")
+	return p.err
+}
+
+func (p *svgPainter) Image() (*image.RGBA, error) {
+	return nil, errors.New("SVG output has no image")
+}
+
+func (p *svgPainter) Clear(c color.RGBA) {
+	p.printf("<rect x=\"0\" y=\"0\" width=\"%d\" height=\"%d\" %s/>\n", p.width, p.height, p.paintAttr("fill", paint{Color: c}))
+}
+
+func (p *svgPainter) Fill(path *raster.Path, rule raster.FillRule, src paint, clip *clipRegion) {
+	if path.Empty() {
+		return
+	}
+
+	fill := p.paintAttr("fill", src)
+	p.printf("<path d=\"%s\" %s fill-rule=\"%s\"%s/>\n", svgPathData(path), fill, svgFillRule(rule), p.clipAttr(clip))
+}
+
+func (p *svgPainter) Stroke(path *raster.Path, s raster.Stroke, src paint, clip *clipRegion) {
+	if path.Empty() {
+		return
+	}
+
+	width := s.Width
+	if width <= 0 {
+		width = 1
+	}
+
+	attrs := []string{
+		"fill=\"none\"",
+		p.paintAttr("stroke", src),
+		"stroke-width=\"" + svgNum(width) + "\"",
+	}
+
+	switch s.Cap {
+	case raster.CapRound:
+		attrs = append(attrs, "stroke-linecap=\"round\"")
+	case raster.CapSquare:
+		attrs = append(attrs, "stroke-linecap=\"square\"")
+	}
+
+	switch s.Join {
+	case raster.JoinRound:
+		attrs = append(attrs, "stroke-linejoin=\"round\"")
+	case raster.JoinBevel:
+		attrs = append(attrs, "stroke-linejoin=\"bevel\"")
+	case raster.JoinMiter:
+		if s.MiterLimit >= 1 {
+			attrs = append(attrs, "stroke-miterlimit=\""+svgNum(s.MiterLimit)+"\"")
+		}
+	}
+
+	if len(s.Dashes) > 0 {
+		dashes := make([]string, len(s.Dashes))
+		for i, v := range s.Dashes {
+			dashes[i] = svgNum(v)
+		}
+		attrs = append(attrs, "stroke-dasharray=\""+strings.Join(dashes, " ")+"\"")
+		if s.DashOffset != 0 {
+			attrs = append(attrs, "stroke-dashoffset=\""+svgNum(s.DashOffset)+"\"")
+		}
+	}
+
+	// GDI lines run through pixel centers
+	d := svgPathData(path.Transform(raster.Translate(0.5, 0.5)))
+	p.printf("<path d=\"%s\" %s%s/>\n", d, strings.Join(attrs, " "), p.clipAttr(clip))
+}
+
+func (p *svgPainter) DrawImage(img image.Image, m raster.Matrix, op raster.ImageOp, smooth bool, clip *clipRegion) {
+	data, err := svgPNG(img)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	var style []string
+	switch op {
+	case raster.ImageAnd:
+		style = append(style, "mix-blend-mode:multiply")
+	case raster.ImageOr:
+		style = append(style, "mix-blend-mode:screen")
+	case raster.ImageXor:
+		style = append(style, "mix-blend-mode:difference")
+	}
+	if !smooth {
+		style = append(style, "image-rendering:pixelated")
+	}
+
+	b := img.Bounds()
+	p.printf("<image x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" preserveAspectRatio=\"none\" transform=\"%s\" style=\"%s\"%s xlink:href=\"%s\"/>\n",
+		b.Min.X, b.Min.Y, b.Dx(), b.Dy(), svgMatrix(m), strings.Join(style, ";"), p.clipAttr(clip), data)
+}
+
+func (p *svgPainter) Text(run *textRun, clip *clipRegion) {
+	if len(run.Text) == 0 || run.Size <= 0 {
+		return
+	}
+
+	// glyphs which are not characters, from glyph index text, are drawn as
+	// shapes as a viewer could not find them
+	for _, r := range run.Text {
+		if r == unicode.ReplacementChar {
+			p.Fill(run.Outline, raster.NonZero, paint{Color: run.Color}, clip)
+			return
+		}
+	}
+
+	// the text is laid out in a space where the font size is run.Size, the
+	// transform adds the rotation, skew and aspect of the run
+	t := raster.Scale(1/run.Size, 1/run.Size).Mul(run.Matrix)
+	inv, ok := t.Invert()
+	if !ok {
+		return
+	}
+
+	xs := make([]string, len(run.Origins))
+	ys := make([]string, len(run.Origins))
+	for i, o := range run.Origins {
+		l := inv.ApplyVector(o)
+		xs[i], ys[i] = svgNum(l.X), svgNum(l.Y)
+	}
+
+	attrs := []string{
+		"x=\"" + strings.Join(xs, " ") + "\"",
+		"y=\"" + strings.Join(ys, " ") + "\"",
+	}
+	if !t.IsIdentity() {
+		attrs = append(attrs, "transform=\""+svgMatrix(t)+"\"")
+	}
+
+	attrs = append(attrs,
+		"font-family=\""+svgEscape(run.Font)+"\"",
+		"font-size=\""+svgNum(run.Size)+"\"",
+	)
+	if run.Weight != 0 && run.Weight != 400 {
+		attrs = append(attrs, "font-weight=\""+strconv.Itoa(run.Weight)+"\"")
+	}
+	if run.Italic {
+		attrs = append(attrs, "font-style=\"italic\"")
+	}
+
+	var decoration []string
+	if run.Underline {
+		decoration = append(decoration, "underline")
+	}
+	if run.StrikeOut {
+		decoration = append(decoration, "line-through")
+	}
+	if len(decoration) > 0 {
+		attrs = append(attrs, "text-decoration=\""+strings.Join(decoration, " ")+"\"")
+	}
+
+	attrs = append(attrs, p.paintAttr("fill", paint{Color: run.Color}))
+
+	p.printf("<text %s xml:space=\"preserve\"%s>%s</text>\n", strings.Join(attrs, " "), p.clipAttr(clip), svgEscape(string(run.Text)))
+}
+
+// paintAttr returns the fill or stroke attribute for src, writing the
+// pattern definition when it is first used.
+func (p *svgPainter) paintAttr(name string, src paint) string {
+	if src.Pattern == nil {
+		c := src.Color
+		if c.A != 0 && c.A != 0xFF {
+			c = unpremultiply(c)
+		}
+		attr := fmt.Sprintf("%s=\"#%02x%02x%02x\"", name, c.R, c.G, c.B)
+		if c.A != 0xFF {
+			attr += fmt.Sprintf(" %s-opacity=\"%s\"", name, svgNum(float64(c.A)/0xFF))
+		}
+		return attr
+	}
+
+	key := svgPatternKey{tile: src.Pattern, origin: src.Origin}
+	id, ok := p.patterns[key]
+	if !ok {
+		data, err := svgPNG(src.Pattern)
+		if err != nil {
+			log.Error(err)
+			return name + "=\"none\""
+		}
+
+		id = p.newID("p")
+		p.patterns[key] = id
+
+		b := src.Pattern.Bounds()
+		p.printf("<defs><pattern id=\"%s\" patternUnits=\"userSpaceOnUse\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\">", id, src.Origin.X, src.Origin.Y, b.Dx(), b.Dy())
+		p.printf("<image width=\"%d\" height=\"%d\" style=\"image-rendering:pixelated\" xlink:href=\"%s\"/>", b.Dx(), b.Dy(), data)
+		p.printf("</pattern></defs>\n")
+	}
+
+	return fmt.Sprintf("%s=\"url(#%s)\"", name, id)
+}
+
+// clipAttr returns the clip-path attribute for clip, writing the clip path
+// definitions when it is first used. Every part of the region is clipped by
+// the parts before it, so the last clip path is the intersection of all.
+func (p *svgPainter) clipAttr(clip *clipRegion) string {
+	if clip == nil {
+		return ""
+	}
+
+	id, ok := p.clips[clip]
+	if !ok {
+		for _, part := range clip.parts {
+			key := svgClipKey{parent: id, path: part.path, rule: part.rule}
+			if def, ok := p.clipDefs[key]; ok {
+				id = def
+				continue
+			}
+
+			parent := ""
+			if id != "" {
+				parent = fmt.Sprintf(" clip-path=\"url(#%s)\"", id)
+			}
+
+			id = p.newID("c")
+			p.clipDefs[key] = id
+			p.printf("<defs><clipPath id=\"%s\" clipPathUnits=\"userSpaceOnUse\"%s><path d=\"%s\" clip-rule=\"%s\"/></clipPath></defs>\n",
+				id, parent, svgPathData(part.path), svgFillRule(part.rule))
+		}
+		p.clips[clip] = id
+	}
+
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf(" clip-path=\"url(#%s)\"", id)
+}
+
+func (p *svgPainter) newID(prefix string) string {
+	p.nextID++
+	return prefix + strconv.Itoa(p.nextID)
+}
+
+func svgPathData(path *raster.Path) string {
+	var b strings.Builder
+	for _, s := range path.Segments {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		switch s.Op {
+		case raster.MoveTo:
+			b.WriteString("M" + svgNum(s.Pts[0].X) + " " + svgNum(s.Pts[0].Y))
+		case raster.LineTo:
+			b.WriteString("L" + svgNum(s.Pts[0].X) + " " + svgNum(s.Pts[0].Y))
+		case raster.CubeTo:
+			b.WriteString("C" + svgNum(s.Pts[0].X) + " " + svgNum(s.Pts[0].Y) + " " +
+				svgNum(s.Pts[1].X) + " " + svgNum(s.Pts[1].Y) + " " +
+				svgNum(s.Pts[2].X) + " " + svgNum(s.Pts[2].Y))
+		case raster.Close:
+			b.WriteString("Z")
+		}
+	}
+	return b.String()
+}
+
+func svgFillRule(rule raster.FillRule) string {
+	if rule == raster.EvenOdd {
+		return "evenodd"
+	}
+	return "nonzero"
+}
+
+func svgMatrix(m raster.Matrix) string {
+	return "matrix(" + svgNum(m.A) + " " + svgNum(m.B) + " " + svgNum(m.C) + " " + svgNum(m.D) + " " + svgNum(m.E) + " " + svgNum(m.F) + ")"
+}
+
+// svgNum formats v with at most three decimals.
+func svgNum(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func svgEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// svgPNG encodes img as a PNG data URI.
+func svgPNG(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
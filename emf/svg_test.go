@@ -0,0 +1,125 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// exportFile returns a file with a filled rectangle, a line, clipped text
+// and a bitmap, which draws with the Go fonts.
+func exportFile(t *testing.T) *EmfFile {
+	t.Helper()
+
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	b.SelectPen(PS_SOLID, 1, 0x000000)
+	b.SelectBrush(BS_SOLID, 0x0000FF, 0)
+	b.Rectangle(10, 10, 50, 40)
+	if err := b.Polyline([]w32.POINT{{X: 10, Y: 90}, {X: 90, Y: 90}}); err != nil {
+		t.Fatal(err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.SetRGBA(0, 0, color.RGBA{0xFF, 0, 0, 0xFF})
+	if err := b.DrawImage(img, 60, 10, 20, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	lf := w32.LOGFONT{Height: -20, Weight: w32.FW_BOLD}
+	lf.SetFaceName("Arial")
+	b.SelectFont(lf)
+	b.SetTextColor(0x00FF00)
+	b.SetBkMode(TRANSPARENT)
+	b.Add(&IntersectClipRectRecord{Record: Record{Type: EMR_INTERSECTCLIPRECT}, Clip: w32.RECT{Right: 80, Bottom: 80}})
+	if err := b.Text(10, 50, "Hi & <you>"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := b.File()
+	f.SetOptions(&ReadOptions{Strict: true, Fonts: NewFontResolver()})
+	return f
+}
+
+func TestWriteSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportFile(t).WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the document is well formed, and keeps the shapes, the text and the
+	// bitmap as their own elements
+	elements := map[string][]map[string]string{}
+	var text string
+
+	dec := xml.NewDecoder(&buf)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			attrs := map[string]string{}
+			for _, a := range tok.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			elements[tok.Name.Local] = append(elements[tok.Name.Local], attrs)
+		case xml.CharData:
+			text += string(tok)
+		}
+	}
+
+	svg := elements["svg"]
+	if len(svg) != 1 || svg[0]["viewBox"] != "0 0 100 100" {
+		t.Errorf("svg elements are %v", svg)
+	}
+
+	has := func(name string, match func(map[string]string) bool) bool {
+		for _, attrs := range elements[name] {
+			if match(attrs) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !has("path", func(a map[string]string) bool { return a["fill"] == "#ff0000" }) {
+		t.Error("no path filled with the brush")
+	}
+	if !has("path", func(a map[string]string) bool { return a["stroke"] == "#000000" && a["fill"] == "none" }) {
+		t.Error("no path stroked with the pen")
+	}
+	if !has("image", func(a map[string]string) bool { return strings.HasPrefix(a["href"], "data:image/png;base64,") }) {
+		t.Error("no embedded PNG image")
+	}
+	if len(elements["clipPath"]) == 0 {
+		t.Error("no clip path")
+	}
+
+	texts := elements["text"]
+	if len(texts) != 1 {
+		t.Fatalf("%d text elements, want 1", len(texts))
+	}
+	want := map[string]string{"font-family": "Arial", "font-size": "20", "font-weight": "700", "fill": "#00ff00"}
+	for name, value := range want {
+		if texts[0][name] != value {
+			t.Errorf("text has %s %q, want %q", name, texts[0][name], value)
+		}
+	}
+	if !strings.HasPrefix(texts[0]["clip-path"], "url(#c") {
+		t.Errorf("text is not clipped: %v", texts[0])
+	}
+	if !strings.Contains(text, "Hi & <you>") {
+		t.Errorf("text is %q", text)
+	}
+}
@@ -0,0 +1,354 @@
+package emf
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+)
+
+// textPainter keeps the text runs handed to the painter.
+type textPainter struct {
+	*rasterPainter
+	runs []*textRun
+}
+
+func (p *textPainter) Text(run *textRun, clip *clipRegion) {
+	p.runs = append(p.runs, run)
+	p.rasterPainter.Text(run, clip)
+}
+
+// textDevice returns a soft device drawing with the Go fonts, whose font is
+// 20 units high.
+func textDevice(t *testing.T, face string) (*softDevice, *textPainter) {
+	t.Helper()
+
+	p := &textPainter{rasterPainter: newRasterPainter(200, 200)}
+	d := newSoftDevice(200, 200, p)
+	d.setFonts(NewFontResolver())
+
+	lf := w32.LOGFONT{Height: -20, Weight: w32.FW_NORMAL}
+	lf.SetFaceName(face)
+	if err := d.SelectObject(d.CreateFontIndirect(lf)); err != nil {
+		t.Fatal(err)
+	}
+
+	return d, p
+}
+
+func near(a, b raster.Point) bool {
+	return math.Abs(a.X-b.X) < 1e-6 && math.Abs(a.Y-b.Y) < 1e-6
+}
+
+func TestTextAlign(t *testing.T) {
+	dx := []int32{10, 10, 10}
+
+	tests := []struct {
+		name  string
+		align uint32
+		x, y  float64 // first origin, without the ascent or descent
+		cur   raster.Point
+	}{
+		{"left top", TA_LEFT | TA_TOP, 50, 100, raster.Pt(0, 0)},
+		{"right", TA_RIGHT | TA_BASELINE, 20, 100, raster.Pt(0, 0)},
+		{"center", TA_CENTER | TA_BASELINE, 35, 100, raster.Pt(0, 0)},
+		{"bottom", TA_LEFT | TA_BOTTOM, 50, 100, raster.Pt(0, 0)},
+		{"update cp", TA_UPDATECP | TA_BASELINE, 5, 7, raster.Pt(35, 7)},
+		{"update cp right", TA_UPDATECP | TA_RIGHT | TA_BASELINE, -25, 7, raster.Pt(-25, 7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, p := textDevice(t, "Arial")
+			d.SetTextAlign(tt.align)
+			d.MoveToEx(5, 7)
+
+			if err := d.ExtTextOut(50, 100, 0, nil, []uint16{'a', 'b', 'c'}, dx); err != nil {
+				t.Fatal(err)
+			}
+			if len(p.runs) != 1 {
+				t.Fatalf("%d runs, want 1", len(p.runs))
+			}
+
+			run := p.runs[0]
+			face := run.Face
+			scale := 20 / face.unitsPerEm
+
+			y := tt.y
+			switch tt.align & TA_BASELINE {
+			case TA_TOP:
+				y += face.ascent * scale
+			case TA_BOTTOM:
+				y -= face.descent * scale
+			}
+
+			for i, o := range run.Origins {
+				if want := raster.Pt(tt.x+float64(10*i), y); !near(o, want) {
+					t.Errorf("origin %d is %v, want %v", i, o, want)
+				}
+			}
+
+			if tt.align&TA_UPDATECP != 0 && !near(d.state.cur, tt.cur) {
+				t.Errorf("current position %v, want %v", d.state.cur, tt.cur)
+			}
+		})
+	}
+}
+
+func TestTextDistances(t *testing.T) {
+	tests := []struct {
+		name    string
+		options uint32
+		dx      []int32
+		origins []raster.Point
+	}{
+		{"font advances", 0, nil, nil},
+		{"dx", 0, []int32{3, 4, 5}, []raster.Point{raster.Pt(10, 50), raster.Pt(13, 50), raster.Pt(17, 50)}},
+		{"pdy", ETO_PDY, []int32{3, 1, 4, -2, 5, 9}, []raster.Point{raster.Pt(10, 50), raster.Pt(13, 49), raster.Pt(17, 51)}},
+		{"short dx", 0, []int32{3}, []raster.Point{raster.Pt(10, 50), raster.Pt(13, 50), raster.Pt(13, 50)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, p := textDevice(t, "Arial")
+			d.SetTextAlign(TA_BASELINE)
+
+			if err := d.ExtTextOut(10, 50, tt.options, nil, []uint16{'W', 'i', 'W'}, tt.dx); err != nil {
+				t.Fatal(err)
+			}
+
+			run := p.runs[0]
+			origins := tt.origins
+			if origins == nil {
+				scale := 20 / run.Face.unitsPerEm
+				x := 10.0
+				for _, g := range run.Glyphs {
+					origins = append(origins, raster.Pt(x, 50))
+					x += run.Face.advance(g) * scale
+				}
+				if origins[2].X-origins[1].X >= origins[1].X-origins[0].X {
+					t.Errorf("i is not narrower than W: %v", origins)
+				}
+			}
+
+			for i, o := range run.Origins {
+				if !near(o, origins[i]) {
+					t.Errorf("origin %d is %v, want %v", i, o, origins[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTextRect(t *testing.T) {
+	d, p := textDevice(t, "Arial")
+	d.SetBkColor(0x0000FF)
+	d.SetTextColor(0x000000)
+
+	rect := &w32.RECT{Left: 10, Top: 10, Right: 30, Bottom: 30}
+	if err := d.ExtTextOut(20, 10, ETO_OPAQUE|ETO_CLIPPED, rect, []uint16{'W', 'W', 'W'}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	img, _ := p.Image()
+	if c := img.RGBAAt(12, 28); c.R != 0xFF || c.G != 0 || c.B != 0 {
+		t.Errorf("opaque rectangle is %v, want red", c)
+	}
+	for x := 31; x < 200; x++ {
+		for y := 0; y < 200; y++ {
+			if c := img.RGBAAt(x, y); c != (color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}) {
+				t.Fatalf("pixel %d,%d is drawn outside the clipped rectangle", x, y)
+			}
+		}
+	}
+}
+
+func TestExtTextOutRecord(t *testing.T) {
+	// the text is placed at the reference point, not at the bounds, and
+	// the y distances of ETO_PDY survive writing and reading the record
+	lf := w32.LOGFONT{Height: -20, Weight: w32.FW_NORMAL}
+	lf.SetFaceName("Arial")
+
+	b := NewBuilder(w32.RECT{Right: 199, Bottom: 199}, w32.RECT{})
+	b.SelectFont(lf)
+	b.Add(&SetTextAlignRecord{Record: Record{Type: EMR_SETTEXTALIGN}, TextAlignmentMode: TA_BASELINE})
+	b.Add(&ExtTextOutWRecord{
+		Record:        Record{Type: EMR_EXTTEXTOUTW},
+		Bounds:        w32.RECT{Left: 100, Top: 100, Right: 120, Bottom: 120},
+		IGraphicsMode: w32.GM_COMPATIBLE,
+		ExScale:       1,
+		EyScale:       1,
+		WEmrText: EmrText{
+			Reference:    w32.POINT{X: 30, Y: 40},
+			Chars:        2,
+			Options:      ETO_PDY,
+			OutputString: []uint16{'a', 'b'},
+			OutputDx:     []int32{7, 3, 7, 3},
+		},
+	})
+
+	f := readFile(t, writeFile(t, b.File()))
+
+	p := &textPainter{rasterPainter: newRasterPainter(200, 200)}
+	d := newSoftDevice(200, 200, p)
+	d.setFonts(NewFontResolver())
+	if err := f.DrawToDevice(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.runs) != 1 {
+		t.Fatalf("%d runs, want 1", len(p.runs))
+	}
+	origins := []raster.Point{raster.Pt(30, 40), raster.Pt(37, 37)}
+	for i, o := range p.runs[0].Origins {
+		if !near(o, origins[i]) {
+			t.Errorf("origin %d is %v, want %v", i, o, origins[i])
+		}
+	}
+}
+
+func TestTextGlyphIndex(t *testing.T) {
+	// the indices are those of the font found under the face name
+	d, p := textDevice(t, "Go")
+	d.setFonts(NewFontResolver(fontDir(t)))
+	if err := d.ExtTextOut(10, 50, 0, nil, []uint16{'A', 'g'}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	chars := p.runs[0]
+	glyphs := []uint16{uint16(chars.Glyphs[0]), uint16(chars.Glyphs[1]), 0}
+	if err := d.ExtTextOut(10, 50, ETO_GLYPH_INDEX, nil, glyphs, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	run := p.runs[1]
+	if got, want := string(run.Text), "Ag\uFFFD"; got != want {
+		t.Errorf("text of the glyphs is %q, want %q", got, want)
+	}
+	for i := range chars.Glyphs {
+		if run.Glyphs[i] != chars.Glyphs[i] || !near(run.Origins[i], chars.Origins[i]) {
+			t.Errorf("glyph %d is %d at %v, want %d at %v", i, run.Glyphs[i], run.Origins[i], chars.Glyphs[i], chars.Origins[i])
+		}
+	}
+}
+
+func TestTextGlyphIndexMissingFace(t *testing.T) {
+	d, p := textDevice(t, "Arial")
+	d.setFonts(NewFontResolver(fontDir(t)))
+	report := &fontReport{}
+	d.setFontReport(report)
+
+	// the opaque rectangle is drawn, the glyphs of the missing face are not
+	rect := w32.RECT{Left: 10, Top: 10, Right: 50, Bottom: 50}
+	d.SetBkColor(0x0000FF)
+	if err := d.ExtTextOut(10, 50, ETO_GLYPH_INDEX|ETO_OPAQUE, &rect, []uint16{36, 74}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.runs) != 0 {
+		t.Errorf("glyphs of a substituted face are drawn as %q", string(p.runs[0].Text))
+	}
+	img, _ := p.Image()
+	if c := img.RGBAAt(30, 30); c != (color.RGBA{0xFF, 0, 0, 0xFF}) {
+		t.Errorf("opaque rectangle is %v", c)
+	}
+
+	// the characters are drawn with the substitute
+	if err := d.ExtTextOut(10, 50, 0, nil, []uint16{'A', 'g'}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.runs) != 1 {
+		t.Errorf("%d runs, want 1", len(p.runs))
+	}
+
+	if l := report.list(); len(l) != 1 || l[0].Face != "Arial" || !l[0].Substituted || !l[0].GlyphsSkipped {
+		t.Errorf("report is %+v", l)
+	}
+}
+
+func TestEmrTextGlyphString(t *testing.T) {
+	text := EmrText{Options: ETO_GLYPH_INDEX, OutputString: []uint16{36, 74}}
+	if s := text.GetString(); s != "" {
+		t.Errorf("string of glyphs is %q, want none", s)
+	}
+
+	text.Options = 0
+	if s := text.GetString(); s != "$J" {
+		t.Errorf("string is %q, want %q", s, "$J")
+	}
+}
+
+func TestTextRotation(t *testing.T) {
+	tests := []struct {
+		name               string
+		escapement, orient int32
+		mode               int
+		second             raster.Point // origin of the second glyph
+		glyph              raster.Matrix
+	}{
+		{"none", 0, 0, w32.GM_COMPATIBLE, raster.Pt(20, 50), raster.Scale(20, 20)},
+		{"escapement", 900, 0, w32.GM_COMPATIBLE, raster.Pt(10, 40), raster.Matrix{B: -20, C: 20}},
+		{"orientation ignored", 0, 900, w32.GM_COMPATIBLE, raster.Pt(20, 50), raster.Scale(20, 20)},
+		{"orientation", 0, 900, w32.GM_ADVANCED, raster.Pt(20, 50), raster.Matrix{B: -20, C: 20}},
+		{"escapement clockwise", -900, -900, w32.GM_ADVANCED, raster.Pt(10, 60), raster.Matrix{B: 20, C: -20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, p := textDevice(t, "Arial")
+			d.state.font.LogFont.Escapement = tt.escapement
+			d.state.font.LogFont.Orientation = tt.orient
+			d.setTextMode(tt.mode)
+			d.SetTextAlign(TA_BASELINE)
+
+			if err := d.ExtTextOut(10, 50, 0, nil, []uint16{'a', 'b'}, []int32{10, 10}); err != nil {
+				t.Fatal(err)
+			}
+
+			run := p.runs[0]
+			if !near(run.Origins[1], tt.second) {
+				t.Errorf("second origin is %v, want %v", run.Origins[1], tt.second)
+			}
+
+			m := run.Matrix
+			if !near(raster.Pt(m.A, m.B), raster.Pt(tt.glyph.A, tt.glyph.B)) || !near(raster.Pt(m.C, m.D), raster.Pt(tt.glyph.C, tt.glyph.D)) {
+				t.Errorf("glyph matrix is %v, want %v", m, tt.glyph)
+			}
+		})
+	}
+}
+
+func TestTextVertical(t *testing.T) {
+	d, p := textDevice(t, "@Arial")
+	d.SetTextAlign(TA_BASELINE)
+
+	// the ideographs stand upright and advance by the em size, the latin
+	// letters lie along the line
+	if err := d.ExtTextOut(10, 50, 0, nil, []uint16{0x65E5, 'A', 0x3001}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.runs) != 2 {
+		t.Fatalf("%d runs, want 2", len(p.runs))
+	}
+
+	run, upright := p.runs[0], p.runs[1]
+	if string(run.Text) != "A" || string(upright.Text) != "\u65E5\u3001" {
+		t.Fatalf("runs are %q and %q", string(run.Text), string(upright.Text))
+	}
+	if run.Font != "Arial" {
+		t.Errorf("font of the run is %q, want it without the @", run.Font)
+	}
+	if !near(run.Origins[0], raster.Pt(30, 50)) {
+		t.Errorf("latin letter is at %v, want after an em", run.Origins[0])
+	}
+
+	// the upright glyphs are turned a quarter counterclockwise
+	if m := upright.Matrix; !near(raster.Pt(m.A, m.B), raster.Pt(0, -20)) || !near(raster.Pt(m.C, m.D), raster.Pt(20, 0)) {
+		t.Errorf("upright glyph matrix is %v", m)
+	}
+	if upright.Underline || upright.StrikeOut {
+		t.Error("upright glyphs carry the lines of the run")
+	}
+}
@@ -0,0 +1,340 @@
+package emf
+
+import (
+	"errors"
+	"math"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+)
+
+// mapping is the transform of logical units to device units, the world
+// transform followed by the page transform, which the mapping mode, the
+// window and the viewport make.
+type mapping struct {
+	mapMode     int
+	windowOrg   raster.Point
+	windowExt   raster.Point
+	viewportOrg raster.Point
+	viewportExt raster.Point
+	world       raster.Matrix
+
+	device raster.Point // size of the device in pixels
+	pixel  raster.Point // size of a device pixel in mm
+}
+
+// mapModeUnits are the sizes in mm of the logical units of the fixed
+// mapping modes.
+var mapModeUnits = map[int]float64{
+	MM_LOMETRIC:  0.1,
+	MM_HIMETRIC:  0.01,
+	MM_LOENGLISH: 0.254,
+	MM_HIENGLISH: 0.0254,
+	MM_TWIPS:     25.4 / 1440,
+}
+
+// newMapping returns the MM_TEXT mapping of a device of width x height
+// pixels at 96 dpi.
+func newMapping(width, height int) mapping {
+	return mapping{
+		mapMode:     MM_TEXT,
+		windowExt:   raster.Pt(1, 1),
+		viewportExt: raster.Pt(1, 1),
+		world:       raster.Identity(),
+		device:      raster.Pt(float64(width), float64(height)),
+		pixel:       raster.Pt(25.4/96, 25.4/96),
+	}
+}
+
+// page returns the mapping from page space to device space.
+func (m *mapping) page() raster.Matrix {
+	if m.windowExt.X == 0 || m.windowExt.Y == 0 {
+		return raster.Identity()
+	}
+
+	sx := m.viewportExt.X / m.windowExt.X
+	sy := m.viewportExt.Y / m.windowExt.Y
+
+	if m.mapMode == MM_ISOTROPIC {
+		// the same unit size on both axes, the smaller one wins
+		k := math.Min(math.Abs(sx), math.Abs(sy))
+		sx = math.Copysign(k, sx)
+		sy = math.Copysign(k, sy)
+	}
+
+	return raster.Translate(-m.windowOrg.X, -m.windowOrg.Y).
+		Mul(raster.Scale(sx, sy)).
+		Mul(raster.Translate(m.viewportOrg.X, m.viewportOrg.Y))
+}
+
+// matrix returns the mapping from logical units to device units.
+func (m *mapping) matrix() raster.Matrix {
+	return m.world.Mul(m.page())
+}
+
+// scalable reports whether the extents can be changed, only the window
+// and viewport origins move in the other mapping modes.
+func (m *mapping) scalable() bool {
+	return m.mapMode == MM_ISOTROPIC || m.mapMode == MM_ANISOTROPIC
+}
+
+// setMapMode sets the extents of the mode as GDI does. A fixed mode maps
+// its unit to device pixels with the Y axis pointing up, MM_ISOTROPIC
+// starts from the extents of MM_LOMETRIC and MM_ANISOTROPIC keeps the
+// current ones.
+func (m *mapping) setMapMode(mode int) error {
+	switch mode {
+	case MM_TEXT:
+		m.windowExt = raster.Pt(1, 1)
+		m.viewportExt = raster.Pt(1, 1)
+	case MM_LOMETRIC, MM_HIMETRIC, MM_LOENGLISH, MM_HIENGLISH, MM_TWIPS, MM_ISOTROPIC:
+		unit, ok := mapModeUnits[mode]
+		if !ok {
+			unit = mapModeUnits[MM_LOMETRIC]
+		}
+
+		m.windowExt = raster.Pt(
+			math.Round(m.device.X*m.pixel.X/unit),
+			math.Round(m.device.Y*m.pixel.Y/unit),
+		)
+		m.viewportExt = raster.Pt(m.device.X, -m.device.Y)
+	case MM_ANISOTROPIC:
+	default:
+		return errors.New("invalid map mode")
+	}
+
+	m.mapMode = mode
+	return nil
+}
+
+func (m *mapping) setWindowExt(cx, cy int) error {
+	if cx == 0 || cy == 0 {
+		return errors.New("invalid window extent")
+	}
+
+	if m.scalable() {
+		m.windowExt = raster.Pt(float64(cx), float64(cy))
+	}
+	return nil
+}
+
+func (m *mapping) setViewportExt(cx, cy int) error {
+	if cx == 0 || cy == 0 {
+		return errors.New("invalid viewport extent")
+	}
+
+	if m.scalable() {
+		m.viewportExt = raster.Pt(float64(cx), float64(cy))
+	}
+	return nil
+}
+
+// scaleExt multiplies an extent by the ratios with integer division, as
+// ScaleWindowExtEx and ScaleViewportExtEx do.
+func (m *mapping) scaleExt(ext *raster.Point, xNum, xDenom, yNum, yDenom int) error {
+	if xDenom == 0 || yDenom == 0 || xNum == 0 || yNum == 0 {
+		return errors.New("invalid extent scale")
+	}
+
+	if m.scalable() {
+		ext.X = math.Trunc(ext.X * float64(xNum) / float64(xDenom))
+		ext.Y = math.Trunc(ext.Y * float64(yNum) / float64(yDenom))
+	}
+	return nil
+}
+
+func xformMatrix(xform w32.XFORM) raster.Matrix {
+	return raster.Matrix{
+		A: float64(xform.M11),
+		B: float64(xform.M12),
+		C: float64(xform.M21),
+		D: float64(xform.M22),
+		E: float64(xform.Dx),
+		F: float64(xform.Dy),
+	}
+}
+
+func (m *mapping) setWorld(xform w32.XFORM) error {
+	w := xformMatrix(xform)
+	if _, ok := w.Invert(); !ok {
+		return errors.New("world transform is not invertible")
+	}
+
+	m.world = w
+	return nil
+}
+
+// modifyWorld combines the world transform with xform. MWT_LEFTMULTIPLY
+// applies xform before the world transform, MWT_RIGHTMULTIPLY after it.
+func (m *mapping) modifyWorld(xform w32.XFORM, mode uint32) error {
+	x := xformMatrix(xform)
+
+	var w raster.Matrix
+	switch mode {
+	case MWT_IDENTITY:
+		w = raster.Identity()
+	case MWT_LEFTMULTIPLY:
+		w = x.Mul(m.world)
+	case MWT_RIGHTMULTIPLY:
+		w = m.world.Mul(x)
+	case MWT_SET:
+		w = x
+	default:
+		return errors.New("invalid world transform mode")
+	}
+
+	if _, ok := w.Invert(); !ok {
+		return errors.New("world transform is not invertible")
+	}
+
+	m.world = w
+	return nil
+}
+
+// pixelSize returns the size in mm of a pixel of the reference device.
+func (h *HeaderRecord) pixelSize() raster.Point {
+	hdr := h.Original
+	if hdr.Device.CX <= 0 || hdr.Device.CY <= 0 {
+		return raster.Pt(25.4/96, 25.4/96)
+	}
+
+	if h.Ext2.MicrometersX > 0 && h.Ext2.MicrometersY > 0 {
+		return raster.Pt(
+			float64(h.Ext2.MicrometersX)/1000/float64(hdr.Device.CX),
+			float64(h.Ext2.MicrometersY)/1000/float64(hdr.Device.CY),
+		)
+	}
+
+	if hdr.Millimeters.CX > 0 && hdr.Millimeters.CY > 0 {
+		return raster.Pt(
+			float64(hdr.Millimeters.CX)/float64(hdr.Device.CX),
+			float64(hdr.Millimeters.CY)/float64(hdr.Device.CY),
+		)
+	}
+
+	return raster.Pt(25.4/96, 25.4/96)
+}
+
+// compatDevice runs the mapping of a device in GM_COMPATIBLE, which has no
+// world transform. It keeps the whole mapping and sets the window and
+// viewport of the device to the combined transform, which they can express
+// unless the world transform rotates or shears.
+type compatDevice struct {
+	Device
+
+	mapping mapping
+	saved   []mapping
+}
+
+func newCompatDevice(dev Device, width, height int) *compatDevice {
+	return &compatDevice{Device: dev, mapping: newMapping(width, height)}
+}
+
+func (d *compatDevice) setPixelSize(size raster.Point) {
+	d.mapping.pixel = size
+}
+
+// apply sets the window and viewport of the device to the mapping. The
+// window is large so the integer extents keep the scale precise.
+func (d *compatDevice) apply(err error) error {
+	if err != nil {
+		return err
+	}
+
+	m := d.mapping.matrix()
+	if m.B != 0 || m.C != 0 {
+		log.Warn("world transform with rotation or shear is drawn without them in GM_COMPATIBLE")
+	}
+
+	n := float64(1 << 16)
+	for n > 1 && math.Max(math.Abs(m.A), math.Abs(m.D))*n > 1<<30 {
+		n /= 2
+	}
+
+	cx, cy := int(math.Round(m.A*n)), int(math.Round(m.D*n))
+	if cx == 0 || cy == 0 {
+		return errors.New("mapping scale is too small")
+	}
+
+	if err := d.Device.SetMapMode(MM_ANISOTROPIC); err != nil {
+		return err
+	}
+	if err := d.Device.SetWindowOrgEx(0, 0); err != nil {
+		return err
+	}
+	if err := d.Device.SetWindowExtEx(int(n), int(n)); err != nil {
+		return err
+	}
+	if err := d.Device.SetViewportExtEx(cx, cy); err != nil {
+		return err
+	}
+	return d.Device.SetViewportOrgEx(int(math.Round(m.E)), int(math.Round(m.F)))
+}
+
+func (d *compatDevice) SaveDC() error {
+	if err := d.Device.SaveDC(); err != nil {
+		return err
+	}
+
+	d.saved = append(d.saved, d.mapping)
+	return nil
+}
+
+func (d *compatDevice) RestoreDC(savedDC int) error {
+	if err := d.Device.RestoreDC(savedDC); err != nil {
+		return err
+	}
+
+	idx := savedDC - 1
+	if savedDC < 0 {
+		idx = len(d.saved) + savedDC
+	}
+
+	if idx < 0 || idx >= len(d.saved) {
+		return errors.New("failed to run RestoreDC")
+	}
+
+	d.mapping = d.saved[idx]
+	d.saved = d.saved[:idx]
+
+	return d.apply(nil)
+}
+
+func (d *compatDevice) SetMapMode(mode int) error {
+	return d.apply(d.mapping.setMapMode(mode))
+}
+
+func (d *compatDevice) SetWindowExtEx(cx, cy int) error {
+	return d.apply(d.mapping.setWindowExt(cx, cy))
+}
+
+func (d *compatDevice) SetWindowOrgEx(x, y int) error {
+	d.mapping.windowOrg = raster.Pt(float64(x), float64(y))
+	return d.apply(nil)
+}
+
+func (d *compatDevice) SetViewportExtEx(cx, cy int) error {
+	return d.apply(d.mapping.setViewportExt(cx, cy))
+}
+
+func (d *compatDevice) SetViewportOrgEx(x, y int) error {
+	d.mapping.viewportOrg = raster.Pt(float64(x), float64(y))
+	return d.apply(nil)
+}
+
+func (d *compatDevice) ScaleWindowExtEx(xNum, xDenom, yNum, yDenom int) error {
+	return d.apply(d.mapping.scaleExt(&d.mapping.windowExt, xNum, xDenom, yNum, yDenom))
+}
+
+func (d *compatDevice) ScaleViewportExtEx(xNum, xDenom, yNum, yDenom int) error {
+	return d.apply(d.mapping.scaleExt(&d.mapping.viewportExt, xNum, xDenom, yNum, yDenom))
+}
+
+func (d *compatDevice) SetWorldTransform(xform w32.XFORM) error {
+	return d.apply(d.mapping.setWorld(xform))
+}
+
+func (d *compatDevice) ModifyWorldTransform(xform w32.XFORM, mode uint32) error {
+	return d.apply(d.mapping.modifyWorld(xform, mode))
+}
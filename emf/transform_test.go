@@ -0,0 +1,187 @@
+package emf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lokks307/go-emf/raster"
+	"github.com/lokks307/go-emf/w32"
+)
+
+// testMapping returns the mapping of a device of 100 x 100 pixels of a
+// quarter millimeter.
+func testMapping() mapping {
+	m := newMapping(100, 100)
+	m.pixel = raster.Pt(0.25, 0.25)
+	return m
+}
+
+func nearPoint(a, b raster.Point) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9
+}
+
+func TestMappingModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(m *mapping)
+		in    raster.Point
+		out   raster.Point
+	}{
+		{"text", func(m *mapping) {}, raster.Pt(10, 20), raster.Pt(10, 20)},
+		{"text ignores extents", func(m *mapping) {
+			m.setWindowExt(10, 10)
+			m.setViewportExt(20, 20)
+		}, raster.Pt(10, 20), raster.Pt(10, 20)},
+		{"text origins", func(m *mapping) {
+			m.windowOrg = raster.Pt(5, 5)
+			m.viewportOrg = raster.Pt(1, 2)
+		}, raster.Pt(10, 20), raster.Pt(6, 17)},
+		{"lometric", func(m *mapping) { m.setMapMode(MM_LOMETRIC) }, raster.Pt(100, 100), raster.Pt(40, -40)},
+		{"himetric", func(m *mapping) { m.setMapMode(MM_HIMETRIC) }, raster.Pt(1000, 1000), raster.Pt(40, -40)},
+		{"loenglish", func(m *mapping) { m.setMapMode(MM_LOENGLISH) }, raster.Pt(98, 98), raster.Pt(100, -100)},
+		{"hienglish", func(m *mapping) { m.setMapMode(MM_HIENGLISH) }, raster.Pt(984, 984), raster.Pt(100, -100)},
+		{"twips", func(m *mapping) { m.setMapMode(MM_TWIPS) }, raster.Pt(1417, 1417), raster.Pt(100, -100)},
+		{"fixed ignores extents", func(m *mapping) {
+			m.setMapMode(MM_LOMETRIC)
+			m.setWindowExt(1, 1)
+		}, raster.Pt(100, 100), raster.Pt(40, -40)},
+		{"isotropic", func(m *mapping) {
+			m.setMapMode(MM_ISOTROPIC)
+			m.setWindowExt(100, 50)
+			m.setViewportExt(100, 100)
+		}, raster.Pt(10, 10), raster.Pt(10, 10)},
+		{"isotropic flipped", func(m *mapping) {
+			m.setMapMode(MM_ISOTROPIC)
+			m.setWindowExt(100, 50)
+			m.setViewportExt(100, -100)
+		}, raster.Pt(10, 10), raster.Pt(10, -10)},
+		{"isotropic from lometric", func(m *mapping) { m.setMapMode(MM_ISOTROPIC) }, raster.Pt(100, 100), raster.Pt(40, -40)},
+		{"anisotropic", func(m *mapping) {
+			m.setMapMode(MM_ANISOTROPIC)
+			m.setWindowExt(200, 50)
+			m.setViewportExt(100, 100)
+		}, raster.Pt(10, 10), raster.Pt(5, 20)},
+		{"anisotropic origins", func(m *mapping) {
+			m.setMapMode(MM_ANISOTROPIC)
+			m.setWindowExt(200, 50)
+			m.setViewportExt(100, 100)
+			m.windowOrg = raster.Pt(10, 10)
+			m.viewportOrg = raster.Pt(5, 5)
+		}, raster.Pt(10, 10), raster.Pt(5, 5)},
+		{"anisotropic keeps extents", func(m *mapping) {
+			m.setMapMode(MM_LOMETRIC)
+			m.setMapMode(MM_ANISOTROPIC)
+		}, raster.Pt(100, 100), raster.Pt(40, -40)},
+		{"scaled extents", func(m *mapping) {
+			m.setMapMode(MM_ANISOTROPIC)
+			m.setWindowExt(10, 10)
+			m.setViewportExt(10, 10)
+			m.scaleExt(&m.viewportExt, 3, 2, 7, 3)
+		}, raster.Pt(10, 10), raster.Pt(15, 23)},
+		{"world before page", func(m *mapping) {
+			m.setMapMode(MM_ANISOTROPIC)
+			m.setWindowExt(2, 2)
+			m.setViewportExt(1, 1)
+			m.setWorld(w32.XFORM{M11: 1, M22: 1, Dx: 10})
+		}, raster.Pt(10, 10), raster.Pt(10, 5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMapping()
+			tt.setup(&m)
+
+			if got := m.matrix().Apply(tt.in); !nearPoint(got, tt.out) {
+				t.Errorf("%v maps to %v, want %v", tt.in, got, tt.out)
+			}
+		})
+	}
+}
+
+func TestMappingErrors(t *testing.T) {
+	m := testMapping()
+
+	if err := m.setMapMode(0); err == nil {
+		t.Error("invalid map mode succeeded")
+	}
+	if err := m.setWindowExt(0, 1); err == nil {
+		t.Error("window extent of 0 succeeded")
+	}
+	if err := m.setViewportExt(1, 0); err == nil {
+		t.Error("viewport extent of 0 succeeded")
+	}
+	if err := m.setWorld(w32.XFORM{M11: 1, M12: 2, M21: 2, M22: 4}); err == nil {
+		t.Error("singular world transform succeeded")
+	}
+	if err := m.modifyWorld(w32.XFORM{M11: 1, M22: 1}, 9); err == nil {
+		t.Error("invalid world transform mode succeeded")
+	}
+	if !m.world.IsIdentity() {
+		t.Errorf("failed calls changed the world transform to %v", m.world)
+	}
+}
+
+func TestModifyWorldTransform(t *testing.T) {
+	double := w32.XFORM{M11: 2, M22: 1}
+	shift := w32.XFORM{M11: 1, M22: 1, Dx: 10}
+	rotate := w32.XFORM{M11: 0, M12: 1, M21: -1, M22: 0}
+
+	tests := []struct {
+		name  string
+		world w32.XFORM
+		xform w32.XFORM
+		mode  uint32
+		in    raster.Point
+		out   raster.Point
+	}{
+		// the x form of LEFTMULTIPLY applies first, of RIGHTMULTIPLY last
+		{"left multiply", double, shift, MWT_LEFTMULTIPLY, raster.Pt(0, 0), raster.Pt(20, 0)},
+		{"right multiply", double, shift, MWT_RIGHTMULTIPLY, raster.Pt(0, 0), raster.Pt(10, 0)},
+		{"left multiply rotation", shift, rotate, MWT_LEFTMULTIPLY, raster.Pt(1, 0), raster.Pt(10, 1)},
+		{"right multiply rotation", shift, rotate, MWT_RIGHTMULTIPLY, raster.Pt(1, 0), raster.Pt(0, 11)},
+		{"identity", double, shift, MWT_IDENTITY, raster.Pt(3, 4), raster.Pt(3, 4)},
+		{"set", double, shift, MWT_SET, raster.Pt(3, 4), raster.Pt(13, 4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMapping()
+			if err := m.setWorld(tt.world); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.modifyWorld(tt.xform, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := m.matrix().Apply(tt.in); !nearPoint(got, tt.out) {
+				t.Errorf("%v maps to %v, want %v", tt.in, got, tt.out)
+			}
+		})
+	}
+}
+
+func TestWorldTransformDrawn(t *testing.T) {
+	// a rotated rectangle is drawn turned on the software device
+	b := NewBuilder(w32.RECT{Right: 19, Bottom: 19}, w32.RECT{})
+	b.SelectPen(PS_NULL, 0, 0)
+	b.SelectBrush(BS_SOLID, 0x000000, 0)
+	b.Add(&SetWorldTransformRecord{Record: Record{Type: EMR_SETWORLDTRANSFORM}, XForm: w32.XFORM{M11: 0, M12: 1, M21: -1, M22: 0, Dx: 20}})
+	b.Rectangle(0, 0, 20, 5)
+
+	dev := NewRasterDevice(20, 20)
+	if err := b.File().DrawToDevice(dev); err != nil {
+		t.Fatal(err)
+	}
+	img, err := dev.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rectangle covers x 15..20 for the whole height
+	if c := img.RGBAAt(17, 15); c.R != 0 {
+		t.Errorf("pixel inside the turned rectangle is %v", c)
+	}
+	if c := img.RGBAAt(5, 2); c.R == 0 {
+		t.Errorf("pixel inside the unturned rectangle is %v", c)
+	}
+}
@@ -3,7 +3,7 @@ package emf
 import (
 	"bytes"
 	"encoding/binary"
-	"os"
+	"io"
 	"unicode/utf16"
 
 	"github.com/lokks307/go-emf/w32"
@@ -30,7 +30,10 @@ func readLogPenEx(reader *bytes.Reader) (w32.LOGPENEX, error) {
 		return r, err
 	}
 
-	if r.PenStyle == PS_USERSTYLE && r.NumStyleEntries > 0 {
+	if r.PenStyle&w32.PS_STYLE_MASK == PS_USERSTYLE && r.NumStyleEntries > 0 {
+		if err := checkCount(reader, r.NumStyleEntries, 4); err != nil {
+			return r, err
+		}
 		r.StyleEntry = make([]uint32, r.NumStyleEntries)
 		if err := binary.Read(reader, binary.LittleEndian, &r.StyleEntry); err != nil {
 			return r, err
@@ -45,13 +48,20 @@ type EmrText struct {
 	Chars        uint32
 	OffString    uint32
 	Options      uint32
-	Rectangle    w32.RECT
+	Rectangle    w32.RECT // not stored with ETO_NO_RECT
 	OffDx        uint32
-	OutputString []uint16
-	OutputDx     []int32
+	OutputString []uint16 // stored as bytes with ETO_SMALL_CHARS
+	OutputDx     []int32  // pairs of x and y distances with ETO_PDY
+
+	// AnsiString is the string of the ANSI records, which is decoded by the
+	// charset of the selected font when it is drawn.
+	AnsiString []byte
 }
 
-func readEmrText(reader *bytes.Reader, offset int) (EmrText, error) {
+// readEmrText reads an EmrText object, the offsets of the string and the
+// distances are from the start of the record. The string of the ANSI
+// records is read into AnsiString.
+func readEmrText(reader *bytes.Reader, ansi bool) (EmrText, error) {
 	r := EmrText{}
 	if err := binary.Read(reader, binary.LittleEndian, &r.Reference); err != nil {
 		return r, err
@@ -65,23 +75,63 @@ func readEmrText(reader *bytes.Reader, offset int) (EmrText, error) {
 	if err := binary.Read(reader, binary.LittleEndian, &r.Options); err != nil {
 		return r, err
 	}
-	if err := binary.Read(reader, binary.LittleEndian, &r.Rectangle); err != nil {
-		return r, err
+	if r.Options&ETO_NO_RECT == 0 {
+		if err := binary.Read(reader, binary.LittleEndian, &r.Rectangle); err != nil {
+			return r, err
+		}
 	}
 	if err := binary.Read(reader, binary.LittleEndian, &r.OffDx); err != nil {
 		return r, err
 	}
 
-	reader.Seek(int64(int(r.OffString)-(offset-reader.Len())), os.SEEK_CUR) // UndefinedSpace1
-
-	r.OutputString = make([]uint16, r.Chars)
-	if err := binary.Read(reader, binary.LittleEndian, &r.OutputString); err != nil {
+	if err := seekRecord(reader, r.OffString); err != nil {
 		return r, err
 	}
 
-	reader.Seek(int64(int(r.OffDx)-(offset-reader.Len())), os.SEEK_CUR) // UndefinedSpace2
+	if ansi || r.Options&ETO_SMALL_CHARS != 0 {
+		if err := checkCount(reader, r.Chars, 1); err != nil {
+			return r, err
+		}
+
+		s := make([]byte, r.Chars)
+		if _, err := io.ReadFull(reader, s); err != nil {
+			return r, err
+		}
+
+		if ansi {
+			r.AnsiString = s
+		} else {
+			r.OutputString = widenString(s)
+		}
+	} else {
+		if err := checkCount(reader, r.Chars, 2); err != nil {
+			return r, err
+		}
+
+		r.OutputString = make([]uint16, r.Chars)
+		if err := binary.Read(reader, binary.LittleEndian, &r.OutputString); err != nil {
+			return r, err
+		}
+	}
+
+	// the distances are optional
+	if r.OffDx == 0 {
+		return r, nil
+	}
+
+	count := r.Chars
+	if r.Options&ETO_PDY != 0 {
+		count *= 2
+	}
 
-	r.OutputDx = make([]int32, r.Chars)
+	if err := seekRecord(reader, r.OffDx); err != nil {
+		return r, err
+	}
+	if err := checkCount(reader, count, 4); err != nil {
+		return r, err
+	}
+
+	r.OutputDx = make([]int32, count)
 	if err := binary.Read(reader, binary.LittleEndian, &r.OutputDx); err != nil {
 		return r, err
 	}
@@ -89,8 +139,42 @@ func readEmrText(reader *bytes.Reader, offset int) (EmrText, error) {
 	return r, nil
 }
 
+// GetString returns the string, which is empty with ETO_GLYPH_INDEX as the
+// glyphs are characters only in the font they were laid out with.
 func (t *EmrText) GetString() string {
-	return string(utf16.Decode(t.OutputString))
+	if t.Options&ETO_GLYPH_INDEX != 0 {
+		return ""
+	}
+	return utf16ToString(t.OutputString)
+}
+
+// options returns the options of the string for ExtTextOut, without those
+// which only tell how the record is stored.
+func (t *EmrText) options() uint32 {
+	return t.Options &^ (ETO_SMALL_CHARS | ETO_NO_RECT)
+}
+
+// rect returns the clipping or opaquing rectangle, nil when the record has
+// none.
+func (t *EmrText) rect() *w32.RECT {
+	if t.Options&ETO_NO_RECT != 0 {
+		return nil
+	}
+	return &t.Rectangle
+}
+
+// widenString returns the UTF-16 string of the 8-bit characters stored with
+// ETO_SMALL_CHARS, which are the low bytes of the characters.
+func widenString(s []byte) []uint16 {
+	text := make([]uint16, len(s))
+	for i, b := range s {
+		text[i] = uint16(b)
+	}
+	return text
+}
+
+func utf16ToString(s []uint16) string {
+	return string(utf16.Decode(s))
 }
 
 type PointS struct {
@@ -181,6 +265,9 @@ func readLogPalette(reader *bytes.Reader) (w32.LOGPALETTE, error) {
 	if err := binary.Read(reader, binary.LittleEndian, &r.NumberOfEntries); err != nil {
 		return r, err
 	}
+	if err := checkCount(reader, uint32(r.NumberOfEntries), 4); err != nil {
+		return r, err
+	}
 	r.PaletteEntries = make([]w32.COLORREF, r.NumberOfEntries)
 	if err := binary.Read(reader, binary.LittleEndian, &r.PaletteEntries); err != nil {
 		return r, err
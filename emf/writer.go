@@ -0,0 +1,624 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// recordMarshaler is implemented by records whose data is more than their
+// fields written in order, usually because it holds offsets into the record.
+type recordMarshaler interface {
+	// marshal writes the record data following the type and the size.
+	marshal(w *bytes.Buffer) error
+}
+
+// record gives access to the type and size of every record, which all embed
+// Record.
+func (r *Record) record() *Record {
+	return r
+}
+
+// WriteTo writes the metafile to w. The sizes of the records, the size,
+// record and handle counts of the header and the last size of the EOF record
+// are computed from the records, which are updated to match the output.
+func (f *EmfFile) WriteTo(w io.Writer) (int64, error) {
+	if f.Header == nil {
+		return 0, errors.New("missing EMF header")
+	}
+
+	eof := f.Eof
+	if eof == nil {
+		eof = &EofRecord{Record: Record{Type: EMR_EOF}}
+	}
+
+	var body bytes.Buffer
+	for _, rec := range f.Records {
+		if err := writeRecord(&body, rec); err != nil {
+			return 0, err
+		}
+	}
+
+	var tail bytes.Buffer
+	if err := writeRecord(&tail, eof); err != nil {
+		return 0, err
+	}
+
+	// the header is written twice, the first time to learn its size
+	var header bytes.Buffer
+	f.Header.Original.Records = uint32(len(f.Records) + 2)
+	f.Header.Original.Handles = f.handles()
+	if err := writeRecord(&header, f.Header); err != nil {
+		return 0, err
+	}
+
+	f.Header.Original.Bytes = uint32(header.Len() + body.Len() + tail.Len())
+
+	header.Reset()
+	if err := writeRecord(&header, f.Header); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, buf := range []*bytes.Buffer{&header, &body, &tail} {
+		m, err := buf.WriteTo(w)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// handles returns the number of handles used by the records, including the
+// reserved index 0.
+func (f *EmfFile) handles() uint16 {
+	max := uint32(0)
+
+	for _, rec := range f.Records {
+		var ih uint32
+
+		switch rec := rec.(type) {
+		case *CreatePenRecord:
+			ih = rec.IhPen
+		case *ExtCreatePenRecord:
+			ih = rec.IhPen
+		case *CreateBrushIndirectRecord:
+			ih = rec.IhBrush
+		case *CreatePaletteRecord:
+			ih = rec.IhPal
+		case *ExtCreateFontIndirectWRecord:
+			ih = rec.IhFonts
+		case *RawRecord:
+			switch rec.Type {
+			case EMR_CREATEMONOBRUSH, EMR_CREATEDIBPATTERNBRUSHPT, EMR_CREATECOLORSPACE, EMR_CREATECOLORSPACEW:
+				if len(rec.Data) >= 4 {
+					ih = binary.LittleEndian.Uint32(rec.Data)
+				}
+			}
+		}
+
+		if ih > max {
+			max = ih
+		}
+	}
+
+	return uint16(max + 1)
+}
+
+func writeRecord(w *bytes.Buffer, rec Recorder) error {
+	hdr, ok := rec.(interface{ record() *Record })
+	if !ok {
+		return errors.New("record does not embed Record")
+	}
+
+	var data bytes.Buffer
+	if m, ok := rec.(recordMarshaler); ok {
+		if err := m.marshal(&data); err != nil {
+			return err
+		}
+	} else if err := writeFields(&data, reflect.ValueOf(rec)); err != nil {
+		return err
+	}
+
+	// records are aligned to 4 bytes
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+
+	r := hdr.record()
+	r.Size = uint32(8 + data.Len())
+
+	if err := binary.Write(w, binary.LittleEndian, r); err != nil {
+		return err
+	}
+	_, err := data.WriteTo(w)
+	return err
+}
+
+// writeFields writes the exported fields of the struct v in order, except
+// for the embedded Record.
+func writeFields(w *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || field.Type == reflect.TypeOf(Record{}) {
+			continue
+		}
+		if err := writeValue(w, v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeValue(w *bytes.Buffer, v reflect.Value) error {
+	if binary.Size(v.Interface()) >= 0 {
+		return binary.Write(w, binary.LittleEndian, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return writeFields(w, v)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := writeValue(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return errors.New("unsupported field type " + v.Type().String())
+}
+
+func (r *HeaderRecord) marshal(w *bytes.Buffer) error {
+	hdr := r.Original
+	ext1 := r.Ext1
+
+	// the header is written with both extensions, followed by the
+	// description and the pixel format
+	off := uint32(108)
+
+	hdr.NDescription, hdr.OffDescription = 0, 0
+	if len(r.Description) > 0 {
+		hdr.NDescription, hdr.OffDescription = uint32(len(r.Description)), off
+		off += uint32(len(r.Description)) * 2
+		off = (off + 3) &^ 3
+	}
+
+	ext1.CbPixelFormat, ext1.OffPixelFormat = 0, 0
+	if len(r.PixelFormat) > 0 {
+		ext1.CbPixelFormat, ext1.OffPixelFormat = uint32(len(r.PixelFormat)), off
+	}
+
+	for _, v := range []interface{}{hdr, ext1, r.Ext2, r.Description} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if len(r.PixelFormat) > 0 {
+		for uint32(w.Len())+8 < ext1.OffPixelFormat {
+			w.WriteByte(0)
+		}
+		w.Write(r.PixelFormat)
+	}
+
+	r.Original.NDescription, r.Original.OffDescription = hdr.NDescription, hdr.OffDescription
+	r.Ext1.CbPixelFormat, r.Ext1.OffPixelFormat = ext1.CbPixelFormat, ext1.OffPixelFormat
+
+	return nil
+}
+
+func (r *EofRecord) marshal(w *bytes.Buffer) error {
+	r.NPalEntries = uint32(len(r.PalEntries))
+	r.OffPalEntries = 16
+	r.SizeLast = 20 + 4*r.NPalEntries
+
+	for _, v := range []interface{}{r.NPalEntries, r.OffPalEntries, r.PalEntries, r.SizeLast} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// marshal writes the comment data as read, which keeps the EMF+ records of
+// a CommentEmfPlusRecord.
+func (r *CommentRecord) marshal(w *bytes.Buffer) error {
+	w.Write(r.Data)
+	return nil
+}
+
+func (r *ExtCreateFontIndirectWRecord) marshal(w *bytes.Buffer) error {
+	if err := binary.Write(w, binary.LittleEndian, r.IhFonts); err != nil {
+		return err
+	}
+
+	if !r.isExDV {
+		return binary.Write(w, binary.LittleEndian, r.Elw.LOGFONT)
+	}
+
+	r.Elw.NumAxes = uint32(len(r.Elw.Values))
+	for _, v := range []interface{}{r.Elw.LOGFONTEX, r.Elw.Signature, r.Elw.NumAxes, r.Elw.Values} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// size returns the size of the fixed part of an EmrText, which has no
+// rectangle with ETO_NO_RECT.
+func (t *EmrText) size() uint32 {
+	if t.Options&ETO_NO_RECT != 0 {
+		return 24
+	}
+	return 40
+}
+
+// layout sets the count and the offsets of the string and the distances,
+// which are stored at off from the start of the record. It returns the data
+// to store there.
+func (t *EmrText) layout(off uint32, ansi bool) []byte {
+	var buf bytes.Buffer
+	switch {
+	case ansi:
+		t.Chars = uint32(len(t.AnsiString))
+		buf.Write(t.AnsiString)
+	case t.Options&ETO_SMALL_CHARS != 0:
+		t.Chars = uint32(len(t.OutputString))
+		for _, c := range t.OutputString {
+			buf.WriteByte(byte(c))
+		}
+	default:
+		t.Chars = uint32(len(t.OutputString))
+		binary.Write(&buf, binary.LittleEndian, t.OutputString)
+	}
+	t.OffString = off
+
+	t.OffDx = 0
+	if len(t.OutputDx) > 0 {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+		t.OffDx = off + uint32(buf.Len())
+		binary.Write(&buf, binary.LittleEndian, t.OutputDx)
+	}
+
+	return buf.Bytes()
+}
+
+// write writes the fixed part of t.
+func (t *EmrText) write(w *bytes.Buffer) error {
+	fields := []interface{}{t.Reference, t.Chars, t.OffString, t.Options}
+	if t.Options&ETO_NO_RECT == 0 {
+		fields = append(fields, t.Rectangle)
+	}
+	fields = append(fields, t.OffDx)
+
+	for _, v := range fields {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalText writes a text record of one EmrText, which follows the 36
+// bytes of the record.
+func marshalText(w *bytes.Buffer, bounds w32.RECT, mode uint32, exScale, eyScale float32, t *EmrText, ansi bool) error {
+	data := t.layout(36+t.size(), ansi)
+
+	for _, v := range []interface{}{bounds, mode, exScale, eyScale} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if err := t.write(w); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+func (r *ExtTextOutWRecord) marshal(w *bytes.Buffer) error {
+	return marshalText(w, r.Bounds, r.IGraphicsMode, r.ExScale, r.EyScale, &r.WEmrText, false)
+}
+
+func (r *ExtTextOutARecord) marshal(w *bytes.Buffer) error {
+	return marshalText(w, r.Bounds, r.IGraphicsMode, r.ExScale, r.EyScale, &r.AEmrText, true)
+}
+
+func (r *PolyTextOutRecord) marshal(w *bytes.Buffer) error {
+	ansi := r.Type == EMR_POLYTEXTOUTA
+
+	// the strings and the distances follow the 40 bytes of the record and
+	// all the EmrText objects
+	off := uint32(40)
+	for i := range r.EmrTexts {
+		off += r.EmrTexts[i].size()
+	}
+
+	var data bytes.Buffer
+	for i := range r.EmrTexts {
+		data.Write(r.EmrTexts[i].layout(off+uint32(data.Len()), ansi))
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	r.Strings = uint32(len(r.EmrTexts))
+	for _, v := range []interface{}{r.Bounds, r.IGraphicsMode, r.ExScale, r.EyScale, r.Strings} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	for i := range r.EmrTexts {
+		if err := r.EmrTexts[i].write(w); err != nil {
+			return err
+		}
+	}
+
+	_, err := data.WriteTo(w)
+	return err
+}
+
+func (r *SmallTextOutRecord) marshal(w *bytes.Buffer) error {
+	r.Chars = uint32(len(r.TextString))
+
+	fields := []interface{}{r.X, r.Y, r.Chars, r.Options, r.IGraphicsMode, r.ExScale, r.EyScale}
+	if r.Options&ETO_NO_RECT == 0 {
+		fields = append(fields, r.Bounds)
+	}
+
+	for _, v := range fields {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if r.Options&ETO_SMALL_CHARS != 0 {
+		for _, c := range r.TextString {
+			w.WriteByte(byte(c))
+		}
+		return nil
+	}
+
+	return binary.Write(w, binary.LittleEndian, r.TextString)
+}
+
+// bitmapBuffer lays out a bitmap after the first off bytes of a record. It
+// returns the offsets and sizes to store in the record and the data which
+// follows the fixed part of the record.
+func bitmapBuffer(off uint32, bmi w32.BITMAPINFOHEADER, colors []w32.RGBQUAD, bits []byte) (offBmi, cbBmi, offBits, cbBits uint32, data []byte) {
+	if bmi.BiSize == 0 {
+		return 0, 0, 0, 0, nil
+	}
+
+	// only the BITMAPINFOHEADER part of larger headers is kept
+	bmi.BiSize = 40
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, bmi)
+	binary.Write(&buf, binary.LittleEndian, colors)
+
+	offBmi, cbBmi = off, uint32(buf.Len())
+	offBits, cbBits = offBmi+cbBmi, uint32(len(bits))
+	buf.Write(bits)
+
+	return offBmi, cbBmi, offBits, cbBits, buf.Bytes()
+}
+
+func (r *ExtCreatePenRecord) marshal(w *bytes.Buffer) error {
+	r.Elp.NumStyleEntries = uint32(len(r.Elp.StyleEntry))
+
+	var data []byte
+	r.OffBmi, r.CbBmi, r.OffBits, r.CbBits, data = bitmapBuffer(52+4*r.Elp.NumStyleEntries, r.BmiSrc, r.ColorsSrc, r.BitsSrc)
+
+	for _, v := range []interface{}{r.IhPen, r.OffBmi, r.CbBmi, r.OffBits, r.CbBits} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFields(w, reflect.ValueOf(r.Elp)); err != nil {
+		return err
+	}
+
+	w.Write(data)
+	return nil
+}
+
+func (r *BitBltRecord) marshal(w *bytes.Buffer) error {
+	var data []byte
+	r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc, data = bitmapBuffer(100, r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc)
+
+	if err := binary.Write(w, binary.LittleEndian, r.CommonBitmapInfo); err != nil {
+		return err
+	}
+
+	w.Write(data)
+	return nil
+}
+
+func (r *StretchbltRecord) marshal(w *bytes.Buffer) error {
+	var data []byte
+	r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc, data = bitmapBuffer(108, r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc)
+
+	for _, v := range []interface{}{r.CommonBitmapInfo, r.CxSrc, r.CySrc} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	w.Write(data)
+	return nil
+}
+
+func (r *MaskBltRecord) marshal(w *bytes.Buffer) error {
+	var src, mask []byte
+	r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc, src = bitmapBuffer(128, r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc)
+
+	off := (128 + uint32(len(src)) + 3) &^ 3
+	r.OffBmiMask, r.CbBmiMask, r.OffBitsMask, r.CbBitsMask, mask = bitmapBuffer(off, r.BmiMask.BITMAPINFOHEADER, r.ColorsMask, r.BitsMask)
+
+	for _, v := range []interface{}{r.CommonBitmapInfo, r.MaskAdditionInfo} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	w.Write(src)
+	if len(mask) > 0 {
+		for uint32(w.Len())+8 < off {
+			w.WriteByte(0)
+		}
+		w.Write(mask)
+	}
+
+	return nil
+}
+
+func (r *StretchDIBitsRecord) marshal(w *bytes.Buffer) error {
+	var data []byte
+	r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc, data = bitmapBuffer(80, r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc)
+
+	if err := binary.Write(w, binary.LittleEndian, r.StretchDIBitsInfo); err != nil {
+		return err
+	}
+
+	w.Write(data)
+	return nil
+}
+
+func (r *SetDIBitsToDeviceRecord) marshal(w *bytes.Buffer) error {
+	var data []byte
+	r.OffBmiSrc, r.CbBmiSrc, r.OffBitsSrc, r.CbBitsSrc, data = bitmapBuffer(76, r.BmiSrc.BITMAPINFOHEADER, r.ColorsSrc, r.BitsSrc)
+
+	if err := binary.Write(w, binary.LittleEndian, r.SetDIBitsToDeviceInfo); err != nil {
+		return err
+	}
+
+	w.Write(data)
+	return nil
+}
+
+// marshal writes the region as RDH_RECTANGLES and returns its size.
+func (r *RegionData) marshal(w *bytes.Buffer) (uint32, error) {
+	r.Size = 32
+	r.Type = RDH_RECTANGLES
+	r.CountRects = uint32(len(r.Data))
+	r.RgnSize = 16 * r.CountRects
+	r.Bounds = NewRegion(r.Data...).Bounds()
+
+	if err := binary.Write(w, binary.LittleEndian, r.RegionDataHeader); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, r.Data); err != nil {
+		return 0, err
+	}
+
+	return 32 + r.RgnSize, nil
+}
+
+func (r *FillRgnRecord) marshal(w *bytes.Buffer) error {
+	var rgn bytes.Buffer
+	size, err := r.RgnData.marshal(&rgn)
+	if err != nil {
+		return err
+	}
+	r.RgnDataSize = size
+
+	for _, v := range []interface{}{r.Bounds, r.RgnDataSize, r.IhBrush} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	_, err = rgn.WriteTo(w)
+	return err
+}
+
+func (r *FrameRgnRecord) marshal(w *bytes.Buffer) error {
+	var rgn bytes.Buffer
+	size, err := r.RgnData.marshal(&rgn)
+	if err != nil {
+		return err
+	}
+	r.RgnDataSize = size
+
+	for _, v := range []interface{}{r.Bounds, r.RgnDataSize, r.IhBrush, r.Width, r.Height} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	_, err = rgn.WriteTo(w)
+	return err
+}
+
+func (r *InvertRgnRecord) marshal(w *bytes.Buffer) error {
+	return marshalRgn(w, r.Bounds, &r.RgnDataSize, &r.RgnData)
+}
+
+func (r *PaintRgnRecord) marshal(w *bytes.Buffer) error {
+	return marshalRgn(w, r.Bounds, &r.RgnDataSize, &r.RgnData)
+}
+
+// marshalRgn writes the fields of EMR_INVERTRGN and EMR_PAINTRGN.
+func marshalRgn(w *bytes.Buffer, bounds w32.RECT, size *uint32, rgn *RegionData) error {
+	var data bytes.Buffer
+	n, err := rgn.marshal(&data)
+	if err != nil {
+		return err
+	}
+	*size = n
+
+	for _, v := range []interface{}{bounds, *size} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	_, err = data.WriteTo(w)
+	return err
+}
+
+func (r *ExtSelectClipRgnRecord) marshal(w *bytes.Buffer) error {
+	var rgn bytes.Buffer
+
+	// RGN_COPY without rectangles selects the default clipping region
+	r.RgnDataSize = 0
+	if r.RegionMode != RGN_COPY || len(r.RgnData.Data) > 0 {
+		size, err := r.RgnData.marshal(&rgn)
+		if err != nil {
+			return err
+		}
+		r.RgnDataSize = size
+	}
+
+	for _, v := range []interface{}{r.RgnDataSize, r.RegionMode} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	_, err := rgn.WriteTo(w)
+	return err
+}
@@ -0,0 +1,260 @@
+package emf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/lokks307/go-emf/w32"
+)
+
+// writeFile returns the bytes of f written by WriteTo.
+func writeFile(t *testing.T, f *EmfFile) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// readFile reads data in strict mode.
+func readFile(t *testing.T, data []byte) *EmfFile {
+	t.Helper()
+
+	f, err := ReadFileWithOptions(data, &ReadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return f
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	rgn := RegionData{Data: []w32.RECT{{Left: 1, Top: 2, Right: 30, Bottom: 20}, {Left: 5, Top: 20, Right: 10, Bottom: 40}}}
+
+	tests := []struct {
+		name  string
+		build func(b *Builder)
+	}{
+		{"empty", func(b *Builder) {}},
+		{"state", func(b *Builder) {
+			b.SaveDC()
+			b.SetMapMode(MM_ANISOTROPIC)
+			b.SetWindowOrgEx(-10, 20)
+			b.SetWindowExtEx(1000, -1000)
+			b.SetViewportOrgEx(5, 5)
+			b.SetViewportExtEx(100, 100)
+			b.SetBkMode(TRANSPARENT)
+			b.SetBkColor(0x123456)
+			b.SetTextColor(0x654321)
+			b.SetTextAlign(TA_BASELINE | TA_CENTER)
+			b.SetPolyFillMode(WINDING)
+			b.Add(&SetWorldTransformRecord{Record: Record{Type: EMR_SETWORLDTRANSFORM}, XForm: w32.XFORM{M11: 0, M12: 1, M21: -1, M22: 0, Dx: 3.5, Dy: -2}})
+			b.Add(&ModifyWorldTransformRecord{Record: Record{Type: EMR_MODIFYWORLDTRANSFORM}, XForm: w32.XFORM{M11: 2, M22: 2}, ModifyWorldTransformMode: MWT_LEFTMULTIPLY})
+			b.RestoreDC(-1)
+		}},
+		{"objects", func(b *Builder) {
+			b.SelectPen(PS_DASH, 3, 0x0000FF)
+			b.SelectBrush(BS_HATCHED, 0x00FF00, w32.HS_FDIAGONAL)
+			b.Add(&ExtCreatePenRecord{
+				Record: Record{Type: EMR_EXTCREATEPEN},
+				IhPen:  b.allocHandle(),
+				Elp: w32.LOGPENEX{
+					PenStyle:        PS_GEOMETRIC | PS_USERSTYLE | PS_ENDCAP_FLAT,
+					Width:           4,
+					ColorRef:        0xFF0000,
+					NumStyleEntries: 2,
+					StyleEntry:      []uint32{6, 2},
+				},
+			})
+			b.DeleteObject(b.pen)
+		}},
+		{"shapes", func(b *Builder) {
+			b.MoveTo(1, 2)
+			b.LineTo(30, 40)
+			b.Rectangle(10, 10, 50, 60)
+			b.Polygon([]w32.POINT{{X: 0, Y: 0}, {X: 100000, Y: 5}, {X: 7, Y: 9}})
+			b.Polyline([]w32.POINT{{X: 0, Y: 0}, {X: 10, Y: 5}})
+			b.Bezier([]w32.POINT{{X: 0, Y: 0}, {X: 10, Y: 5}, {X: 20, Y: 5}, {X: 30, Y: 0}})
+			b.PolyPolygon([][]w32.POINT{{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}}, {{X: 20, Y: 20}, {X: 30, Y: 20}, {X: 30, Y: 30}, {X: 20, Y: 30}}})
+			b.Add(&EllipseRecord{Record: Record{Type: EMR_ELLIPSE}, Box: w32.RECT{Left: 1, Top: 2, Right: 30, Bottom: 40}})
+			b.Add(&RoundRectRecord{Record: Record{Type: EMR_ROUNDRECT}, Box: w32.RECT{Left: 1, Top: 2, Right: 30, Bottom: 40}, Corner: w32.SIZE{CX: 5, CY: 6}})
+			b.Add(&ArcRecord{Record: Record{Type: EMR_ARC}, Box: w32.RECT{Right: 40, Bottom: 40}, Start: w32.POINT{X: 40, Y: 20}, End: w32.POINT{X: 20, Y: 0}})
+			b.Add(&AngleArcRecord{Record: Record{Type: EMR_ANGLEARC}, Center: w32.POINT{X: 20, Y: 20}, Radius: 10, StartAngle: 30, SweepAngle: -120.5})
+			b.Add(&PolyDrawRecord{
+				Record:  Record{Type: EMR_POLYDRAW},
+				Count:   3,
+				APoints: []w32.POINTL{{X: 1, Y: 1}, {X: 5, Y: 9}, {X: 9, Y: 1}},
+				AbTypes: []byte{PT_MOVETO, PT_LINETO, PT_LINETO | PT_CLOSEFIGURE},
+			})
+			b.Add(&PolyPolyLine16Record{
+				Record:             Record{Type: EMR_POLYPOLYLINE16},
+				NumberOfPolylines:  2,
+				Count:              4,
+				PolylinePointCount: []uint32{2, 2},
+				APoints:            []PointS{{X: 0, Y: 0}, {X: 5, Y: 5}, {X: 9, Y: 0}, {X: 0, Y: 9}},
+			})
+			b.Add(&SetPixelvRecord{Record: Record{Type: EMR_SETPIXELV}, Pixel: w32.POINT{X: 3, Y: 4}, Color: WMFCOLORREF{Red: 9}})
+		}},
+		{"regions", func(b *Builder) {
+			brush := b.CreateBrush(BS_SOLID, 0x808080, 0)
+			b.Add(&IntersectClipRectRecord{Record: Record{Type: EMR_INTERSECTCLIPRECT}, Clip: w32.RECT{Left: 2, Top: 2, Right: 90, Bottom: 90}})
+			b.Add(&OffSetClipRgnRecord{Record: Record{Type: EMR_OFFSETCLIPRGN}, Offset: w32.POINT{X: 3, Y: -1}})
+			b.Add(&ExtSelectClipRgnRecord{Record: Record{Type: EMR_EXTSELECTCLIPRGN}, RegionMode: RGN_OR, RgnData: rgn})
+			b.Add(&ExtSelectClipRgnRecord{Record: Record{Type: EMR_EXTSELECTCLIPRGN}, RegionMode: RGN_COPY})
+			b.Add(&SetMetaRgnRecord{Record: Record{Type: EMR_SETMETARGN}})
+			b.Add(&FillRgnRecord{Record: Record{Type: EMR_FILLRGN}, IhBrush: brush, RgnData: rgn})
+			b.Add(&FrameRgnRecord{Record: Record{Type: EMR_FRAMERGN}, IhBrush: brush, Width: 2, Height: 3, RgnData: rgn})
+			b.Add(&InvertRgnRecord{Record: Record{Type: EMR_INVERTRGN}, RgnData: rgn})
+			b.Add(&PaintRgnRecord{Record: Record{Type: EMR_PAINTRGN}, RgnData: rgn})
+		}},
+		{"paths", func(b *Builder) {
+			b.Add(&BeginPathRecord{Record: Record{Type: EMR_BEGINPATH}})
+			b.Rectangle(0, 0, 10, 10)
+			b.Add(&CloseFigureRecord{Record: Record{Type: EMR_CLOSEFIGURE}})
+			b.Add(&EndPathRecord{Record: Record{Type: EMR_ENDPATH}})
+			b.Add(&WidenPathRecord{Record: Record{Type: EMR_WIDENPATH}})
+			b.Add(&SelectClipPathRecord{Record: Record{Type: EMR_SELECTCLIPPATH}, RegionMode: RGN_AND})
+		}},
+		{"text", func(b *Builder) {
+			b.Text(10, 20, "Hello")
+			b.Add(&ExtTextOutARecord{
+				Record:        Record{Type: EMR_EXTTEXTOUTA},
+				IGraphicsMode: w32.GM_ADVANCED,
+				ExScale:       1,
+				EyScale:       1,
+				AEmrText: EmrText{
+					Reference:  w32.POINT{X: 5, Y: 6},
+					Chars:      3,
+					Options:    ETO_OPAQUE | ETO_PDY,
+					Rectangle:  w32.RECT{Right: 40, Bottom: 20},
+					AnsiString: []byte("abc"),
+					OutputDx:   []int32{5, 0, 6, 1, 7, 2},
+				},
+			})
+			b.Add(&PolyTextOutRecord{
+				Record:        Record{Type: EMR_POLYTEXTOUTW},
+				IGraphicsMode: w32.GM_COMPATIBLE,
+				Strings:       2,
+				EmrTexts: []EmrText{
+					{Reference: w32.POINT{X: 1, Y: 2}, Chars: 2, Options: ETO_NO_RECT, OutputString: []uint16{'h', 'i'}, OutputDx: []int32{4, 4}},
+					{Reference: w32.POINT{X: 1, Y: 20}, Chars: 1, Rectangle: w32.RECT{Right: 9, Bottom: 9}, OutputString: []uint16{'!'}, OutputDx: []int32{3}},
+				},
+			})
+			b.Add(&SmallTextOutRecord{
+				Record:        Record{Type: EMR_SMALLTEXTOUT},
+				X:             7,
+				Y:             8,
+				Chars:         3,
+				Options:       ETO_SMALL_CHARS | ETO_NO_RECT,
+				IGraphicsMode: w32.GM_COMPATIBLE,
+				TextString:    []uint16{'x', 'y', 'z'},
+			})
+		}},
+		{"bitmaps", func(b *Builder) {
+			img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+			img.Set(1, 1, color.NRGBA{R: 0xFF, A: 0xFF})
+			if err := b.DrawImage(img, 4, 5, 30, 20); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"comment", func(b *Builder) {
+			b.Add(&CommentRecord{Record: Record{Type: EMR_COMMENT}, Data: []byte("private data")})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+			tt.build(b)
+			f := b.File()
+
+			first := writeFile(t, f)
+			read := readFile(t, first)
+			second := writeFile(t, read)
+
+			if !bytes.Equal(first, second) {
+				t.Fatalf("written again as %d bytes, want the %d bytes written first", len(second), len(first))
+			}
+
+			if len(read.Records) != len(f.Records) {
+				t.Fatalf("read %d records, want %d", len(read.Records), len(f.Records))
+			}
+			for i := range f.Records {
+				if got, want := recordType(read.Records[i]), recordType(f.Records[i]); got != want {
+					t.Errorf("record %d has type %#x, want %#x", i, got, want)
+				}
+			}
+
+			if again := readFile(t, second); !reflect.DeepEqual(again.Records, read.Records) {
+				t.Errorf("records read again differ from the records read first")
+			}
+		})
+	}
+}
+
+func TestWriteHeaderCounts(t *testing.T) {
+	b := NewBuilder(w32.RECT{Right: 99, Bottom: 99}, w32.RECT{})
+	b.SelectPen(PS_SOLID, 1, 0)
+	b.SelectBrush(BS_SOLID, 0, 0)
+	b.Rectangle(0, 0, 10, 10)
+
+	data := writeFile(t, b.File())
+	f := readFile(t, data)
+
+	if got := f.Header.Original.Bytes; got != uint32(len(data)) {
+		t.Errorf("header size is %d, want %d", got, len(data))
+	}
+	if got, want := f.Header.Original.Records, uint32(len(f.Records)+2); got != want {
+		t.Errorf("header record count is %d, want %d", got, want)
+	}
+	if got := f.Header.Original.Handles; got != 3 {
+		t.Errorf("header handle count is %d, want 3", got)
+	}
+	if f.Eof == nil || f.Eof.Size != 20 {
+		t.Errorf("EOF record is %+v, want 20 bytes", f.Eof)
+	}
+}
+
+func TestWriteNoHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := (&EmfFile{}).WriteTo(&buf); err == nil {
+		t.Error("WriteTo without a header succeeded")
+	}
+}
+
+func TestReadTruncatedRecords(t *testing.T) {
+	// a record which cannot be read is never returned half filled
+	for typ, read := range records {
+		if read == nil {
+			continue
+		}
+
+		for n := 0; n < 120; n++ {
+			rec, err := read(bytes.NewReader(make([]byte, n)), uint32(n+8))
+			if err != nil && rec != nil {
+				t.Errorf("record %#x of %d bytes returned %T with %v", typ, n+8, rec, err)
+				break
+			}
+		}
+	}
+}
+
+func TestReadTruncatedPlusRecords(t *testing.T) {
+	for typ, read := range plusRecords {
+		if read == nil {
+			continue
+		}
+
+		for n := 0; n < 120; n++ {
+			rec, err := read(bytes.NewReader(make([]byte, n)), EmfPlusRecord{Type: typ, Size: uint32(n + 12), DataSize: uint32(n)})
+			if err != nil && rec != nil {
+				t.Errorf("EMF+ record %#x of %d bytes returned %T with %v", typ, n+12, rec, err)
+				break
+			}
+		}
+	}
+}
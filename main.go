@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/lokks307/go-emf/emf"
+	"github.com/lokks307/go-emf/wmf"
 	"github.com/mattn/go-colorable"
 	log "github.com/sirupsen/logrus"
 )
@@ -19,8 +21,8 @@ func main() {
 	// Flag
 
 	logDebugFlag := flag.Bool("debug", false, "print out debug message")
-	inFile := flag.String("in", "", "emf file to convert")
-	outFile := flag.String("out", "./out.png", "png file to output")
+	inFile := flag.String("in", "", "emf or wmf file to convert")
+	outFile := flag.String("out", "./out.png", "png, svg or pdf file to output")
 
 	flag.Parse()
 
@@ -42,7 +44,7 @@ func main() {
 
 	if *inFile == "" {
 		fmt.Println("")
-		fmt.Println("GO-EMF: EMF images converter (ver. ", VERSION, ")")
+		fmt.Println("GO-EMF: EMF and WMF images converter (ver. ", VERSION, ")")
 		fmt.Println("")
 		fmt.Println("Usage: ./go-emf [options]")
 		flag.PrintDefaults()
@@ -69,12 +71,66 @@ func main() {
 		return
 	}
 
-	log.Info("EMF file reading...")
-	emfFile := emf.ReadFile(fdata)
-	log.Info("EMF file reading... done")
+	var emfFile *emf.EmfFile
+
+	if wmf.IsWMF(fdata) {
+		log.Info("WMF file reading...")
+		wmfFile, err := wmf.ReadFile(fdata)
+		if err != nil {
+			if wmfFile == nil {
+				log.Error(err)
+				os.Exit(0)
+				return
+			}
+			log.Warn(err)
+		}
+		emfFile, err = wmfFile.Emf()
+		if err != nil {
+			log.Warn(err)
+		}
+		log.Info("WMF file reading... done")
+	} else {
+		log.Info("EMF file reading...")
+		emfFile, err = emf.ReadFile(fdata)
+		if err != nil {
+			if emfFile == nil {
+				log.Error(err)
+				os.Exit(0)
+				return
+			}
+			log.Warn(err)
+		}
+		log.Info("EMF file reading... done")
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(*outFile)); ext {
+	case ".svg", ".pdf":
+		format := strings.ToUpper(ext[1:])
+		log.Info("Converting EMF file to ", format, "...")
+		out, err := os.Create(*outFile)
+		if err != nil {
+			log.Error(err)
+			os.Exit(0)
+			return
+		}
+		defer out.Close()
+
+		if ext == ".svg" {
+			err = emfFile.WriteSVG(out)
+		} else {
+			err = emfFile.WritePDF(out, nil)
+		}
+		if err != nil {
+			log.Error(err)
+		}
+		log.Info("Converting EMF file to ", format, "... done")
+		return
+	}
 
 	log.Info("Converting EMF file to PNG...")
-	emfFile.DrawToGrayPNG(*outFile)
+	if err := emfFile.DrawToGrayPNG(*outFile); err != nil {
+		log.Error(err)
+	}
 	log.Info("Converting EMF file to PNG... done")
 
 }
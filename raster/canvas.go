@@ -0,0 +1,223 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// ImageOp selects how DrawImage combines source and destination pixels.
+type ImageOp int
+
+const (
+	ImageCopy ImageOp = iota // opaque copy, source alpha is ignored
+	ImageOver                // alpha blending
+	ImageAnd
+	ImageOr
+	ImageXor
+)
+
+// Canvas paints anti-aliased shapes and images onto an RGBA image, limited
+// by an optional clip mask.
+type Canvas struct {
+	img  *image.RGBA
+	clip *image.Alpha
+}
+
+func NewCanvas(width, height int) *Canvas {
+	return &Canvas{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (c *Canvas) Image() *image.RGBA {
+	return c.img
+}
+
+func (c *Canvas) Bounds() image.Rectangle {
+	return c.img.Bounds()
+}
+
+// Clip returns the current clip mask, nil when drawing is not clipped.
+func (c *Canvas) Clip() *image.Alpha {
+	return c.clip
+}
+
+func (c *Canvas) SetClip(mask *image.Alpha) {
+	c.clip = mask
+}
+
+// Mask returns the coverage of p over the whole canvas.
+func (c *Canvas) Mask(p *Path, rule FillRule) *image.Alpha {
+	full := image.NewAlpha(c.Bounds())
+	if m := Rasterize(p.Flatten(DefaultTolerance), rule, c.Bounds()); m != nil {
+		draw.Draw(full, m.Rect, m, m.Rect.Min, draw.Src)
+	}
+	return full
+}
+
+// Clear fills the whole canvas with col, ignoring the clip.
+func (c *Canvas) Clear(col color.Color) {
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+// Fill paints the inside of p with src.
+func (c *Canvas) Fill(p *Path, rule FillRule, src image.Image) {
+	c.FillPolylines(p.Flatten(DefaultTolerance), rule, src)
+}
+
+func (c *Canvas) FillPolylines(polys []Polyline, rule FillRule, src image.Image) {
+	c.paint(Rasterize(polys, rule, c.Bounds()), src)
+}
+
+// Stroke paints the outline of p with src.
+func (c *Canvas) Stroke(p *Path, s Stroke, src image.Image) {
+	outline := s.Outline(p.Flatten(DefaultTolerance))
+	c.paint(Rasterize(outline, NonZero, c.Bounds()), src)
+}
+
+func (c *Canvas) paint(mask *image.Alpha, src image.Image) {
+	if mask == nil {
+		return
+	}
+
+	r := mask.Rect
+	if c.clip != nil {
+		r = r.Intersect(c.clip.Rect)
+		if r.Empty() {
+			return
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			mi := mask.PixOffset(r.Min.X, y)
+			ci := c.clip.PixOffset(r.Min.X, y)
+			for x := 0; x < r.Dx(); x++ {
+				mask.Pix[mi+x] = uint8((uint32(mask.Pix[mi+x])*uint32(c.clip.Pix[ci+x]) + 127) / 255)
+			}
+		}
+	}
+
+	draw.DrawMask(c.img, r, src, r.Min, mask, r.Min, draw.Over)
+}
+
+// DrawImage paints img transformed by m, which maps img coordinates to
+// canvas coordinates. Pixels are sampled from the nearest source pixel, or
+// bilinearly interpolated when smooth is set.
+func (c *Canvas) DrawImage(img image.Image, m Matrix, op ImageOp, smooth bool) {
+	inv, ok := m.Invert()
+	if !ok {
+		return
+	}
+
+	sb := img.Bounds()
+	corners := []Point{
+		m.Apply(Pt(float64(sb.Min.X), float64(sb.Min.Y))),
+		m.Apply(Pt(float64(sb.Max.X), float64(sb.Min.Y))),
+		m.Apply(Pt(float64(sb.Max.X), float64(sb.Max.Y))),
+		m.Apply(Pt(float64(sb.Min.X), float64(sb.Max.Y))),
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range corners {
+		minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+
+	r := image.Rect(
+		int(math.Floor(math.Max(minX, -1e6))), int(math.Floor(math.Max(minY, -1e6))),
+		int(math.Ceil(math.Min(maxX, 1e6))), int(math.Ceil(math.Min(maxY, 1e6))),
+	).Intersect(c.Bounds())
+	if c.clip != nil {
+		r = r.Intersect(c.clip.Rect)
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sp := inv.Apply(Pt(float64(x)+0.5, float64(y)+0.5))
+			if sp.X < float64(sb.Min.X) || sp.Y < float64(sb.Min.Y) || sp.X >= float64(sb.Max.X) || sp.Y >= float64(sb.Max.Y) {
+				continue
+			}
+
+			var s color.RGBA
+			if smooth {
+				s = bilinear(img, sp)
+			} else {
+				s = color.RGBAModel.Convert(img.At(int(math.Floor(sp.X)), int(math.Floor(sp.Y)))).(color.RGBA)
+			}
+
+			coverage := uint32(0xFF)
+			if c.clip != nil {
+				coverage = uint32(c.clip.AlphaAt(x, y).A)
+				if coverage == 0 {
+					continue
+				}
+			}
+
+			i := c.img.PixOffset(x, y)
+			d := c.img.Pix[i : i+4 : i+4]
+
+			var res [4]uint8
+			switch op {
+			case ImageOver:
+				a := 255 - uint32(s.A)
+				res = [4]uint8{
+					uint8(uint32(s.R) + uint32(d[0])*a/255),
+					uint8(uint32(s.G) + uint32(d[1])*a/255),
+					uint8(uint32(s.B) + uint32(d[2])*a/255),
+					uint8(uint32(s.A) + uint32(d[3])*a/255),
+				}
+			case ImageAnd:
+				res = [4]uint8{d[0] & s.R, d[1] & s.G, d[2] & s.B, 0xFF}
+			case ImageOr:
+				res = [4]uint8{d[0] | s.R, d[1] | s.G, d[2] | s.B, 0xFF}
+			case ImageXor:
+				res = [4]uint8{d[0] ^ s.R, d[1] ^ s.G, d[2] ^ s.B, 0xFF}
+			default:
+				res = [4]uint8{s.R, s.G, s.B, 0xFF}
+			}
+
+			for k := 0; k < 4; k++ {
+				d[k] = uint8((uint32(res[k])*coverage + uint32(d[k])*(255-coverage) + 127) / 255)
+			}
+		}
+	}
+}
+
+func bilinear(img image.Image, p Point) color.RGBA {
+	b := img.Bounds()
+	x := p.X - 0.5
+	y := p.Y - 0.5
+	x0 := int(math.Floor(x))
+	y0 := int(math.Floor(y))
+	fx := x - float64(x0)
+	fy := y - float64(y0)
+
+	clamp := func(v, lo, hi int) int {
+		if v < lo {
+			return lo
+		}
+		if v >= hi {
+			return hi - 1
+		}
+		return v
+	}
+
+	var acc [4]float64
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 2; i++ {
+			wx := fx
+			if i == 0 {
+				wx = 1 - fx
+			}
+			wy := fy
+			if j == 0 {
+				wy = 1 - fy
+			}
+			c := color.RGBAModel.Convert(img.At(clamp(x0+i, b.Min.X, b.Max.X), clamp(y0+j, b.Min.Y, b.Max.Y))).(color.RGBA)
+			acc[0] += float64(c.R) * wx * wy
+			acc[1] += float64(c.G) * wx * wy
+			acc[2] += float64(c.B) * wx * wy
+			acc[3] += float64(c.A) * wx * wy
+		}
+	}
+
+	return color.RGBA{uint8(acc[0] + 0.5), uint8(acc[1] + 0.5), uint8(acc[2] + 0.5), uint8(acc[3] + 0.5)}
+}
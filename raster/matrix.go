@@ -0,0 +1,90 @@
+package raster
+
+import "math"
+
+// Matrix is a 2x3 affine transformation. It maps (x, y) to
+// (A*x + C*y + E, B*x + D*y + F), which is the same layout as the
+// M11, M12, M21, M22, Dx, Dy members of a Win32 XFORM.
+type Matrix struct {
+	A, B, C, D, E, F float64
+}
+
+func Identity() Matrix {
+	return Matrix{A: 1, D: 1}
+}
+
+func Translate(tx, ty float64) Matrix {
+	return Matrix{A: 1, D: 1, E: tx, F: ty}
+}
+
+func Scale(sx, sy float64) Matrix {
+	return Matrix{A: sx, D: sy}
+}
+
+// Rotate returns a rotation by angle radians. With the Y axis pointing
+// down, a positive angle turns clockwise on screen.
+func Rotate(angle float64) Matrix {
+	s, c := math.Sincos(angle)
+	return Matrix{A: c, B: s, C: -s, D: c}
+}
+
+// Mul returns the transformation that applies m first and then n.
+func (m Matrix) Mul(n Matrix) Matrix {
+	return Matrix{
+		A: m.A*n.A + m.B*n.C,
+		B: m.A*n.B + m.B*n.D,
+		C: m.C*n.A + m.D*n.C,
+		D: m.C*n.B + m.D*n.D,
+		E: m.E*n.A + m.F*n.C + n.E,
+		F: m.E*n.B + m.F*n.D + n.F,
+	}
+}
+
+func (m Matrix) Apply(p Point) Point {
+	return Point{
+		X: m.A*p.X + m.C*p.Y + m.E,
+		Y: m.B*p.X + m.D*p.Y + m.F,
+	}
+}
+
+// ApplyVector transforms p ignoring the translation part.
+func (m Matrix) ApplyVector(p Point) Point {
+	return Point{
+		X: m.A*p.X + m.C*p.Y,
+		Y: m.B*p.X + m.D*p.Y,
+	}
+}
+
+func (m Matrix) Det() float64 {
+	return m.A*m.D - m.B*m.C
+}
+
+// Invert returns the inverse of m. The second result is false when m is
+// singular.
+func (m Matrix) Invert() (Matrix, bool) {
+	det := m.Det()
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return Matrix{}, false
+	}
+
+	inv := Matrix{
+		A: m.D / det,
+		B: -m.B / det,
+		C: -m.C / det,
+		D: m.A / det,
+	}
+	inv.E = -(inv.A*m.E + inv.C*m.F)
+	inv.F = -(inv.B*m.E + inv.D*m.F)
+
+	return inv, true
+}
+
+// ScaleFactor returns the geometric mean of the scaling applied by m, which
+// is used to convert lengths such as pen widths.
+func (m Matrix) ScaleFactor() float64 {
+	return math.Sqrt(math.Abs(m.Det()))
+}
+
+func (m Matrix) IsIdentity() bool {
+	return m == Identity()
+}
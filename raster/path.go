@@ -0,0 +1,294 @@
+package raster
+
+import "math"
+
+type Point struct {
+	X, Y float64
+}
+
+func Pt(x, y float64) Point {
+	return Point{X: x, Y: y}
+}
+
+func (p Point) Add(q Point) Point {
+	return Point{p.X + q.X, p.Y + q.Y}
+}
+
+func (p Point) Sub(q Point) Point {
+	return Point{p.X - q.X, p.Y - q.Y}
+}
+
+func (p Point) Mul(k float64) Point {
+	return Point{p.X * k, p.Y * k}
+}
+
+func (p Point) Dot(q Point) float64 {
+	return p.X*q.X + p.Y*q.Y
+}
+
+func (p Point) Cross(q Point) float64 {
+	return p.X*q.Y - p.Y*q.X
+}
+
+func (p Point) Len() float64 {
+	return math.Hypot(p.X, p.Y)
+}
+
+// Op is the operator of a path segment.
+type Op uint8
+
+const (
+	MoveTo Op = iota
+	LineTo
+	CubeTo
+	Close
+)
+
+// Segment is one path command. MoveTo and LineTo use Pts[0], CubeTo uses
+// Pts[0] and Pts[1] as control points and Pts[2] as the end point and Close
+// uses none.
+type Segment struct {
+	Op  Op
+	Pts [3]Point
+}
+
+// Path is a sequence of figures made of straight and cubic Bézier segments.
+type Path struct {
+	Segments []Segment
+
+	start   Point
+	current Point
+	open    bool
+}
+
+func (p *Path) MoveTo(pt Point) {
+	p.Segments = append(p.Segments, Segment{Op: MoveTo, Pts: [3]Point{pt}})
+	p.start, p.current, p.open = pt, pt, true
+}
+
+func (p *Path) LineTo(pt Point) {
+	if !p.open {
+		p.MoveTo(p.current)
+	}
+	p.Segments = append(p.Segments, Segment{Op: LineTo, Pts: [3]Point{pt}})
+	p.current = pt
+}
+
+func (p *Path) CubeTo(c1, c2, pt Point) {
+	if !p.open {
+		p.MoveTo(p.current)
+	}
+	p.Segments = append(p.Segments, Segment{Op: CubeTo, Pts: [3]Point{c1, c2, pt}})
+	p.current = pt
+}
+
+// QuadTo appends a quadratic Bézier segment, stored as the equivalent cubic.
+func (p *Path) QuadTo(c, pt Point) {
+	c1 := p.current.Add(c.Sub(p.current).Mul(2.0 / 3.0))
+	c2 := pt.Add(c.Sub(pt).Mul(2.0 / 3.0))
+	p.CubeTo(c1, c2, pt)
+}
+
+// Close closes the current figure. The next segment starts a new figure at
+// the start point of the closed one.
+func (p *Path) Close() {
+	if !p.open {
+		return
+	}
+	p.Segments = append(p.Segments, Segment{Op: Close})
+	p.current, p.open = p.start, false
+}
+
+// Current returns the current point and whether there is one.
+func (p *Path) Current() (Point, bool) {
+	return p.current, len(p.Segments) > 0
+}
+
+// Open reports whether the last figure of p has not been closed.
+func (p *Path) Open() bool {
+	return p.open
+}
+
+func (p *Path) Empty() bool {
+	return len(p.Segments) == 0
+}
+
+func (p *Path) Reset() {
+	p.Segments = p.Segments[:0]
+	p.start, p.current, p.open = Point{}, Point{}, false
+}
+
+// Append adds all figures of q to p.
+func (p *Path) Append(q *Path) {
+	for _, s := range q.Segments {
+		switch s.Op {
+		case MoveTo:
+			p.MoveTo(s.Pts[0])
+		case LineTo:
+			p.LineTo(s.Pts[0])
+		case CubeTo:
+			p.CubeTo(s.Pts[0], s.Pts[1], s.Pts[2])
+		case Close:
+			p.Close()
+		}
+	}
+}
+
+// Transform returns a copy of p with every point mapped by m.
+func (p *Path) Transform(m Matrix) *Path {
+	r := &Path{Segments: make([]Segment, len(p.Segments))}
+	for i, s := range p.Segments {
+		r.Segments[i].Op = s.Op
+		for j := range s.Pts {
+			r.Segments[i].Pts[j] = m.Apply(s.Pts[j])
+		}
+	}
+	r.start, r.current, r.open = m.Apply(p.start), m.Apply(p.current), p.open
+	return r
+}
+
+// Bounds returns the bounding box of all points, including control points.
+func (p *Path) Bounds() (min, max Point) {
+	first := true
+	add := func(pt Point) {
+		if first {
+			min, max, first = pt, pt, false
+			return
+		}
+		min.X, min.Y = math.Min(min.X, pt.X), math.Min(min.Y, pt.Y)
+		max.X, max.Y = math.Max(max.X, pt.X), math.Max(max.Y, pt.Y)
+	}
+
+	for _, s := range p.Segments {
+		switch s.Op {
+		case MoveTo, LineTo:
+			add(s.Pts[0])
+		case CubeTo:
+			add(s.Pts[0])
+			add(s.Pts[1])
+			add(s.Pts[2])
+		}
+	}
+
+	return min, max
+}
+
+// Polyline is a flattened figure.
+type Polyline struct {
+	Points []Point
+	Closed bool
+}
+
+// Flatten converts p to polylines, replacing curves by line segments that
+// stay within tolerance of the curve.
+func (p *Path) Flatten(tolerance float64) []Polyline {
+	var lines []Polyline
+	var cur *Polyline
+
+	flush := func() {
+		if cur != nil && len(cur.Points) > 0 {
+			lines = append(lines, *cur)
+		}
+		cur = nil
+	}
+
+	var last Point
+	for _, s := range p.Segments {
+		switch s.Op {
+		case MoveTo:
+			flush()
+			cur = &Polyline{Points: []Point{s.Pts[0]}}
+			last = s.Pts[0]
+		case LineTo:
+			if cur == nil {
+				cur = &Polyline{Points: []Point{last}}
+			}
+			cur.Points = append(cur.Points, s.Pts[0])
+			last = s.Pts[0]
+		case CubeTo:
+			if cur == nil {
+				cur = &Polyline{Points: []Point{last}}
+			}
+			cur.Points = flattenCubic(cur.Points, last, s.Pts[0], s.Pts[1], s.Pts[2], tolerance)
+			last = s.Pts[2]
+		case Close:
+			if cur != nil {
+				cur.Closed = true
+				last = cur.Points[0]
+			}
+			flush()
+		}
+	}
+	flush()
+
+	return lines
+}
+
+func flattenCubic(dst []Point, p0, p1, p2, p3 Point, tolerance float64) []Point {
+	if tolerance <= 0 {
+		tolerance = 0.1
+	}
+
+	// Wang's formula for the number of segments of a cubic curve.
+	dd1 := p0.Sub(p1.Mul(2)).Add(p2).Len()
+	dd2 := p1.Sub(p2.Mul(2)).Add(p3).Len()
+	n := int(math.Ceil(math.Sqrt(0.75 * math.Max(dd1, dd2) / tolerance)))
+	if n < 1 {
+		n = 1
+	} else if n > 1000 {
+		n = 1000
+	}
+
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		a := mt * mt * mt
+		b := 3 * mt * mt * t
+		c := 3 * mt * t * t
+		d := t * t * t
+		dst = append(dst, Point{
+			X: a*p0.X + b*p1.X + c*p2.X + d*p3.X,
+			Y: a*p0.Y + b*p1.Y + c*p2.Y + d*p3.Y,
+		})
+	}
+
+	return dst
+}
+
+// ArcToCubics appends to p the cubic approximation of an elliptical arc of
+// the axis-aligned ellipse with the given center and radii, starting at angle
+// start and sweeping by sweep radians. Angles follow the Y-down convention of
+// Rotate. The first point is connected with a line unless p has no current
+// point.
+func (p *Path) ArcToCubics(center Point, rx, ry, start, sweep float64) {
+	pointAt := func(a float64) Point {
+		s, c := math.Sincos(a)
+		return Point{center.X + rx*c, center.Y + ry*s}
+	}
+
+	first := pointAt(start)
+	if _, ok := p.Current(); ok && p.open {
+		p.LineTo(first)
+	} else {
+		p.MoveTo(first)
+	}
+
+	n := int(math.Ceil(math.Abs(sweep) / (math.Pi / 2)))
+	if n < 1 {
+		n = 1
+	}
+	step := sweep / float64(n)
+	k := 4.0 / 3.0 * math.Tan(step/4)
+
+	a := start
+	for i := 0; i < n; i++ {
+		s0, c0 := math.Sincos(a)
+		s1, c1 := math.Sincos(a + step)
+		p0 := Point{center.X + rx*c0, center.Y + ry*s0}
+		p3 := Point{center.X + rx*c1, center.Y + ry*s1}
+		p1 := Point{p0.X - k*rx*s0, p0.Y + k*ry*c0}
+		p2 := Point{p3.X + k*rx*s1, p3.Y - k*ry*c1}
+		p.CubeTo(p1, p2, p3)
+		a += step
+	}
+}
@@ -0,0 +1,188 @@
+package raster
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// FillRule selects how the inside of overlapping figures is determined.
+type FillRule int
+
+const (
+	EvenOdd FillRule = iota // ALTERNATE in GDI
+	NonZero                 // WINDING in GDI
+)
+
+// subSamples is the number of sample rows per pixel. Coverage along a
+// sample row is computed exactly, so edges are anti-aliased in both
+// directions.
+const subSamples = 5
+
+// DefaultTolerance is the maximum distance in pixels between a curve and
+// its flattened approximation.
+const DefaultTolerance = 0.1
+
+type edge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+}
+
+type crossing struct {
+	x   float64
+	dir int
+}
+
+// Rasterize computes the anti-aliased coverage of the polygons inside
+// bounds. Open polylines are treated as closed. The returned mask covers
+// the bounding box of the polygons clipped to bounds and is nil when that
+// box is empty.
+func Rasterize(polys []Polyline, rule FillRule, bounds image.Rectangle) *image.Alpha {
+	var edges []edge
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+
+	for _, poly := range polys {
+		n := len(poly.Points)
+		if n < 2 {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			a := poly.Points[i]
+			b := poly.Points[(i+1)%n]
+			if math.IsNaN(a.X) || math.IsNaN(a.Y) || math.IsNaN(b.X) || math.IsNaN(b.Y) {
+				continue
+			}
+			minX, maxX = math.Min(minX, a.X), math.Max(maxX, a.X)
+			minY, maxY = math.Min(minY, a.Y), math.Max(maxY, a.Y)
+			if a.Y == b.Y {
+				continue
+			}
+			if a.Y < b.Y {
+				edges = append(edges, edge{a.X, a.Y, b.X, b.Y, 1})
+			} else {
+				edges = append(edges, edge{b.X, b.Y, a.X, a.Y, -1})
+			}
+		}
+	}
+
+	if len(edges) == 0 {
+		return nil
+	}
+
+	r := image.Rect(
+		int(math.Floor(math.Max(minX, -1e6))), int(math.Floor(math.Max(minY, -1e6))),
+		int(math.Ceil(math.Min(maxX, 1e6)))+1, int(math.Ceil(math.Min(maxY, 1e6)))+1,
+	).Intersect(bounds)
+	if r.Empty() {
+		return nil
+	}
+
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	mask := image.NewAlpha(r)
+	width := r.Dx()
+	acc := make([]float64, width+2)
+	cover := make([]float64, width+2)
+	var active []edge
+	var xs []crossing
+	next := 0
+	w := 1.0 / subSamples
+
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for i := range acc {
+			acc[i], cover[i] = 0, 0
+		}
+
+		for s := 0; s < subSamples; s++ {
+			y := float64(py) + (float64(s)+0.5)*w
+
+			// update active edges
+			for next < len(edges) && edges[next].y0 <= y {
+				active = append(active, edges[next])
+				next++
+			}
+			k := 0
+			for _, e := range active {
+				if e.y1 > y {
+					active[k] = e
+					k++
+				}
+			}
+			active = active[:k]
+
+			xs = xs[:0]
+			for _, e := range active {
+				if e.y0 > y {
+					continue
+				}
+				t := (y - e.y0) / (e.y1 - e.y0)
+				xs = append(xs, crossing{e.x0 + t*(e.x1-e.x0), e.dir})
+			}
+			if len(xs) < 2 {
+				continue
+			}
+			sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+
+			wind := 0
+			for i := 0; i < len(xs)-1; i++ {
+				wind += xs[i].dir
+				inside := false
+				if rule == EvenOdd {
+					inside = (i+1)%2 == 1
+				} else {
+					inside = wind != 0
+				}
+				if inside {
+					addSpan(acc, cover, xs[i].x-float64(r.Min.X), xs[i+1].x-float64(r.Min.X), w, width)
+				}
+			}
+		}
+
+		run := 0.0
+		row := mask.Pix[(py-r.Min.Y)*mask.Stride:]
+		for x := 0; x < width; x++ {
+			run += cover[x]
+			v := acc[x] + run
+			if v <= 0 {
+				continue
+			}
+			if v >= 1 {
+				row[x] = 0xFF
+			} else {
+				row[x] = uint8(v*255 + 0.5)
+			}
+		}
+	}
+
+	return mask
+}
+
+// addSpan adds coverage weight w for the span [a, b). Whole pixels are
+// accumulated in the cover difference array, partial ones in acc.
+func addSpan(acc, cover []float64, a, b, w float64, width int) {
+	if a < 0 {
+		a = 0
+	}
+	if b > float64(width) {
+		b = float64(width)
+	}
+	if b <= a {
+		return
+	}
+
+	ia := int(a)
+	ib := int(b)
+
+	if ia == ib {
+		acc[ia] += (b - a) * w
+		return
+	}
+
+	acc[ia] += (float64(ia+1) - a) * w
+	cover[ia+1] += w
+	cover[ib] -= w
+	if ib < width {
+		acc[ib] += (b - float64(ib)) * w
+	}
+}
@@ -0,0 +1,291 @@
+package raster
+
+import "math"
+
+type LineCap int
+
+const (
+	CapRound LineCap = iota
+	CapSquare
+	CapFlat
+)
+
+type LineJoin int
+
+const (
+	JoinRound LineJoin = iota
+	JoinBevel
+	JoinMiter
+)
+
+// Stroke describes how the outline of a path is drawn.
+type Stroke struct {
+	Width      float64
+	Cap        LineCap
+	Join       LineJoin
+	MiterLimit float64
+	Dashes     []float64 // alternating on and off lengths, nil for solid lines
+	DashOffset float64
+}
+
+// Outline returns polygons that cover the stroke of lines. The polygons all
+// have the same orientation, so they have to be filled with NonZero.
+func (s Stroke) Outline(lines []Polyline) []Polyline {
+	if len(s.Dashes) > 0 {
+		lines = dash(lines, s.Dashes, s.DashOffset)
+	}
+
+	hw := s.Width / 2
+	if hw <= 0 {
+		hw = 0.5
+	}
+
+	var out []Polyline
+	for _, l := range lines {
+		out = s.outlineOne(out, removeDuplicates(l), hw)
+	}
+
+	for i := range out {
+		if signedArea(out[i].Points) < 0 {
+			reverse(out[i].Points)
+		}
+	}
+
+	return out
+}
+
+func (s Stroke) outlineOne(out []Polyline, l Polyline, hw float64) []Polyline {
+	pts := l.Points
+	n := len(pts)
+
+	if n == 1 {
+		switch s.Cap {
+		case CapRound:
+			out = append(out, circle(pts[0], hw))
+		case CapSquare:
+			p := pts[0]
+			out = append(out, Polyline{Points: []Point{
+				{p.X - hw, p.Y - hw}, {p.X + hw, p.Y - hw}, {p.X + hw, p.Y + hw}, {p.X - hw, p.Y + hw},
+			}, Closed: true})
+		}
+		return out
+	}
+
+	closed := l.Closed && n > 2
+	segs := n - 1
+	if closed {
+		segs = n
+	}
+
+	for i := 0; i < segs; i++ {
+		p, q := pts[i], pts[(i+1)%n]
+		nv := normal(p, q, hw)
+		out = append(out, Polyline{Points: []Point{p.Add(nv), q.Add(nv), q.Sub(nv), p.Sub(nv)}, Closed: true})
+	}
+
+	// joins
+	for i := 0; i < n; i++ {
+		if !closed && (i == 0 || i == n-1) {
+			continue
+		}
+		prev := pts[(i-1+n)%n]
+		next := pts[(i+1)%n]
+		out = s.join(out, prev, pts[i], next, hw)
+	}
+
+	// caps
+	if !closed {
+		out = s.cap(out, pts[1], pts[0], hw)
+		out = s.cap(out, pts[n-2], pts[n-1], hw)
+	}
+
+	return out
+}
+
+func (s Stroke) join(out []Polyline, a, p, b Point, hw float64) []Polyline {
+	if s.Join == JoinRound {
+		return append(out, circle(p, hw))
+	}
+
+	d0 := unit(p.Sub(a))
+	d1 := unit(b.Sub(p))
+	n0 := Point{-d0.Y, d0.X}
+	n1 := Point{-d1.Y, d1.X}
+
+	sign := 1.0
+	if d0.Cross(d1) > 0 {
+		sign = -1
+	}
+	o0 := p.Add(n0.Mul(sign * hw))
+	o1 := p.Add(n1.Mul(sign * hw))
+
+	if s.Join == JoinMiter {
+		bis := unit(n0.Add(n1))
+		cosHalf := bis.Dot(n0)
+		limit := s.MiterLimit
+		if limit < 1 {
+			limit = 10
+		}
+		if cosHalf > 1e-9 && 1/cosHalf <= limit {
+			m := p.Add(bis.Mul(sign * hw / cosHalf))
+			return append(out, Polyline{Points: []Point{p, o0, m, o1}, Closed: true})
+		}
+	}
+
+	return append(out, Polyline{Points: []Point{p, o0, o1}, Closed: true})
+}
+
+// cap adds the line cap at end, for the segment coming from prev.
+func (s Stroke) cap(out []Polyline, prev, end Point, hw float64) []Polyline {
+	switch s.Cap {
+	case CapRound:
+		out = append(out, circle(end, hw))
+	case CapSquare:
+		d := unit(end.Sub(prev)).Mul(hw)
+		nv := Point{-d.Y, d.X}
+		out = append(out, Polyline{Points: []Point{
+			end.Add(nv), end.Add(nv).Add(d), end.Sub(nv).Add(d), end.Sub(nv),
+		}, Closed: true})
+	}
+	return out
+}
+
+// maxDashes bounds the number of dashes of a stroke, longer lines are
+// drawn solid.
+const maxDashes = 1 << 20
+
+func dash(lines []Polyline, pattern []float64, offset float64) []Polyline {
+	total := 0.0
+	for _, v := range pattern {
+		if v < 0 {
+			return lines
+		}
+		total += v
+	}
+	if total <= 0 {
+		return lines
+	}
+
+	length := 0.0
+	for _, l := range lines {
+		for i := 0; i+1 < len(l.Points); i++ {
+			length += l.Points[i+1].Sub(l.Points[i]).Len()
+		}
+	}
+	if length/total*float64(len(pattern)) > maxDashes {
+		return lines
+	}
+
+	var out []Polyline
+	for _, l := range lines {
+		pts := l.Points
+		if l.Closed && len(pts) > 1 {
+			pts = append(append([]Point{}, pts...), pts[0])
+		}
+
+		idx := 0
+		remain := math.Mod(offset, total)
+		if remain < 0 {
+			remain += total
+		}
+		for remain >= pattern[idx] {
+			remain -= pattern[idx]
+			idx = (idx + 1) % len(pattern)
+		}
+		left := pattern[idx] - remain
+		on := idx%2 == 0
+
+		var cur []Point
+		if on && len(pts) > 0 {
+			cur = []Point{pts[0]}
+		}
+
+		for i := 0; i+1 < len(pts); i++ {
+			p, q := pts[i], pts[i+1]
+			segLen := q.Sub(p).Len()
+			pos := 0.0
+			for segLen-pos > left {
+				pos += left
+				pt := p.Add(q.Sub(p).Mul(pos / segLen))
+				if on {
+					cur = append(cur, pt)
+					out = append(out, Polyline{Points: cur})
+					cur = nil
+				} else {
+					cur = []Point{pt}
+				}
+				on = !on
+				idx = (idx + 1) % len(pattern)
+				left = pattern[idx]
+			}
+			left -= segLen - pos
+			if on {
+				cur = append(cur, q)
+			}
+		}
+		if on && len(cur) > 1 {
+			out = append(out, Polyline{Points: cur})
+		}
+	}
+
+	return out
+}
+
+func removeDuplicates(l Polyline) Polyline {
+	if len(l.Points) == 0 {
+		return l
+	}
+	pts := []Point{l.Points[0]}
+	for _, p := range l.Points[1:] {
+		if p.Sub(pts[len(pts)-1]).Len() > 1e-9 {
+			pts = append(pts, p)
+		}
+	}
+	if l.Closed && len(pts) > 1 && pts[0].Sub(pts[len(pts)-1]).Len() <= 1e-9 {
+		pts = pts[:len(pts)-1]
+	}
+	return Polyline{Points: pts, Closed: l.Closed}
+}
+
+func normal(p, q Point, hw float64) Point {
+	d := unit(q.Sub(p))
+	return Point{-d.Y * hw, d.X * hw}
+}
+
+func unit(p Point) Point {
+	l := p.Len()
+	if l == 0 {
+		return Point{}
+	}
+	return Point{p.X / l, p.Y / l}
+}
+
+func circle(c Point, r float64) Polyline {
+	n := int(math.Ceil(2 * math.Pi * r / 2))
+	if n < 8 {
+		n = 8
+	} else if n > 256 {
+		n = 256
+	}
+	pts := make([]Point, n)
+	for i := range pts {
+		s, co := math.Sincos(2 * math.Pi * float64(i) / float64(n))
+		pts[i] = Point{c.X + r*co, c.Y + r*s}
+	}
+	return Polyline{Points: pts, Closed: true}
+}
+
+func signedArea(pts []Point) float64 {
+	a := 0.0
+	for i := range pts {
+		p, q := pts[i], pts[(i+1)%len(pts)]
+		a += p.Cross(q)
+	}
+	return a / 2
+}
+
+func reverse(pts []Point) {
+	for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+		pts[i], pts[j] = pts[j], pts[i]
+	}
+}
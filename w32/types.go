@@ -5,7 +5,6 @@
 package w32
 
 import (
-	"syscall"
 	"unicode/utf16"
 	"unsafe"
 )
@@ -84,6 +83,11 @@ type POINT struct {
 	X, Y int32
 }
 
+// http://msdn.microsoft.com/en-us/library/windows/desktop/dd162807.aspx
+type POINTL struct {
+	X, Y int32
+}
+
 // http://msdn.microsoft.com/en-us/library/windows/desktop/dd162897.aspx
 type RECT struct {
 	Left, Top, Right, Bottom int32
@@ -1169,28 +1173,6 @@ type NETRESOURCE struct {
 	Provider    string
 }
 
-func (n *NETRESOURCE) toInternal() *netresource {
-	internal := &netresource{
-		Scope:       n.Scope,
-		Type:        n.Type,
-		DisplayType: n.DisplayType,
-		Usage:       n.Usage,
-	}
-	if n.LocalName != "" {
-		internal.LocalName = syscall.StringToUTF16Ptr(n.LocalName)
-	}
-	if n.RemoteName != "" {
-		internal.RemoteName = syscall.StringToUTF16Ptr(n.RemoteName)
-	}
-	if n.Comment != "" {
-		internal.Comment = syscall.StringToUTF16Ptr(n.Comment)
-	}
-	if n.Provider != "" {
-		internal.Provider = syscall.StringToUTF16Ptr(n.Provider)
-	}
-	return internal
-}
-
 type netresource struct {
 	Scope       uint32
 	Type        uint32
@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+// Copyright 2010-2012 The W32 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package w32
+
+import (
+	"syscall"
+)
+
+func (n *NETRESOURCE) toInternal() *netresource {
+	internal := &netresource{
+		Scope:       n.Scope,
+		Type:        n.Type,
+		DisplayType: n.DisplayType,
+		Usage:       n.Usage,
+	}
+	if n.LocalName != "" {
+		internal.LocalName = syscall.StringToUTF16Ptr(n.LocalName)
+	}
+	if n.RemoteName != "" {
+		internal.RemoteName = syscall.StringToUTF16Ptr(n.RemoteName)
+	}
+	if n.Comment != "" {
+		internal.Comment = syscall.StringToUTF16Ptr(n.Comment)
+	}
+	if n.Provider != "" {
+		internal.Provider = syscall.StringToUTF16Ptr(n.Provider)
+	}
+	return internal
+}
@@ -0,0 +1,402 @@
+package wmf
+
+import (
+	"errors"
+	"math"
+
+	"github.com/lokks307/go-emf/emf"
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+)
+
+// converter plays the records of a metafile into an EMF builder. The
+// picture is fitted to its size with MM_ANISOTROPIC, as Windows plays a
+// placeable metafile, and the records draw in the logical units of the
+// metafile. The bounds of the converted records are left empty, the
+// header has the bounds of the picture.
+//
+// WMF objects take the lowest free index of the object table, the EMF
+// object of index i has the handle i+1.
+type converter struct {
+	file    *WmfFile
+	b       *emf.Builder
+	objects []Recorder // records which created the objects
+	handles int
+
+	state dcState
+	saved []dcState
+
+	unitSize float64 // size of a logical unit in 0.01 millimeters
+	fixedExt bool    // window extents are ignored in MM_TEXT
+
+	index int   // of the record converted
+	err   error // first record which failed
+}
+
+// dcState is the part of the device context the converter needs to know.
+type dcState struct {
+	brush   uint32    // handle of the selected brush
+	charset byte      // charset of the selected font
+	org     w32.POINT // window origin
+	cur     w32.POINT // current position
+}
+
+func newConverter(f *WmfFile) *converter {
+	return &converter{
+		file:  f,
+		state: dcState{brush: emf.WHITE_BRUSH},
+	}
+}
+
+func (c *converter) convert() (*emf.EmfFile, error) {
+	org, ext, inch := c.picture()
+
+	c.unitSize = 2540 / inch
+	c.fixedExt = c.file.Placeable == nil && inch == 96
+	width := int32(math.Max(1, math.Round(math.Abs(float64(ext.CX))*96/inch)))
+	height := int32(math.Max(1, math.Round(math.Abs(float64(ext.CY))*96/inch)))
+
+	c.b = emf.NewBuilder(w32.RECT{Right: width - 1, Bottom: height - 1}, w32.RECT{
+		Right:  int32(math.Round(math.Abs(float64(ext.CX)) * c.unitSize)),
+		Bottom: int32(math.Round(math.Abs(float64(ext.CY)) * c.unitSize)),
+	})
+
+	c.b.SetMapMode(emf.MM_ANISOTROPIC)
+	c.b.SetWindowOrgEx(org.X, org.Y)
+	c.b.SetWindowExtEx(ext.CX, ext.CY)
+	c.b.SetViewportExtEx(width, height)
+	c.state.org = org
+
+	for i, rec := range c.file.Records {
+		c.index = i
+		rec.convert(c)
+		if c.err != nil && c.strict() {
+			return nil, c.err
+		}
+	}
+
+	f := c.b.File()
+	f.Header.Original.Handles = uint16(c.handles + 1)
+	f.SetOptions(c.file.opts)
+
+	return f, c.err
+}
+
+func (c *converter) strict() bool {
+	return c.file.opts != nil && c.file.opts.Strict
+}
+
+// fail reports that the record converted cannot be, the first failure is
+// returned by convert and the others are logged.
+func (c *converter) fail(err error) {
+	rerr := &RecordError{Op: "convert", Index: c.index, Err: err}
+	if c.index < len(c.file.offsets) {
+		rerr.Offset = c.file.offsets[c.index]
+	}
+	if r, ok := c.file.Records[c.index].(interface{ record() *Record }); ok {
+		rerr.Function = r.record().Function
+	}
+
+	if c.err == nil {
+		c.err = rerr
+	}
+	if !c.strict() {
+		log.Error(rerr)
+	}
+}
+
+// picture returns the window of the picture and its logical units per inch.
+// A placeable header gives both. Otherwise the window is the first one the
+// metafile sets, or the extent of what it draws, in units which are pixels
+// in MM_TEXT and taken as twips in the other mapping modes.
+func (c *converter) picture() (w32.POINT, w32.SIZE, float64) {
+	if p := c.file.Placeable; p != nil {
+		inch := float64(p.Inch)
+		if inch == 0 {
+			inch = 1440
+		}
+
+		box := p.BoundingBox
+		return w32.POINT{X: int32(box.Left), Y: int32(box.Top)},
+			w32.SIZE{CX: int32(box.Right) - int32(box.Left), CY: int32(box.Bottom) - int32(box.Top)}, inch
+	}
+
+	var org *w32.POINT
+	var ext *w32.SIZE
+	inch := 96.0
+
+	for _, rec := range c.file.Records {
+		switch rec := rec.(type) {
+		case *SetMapModeRecord:
+			if rec.MapMode != emf.MM_TEXT {
+				inch = 1440
+			}
+		case *SetWindowOrgRecord:
+			if org == nil {
+				p := rec.Origin.point()
+				org = &p
+			}
+		case *SetWindowExtRecord:
+			if ext == nil {
+				ext = &w32.SIZE{CX: int32(rec.Extent.X), CY: int32(rec.Extent.Y)}
+			}
+		}
+	}
+
+	if ext != nil && ext.CX != 0 && ext.CY != 0 && inch != 96 {
+		if org == nil {
+			org = &w32.POINT{}
+		}
+		return *org, *ext, inch
+	}
+
+	// the extent of the points of the drawing records
+	r, ok := c.extent()
+	if !ok {
+		return w32.POINT{}, w32.SIZE{CX: 1, CY: 1}, 96
+	}
+
+	return w32.POINT{X: r.Left, Y: r.Top}, w32.SIZE{CX: r.Right - r.Left + 1, CY: r.Bottom - r.Top + 1}, inch
+}
+
+func (c *converter) extent() (w32.RECT, bool) {
+	var r w32.RECT
+	found := false
+
+	add := func(points ...w32.POINT) {
+		for _, p := range points {
+			if !found {
+				r = w32.RECT{Left: p.X, Top: p.Y, Right: p.X, Bottom: p.Y}
+				found = true
+				continue
+			}
+			r.Left = min32(r.Left, p.X)
+			r.Top = min32(r.Top, p.Y)
+			r.Right = max32(r.Right, p.X)
+			r.Bottom = max32(r.Bottom, p.Y)
+		}
+	}
+
+	box := func(b Box16) {
+		add(w32.POINT{X: int32(b.Left), Y: int32(b.Top)}, w32.POINT{X: int32(b.Right), Y: int32(b.Bottom)})
+	}
+
+	size := func(p Point16, cx, cy int16) {
+		add(p.point(), w32.POINT{X: int32(p.X) + int32(cx), Y: int32(p.Y) + int32(cy)})
+	}
+
+	for _, rec := range c.file.Records {
+		switch rec := rec.(type) {
+		case *PolyRecord:
+			add(pointsOf(rec.APoints)...)
+		case *PolyPolygonRecord:
+			add(pointsOf(rec.APoints)...)
+		case *RectangleRecord:
+			box(rec.Box)
+		case *EllipseRecord:
+			box(rec.Box)
+		case *RoundRectRecord:
+			box(rec.Box)
+		case *ArcRecord:
+			box(rec.Box)
+		case *MoveToRecord:
+			add(rec.Point.point())
+		case *LineToRecord:
+			add(rec.Point.point())
+		case *SetPixelRecord:
+			add(rec.Point.point())
+		case *TextOutRecord:
+			add(rec.Start.point())
+		case *ExtTextOutRecord:
+			add(rec.Point.point())
+		case *PatBltRecord:
+			size(rec.Dest, rec.Width, rec.Height)
+		case *DibBitBltRecord:
+			size(rec.Dest, rec.Width, rec.Height)
+		case *DibStretchBltRecord:
+			size(rec.Dest, rec.DestWidth, rec.DestHeight)
+		case *StretchDibRecord:
+			size(rec.Dest, rec.DestWidth, rec.DestHeight)
+		case *SetDibToDevRecord:
+			size(rec.Dest, rec.Width, rec.Height)
+		}
+	}
+
+	return r, found
+}
+
+func pointsOf(ps []emf.PointS) []w32.POINT {
+	points := make([]w32.POINT, len(ps))
+	for i, p := range ps {
+		points[i] = w32.POINT{X: int32(p.X), Y: int32(p.Y)}
+	}
+	return points
+}
+
+func min32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (c *converter) add(rec emf.Recorder) {
+	c.b.Add(rec)
+}
+
+// addObject puts the record at the lowest free index of the object table
+// and returns the handle of its EMF object.
+func (c *converter) addObject(rec Recorder) uint32 {
+	i := 0
+	for i < len(c.objects) && c.objects[i] != nil {
+		i++
+	}
+
+	if i == len(c.objects) {
+		c.objects = append(c.objects, nil)
+	}
+	c.objects[i] = rec
+
+	if len(c.objects) > c.handles {
+		c.handles = len(c.objects)
+	}
+
+	return uint32(i) + 1
+}
+
+func (c *converter) object(index uint16) (Recorder, bool) {
+	if int(index) >= len(c.objects) || c.objects[index] == nil {
+		return nil, false
+	}
+	return c.objects[index], true
+}
+
+func (c *converter) createBrush(rec Recorder, brush emf.WMFLOGBRUSH) {
+	c.add(&emf.CreateBrushIndirectRecord{
+		Record:   emf.Record{Type: emf.EMR_CREATEBRUSHINDIRECT},
+		IhBrush:  c.addObject(rec),
+		LogBrush: brush,
+	})
+}
+
+func (c *converter) setWindowOrg(p w32.POINT) {
+	c.state.org = p
+	c.b.SetWindowOrgEx(p.X, p.Y)
+}
+
+func (c *converter) moveTo(p w32.POINT) {
+	c.state.cur = p
+	c.add(&emf.MoveToExRecord{Record: emf.Record{Type: emf.EMR_MOVETOEX}, Offset: p})
+}
+
+// path adds the records drawn by fn as a path.
+func (c *converter) path(fn func()) {
+	c.add(&emf.BeginPathRecord{Record: emf.Record{Type: emf.EMR_BEGINPATH}})
+	fn()
+	c.add(&emf.EndPathRecord{Record: emf.Record{Type: emf.EMR_ENDPATH}})
+}
+
+func (c *converter) rects(rects []w32.RECT) {
+	for _, r := range rects {
+		c.add(&emf.RectangleRecord{Record: emf.Record{Type: emf.EMR_RECTANGLE}, Box: r})
+	}
+}
+
+// clipRects combines the clipping region with a region given by its
+// rectangles in logical units.
+func (c *converter) clipRects(rects []w32.RECT, mode uint32) {
+	c.path(func() {
+		if len(rects) == 0 {
+			// an empty region clips everything
+			c.rects([]w32.RECT{{}})
+			return
+		}
+		c.rects(rects)
+	})
+	c.add(&emf.SelectClipPathRecord{Record: emf.Record{Type: emf.EMR_SELECTCLIPPATH}, RegionMode: mode})
+}
+
+// textOut draws a string in the code page of the charset of the selected
+// font. The distances of the metafile are given per byte, they are summed
+// per UTF-16 unit.
+func (c *converter) textOut(p w32.POINT, options uint32, rect *w32.RECT, s []byte, dx []int16) {
+	text, sizes := emf.DecodeCharset(c.state.charset, s)
+
+	var outDx []int32
+	if dx != nil {
+		i := 0
+		for _, n := range sizes {
+			d := int32(0)
+			for ; n > 0 && i < len(dx); n-- {
+				d += int32(dx[i])
+				i++
+			}
+			outDx = append(outDx, d)
+		}
+	}
+
+	rec := &emf.ExtTextOutWRecord{
+		Record:        emf.Record{Type: emf.EMR_EXTTEXTOUTW},
+		IGraphicsMode: w32.GM_COMPATIBLE,
+		ExScale:       float32(c.unitSize),
+		EyScale:       float32(c.unitSize),
+		WEmrText: emf.EmrText{
+			Reference:    p,
+			Chars:        uint32(len(text)),
+			Options:      options,
+			OutputString: text,
+			OutputDx:     outDx,
+		},
+	}
+	if rect != nil {
+		rec.WEmrText.Rectangle = *rect
+	}
+
+	c.add(rec)
+}
+
+func (c *converter) patBlt(dest w32.POINT, cx, cy int32, rop uint32) {
+	c.add(&emf.BitBltRecord{
+		Record: emf.Record{Type: emf.EMR_BITBLT},
+		CommonBitmapInfo: emf.CommonBitmapInfo{
+			XDest:     dest.X,
+			YDest:     dest.Y,
+			CxDest:    cx,
+			CyDest:    cy,
+			BitBltROP: rop,
+		},
+	})
+}
+
+func (c *converter) stretchDIBits(dest w32.POINT, cx, cy int32, src w32.POINT, cxSrc, cySrc int32, bmp *emf.Bitmap, usage, rop uint32) {
+	if bmp == nil {
+		c.fail(errors.New("no bitmap to draw"))
+		return
+	}
+
+	c.add(&emf.StretchDIBitsRecord{
+		Record: emf.Record{Type: emf.EMR_STRETCHDIBITS},
+		StretchDIBitsInfo: emf.StretchDIBitsInfo{
+			XDest:     dest.X,
+			YDest:     dest.Y,
+			XSrc:      src.X,
+			YSrc:      src.Y,
+			CxSrc:     cxSrc,
+			CySrc:     cySrc,
+			UsageSrc:  usage,
+			BitBltROP: rop,
+			CxDest:    cx,
+			CyDest:    cy,
+		},
+		BmiSrc:    bmp.Info,
+		ColorsSrc: bmp.Colors,
+		BitsSrc:   bmp.Bits,
+	})
+}
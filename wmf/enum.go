@@ -0,0 +1,84 @@
+package wmf
+
+// Key of the placeable header, [MS-WMF] 2.3.2.3
+const PLACEABLE_KEY = 0x9AC6CDD7
+
+// MetafileType
+const (
+	MEMORYMETAFILE = 0x0001
+	DISKMETAFILE   = 0x0002
+)
+
+// RecordType
+const (
+	META_EOF                   = uint16(0x0000)
+	META_REALIZEPALETTE        = uint16(0x0035)
+	META_SETPALENTRIES         = uint16(0x0037)
+	META_SETBKMODE             = uint16(0x0102)
+	META_SETMAPMODE            = uint16(0x0103)
+	META_SETROP2               = uint16(0x0104)
+	META_SETRELABS             = uint16(0x0105)
+	META_SETPOLYFILLMODE       = uint16(0x0106)
+	META_SETSTRETCHBLTMODE     = uint16(0x0107)
+	META_SETTEXTCHAREXTRA      = uint16(0x0108)
+	META_RESTOREDC             = uint16(0x0127)
+	META_RESIZEPALETTE         = uint16(0x0139)
+	META_DIBCREATEPATTERNBRUSH = uint16(0x0142)
+	META_SETLAYOUT             = uint16(0x0149)
+	META_SETBKCOLOR            = uint16(0x0201)
+	META_SETTEXTCOLOR          = uint16(0x0209)
+	META_OFFSETVIEWPORTORG     = uint16(0x0211)
+	META_LINETO                = uint16(0x0213)
+	META_MOVETO                = uint16(0x0214)
+	META_OFFSETCLIPRGN         = uint16(0x0220)
+	META_FILLREGION            = uint16(0x0228)
+	META_SETMAPPERFLAGS        = uint16(0x0231)
+	META_SELECTPALETTE         = uint16(0x0234)
+	META_POLYGON               = uint16(0x0324)
+	META_POLYLINE              = uint16(0x0325)
+	META_SETTEXTJUSTIFICATION  = uint16(0x020A)
+	META_SETWINDOWORG          = uint16(0x020B)
+	META_SETWINDOWEXT          = uint16(0x020C)
+	META_SETVIEWPORTORG        = uint16(0x020D)
+	META_SETVIEWPORTEXT        = uint16(0x020E)
+	META_OFFSETWINDOWORG       = uint16(0x020F)
+	META_SCALEWINDOWEXT        = uint16(0x0410)
+	META_SCALEVIEWPORTEXT      = uint16(0x0412)
+	META_EXCLUDECLIPRECT       = uint16(0x0415)
+	META_INTERSECTCLIPRECT     = uint16(0x0416)
+	META_ELLIPSE               = uint16(0x0418)
+	META_FLOODFILL             = uint16(0x0419)
+	META_FRAMEREGION           = uint16(0x0429)
+	META_ANIMATEPALETTE        = uint16(0x0436)
+	META_TEXTOUT               = uint16(0x0521)
+	META_POLYPOLYGON           = uint16(0x0538)
+	META_EXTFLOODFILL          = uint16(0x0548)
+	META_RECTANGLE             = uint16(0x041B)
+	META_SETPIXEL              = uint16(0x041F)
+	META_ROUNDRECT             = uint16(0x061C)
+	META_PATBLT                = uint16(0x061D)
+	META_SAVEDC                = uint16(0x001E)
+	META_PIE                   = uint16(0x081A)
+	META_STRETCHBLT            = uint16(0x0B23)
+	META_ESCAPE                = uint16(0x0626)
+	META_INVERTREGION          = uint16(0x012A)
+	META_PAINTREGION           = uint16(0x012B)
+	META_SELECTCLIPREGION      = uint16(0x012C)
+	META_SELECTOBJECT          = uint16(0x012D)
+	META_SETTEXTALIGN          = uint16(0x012E)
+	META_ARC                   = uint16(0x0817)
+	META_CHORD                 = uint16(0x0830)
+	META_BITBLT                = uint16(0x0922)
+	META_EXTTEXTOUT            = uint16(0x0A32)
+	META_SETDIBTODEV           = uint16(0x0D33)
+	META_DIBBITBLT             = uint16(0x0940)
+	META_DIBSTRETCHBLT         = uint16(0x0B41)
+	META_STRETCHDIB            = uint16(0x0F43)
+	META_DELETEOBJECT          = uint16(0x01F0)
+	META_CREATEPALETTE         = uint16(0x00F7)
+	META_CREATEPATTERNBRUSH    = uint16(0x01F9)
+	META_CREATEPENINDIRECT     = uint16(0x02FA)
+	META_CREATEFONTINDIRECT    = uint16(0x02FB)
+	META_CREATEBRUSHINDIRECT   = uint16(0x02FC)
+	META_CREATEREGION          = uint16(0x06FF)
+)
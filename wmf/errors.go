@@ -0,0 +1,34 @@
+package wmf
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoHeader is returned when the data does not start with a
+	// placeable or standard metafile header.
+	ErrNoHeader = errors.New("invalid WMF header")
+
+	// ErrNoEof is returned when the records end without a META_EOF record.
+	ErrNoEof = errors.New("missing WMF end of file")
+)
+
+// RecordError records the record which failed to be read or converted,
+// and the cause of the failure. The causes shared with the emf package are
+// emf.ErrUnknownRecord, emf.ErrRecordSize and emf.ErrLimit.
+type RecordError struct {
+	Op       string // "read" or "convert"
+	Offset   int64  // byte offset of the record in the data
+	Index    int    // index in WmfFile.Records
+	Function uint16 // META_* type of the record
+	Err      error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("%s record %#04x at index %d, offset %d: %v", e.Op, e.Function, e.Index, e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
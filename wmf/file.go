@@ -0,0 +1,149 @@
+// Package wmf reads Windows Metafile Format files ([MS-WMF]) and converts
+// them to enhanced metafiles, which are drawn by the emf package.
+package wmf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/lokks307/go-emf/emf"
+	log "github.com/sirupsen/logrus"
+)
+
+// PlaceableHeader precedes the metafile in .wmf files written by most
+// applications. It gives the size of the picture.
+type PlaceableHeader struct {
+	Key         uint32
+	HWmf        uint16
+	BoundingBox Rect16
+	Inch        uint16 // logical units per inch
+	Reserved    uint32
+	Checksum    uint16
+}
+
+type Header struct {
+	Type            uint16
+	HeaderSize      uint16 // in 16-bit words
+	Version         uint16
+	SizeLow         uint16
+	SizeHigh        uint16
+	NumberOfObjects uint16
+	MaxRecord       uint32
+	NumberOfMembers uint16
+}
+
+type WmfFile struct {
+	Placeable *PlaceableHeader // nil for standard metafiles
+	Header    Header
+	Records   []Recorder
+
+	opts    *emf.ReadOptions
+	offsets []int64 // of the records in the data
+}
+
+// IsWMF tells whether data starts like a placeable or standard metafile.
+func IsWMF(data []byte) bool {
+	if len(data) < 18 {
+		return false
+	}
+
+	if binary.LittleEndian.Uint32(data) == PLACEABLE_KEY {
+		return true
+	}
+
+	typ := binary.LittleEndian.Uint16(data)
+	return (typ == MEMORYMETAFILE || typ == DISKMETAFILE) && binary.LittleEndian.Uint16(data[2:]) == 9
+}
+
+// ReadFile reads the records of data in lenient mode. The file is returned
+// with the error when only part of it could be read.
+func ReadFile(data []byte) (*WmfFile, error) {
+	return ReadFileWithOptions(data, nil)
+}
+
+// ReadFileWithOptions reads the records of data with the options of the emf
+// package, nil means the defaults. A record which cannot be read is
+// reported as a *RecordError. In lenient mode unknown and unreadable
+// records are kept as RawRecord, and a file which cannot be read to the end
+// is returned with the records read so far. The options are passed on to
+// the file converted by Emf.
+func ReadFileWithOptions(data []byte, opts *emf.ReadOptions) (*WmfFile, error) {
+	if opts == nil {
+		opts = &emf.ReadOptions{}
+	}
+
+	limits := opts.Limits
+	if limits == nil {
+		limits = &emf.DefaultLimits
+	}
+
+	reader := bytes.NewReader(data)
+	wmfFile := &WmfFile{opts: opts}
+
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == PLACEABLE_KEY {
+		wmfFile.Placeable = &PlaceableHeader{}
+		if err := binary.Read(reader, binary.LittleEndian, wmfFile.Placeable); err != nil {
+			return nil, ErrNoHeader
+		}
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &wmfFile.Header); err != nil {
+		return nil, ErrNoHeader
+	}
+
+	h := wmfFile.Header
+	if (h.Type != MEMORYMETAFILE && h.Type != DISKMETAFILE) || h.HeaderSize != 9 {
+		return nil, ErrNoHeader
+	}
+
+	for reader.Len() > 0 {
+		offset := reader.Size() - int64(reader.Len())
+
+		hdr, params, err := readRecord(reader, limits)
+		if err != nil {
+			// the size does not tell where the next record is
+			rerr := &RecordError{Op: "read", Offset: offset, Index: len(wmfFile.Records), Function: hdr.Function, Err: err}
+			if opts.Strict {
+				return nil, rerr
+			}
+			return wmfFile, rerr
+		}
+
+		rec, err := parseRecord(hdr, params)
+		if err != nil {
+			rerr := &RecordError{Op: "read", Offset: offset, Index: len(wmfFile.Records), Function: hdr.Function, Err: err}
+			if opts.Strict {
+				return nil, rerr
+			}
+
+			if errors.Is(err, emf.ErrUnknownRecord) {
+				log.Warn(rerr)
+			} else {
+				log.Error(rerr)
+			}
+			rec = &RawRecord{Record: hdr, Data: params}
+		}
+
+		if _, ok := rec.(*EofRecord); ok {
+			return wmfFile, nil
+		}
+
+		wmfFile.Records = append(wmfFile.Records, rec)
+		wmfFile.offsets = append(wmfFile.offsets, offset)
+	}
+
+	if opts.Strict {
+		return nil, ErrNoEof
+	}
+	return wmfFile, ErrNoEof
+}
+
+// Emf converts the metafile to an enhanced metafile, which is drawn with
+// the options the metafile was read with. A record which cannot be
+// converted is reported as a *RecordError. In strict mode the conversion
+// stops at the first one, otherwise the other records are converted and
+// the file is returned with the first error.
+func (f *WmfFile) Emf() (*emf.EmfFile, error) {
+	return newConverter(f).convert()
+}
@@ -0,0 +1,194 @@
+package wmf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/lokks307/go-emf/emf"
+)
+
+// wmfRecord returns a record of the function with 16-bit parameters.
+func wmfRecord(function uint16, params ...uint16) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(3+len(params)))
+	binary.Write(&buf, binary.LittleEndian, function)
+	binary.Write(&buf, binary.LittleEndian, params)
+	return buf.Bytes()
+}
+
+// wmfData returns a standard metafile made of the records.
+func wmfData(records ...[]byte) []byte {
+	var body bytes.Buffer
+	for _, r := range records {
+		body.Write(r)
+	}
+
+	size := uint32(18+body.Len()) / 2
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, Header{
+		Type:       MEMORYMETAFILE,
+		HeaderSize: 9,
+		Version:    0x0300,
+		SizeLow:    uint16(size),
+		SizeHigh:   uint16(size >> 16),
+	})
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadFile(t *testing.T) {
+	rect := wmfRecord(META_RECTANGLE, 20, 20, 0, 0)
+	eof := wmfRecord(META_EOF)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		strict   bool
+		records  int   // read in lenient mode, -1 when nothing is returned
+		err      error // cause of the error
+		offset   int64 // of the record which failed
+		index    int
+		function uint16
+	}{
+		{"valid", wmfData(wmfRecord(META_SETBKMODE, 1), rect, eof), false, 2, nil, 0, 0, 0},
+		{"no header", []byte("not a metafile at all"), false, -1, ErrNoHeader, 0, 0, 0},
+		{"unknown lenient", wmfData(rect, wmfRecord(0x0777, 1, 2), eof), false, 2, nil, 0, 0, 0},
+		{"unknown strict", wmfData(rect, wmfRecord(0x0777, 1, 2), eof), true, -1, emf.ErrUnknownRecord, 32, 1, 0x0777},
+		{"unreadable lenient", wmfData(wmfRecord(META_RECTANGLE, 1), eof), false, 1, nil, 0, 0, 0},
+		{"unreadable strict", wmfData(wmfRecord(META_RECTANGLE, 1), eof), true, -1, errors.New(""), 18, 0, META_RECTANGLE},
+		{"size past the data", wmfData(rect, []byte{0xFF, 0, 0, 0, 0x1B, 0x04}), false, 1, emf.ErrRecordSize, 32, 1, META_RECTANGLE},
+		{"size too small", wmfData(rect, []byte{2, 0, 0, 0, 0x1B, 0x04}), false, 1, emf.ErrRecordSize, 32, 1, META_RECTANGLE},
+		{"no eof", wmfData(rect), false, 1, ErrNoEof, 0, 0, 0},
+		{"no eof strict", wmfData(rect), true, -1, ErrNoEof, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ReadFileWithOptions(tt.data, &emf.ReadOptions{Strict: tt.strict})
+
+			if tt.records < 0 {
+				if f != nil {
+					t.Errorf("returned a file with %d records, want none", len(f.Records))
+				}
+			} else if f == nil || len(f.Records) != tt.records {
+				t.Fatalf("returned %v, want %d records", f, tt.records)
+			}
+
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("returned error %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("returned no error, want %v", tt.err)
+			}
+			if tt.err.Error() != "" && !errors.Is(err, tt.err) {
+				t.Errorf("returned error %v, want %v", err, tt.err)
+			}
+
+			var rerr *RecordError
+			if errors.As(err, &rerr) {
+				if rerr.Op != "read" || rerr.Offset != tt.offset || rerr.Index != tt.index || rerr.Function != tt.function {
+					t.Errorf("returned %+v, want a read error at offset %d, index %d of function %#04x", rerr, tt.offset, tt.index, tt.function)
+				}
+			} else if tt.function != 0 {
+				t.Errorf("returned %v, want a *RecordError", err)
+			}
+		})
+	}
+}
+
+func TestReadFileLimits(t *testing.T) {
+	data := wmfData(wmfRecord(META_RECTANGLE, 20, 20, 0, 0), wmfRecord(META_EOF))
+
+	_, err := ReadFileWithOptions(data, &emf.ReadOptions{Limits: &emf.Limits{MaxRecordSize: 12}})
+	if !errors.Is(err, emf.ErrLimit) {
+		t.Errorf("returned %v, want %v", err, emf.ErrLimit)
+	}
+
+	if _, err := ReadFileWithOptions(data, &emf.ReadOptions{Limits: &emf.Limits{MaxRecordSize: 14}}); err != nil {
+		t.Errorf("record of the largest size returned %v", err)
+	}
+}
+
+func TestEmf(t *testing.T) {
+	// the record selecting object 3 comes after two records which convert
+	data := wmfData(
+		wmfRecord(META_CREATEBRUSHINDIRECT, 0, 0xFF, 0, 0),
+		wmfRecord(META_SELECTOBJECT, 0),
+		wmfRecord(META_SELECTOBJECT, 3),
+		wmfRecord(META_RECTANGLE, 20, 20, 0, 0),
+		wmfRecord(META_EOF),
+	)
+
+	for _, strict := range []bool{false, true} {
+		f, err := ReadFileWithOptions(data, &emf.ReadOptions{Strict: strict})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := f.Emf()
+
+		var rerr *RecordError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("strict %v: Emf returned %v, want a *RecordError", strict, err)
+		}
+		if rerr.Op != "convert" || rerr.Index != 2 || rerr.Offset != 18+14+8 || rerr.Function != META_SELECTOBJECT {
+			t.Errorf("strict %v: Emf returned %+v, want the third record", strict, rerr)
+		}
+
+		if strict {
+			if out != nil {
+				t.Errorf("strict Emf returned a file")
+			}
+			continue
+		}
+
+		// the rectangle is converted after the failed record
+		if out == nil || len(out.Records) == 0 {
+			t.Fatal("lenient Emf returned no records")
+		}
+		if _, ok := out.Records[len(out.Records)-1].(*emf.RectangleRecord); !ok {
+			t.Errorf("last record is %T, want the rectangle", out.Records[len(out.Records)-1])
+		}
+	}
+}
+
+func TestEmfValid(t *testing.T) {
+	f, err := ReadFile(wmfData(wmfRecord(META_RECTANGLE, 20, 30, 0, 0), wmfRecord(META_EOF)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := f.Emf()
+	if err != nil {
+		t.Fatalf("Emf returned %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := out.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := emf.ReadFileWithOptions(buf.Bytes(), &emf.ReadOptions{Strict: true}); err != nil {
+		t.Errorf("converted file reads with %v", err)
+	}
+}
+
+func TestReadTruncatedRecords(t *testing.T) {
+	// a record which cannot be read is never returned half filled
+	for fn, read := range records {
+		if read == nil {
+			continue
+		}
+		for n := 0; n < 120; n += 2 {
+			rec, err := read(bytes.NewReader(make([]byte, n)), Record{Size: uint32(n/2 + 3), Function: fn})
+			if err != nil && rec != nil {
+				t.Errorf("record %#x of %d bytes returned %T with %v", fn, n, rec, err)
+				break
+			}
+		}
+	}
+}
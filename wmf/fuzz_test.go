@@ -0,0 +1,45 @@
+package wmf
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/lokks307/go-emf/emf"
+)
+
+// fuzzLimits keep the inputs of the fuzzer fast to convert and draw.
+var fuzzLimits = emf.Limits{MaxRecordSize: 1 << 20, MaxImagePixels: 1 << 20}
+
+// FuzzReadFile reads metafiles in lenient mode, what could be read is
+// converted, and the enhanced metafile is written and drawn. Run it with
+// go test -fuzz FuzzReadFile.
+func FuzzReadFile(f *testing.F) {
+	rect := wmfRecord(META_RECTANGLE, 20, 20, 0, 0)
+	eof := wmfRecord(META_EOF)
+
+	f.Add(wmfData(eof))
+	f.Add(wmfData(wmfRecord(META_SETBKMODE, 1), rect, eof))
+	f.Add(wmfData(
+		wmfRecord(META_CREATEBRUSHINDIRECT, 0, 0xFF, 0, 0),
+		wmfRecord(META_SELECTOBJECT, 0),
+		wmfRecord(META_SETWINDOWEXT, 100, 100),
+		rect,
+		wmfRecord(META_DELETEOBJECT, 0),
+		eof,
+	))
+	f.Add(wmfData(rect))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, _ := ReadFileWithOptions(data, &emf.ReadOptions{Limits: &fuzzLimits})
+		if file == nil {
+			return
+		}
+
+		e, _ := file.Emf()
+		if e == nil {
+			return
+		}
+		e.WriteTo(ioutil.Discard)
+		e.DrawToImg(emf.DRAW_COLOR_IMAGE)
+	})
+}
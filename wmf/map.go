@@ -0,0 +1,77 @@
+package wmf
+
+import "bytes"
+
+// map of readers for records
+var records = map[uint16]func(*bytes.Reader, Record) (Recorder, error){
+	META_EOF:                   readEofRecord,
+	META_REALIZEPALETTE:        readRealizePaletteRecord,
+	META_SETPALENTRIES:         readUnsupportedRecord,
+	META_SETBKMODE:             readSetBkModeRecord,
+	META_SETMAPMODE:            readSetMapModeRecord,
+	META_SETROP2:               readSetROP2Record,
+	META_SETRELABS:             nil,
+	META_SETPOLYFILLMODE:       readSetPolyFillModeRecord,
+	META_SETSTRETCHBLTMODE:     readSetStretchBltModeRecord,
+	META_SETTEXTCHAREXTRA:      readSetTextCharExtraRecord,
+	META_RESTOREDC:             readRestoreDCRecord,
+	META_RESIZEPALETTE:         readUnsupportedRecord,
+	META_DIBCREATEPATTERNBRUSH: readDibCreatePatternBrushRecord,
+	META_SETLAYOUT:             readSetLayoutRecord,
+	META_SETBKCOLOR:            readSetBkColorRecord,
+	META_SETTEXTCOLOR:          readSetTextColorRecord,
+	META_OFFSETVIEWPORTORG:     readViewportRecord,
+	META_LINETO:                readLineToRecord,
+	META_MOVETO:                readMoveToRecord,
+	META_OFFSETCLIPRGN:         readOffsetClipRgnRecord,
+	META_FILLREGION:            readFillRegionRecord,
+	META_SETMAPPERFLAGS:        readSetMapperFlagsRecord,
+	META_SELECTPALETTE:         readObjectRecord,
+	META_POLYGON:               readPolyRecord,
+	META_POLYLINE:              readPolyRecord,
+	META_SETTEXTJUSTIFICATION:  readSetTextJustificationRecord,
+	META_SETWINDOWORG:          readSetWindowOrgRecord,
+	META_SETWINDOWEXT:          readSetWindowExtRecord,
+	META_SETVIEWPORTORG:        readViewportRecord,
+	META_SETVIEWPORTEXT:        readViewportRecord,
+	META_OFFSETWINDOWORG:       readOffsetWindowOrgRecord,
+	META_SCALEWINDOWEXT:        readScaleWindowExtRecord,
+	META_SCALEVIEWPORTEXT:      readViewportRecord,
+	META_EXCLUDECLIPRECT:       readExcludeClipRectRecord,
+	META_INTERSECTCLIPRECT:     readIntersectClipRectRecord,
+	META_ELLIPSE:               readEllipseRecord,
+	META_FLOODFILL:             readUnsupportedRecord,
+	META_FRAMEREGION:           readFrameRegionRecord,
+	META_ANIMATEPALETTE:        readUnsupportedRecord,
+	META_TEXTOUT:               readTextOutRecord,
+	META_POLYPOLYGON:           readPolyPolygonRecord,
+	META_EXTFLOODFILL:          readUnsupportedRecord,
+	META_RECTANGLE:             readRectangleRecord,
+	META_SETPIXEL:              readSetPixelRecord,
+	META_ROUNDRECT:             readRoundRectRecord,
+	META_PATBLT:                readPatBltRecord,
+	META_SAVEDC:                readSaveDCRecord,
+	META_PIE:                   readArcRecord,
+	META_STRETCHBLT:            readUnsupportedRecord,
+	META_ESCAPE:                nil,
+	META_INVERTREGION:          readObjectRecord,
+	META_PAINTREGION:           readObjectRecord,
+	META_SELECTCLIPREGION:      readObjectRecord,
+	META_SELECTOBJECT:          readObjectRecord,
+	META_SETTEXTALIGN:          readSetTextAlignRecord,
+	META_ARC:                   readArcRecord,
+	META_CHORD:                 readArcRecord,
+	META_BITBLT:                readUnsupportedRecord,
+	META_EXTTEXTOUT:            readExtTextOutRecord,
+	META_SETDIBTODEV:           readSetDibToDevRecord,
+	META_DIBBITBLT:             readDibBitBltRecord,
+	META_DIBSTRETCHBLT:         readDibStretchBltRecord,
+	META_STRETCHDIB:            readStretchDibRecord,
+	META_DELETEOBJECT:          readObjectRecord,
+	META_CREATEPALETTE:         readCreatePaletteRecord,
+	META_CREATEPATTERNBRUSH:    readCreatePatternBrushRecord,
+	META_CREATEPENINDIRECT:     readCreatePenIndirectRecord,
+	META_CREATEFONTINDIRECT:    readCreateFontIndirectRecord,
+	META_CREATEBRUSHINDIRECT:   readCreateBrushIndirectRecord,
+	META_CREATEREGION:          readCreateRegionRecord,
+}
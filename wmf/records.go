@@ -0,0 +1,1353 @@
+package wmf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/lokks307/go-emf/emf"
+	"github.com/lokks307/go-emf/w32"
+	log "github.com/sirupsen/logrus"
+)
+
+// Recorder is a WMF record, which converts itself to EMF records.
+type Recorder interface {
+	convert(c *converter)
+}
+
+type Record struct {
+	Size     uint32 // in 16-bit words, the record header included
+	Function uint16
+}
+
+func (r *Record) convert(c *converter) {
+	log.Tracef("Unsupported record %#04x", r.Function)
+}
+
+// record gives access to the header of every record, which all embed
+// Record.
+func (r *Record) record() *Record {
+	return r
+}
+
+// readRecord reads the header and the parameters of the next record. A
+// record which does not fit the data or the limits cannot be skipped.
+func readRecord(reader *bytes.Reader, limits *emf.Limits) (Record, []byte, error) {
+	var defaultRecord Record
+
+	if err := binary.Read(reader, binary.LittleEndian, &defaultRecord); err != nil {
+		return defaultRecord, nil, emf.ErrRecordSize
+	}
+
+	log.Tracef("Record function = %04x\n", defaultRecord.Function)
+
+	if defaultRecord.Size < 3 || uint64(defaultRecord.Size-3)*2 > uint64(reader.Len()) {
+		return defaultRecord, nil, emf.ErrRecordSize
+	}
+
+	if size := uint64(defaultRecord.Size) * 2; limits.MaxRecordSize > 0 && size > uint64(limits.MaxRecordSize) {
+		return defaultRecord, nil, fmt.Errorf("%w: record of %d bytes", emf.ErrLimit, size)
+	}
+
+	// the parameters are read from their own reader, so that records
+	// with trailing data do not shift the following ones
+	params := make([]byte, (defaultRecord.Size-3)*2)
+	if _, err := io.ReadFull(reader, params); err != nil {
+		return defaultRecord, nil, err
+	}
+
+	return defaultRecord, params, nil
+}
+
+// parseRecord returns the record of the parameters.
+func parseRecord(rec Record, params []byte) (Recorder, error) {
+	fn, ok := records[rec.Function]
+	if !ok {
+		return nil, emf.ErrUnknownRecord
+	}
+
+	if fn != nil {
+		return fn(bytes.NewReader(params), rec)
+	}
+
+	// default implementation keeps record data
+	return &RawRecord{Record: rec, Data: params}, nil
+}
+
+// RawRecord is a record without a reader.
+type RawRecord struct {
+	Record
+	Data []byte
+}
+
+// Point16 is a point stored y first, as in the parameters of the records.
+type Point16 struct {
+	Y, X int16
+}
+
+func (p Point16) point() w32.POINT {
+	return w32.POINT{X: int32(p.X), Y: int32(p.Y)}
+}
+
+type EofRecord struct {
+	Record
+}
+
+func readEofRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	return &EofRecord{Record: rec}, nil
+}
+
+func (r *EofRecord) convert(c *converter) {}
+
+// state records
+
+type SetBkModeRecord struct {
+	Record
+	BkMode uint16
+}
+
+func readSetBkModeRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetBkModeRecord{Record: rec}
+	return recordValues(r, reader, &r.BkMode)
+}
+
+func (r *SetBkModeRecord) convert(c *converter) {
+	c.add(&emf.SetBkModeRecord{Record: emf.Record{Type: emf.EMR_SETBKMODE}, BkMode: uint32(r.BkMode)})
+}
+
+type SetMapModeRecord struct {
+	Record
+	MapMode uint16
+}
+
+func readSetMapModeRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetMapModeRecord{Record: rec}
+	return recordValues(r, reader, &r.MapMode)
+}
+
+func (r *SetMapModeRecord) convert(c *converter) {
+	// the picture is fitted to its size in MM_ANISOTROPIC, as a placeable
+	// metafile is played
+	log.Tracef("Ignored META_SETMAPMODE %d", r.MapMode)
+}
+
+type SetROP2Record struct {
+	Record
+	DrawMode uint16
+}
+
+func readSetROP2Record(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetROP2Record{Record: rec}
+	return recordValues(r, reader, &r.DrawMode)
+}
+
+func (r *SetROP2Record) convert(c *converter) {
+	c.add(&emf.SetROP2Record{Record: emf.Record{Type: emf.EMR_SETROP2}, ROP2Mode: uint32(r.DrawMode)})
+}
+
+type SetPolyFillModeRecord struct {
+	Record
+	PolyFillMode uint16
+}
+
+func readSetPolyFillModeRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetPolyFillModeRecord{Record: rec}
+	return recordValues(r, reader, &r.PolyFillMode)
+}
+
+func (r *SetPolyFillModeRecord) convert(c *converter) {
+	c.add(&emf.SetPolyfillModeRecord{Record: emf.Record{Type: emf.EMR_SETPOLYFILLMODE}, PolygonFillMode: uint32(r.PolyFillMode)})
+}
+
+type SetStretchBltModeRecord struct {
+	Record
+	StretchMode uint16
+}
+
+func readSetStretchBltModeRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetStretchBltModeRecord{Record: rec}
+	return recordValues(r, reader, &r.StretchMode)
+}
+
+func (r *SetStretchBltModeRecord) convert(c *converter) {
+	c.add(&emf.SetStretchBltModeRecord{Record: emf.Record{Type: emf.EMR_SETSTRETCHBLTMODE}, StretchMode: uint32(r.StretchMode)})
+}
+
+type SetTextAlignRecord struct {
+	Record
+	TextAlignmentMode uint16
+}
+
+func readSetTextAlignRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetTextAlignRecord{Record: rec}
+	return recordValues(r, reader, &r.TextAlignmentMode)
+}
+
+func (r *SetTextAlignRecord) convert(c *converter) {
+	c.add(&emf.SetTextAlignRecord{Record: emf.Record{Type: emf.EMR_SETTEXTALIGN}, TextAlignmentMode: uint32(r.TextAlignmentMode)})
+}
+
+type SetTextCharExtraRecord struct {
+	Record
+	CharExtra uint16
+}
+
+func readSetTextCharExtraRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetTextCharExtraRecord{Record: rec}
+	return recordValues(r, reader, &r.CharExtra)
+}
+
+func (r *SetTextCharExtraRecord) convert(c *converter) {
+	// EMF has no record for it
+	if r.CharExtra != 0 {
+		log.Warnf("Ignored META_SETTEXTCHAREXTRA %d", r.CharExtra)
+	}
+}
+
+type SetLayoutRecord struct {
+	Record
+	Layout uint16
+}
+
+func readSetLayoutRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetLayoutRecord{Record: rec}
+	return recordValues(r, reader, &r.Layout)
+}
+
+func (r *SetLayoutRecord) convert(c *converter) {
+	c.add(&emf.SetLayoutRecord{Record: emf.Record{Type: emf.EMR_SETLAYOUT}, LayoutMode: uint32(r.Layout)})
+}
+
+type SetBkColorRecord struct {
+	Record
+	ColorRef emf.WMFCOLORREF
+}
+
+func readSetBkColorRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetBkColorRecord{Record: rec}
+	return recordValues(r, reader, &r.ColorRef)
+}
+
+func (r *SetBkColorRecord) convert(c *converter) {
+	c.add(&emf.SetBkColorRecord{Record: emf.Record{Type: emf.EMR_SETBKCOLOR}, Color: r.ColorRef})
+}
+
+type SetTextColorRecord struct {
+	Record
+	ColorRef emf.WMFCOLORREF
+}
+
+func readSetTextColorRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetTextColorRecord{Record: rec}
+	return recordValues(r, reader, &r.ColorRef)
+}
+
+func (r *SetTextColorRecord) convert(c *converter) {
+	c.add(&emf.SetTextColorRecord{Record: emf.Record{Type: emf.EMR_SETTEXTCOLOR}, Color: r.ColorRef})
+}
+
+type SetMapperFlagsRecord struct {
+	Record
+	MapperValues uint32
+}
+
+func readSetMapperFlagsRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetMapperFlagsRecord{Record: rec}
+	return recordValues(r, reader, &r.MapperValues)
+}
+
+func (r *SetMapperFlagsRecord) convert(c *converter) {
+	c.add(&emf.SetMapperFlagsRecord{Record: emf.Record{Type: emf.EMR_SETMAPPERFLAGS}, Flags: r.MapperValues})
+}
+
+type SetTextJustificationRecord struct {
+	Record
+	BreakCount uint16
+	BreakExtra uint16
+}
+
+func readSetTextJustificationRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetTextJustificationRecord{Record: rec}
+	return recordValues(r, reader, &r.BreakCount, &r.BreakExtra)
+}
+
+func (r *SetTextJustificationRecord) convert(c *converter) {
+	c.add(&emf.SetTextJustificationRecord{
+		Record:    emf.Record{Type: emf.EMR_SETTEXTJUSTIFICATION},
+		BreakExCn: emf.BreakExCn{NBreakExtra: uint32(r.BreakExtra), NBreakCount: uint32(r.BreakCount)},
+	})
+}
+
+type SaveDCRecord struct {
+	Record
+}
+
+func readSaveDCRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	return &SaveDCRecord{Record: rec}, nil
+}
+
+func (r *SaveDCRecord) convert(c *converter) {
+	c.saved = append(c.saved, c.state)
+	c.add(&emf.SaveDCRecord{Record: emf.Record{Type: emf.EMR_SAVEDC}})
+}
+
+type RestoreDCRecord struct {
+	Record
+	NSavedDC int16
+}
+
+func readRestoreDCRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &RestoreDCRecord{Record: rec}
+	return recordValues(r, reader, &r.NSavedDC)
+}
+
+func (r *RestoreDCRecord) convert(c *converter) {
+	// negative values are relative to the current state
+	n := int(r.NSavedDC)
+	if n > 0 {
+		n -= len(c.saved) + 1
+	}
+
+	if n >= 0 || -n > len(c.saved) {
+		log.Warnf("Ignored META_RESTOREDC %d", r.NSavedDC)
+		return
+	}
+
+	c.state = c.saved[len(c.saved)+n]
+	c.saved = c.saved[:len(c.saved)+n]
+	c.add(&emf.RestoreDCRecord{Record: emf.Record{Type: emf.EMR_RESTOREDC}, SavedDC: int32(n)})
+}
+
+// window and viewport
+
+type SetWindowOrgRecord struct {
+	Record
+	Origin Point16
+}
+
+func readSetWindowOrgRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetWindowOrgRecord{Record: rec}
+	return recordValues(r, reader, &r.Origin)
+}
+
+func (r *SetWindowOrgRecord) convert(c *converter) {
+	c.setWindowOrg(r.Origin.point())
+}
+
+type OffsetWindowOrgRecord struct {
+	Record
+	Offset Point16
+}
+
+func readOffsetWindowOrgRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &OffsetWindowOrgRecord{Record: rec}
+	return recordValues(r, reader, &r.Offset)
+}
+
+func (r *OffsetWindowOrgRecord) convert(c *converter) {
+	c.setWindowOrg(w32.POINT{X: c.state.org.X + int32(r.Offset.X), Y: c.state.org.Y + int32(r.Offset.Y)})
+}
+
+type SetWindowExtRecord struct {
+	Record
+	Extent Point16
+}
+
+func readSetWindowExtRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetWindowExtRecord{Record: rec}
+	return recordValues(r, reader, &r.Extent)
+}
+
+func (r *SetWindowExtRecord) convert(c *converter) {
+	if c.fixedExt {
+		log.Trace("Ignored META_SETWINDOWEXT in MM_TEXT")
+		return
+	}
+
+	c.add(&emf.SetWindowExtExRecord{
+		Record: emf.Record{Type: emf.EMR_SETWINDOWEXTEX},
+		Extent: w32.SIZE{CX: int32(r.Extent.X), CY: int32(r.Extent.Y)},
+	})
+}
+
+type ScaleWindowExtRecord struct {
+	Record
+	YDenom, YNum, XDenom, XNum int16
+}
+
+func readScaleWindowExtRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &ScaleWindowExtRecord{Record: rec}
+	return recordValues(r, reader, &r.YDenom, &r.YNum, &r.XDenom, &r.XNum)
+}
+
+func (r *ScaleWindowExtRecord) convert(c *converter) {
+	if c.fixedExt {
+		log.Trace("Ignored META_SCALEWINDOWEXT in MM_TEXT")
+		return
+	}
+
+	c.add(&emf.ScaleWindowExtExRecord{
+		Record: emf.Record{Type: emf.EMR_SCALEWINDOWEXTEX},
+		XYNumDenon: emf.XYNumDenon{
+			XNum: uint32(int32(r.XNum)), XDenon: uint32(int32(r.XDenom)),
+			YNum: uint32(int32(r.YNum)), YDenon: uint32(int32(r.YDenom)),
+		},
+	})
+}
+
+// ViewportRecord is one of the META_SETVIEWPORTORG, META_SETVIEWPORTEXT,
+// META_OFFSETVIEWPORTORG and META_SCALEVIEWPORTEXT records. The viewport
+// belongs to the device a metafile is played on, the picture is fitted to
+// its size instead.
+type ViewportRecord struct {
+	Record
+	Values []int16
+}
+
+func readViewportRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &ViewportRecord{Record: rec}
+	r.Values = make([]int16, reader.Len()/2)
+	return recordValues(r, reader, r.Values)
+}
+
+func (r *ViewportRecord) convert(c *converter) {
+	log.Tracef("Ignored viewport record %#04x", r.Function)
+}
+
+// clipping
+
+type ExcludeClipRectRecord struct {
+	Record
+	Box Box16
+}
+
+func readExcludeClipRectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &ExcludeClipRectRecord{Record: rec}
+	return recordValues(r, reader, &r.Box)
+}
+
+func (r *ExcludeClipRectRecord) convert(c *converter) {
+	c.add(&emf.ExcludeClipRectRecord{Record: emf.Record{Type: emf.EMR_EXCLUDECLIPRECT}, Clip: r.Box.rect()})
+}
+
+type IntersectClipRectRecord struct {
+	Record
+	Box Box16
+}
+
+func readIntersectClipRectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &IntersectClipRectRecord{Record: rec}
+	return recordValues(r, reader, &r.Box)
+}
+
+func (r *IntersectClipRectRecord) convert(c *converter) {
+	c.add(&emf.IntersectClipRectRecord{Record: emf.Record{Type: emf.EMR_INTERSECTCLIPRECT}, Clip: r.Box.rect()})
+}
+
+type OffsetClipRgnRecord struct {
+	Record
+	Offset Point16
+}
+
+func readOffsetClipRgnRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &OffsetClipRgnRecord{Record: rec}
+	return recordValues(r, reader, &r.Offset)
+}
+
+func (r *OffsetClipRgnRecord) convert(c *converter) {
+	c.add(&emf.OffSetClipRgnRecord{Record: emf.Record{Type: emf.EMR_OFFSETCLIPRGN}, Offset: r.Offset.point()})
+}
+
+// ObjectRecord is a record taking the index of an object,
+// META_SELECTOBJECT, META_DELETEOBJECT, META_SELECTPALETTE,
+// META_SELECTCLIPREGION, META_PAINTREGION, META_INVERTREGION.
+type ObjectRecord struct {
+	Record
+	ObjectIndex uint16
+}
+
+func readObjectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &ObjectRecord{Record: rec}
+	return recordValues(r, reader, &r.ObjectIndex)
+}
+
+func (r *ObjectRecord) convert(c *converter) {
+	object, ok := c.object(r.ObjectIndex)
+	if !ok {
+		c.fail(fmt.Errorf("no object %d", r.ObjectIndex))
+		return
+	}
+
+	ih := uint32(r.ObjectIndex) + 1
+
+	switch r.Function {
+	case META_SELECTOBJECT:
+		switch object := object.(type) {
+		case *CreateRegionRecord:
+			c.clipRects(object.Region.Rects, emf.RGN_COPY)
+			return
+		case *CreateBrushIndirectRecord, *DibCreatePatternBrushRecord, *CreatePatternBrushRecord:
+			c.state.brush = ih
+		case *CreateFontIndirectRecord:
+			c.state.charset = object.Font.CharSet
+		case *CreatePaletteRecord:
+			c.add(&emf.SelectPaletteRecord{Record: emf.Record{Type: emf.EMR_SELECTPALETTE}, IhPal: ih})
+			return
+		}
+		c.add(&emf.SelectObjectRecord{Record: emf.Record{Type: emf.EMR_SELECTOBJECT}, IhObject: ih})
+
+	case META_SELECTPALETTE:
+		c.add(&emf.SelectPaletteRecord{Record: emf.Record{Type: emf.EMR_SELECTPALETTE}, IhPal: ih})
+
+	case META_DELETEOBJECT:
+		c.objects[r.ObjectIndex] = nil
+		if _, ok := object.(*CreateRegionRecord); ok {
+			return
+		}
+		c.add(&emf.DeleteObjectRecord{Record: emf.Record{Type: emf.EMR_DELETEOBJECT}, IhObject: ih})
+
+	case META_SELECTCLIPREGION, META_PAINTREGION, META_INVERTREGION:
+		region, ok := object.(*CreateRegionRecord)
+		if !ok {
+			c.fail(fmt.Errorf("object %d is not a region", r.ObjectIndex))
+			return
+		}
+
+		rgn := emf.RegionData{Data: region.Region.Rects}
+
+		switch r.Function {
+		case META_SELECTCLIPREGION:
+			c.clipRects(region.Region.Rects, emf.RGN_COPY)
+		case META_PAINTREGION:
+			c.add(&emf.PaintRgnRecord{Record: emf.Record{Type: emf.EMR_PAINTRGN}, RgnData: rgn})
+		default:
+			c.add(&emf.InvertRgnRecord{Record: emf.Record{Type: emf.EMR_INVERTRGN}, RgnData: rgn})
+		}
+	}
+}
+
+// objects
+
+type CreatePenIndirectRecord struct {
+	Record
+	Pen LogPen16
+}
+
+func readCreatePenIndirectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &CreatePenIndirectRecord{Record: rec}
+	return recordValues(r, reader, &r.Pen)
+}
+
+func (r *CreatePenIndirectRecord) convert(c *converter) {
+	c.add(&emf.CreatePenRecord{
+		Record: emf.Record{Type: emf.EMR_CREATEPEN},
+		IhPen:  c.addObject(r),
+		LogPen: emf.WMFLOGPEN{
+			PenStyle: uint32(r.Pen.PenStyle),
+			Width:    w32.POINT{X: int32(r.Pen.Width.X)},
+			ColorRef: r.Pen.ColorRef,
+		},
+	})
+}
+
+type CreateBrushIndirectRecord struct {
+	Record
+	Brush LogBrush16
+}
+
+func readCreateBrushIndirectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &CreateBrushIndirectRecord{Record: rec}
+	return recordValues(r, reader, &r.Brush)
+}
+
+func (r *CreateBrushIndirectRecord) convert(c *converter) {
+	c.createBrush(r, emf.WMFLOGBRUSH{
+		BrushStyle: uint32(r.Brush.BrushStyle),
+		Color:      r.Brush.ColorRef,
+		BrushHatch: uint32(r.Brush.BrushHatch),
+	})
+}
+
+// DibCreatePatternBrushRecord creates a brush from a bitmap. EMF pattern
+// brushes are not drawn, the brush is converted to a solid brush of the
+// average color of the pattern.
+type DibCreatePatternBrushRecord struct {
+	Record
+	Style      uint16
+	ColorUsage uint16
+	Target     *emf.Bitmap // for DIB patterns
+	Bitmap     *Bitmap16   // for BS_PATTERN
+}
+
+func readDibCreatePatternBrushRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &DibCreatePatternBrushRecord{Record: rec}
+	if err := readValues(reader, &r.Style, &r.ColorUsage); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Style == emf.BS_PATTERN {
+		r.Bitmap, err = readBitmap16(reader)
+	} else {
+		r.Target, err = readDIB(reader, r.ColorUsage)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *DibCreatePatternBrushRecord) convert(c *converter) {
+	color := emf.WMFCOLORREF{Red: 0x80, Green: 0x80, Blue: 0x80}
+
+	switch {
+	case r.Bitmap != nil:
+		color = r.Bitmap.averageColor()
+	case r.ColorUsage == emf.DIB_PAL_COLORS:
+		log.Warn("Unsupported pattern brush with palette colors")
+	default:
+		img, err := r.Target.Image()
+		if err != nil {
+			c.fail(err)
+			break
+		}
+		color = averageColor(img)
+	}
+
+	c.createBrush(r, emf.WMFLOGBRUSH{BrushStyle: emf.BS_SOLID, Color: color})
+}
+
+// Bitmap16 is a device dependent bitmap, only monochrome ones are used
+// in metafiles.
+type Bitmap16 struct {
+	Type       int16
+	Width      int16
+	Height     int16
+	WidthBytes int16
+	Planes     uint8
+	BitsPixel  uint8
+	Bits       []byte
+}
+
+func readBitmap16(reader *bytes.Reader) (*Bitmap16, error) {
+	b := &Bitmap16{}
+	if err := readValues(reader, &b.Type, &b.Width, &b.Height, &b.WidthBytes, &b.Planes, &b.BitsPixel); err != nil {
+		return nil, err
+	}
+
+	b.Bits = make([]byte, reader.Len())
+	reader.Read(b.Bits)
+
+	return b, nil
+}
+
+// averageColor returns the gray of the share of set bits, which are white
+// in a monochrome bitmap.
+func (b *Bitmap16) averageColor() emf.WMFCOLORREF {
+	var set, all int
+	for y := 0; y < int(b.Height); y++ {
+		for x := 0; x < int(b.Width); x++ {
+			i := y*int(b.WidthBytes) + x/8
+			if i >= len(b.Bits) {
+				break
+			}
+			if b.Bits[i]&(0x80>>uint(x%8)) != 0 {
+				set++
+			}
+			all++
+		}
+	}
+
+	if all == 0 {
+		return emf.WMFCOLORREF{}
+	}
+
+	gray := byte(set * 0xFF / all)
+	return emf.WMFCOLORREF{Red: gray, Green: gray, Blue: gray}
+}
+
+// CreatePatternBrushRecord creates a brush from a device dependent bitmap,
+// it is converted like DibCreatePatternBrushRecord.
+type CreatePatternBrushRecord struct {
+	Record
+	Bitmap *Bitmap16
+}
+
+func readCreatePatternBrushRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &CreatePatternBrushRecord{Record: rec}
+
+	b := &Bitmap16{}
+	if err := readValues(reader, &b.Type, &b.Width, &b.Height, &b.WidthBytes, &b.Planes, &b.BitsPixel); err != nil {
+		return nil, err
+	}
+
+	// Bits of the Bitmap16 object and Reserved are not used
+	var reserved [22]byte
+	if err := readValues(reader, &reserved); err != nil {
+		return nil, err
+	}
+
+	b.Bits = make([]byte, reader.Len())
+	reader.Read(b.Bits)
+	r.Bitmap = b
+
+	return r, nil
+}
+
+func (r *CreatePatternBrushRecord) convert(c *converter) {
+	c.createBrush(r, emf.WMFLOGBRUSH{BrushStyle: emf.BS_SOLID, Color: r.Bitmap.averageColor()})
+}
+
+type CreateFontIndirectRecord struct {
+	Record
+	Font Font
+}
+
+func readCreateFontIndirectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	font, err := readFont(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateFontIndirectRecord{Record: rec, Font: font}, nil
+}
+
+func (r *CreateFontIndirectRecord) convert(c *converter) {
+	font := &emf.ExtCreateFontIndirectWRecord{
+		Record:  emf.Record{Type: emf.EMR_EXTCREATEFONTINDIRECTW},
+		IhFonts: c.addObject(r),
+	}
+	font.Elw.LOGFONT = r.Font.logFont()
+	c.add(font)
+}
+
+type CreatePaletteRecord struct {
+	Record
+	Palette Palette
+}
+
+func readCreatePaletteRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	palette, err := readPalette(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CreatePaletteRecord{Record: rec, Palette: palette}, nil
+}
+
+func (r *CreatePaletteRecord) convert(c *converter) {
+	c.add(&emf.CreatePaletteRecord{
+		Record: emf.Record{Type: emf.EMR_CREATEPALETTE},
+		IhPal:  c.addObject(r),
+		LogPalette: w32.LOGPALETTE{
+			Version:         0x0300,
+			NumberOfEntries: uint16(len(r.Palette.Entries)),
+			PaletteEntries:  r.Palette.Entries,
+		},
+	})
+}
+
+type RealizePaletteRecord struct {
+	Record
+}
+
+func readRealizePaletteRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	return &RealizePaletteRecord{Record: rec}, nil
+}
+
+func (r *RealizePaletteRecord) convert(c *converter) {
+	c.add(&emf.RawRecord{Record: emf.Record{Type: emf.EMR_REALIZEPALETTE}})
+}
+
+// CreateRegionRecord creates a region. Regions have no EMF object, the
+// converter keeps their rectangles.
+type CreateRegionRecord struct {
+	Record
+	Region Region
+}
+
+func readCreateRegionRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	region, err := readRegion(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateRegionRecord{Record: rec, Region: region}, nil
+}
+
+func (r *CreateRegionRecord) convert(c *converter) {
+	c.addObject(r)
+}
+
+type FillRegionRecord struct {
+	Record
+	Region uint16
+	Brush  uint16
+}
+
+func readFillRegionRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &FillRegionRecord{Record: rec}
+	return recordValues(r, reader, &r.Region, &r.Brush)
+}
+
+func (r *FillRegionRecord) convert(c *converter) {
+	object, _ := c.object(r.Region)
+	region, ok := object.(*CreateRegionRecord)
+	if !ok {
+		c.fail(fmt.Errorf("no region %d", r.Region))
+		return
+	}
+
+	if _, ok := c.object(r.Brush); !ok {
+		c.fail(fmt.Errorf("no brush %d", r.Brush))
+		return
+	}
+
+	c.add(&emf.FillRgnRecord{
+		Record:  emf.Record{Type: emf.EMR_FILLRGN},
+		IhBrush: uint32(r.Brush) + 1,
+		RgnData: emf.RegionData{Data: region.Region.Rects},
+	})
+}
+
+type FrameRegionRecord struct {
+	Record
+	Region uint16
+	Brush  uint16
+	Height int16
+	Width  int16
+}
+
+func readFrameRegionRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &FrameRegionRecord{Record: rec}
+	return recordValues(r, reader, &r.Region, &r.Brush, &r.Height, &r.Width)
+}
+
+func (r *FrameRegionRecord) convert(c *converter) {
+	object, _ := c.object(r.Region)
+	region, ok := object.(*CreateRegionRecord)
+	if !ok {
+		c.fail(fmt.Errorf("no region %d", r.Region))
+		return
+	}
+
+	if _, ok := c.object(r.Brush); !ok {
+		c.fail(fmt.Errorf("no brush %d", r.Brush))
+		return
+	}
+
+	c.add(&emf.FrameRgnRecord{
+		Record:  emf.Record{Type: emf.EMR_FRAMERGN},
+		IhBrush: uint32(r.Brush) + 1,
+		Width:   int32(r.Width),
+		Height:  int32(r.Height),
+		RgnData: emf.RegionData{Data: region.Region.Rects},
+	})
+}
+
+// drawing
+
+type MoveToRecord struct {
+	Record
+	Point Point16
+}
+
+func readMoveToRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &MoveToRecord{Record: rec}
+	return recordValues(r, reader, &r.Point)
+}
+
+func (r *MoveToRecord) convert(c *converter) {
+	c.moveTo(r.Point.point())
+}
+
+type LineToRecord struct {
+	Record
+	Point Point16
+}
+
+func readLineToRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &LineToRecord{Record: rec}
+	return recordValues(r, reader, &r.Point)
+}
+
+func (r *LineToRecord) convert(c *converter) {
+	c.state.cur = r.Point.point()
+	c.add(&emf.LineToRecord{Record: emf.Record{Type: emf.EMR_LINETO}, Point: c.state.cur})
+}
+
+type RectangleRecord struct {
+	Record
+	Box Box16
+}
+
+func readRectangleRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &RectangleRecord{Record: rec}
+	return recordValues(r, reader, &r.Box)
+}
+
+func (r *RectangleRecord) convert(c *converter) {
+	c.add(&emf.RectangleRecord{Record: emf.Record{Type: emf.EMR_RECTANGLE}, Box: r.Box.rect()})
+}
+
+type EllipseRecord struct {
+	Record
+	Box Box16
+}
+
+func readEllipseRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &EllipseRecord{Record: rec}
+	return recordValues(r, reader, &r.Box)
+}
+
+func (r *EllipseRecord) convert(c *converter) {
+	c.add(&emf.EllipseRecord{Record: emf.Record{Type: emf.EMR_ELLIPSE}, Box: r.Box.rect()})
+}
+
+type RoundRectRecord struct {
+	Record
+	Height, Width int16
+	Box           Box16
+}
+
+func readRoundRectRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &RoundRectRecord{Record: rec}
+	return recordValues(r, reader, &r.Height, &r.Width, &r.Box)
+}
+
+func (r *RoundRectRecord) convert(c *converter) {
+	c.add(&emf.RoundRectRecord{
+		Record: emf.Record{Type: emf.EMR_ROUNDRECT},
+		Box:    r.Box.rect(),
+		Corner: w32.SIZE{CX: int32(r.Width), CY: int32(r.Height)},
+	})
+}
+
+// ArcRecord is one of META_ARC, META_PIE and META_CHORD, which take the same
+// parameters.
+type ArcRecord struct {
+	Record
+	End   Point16
+	Start Point16
+	Box   Box16
+}
+
+func readArcRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &ArcRecord{Record: rec}
+	return recordValues(r, reader, &r.End, &r.Start, &r.Box)
+}
+
+func (r *ArcRecord) convert(c *converter) {
+	box, start, end := r.Box.rect(), r.Start.point(), r.End.point()
+
+	switch r.Function {
+	case META_ARC:
+		c.add(&emf.ArcRecord{Record: emf.Record{Type: emf.EMR_ARC}, Box: box, Start: start, End: end})
+	case META_PIE:
+		c.add(&emf.PieRecord{Record: emf.Record{Type: emf.EMR_PIE}, Box: box, Start: start, End: end})
+	case META_CHORD:
+		c.add(&emf.ChordRecord{Record: emf.Record{Type: emf.EMR_CHORD}, Box: box, Start: start, End: end})
+	}
+}
+
+type SetPixelRecord struct {
+	Record
+	ColorRef emf.WMFCOLORREF
+	Point    Point16
+}
+
+func readSetPixelRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetPixelRecord{Record: rec}
+	return recordValues(r, reader, &r.ColorRef, &r.Point)
+}
+
+func (r *SetPixelRecord) convert(c *converter) {
+	c.add(&emf.SetPixelvRecord{Record: emf.Record{Type: emf.EMR_SETPIXELV}, Pixel: r.Point.point(), Color: r.ColorRef})
+}
+
+// PolyRecord is a META_POLYGON or META_POLYLINE record.
+type PolyRecord struct {
+	Record
+	NumberOfPoints int16
+	APoints        []emf.PointS
+}
+
+func readPolyRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &PolyRecord{Record: rec}
+	if err := readValues(reader, &r.NumberOfPoints); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.APoints, err = readPoints(reader, int(r.NumberOfPoints))
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyRecord) convert(c *converter) {
+	if r.Function == META_POLYGON {
+		c.add(&emf.Polygon16Record{Record: emf.Record{Type: emf.EMR_POLYGON16}, Count: uint32(len(r.APoints)), APoints: r.APoints})
+	} else {
+		c.add(&emf.PolyLine16Record{Record: emf.Record{Type: emf.EMR_POLYLINE16}, Count: uint32(len(r.APoints)), APoints: r.APoints})
+	}
+}
+
+type PolyPolygonRecord struct {
+	Record
+	NumberOfPolygons uint16
+	PointsPerPolygon []uint16
+	APoints          []emf.PointS
+}
+
+func readPolyPolygonRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &PolyPolygonRecord{Record: rec}
+	if err := readValues(reader, &r.NumberOfPolygons); err != nil {
+		return nil, err
+	}
+
+	if err := checkCount(reader, int(r.NumberOfPolygons), 2); err != nil {
+		return nil, err
+	}
+
+	r.PointsPerPolygon = make([]uint16, r.NumberOfPolygons)
+	if err := readValues(reader, r.PointsPerPolygon); err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, n := range r.PointsPerPolygon {
+		count += int(n)
+	}
+
+	var err error
+	r.APoints, err = readPoints(reader, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *PolyPolygonRecord) convert(c *converter) {
+	rec := &emf.PolyPolygon16Record{
+		Record:           emf.Record{Type: emf.EMR_POLYPOLYGON16},
+		NumberOfPolygons: uint32(r.NumberOfPolygons),
+		Count:            uint32(len(r.APoints)),
+		APoints:          r.APoints,
+	}
+	for _, n := range r.PointsPerPolygon {
+		rec.PolygonPointCount = append(rec.PolygonPointCount, uint32(n))
+	}
+
+	c.add(rec)
+}
+
+// text
+
+// TextOutRecord draws a string in the code page of the charset of the
+// selected font.
+type TextOutRecord struct {
+	Record
+	StringLength int16
+	String       []byte
+	Start        Point16
+}
+
+func readTextOutRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &TextOutRecord{Record: rec}
+	if err := readValues(reader, &r.StringLength); err != nil {
+		return nil, err
+	}
+
+	// the string is padded to 16 bits
+	if err := checkCount(reader, (int(r.StringLength)+1)&^1, 1); err != nil {
+		return nil, err
+	}
+
+	r.String = make([]byte, (int(r.StringLength)+1)&^1)
+	if err := readValues(reader, r.String); err != nil {
+		return nil, err
+	}
+	r.String = r.String[:r.StringLength]
+
+	return recordValues(r, reader, &r.Start)
+}
+
+func (r *TextOutRecord) convert(c *converter) {
+	c.textOut(r.Start.point(), 0, nil, r.String, nil)
+}
+
+type ExtTextOutRecord struct {
+	Record
+	Point        Point16
+	StringLength int16
+	FwOpts       uint16
+	Rectangle    *Rect16 // with ETO_OPAQUE or ETO_CLIPPED
+	String       []byte
+	Dx           []int16 // a distance for every byte of String, optional
+}
+
+func readExtTextOutRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &ExtTextOutRecord{Record: rec}
+	if err := readValues(reader, &r.Point, &r.StringLength, &r.FwOpts); err != nil {
+		return nil, err
+	}
+
+	if uint32(r.FwOpts)&(emf.ETO_OPAQUE|emf.ETO_CLIPPED) != 0 {
+		r.Rectangle = &Rect16{}
+		if err := readValues(reader, r.Rectangle); err != nil {
+			return nil, err
+		}
+	}
+
+	// the string is padded to 16 bits
+	if err := checkCount(reader, (int(r.StringLength)+1)&^1, 1); err != nil {
+		return nil, err
+	}
+
+	r.String = make([]byte, (int(r.StringLength)+1)&^1)
+	if err := readValues(reader, r.String); err != nil {
+		return nil, err
+	}
+	r.String = r.String[:r.StringLength]
+
+	if reader.Len() >= int(r.StringLength)*2 {
+		r.Dx = make([]int16, r.StringLength)
+		if err := readValues(reader, r.Dx); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *ExtTextOutRecord) convert(c *converter) {
+	var rect *w32.RECT
+	if r.Rectangle != nil {
+		rc := r.Rectangle.rect()
+		rect = &rc
+	}
+
+	c.textOut(r.Point.point(), uint32(r.FwOpts), rect, r.String, r.Dx)
+}
+
+// bitmaps
+
+type PatBltRecord struct {
+	Record
+	RasterOperation uint32
+	Height, Width   int16
+	Dest            Point16
+}
+
+func readPatBltRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &PatBltRecord{Record: rec}
+	return recordValues(r, reader, &r.RasterOperation, &r.Height, &r.Width, &r.Dest)
+}
+
+func (r *PatBltRecord) convert(c *converter) {
+	c.patBlt(r.Dest.point(), int32(r.Width), int32(r.Height), r.RasterOperation)
+}
+
+// hasBitmap tells whether a bitmap record carries a bitmap, the size of the
+// record without one is in the high byte of its function.
+func hasBitmap(rec Record) bool {
+	return rec.Size != uint32(rec.Function>>8)+3
+}
+
+// DibBitBltRecord is a META_DIBBITBLT record, Target is nil for pattern
+// operations without a source.
+type DibBitBltRecord struct {
+	Record
+	RasterOperation uint32
+	Src             Point16
+	Height, Width   int16
+	Dest            Point16
+	Target          *emf.Bitmap
+}
+
+func readDibBitBltRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &DibBitBltRecord{Record: rec}
+	if err := readValues(reader, &r.RasterOperation, &r.Src); err != nil {
+		return nil, err
+	}
+
+	bitmap := hasBitmap(rec)
+	if !bitmap {
+		var reserved uint16
+		if err := readValues(reader, &reserved); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := readValues(reader, &r.Height, &r.Width, &r.Dest); err != nil {
+		return nil, err
+	}
+
+	if bitmap {
+		var err error
+		r.Target, err = readDIB(reader, emf.DIB_RGB_COLORS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *DibBitBltRecord) convert(c *converter) {
+	if r.Target == nil {
+		c.patBlt(r.Dest.point(), int32(r.Width), int32(r.Height), r.RasterOperation)
+		return
+	}
+
+	c.stretchDIBits(r.Dest.point(), int32(r.Width), int32(r.Height),
+		r.Src.point(), int32(r.Width), int32(r.Height), r.Target, emf.DIB_RGB_COLORS, r.RasterOperation)
+}
+
+type DibStretchBltRecord struct {
+	Record
+	RasterOperation       uint32
+	SrcHeight, SrcWidth   int16
+	Src                   Point16
+	DestHeight, DestWidth int16
+	Dest                  Point16
+	Target                *emf.Bitmap
+}
+
+func readDibStretchBltRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &DibStretchBltRecord{Record: rec}
+	if err := readValues(reader, &r.RasterOperation, &r.SrcHeight, &r.SrcWidth, &r.Src); err != nil {
+		return nil, err
+	}
+
+	bitmap := hasBitmap(rec)
+	if !bitmap {
+		var reserved uint16
+		if err := readValues(reader, &reserved); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := readValues(reader, &r.DestHeight, &r.DestWidth, &r.Dest); err != nil {
+		return nil, err
+	}
+
+	if bitmap {
+		var err error
+		r.Target, err = readDIB(reader, emf.DIB_RGB_COLORS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *DibStretchBltRecord) convert(c *converter) {
+	if r.Target == nil {
+		c.patBlt(r.Dest.point(), int32(r.DestWidth), int32(r.DestHeight), r.RasterOperation)
+		return
+	}
+
+	c.stretchDIBits(r.Dest.point(), int32(r.DestWidth), int32(r.DestHeight),
+		r.Src.point(), int32(r.SrcWidth), int32(r.SrcHeight), r.Target, emf.DIB_RGB_COLORS, r.RasterOperation)
+}
+
+type StretchDibRecord struct {
+	Record
+	RasterOperation       uint32
+	ColorUsage            uint16
+	SrcHeight, SrcWidth   int16
+	Src                   Point16
+	DestHeight, DestWidth int16
+	Dest                  Point16
+	DIB                   *emf.Bitmap
+}
+
+func readStretchDibRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &StretchDibRecord{Record: rec}
+	if err := readValues(reader, &r.RasterOperation, &r.ColorUsage, &r.SrcHeight, &r.SrcWidth, &r.Src,
+		&r.DestHeight, &r.DestWidth, &r.Dest); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.DIB, err = readDIB(reader, r.ColorUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *StretchDibRecord) convert(c *converter) {
+	c.stretchDIBits(r.Dest.point(), int32(r.DestWidth), int32(r.DestHeight),
+		r.Src.point(), int32(r.SrcWidth), int32(r.SrcHeight), r.DIB, uint32(r.ColorUsage), r.RasterOperation)
+}
+
+type SetDibToDevRecord struct {
+	Record
+	ColorUsage    uint16
+	ScanCount     uint16
+	StartScan     uint16
+	Dib           Point16
+	Height, Width int16
+	Dest          Point16
+	DIB           *emf.Bitmap
+}
+
+func readSetDibToDevRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &SetDibToDevRecord{Record: rec}
+	if err := readValues(reader, &r.ColorUsage, &r.ScanCount, &r.StartScan, &r.Dib,
+		&r.Height, &r.Width, &r.Dest); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.DIB, err = readDIB(reader, r.ColorUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *SetDibToDevRecord) convert(c *converter) {
+	c.add(&emf.SetDIBitsToDeviceRecord{
+		Record: emf.Record{Type: emf.EMR_SETDIBITSTODEVICE},
+		SetDIBitsToDeviceInfo: emf.SetDIBitsToDeviceInfo{
+			XDest:      int32(r.Dest.X),
+			YDest:      int32(r.Dest.Y),
+			XSrc:       int32(r.Dib.X),
+			YSrc:       int32(r.Dib.Y),
+			CxSrc:      int32(r.Width),
+			CySrc:      int32(r.Height),
+			UsageSrc:   uint32(r.ColorUsage),
+			IStartScan: uint32(r.StartScan),
+			CScans:     uint32(r.ScanCount),
+		},
+		BmiSrc:    r.DIB.Info,
+		ColorsSrc: r.DIB.Colors,
+		BitsSrc:   r.DIB.Bits,
+	})
+}
+
+// UnsupportedRecord is a record which has no counterpart in the drawing
+// model of the converter, such as META_FLOODFILL or META_ANIMATEPALETTE.
+type UnsupportedRecord struct {
+	RawRecord
+}
+
+func readUnsupportedRecord(reader *bytes.Reader, rec Record) (Recorder, error) {
+	r := &UnsupportedRecord{RawRecord: RawRecord{Record: rec}}
+	r.Data = make([]byte, reader.Len())
+	reader.Read(r.Data)
+	return r, nil
+}
+
+func (r *UnsupportedRecord) convert(c *converter) {
+	log.Warnf("Unsupported record %#04x", r.Function)
+}
@@ -0,0 +1,340 @@
+package wmf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"unicode/utf16"
+
+	"github.com/lokks307/go-emf/emf"
+	"github.com/lokks307/go-emf/w32"
+)
+
+func readValues(reader *bytes.Reader, values ...interface{}) error {
+	for _, v := range values {
+		if err := binary.Read(reader, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordValues reads the values of r, which is returned only when they
+// could all be read.
+func recordValues(r Recorder, reader *bytes.Reader, values ...interface{}) (Recorder, error) {
+	if err := readValues(reader, values...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// checkCount fails when count items of size bytes do not fit the rest of
+// the record.
+func checkCount(reader *bytes.Reader, count int, size int) error {
+	if count < 0 || count*size > reader.Len() {
+		return errors.New("count exceeds record size")
+	}
+	return nil
+}
+
+func readPoints(reader *bytes.Reader, count int) ([]emf.PointS, error) {
+	if err := checkCount(reader, count, 4); err != nil {
+		return nil, err
+	}
+
+	points := make([]emf.PointS, count)
+	if err := readValues(reader, points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// Rect16 is a rectangle of 16-bit coordinates, as in the Rect object.
+type Rect16 struct {
+	Left, Top, Right, Bottom int16
+}
+
+func (r Rect16) rect() w32.RECT {
+	return w32.RECT{Left: int32(r.Left), Top: int32(r.Top), Right: int32(r.Right), Bottom: int32(r.Bottom)}
+}
+
+// Box16 is a rectangle stored bottom first, as the parameters of the
+// drawing records.
+type Box16 struct {
+	Bottom, Right, Top, Left int16
+}
+
+func (b Box16) rect() w32.RECT {
+	return w32.RECT{Left: int32(b.Left), Top: int32(b.Top), Right: int32(b.Right), Bottom: int32(b.Bottom)}
+}
+
+type LogPen16 struct {
+	PenStyle uint16
+	Width    emf.PointS
+	ColorRef emf.WMFCOLORREF
+}
+
+type LogBrush16 struct {
+	BrushStyle uint16
+	ColorRef   emf.WMFCOLORREF
+	BrushHatch uint16
+}
+
+// Font is the Font object of a META_CREATEFONTINDIRECT record, the face
+// name is in the code page of CharSet.
+type Font struct {
+	Height         int16
+	Width          int16
+	Escapement     int16
+	Orientation    int16
+	Weight         int16
+	Italic         byte
+	Underline      byte
+	StrikeOut      byte
+	CharSet        byte
+	OutPrecision   byte
+	ClipPrecision  byte
+	Quality        byte
+	PitchAndFamily byte
+	FaceName       []byte
+}
+
+func readFont(reader *bytes.Reader) (Font, error) {
+	var f Font
+	if err := readValues(reader, &f.Height, &f.Width, &f.Escapement, &f.Orientation, &f.Weight,
+		&f.Italic, &f.Underline, &f.StrikeOut, &f.CharSet,
+		&f.OutPrecision, &f.ClipPrecision, &f.Quality, &f.PitchAndFamily); err != nil {
+		return f, err
+	}
+
+	// up to 32 bytes, null-terminated
+	name := make([]byte, reader.Len())
+	reader.Read(name)
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	f.FaceName = name
+
+	return f, nil
+}
+
+func (f *Font) GetFaceName() string {
+	name, _ := emf.DecodeCharset(f.CharSet, f.FaceName)
+	return string(utf16.Decode(name))
+}
+
+func (f *Font) logFont() w32.LOGFONT {
+	lf := w32.LOGFONT{
+		Height:         int32(f.Height),
+		Width:          int32(f.Width),
+		Escapement:     int32(f.Escapement),
+		Orientation:    int32(f.Orientation),
+		Weight:         int32(f.Weight),
+		Italic:         f.Italic,
+		Underline:      f.Underline,
+		StrikeOut:      f.StrikeOut,
+		CharSet:        f.CharSet,
+		OutPrecision:   f.OutPrecision,
+		ClipPrecision:  f.ClipPrecision,
+		Quality:        f.Quality,
+		PitchAndFamily: f.PitchAndFamily,
+	}
+	lf.SetFaceName(f.GetFaceName())
+	return lf
+}
+
+// Palette is the Palette object of META_CREATEPALETTE and
+// META_SETPALENTRIES.
+type Palette struct {
+	Start   uint16
+	Entries []w32.COLORREF
+}
+
+func readPalette(reader *bytes.Reader) (Palette, error) {
+	var p Palette
+
+	var n uint16
+	if err := readValues(reader, &p.Start, &n); err != nil {
+		return p, err
+	}
+
+	if err := checkCount(reader, int(n), 4); err != nil {
+		return p, err
+	}
+
+	p.Entries = make([]w32.COLORREF, n)
+	err := readValues(reader, p.Entries)
+	return p, err
+}
+
+// Region is the Region object of META_CREATEREGION, as the rectangles of
+// its scans in logical units.
+type Region struct {
+	Bounds Rect16
+	Rects  []w32.RECT
+}
+
+func readRegion(reader *bytes.Reader) (Region, error) {
+	var r Region
+
+	var nextInChain, objectType int16
+	var objectCount int32
+	var regionSize, scanCount, maxScan int16
+	if err := readValues(reader, &nextInChain, &objectType, &objectCount,
+		&regionSize, &scanCount, &maxScan, &r.Bounds); err != nil {
+		return r, err
+	}
+
+	for i := 0; i < int(scanCount); i++ {
+		var count, top, bottom uint16
+		if err := readValues(reader, &count, &top, &bottom); err != nil {
+			return r, err
+		}
+
+		if err := checkCount(reader, int(count/2), 4); err != nil {
+			return r, err
+		}
+
+		for j := 0; j < int(count/2); j++ {
+			var left, right uint16
+			if err := readValues(reader, &left, &right); err != nil {
+				return r, err
+			}
+			r.Rects = append(r.Rects, w32.RECT{
+				Left: int32(int16(left)), Top: int32(int16(top)),
+				Right: int32(int16(right)), Bottom: int32(int16(bottom)),
+			})
+		}
+
+		// Count2 repeats Count
+		var count2 uint16
+		if err := readValues(reader, &count2); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// readDIB reads the device independent bitmap at the end of a record. The
+// colors follow the convention of the EMF records, BI_BITFIELDS masks are
+// the first three entries.
+func readDIB(reader *bytes.Reader, usage uint16) (*emf.Bitmap, error) {
+	var size uint32
+	if err := readValues(reader, &size); err != nil {
+		return nil, err
+	}
+
+	bmp := &emf.Bitmap{}
+	h := &bmp.Info.BITMAPINFOHEADER
+
+	if size == 12 {
+		// BITMAPCOREHEADER with RGBTRIPLE colors
+		var width, height, planes, bitCount uint16
+		if err := readValues(reader, &width, &height, &planes, &bitCount); err != nil {
+			return nil, err
+		}
+		*h = w32.BITMAPINFOHEADER{
+			BiSize: 40, BiWidth: int32(width), BiHeight: int32(height),
+			BiPlanes: planes, BiBitCount: bitCount, BiCompression: emf.BI_RGB,
+		}
+
+		if bitCount <= 8 {
+			n := 1 << bitCount
+			if err := checkCount(reader, n, 3); err != nil {
+				return nil, err
+			}
+			for i := 0; i < n; i++ {
+				var t [3]byte
+				reader.Read(t[:])
+				bmp.Colors = append(bmp.Colors, w32.RGBQUAD{RgbBlue: t[0], RgbGreen: t[1], RgbRed: t[2]})
+			}
+		}
+	} else {
+		if size < 40 {
+			return nil, errors.New("invalid bitmap header")
+		}
+
+		h.BiSize = size
+		if err := readValues(reader, &h.BiWidth, &h.BiHeight, &h.BiPlanes, &h.BiBitCount, &h.BiCompression,
+			&h.BiSizeImage, &h.BiXPelsPerMeter, &h.BiYPelsPerMeter, &h.BiClrUsed, &h.BiClrImportant); err != nil {
+			return nil, err
+		}
+
+		extra := make([]byte, size-40)
+		if _, err := reader.Read(extra); len(extra) > 0 && err != nil {
+			return nil, err
+		}
+
+		n := int(h.BiClrUsed)
+		if n == 0 && h.BiBitCount <= 8 {
+			n = 1 << h.BiBitCount
+		}
+
+		if h.BiCompression == emf.BI_BITFIELDS {
+			// the masks are part of larger headers
+			masks := extra
+			if len(masks) < 12 {
+				masks = make([]byte, 12)
+				if _, err := reader.Read(masks); err != nil {
+					return nil, err
+				}
+			}
+			for i := 0; i < 3; i++ {
+				bmp.Colors = append(bmp.Colors, w32.RGBQUAD{
+					RgbBlue: masks[4*i], RgbGreen: masks[4*i+1], RgbRed: masks[4*i+2], RgbReserved: masks[4*i+3],
+				})
+			}
+		}
+
+		if h.BiBitCount <= 8 {
+			entry := 4
+			if usage == emf.DIB_PAL_COLORS {
+				entry = 2
+			}
+			if err := checkCount(reader, n, entry); err != nil {
+				return nil, err
+			}
+
+			table := make([]byte, (n*entry+3)&^3)
+			reader.Read(table[:n*entry])
+			colors := make([]w32.RGBQUAD, len(table)/4)
+			binary.Read(bytes.NewReader(table), binary.LittleEndian, colors)
+			bmp.Colors = append(bmp.Colors, colors...)
+		}
+
+		h.BiSize = 40
+	}
+
+	bmp.Bits = make([]byte, reader.Len())
+	reader.Read(bmp.Bits)
+
+	return bmp, nil
+}
+
+// averageColor returns the mean color of an image, the color of a pattern
+// brush drawn as a solid brush.
+func averageColor(img image.Image) emf.WMFCOLORREF {
+	b := img.Bounds()
+	if b.Empty() {
+		return emf.WMFCOLORREF{}
+	}
+
+	var r, g, bl uint64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			r += uint64(c.R)
+			g += uint64(c.G)
+			bl += uint64(c.B)
+		}
+	}
+
+	n := uint64(b.Dx() * b.Dy())
+	return emf.WMFCOLORREF{Red: byte(r / n), Green: byte(g / n), Blue: byte(bl / n)}
+}